@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// isCompanionName reports whether base, a file name without its extension,
+// names the T.mdl texture file or a NN.mdl sequence group file of the model
+// main, which loads them itself.
+func isCompanionName(base, main string) bool {
+	if !strings.HasPrefix(base, main) {
+		return false
+	}
+	suffix := base[len(main):]
+	if suffix == "t" {
+		return true
+	}
+	return len(suffix) == 2 && suffix[0] >= '0' && suffix[0] <= '9' && suffix[1] >= '0' && suffix[1] <= '9'
+}
+
+// isCompanionFile reports whether the file at path holds what its companion
+// name promises: a sequence group for NN.mdl, a header with textures only
+// for T.mdl. Files that can not be read are left to the decompiler.
+func isCompanionFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	var hdr studio.StudioHdr
+	if err = binary.Read(file, binary.LittleEndian, &hdr.Ident); err != nil {
+		return false
+	}
+	base := strings.ToLower(strings.TrimSuffix(path, filepath.Ext(path)))
+	if !strings.HasSuffix(base, "t") {
+		return hdr.Ident == studio.SeqIdent
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+	if err = binary.Read(file, binary.LittleEndian, &hdr); err != nil {
+		return false
+	}
+	return hdr.Ident == studio.MdlIdent && hdr.TexturesNum > 0 &&
+		hdr.BonesNum == 0 && hdr.SequencesNum == 0 && hdr.BodyPartsNum == 0
+}
+
+// findModels returns the main models found under root in lexical order. A
+// file is taken for a companion only when its main model sits next to it and
+// its header is the one of a companion.
+func findModels(root string) ([]string, error) {
+	var paths []string
+	var names = make(map[string]bool)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.EqualFold(filepath.Ext(path), ".mdl") {
+			paths = append(paths, path)
+			names[strings.ToLower(path)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var models []string
+	for _, path := range paths {
+		base := strings.ToLower(strings.TrimSuffix(path, filepath.Ext(path)))
+		companion := false
+		for _, n := range []int{1, 2} {
+			if len(base) > n && names[base[:len(base)-n]+".mdl"] && isCompanionName(base, base[:len(base)-n]) {
+				companion = isCompanionFile(path)
+			}
+		}
+		if !companion {
+			models = append(models, path)
+		}
+	}
+	return models, nil
+}
+
+// runBatch decompiles every model found in a directory tree into a tree of
+// the same layout, each model into a directory named after it.
+func runBatch(args []string, stdout io.Writer) int {
+	var (
+		opts      = decompileOptions{}
+		fs        = newFlagSet("batch", "[options] source_directory [target_directory]")
+		artifacts = setDecompileFlags(fs, &opts)
+		quiet     = fs.Bool("q", false, "print errors and the summary only")
+		workers   = fs.Int("j", runtime.NumCPU(), "number of models decompiled at the same time")
+		destRoot  string
+	)
+	fs.StringVar(&destRoot, "o", "", "target directory, by default decomp_<source_directory> next to the source")
+
+	files, ok := parseArgs(fs, args, 1, 2)
+	if !ok || !checkDecompileFlags(&opts, *artifacts) {
+		return exitUsage
+	}
+	if *workers < 1 {
+		printError(errors.New(fmt.Sprintf("invalid number of workers %d", *workers)))
+		return exitUsage
+	}
+	// the SMD workers are shared by the models decompiled at the same time
+	opts.smdWorkers /= *workers
+	if opts.smdWorkers < 1 {
+		opts.smdWorkers = 1
+	}
+
+	sourceRoot := files[0]
+	if len(files) > 1 {
+		if len(destRoot) > 0 {
+			printError(errors.New("the target directory is given twice"))
+			return exitUsage
+		}
+		destRoot = files[1]
+	} else if len(destRoot) == 0 {
+		destRoot = defaultDestPath(filepath.Clean(sourceRoot))
+	}
+
+	out := output(stdout, *quiet)
+
+	printBanner(out)
+	models, err := findModels(sourceRoot)
+	if err != nil {
+		printError(err)
+		return printFooter(out)
+	}
+
+	var (
+		results = make([]decompileResult, len(models))
+		jobs    = make(chan int)
+		wg      = &sync.WaitGroup{}
+		outMu   = &sync.Mutex{}
+	)
+	for w := 0; w < *workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				path := models[i]
+				rel, err := filepath.Rel(sourceRoot, path)
+				if err != nil {
+					results[i].errors = append(results[i].errors, err)
+					outMu.Lock()
+					results[i].printErrors()
+					outMu.Unlock()
+					continue
+				}
+
+				modelOpts := opts
+				modelOpts.sourcePath = path
+				modelOpts.destPath = filepath.Join(destRoot, filepath.Dir(rel), modelName(path))
+				if err := os.MkdirAll(filepath.Dir(modelOpts.destPath), 0744); err != nil {
+					results[i].errors = append(results[i].errors, err)
+					outMu.Lock()
+					results[i].printErrors()
+					outMu.Unlock()
+					continue
+				}
+
+				// the lines of a model are printed together once it is done
+				var lines bytes.Buffer
+				fmt.Fprintf(&lines, "Model %d/%d: %s\n", i+1, len(models), rel)
+				results[i] = decompile(&modelOpts, &lines)
+				outMu.Lock()
+				out.Write(lines.Bytes())
+				results[i].printErrors()
+				outMu.Unlock()
+			}
+		}()
+	}
+	for i := range models {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// the summary is kept in quiet mode
+	var succeeded, warned, failed []string
+	for i, path := range models {
+		switch {
+		case len(results[i].errors) > 0:
+			failed = append(failed, path)
+		case results[i].repairs > 0 || results[i].warnings > 0:
+			warned = append(warned, fmt.Sprintf("%s (%d repairs, %d warnings)",
+				path, results[i].repairs, results[i].warnings))
+		default:
+			succeeded = append(succeeded, path)
+		}
+	}
+	fmt.Fprintf(stdout, "Models: %d, succeeded: %d, with warnings: %d, failed: %d.\n",
+		len(models), len(succeeded), len(warned), len(failed))
+	for _, path := range warned {
+		studio.Warnf(stdout, "%s", path)
+	}
+	for _, path := range failed {
+		fmt.Fprintf(stdout, "[FAILED] %s.\n", path)
+	}
+	return printFooter(out)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// TestFindModels checks that only the files with the header of a companion
+// are left to their main model.
+func TestFindModels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	box, err := ioutil.ReadFile(filepath.Join("testdata", "box.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := ioutil.ReadFile(filepath.Join("testdata", "boxgroup01.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a texture file: the header of the model with its textures only
+	textures := append([]byte{}, box...)
+	hdr := studio.StudioHdr{Ident: studio.MdlIdent, Version: studio.StudioVersion, TexturesNum: 1}
+	var header bytes.Buffer
+	if err = binary.Write(&header, binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	copy(textures, header.Bytes())
+
+	files := map[string][]byte{
+		"a.mdl":         box,
+		"aT.mdl":        textures,
+		"a01.mdl":       group,
+		"b.mdl":         box,
+		"bt.mdl":        box, // a model named like a texture file
+		"b02.mdl":       box, // a model named like a group file
+		"sub/c.mdl":     box,
+		"sub/c01.mdl":   group,
+		"sub/d01.mdl":   group, // no main model next to it
+		"sub/notes.txt": []byte("text"),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0744); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	models, err := findModels(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, name := range []string{"a.mdl", "b.mdl", "b02.mdl", "bt.mdl", "sub/c.mdl", "sub/d01.mdl"} {
+		want = append(want, filepath.Join(dir, filepath.FromSlash(name)))
+	}
+	if !reflect.DeepEqual(models, want) {
+		t.Errorf("models %q, want %q", models, want)
+	}
+}
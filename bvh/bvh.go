@@ -0,0 +1,159 @@
+package bvh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// The studio Z-up space is converted to the Y-up space most motion capture
+// tools expect: positions become (x, z, -y), and the yaw, pitch and roll
+// rotations about Z, Y and X become rotations about Y, -Z and X, applied in
+// the same order.
+const channels = "CHANNELS 6 Xposition Yposition Zposition Yrotation Zrotation Xrotation"
+
+type encoder struct {
+	buf      bytes.Buffer
+	bones    []*studio.StudioBone
+	children [][]int
+	order    []int // bones in the order of the hierarchy
+}
+
+func jointName(bone *studio.StudioBone, i int) string {
+	name := strings.Join(strings.Fields(bone.Name.String()), "_")
+	if len(name) == 0 {
+		name = fmt.Sprintf("bone%d", i)
+	}
+	return name
+}
+
+func (e *encoder) writeJoint(i, depth int) {
+	var (
+		indent = strings.Repeat("\t", depth)
+		bone   = e.bones[i]
+	)
+	if depth == 0 {
+		e.buf.WriteString(fmt.Sprintf("ROOT %s\n", jointName(bone, i)))
+	} else {
+		e.buf.WriteString(fmt.Sprintf("%sJOINT %s\n", indent, jointName(bone, i)))
+	}
+	e.buf.WriteString(indent + "{\n")
+	e.buf.WriteString(fmt.Sprintf("%s\tOFFSET %f %f %f\n", indent, bone.Value[0], bone.Value[2], -bone.Value[1]))
+	e.buf.WriteString(fmt.Sprintf("%s\t%s\n", indent, channels))
+	e.order = append(e.order, i)
+
+	for _, child := range e.children[i] {
+		e.writeJoint(child, depth+1)
+	}
+	if len(e.children[i]) == 0 {
+		e.buf.WriteString(indent + "\tEnd Site\n")
+		e.buf.WriteString(indent + "\t{\n")
+		e.buf.WriteString(indent + "\t\tOFFSET 0.000000 0.000000 0.000000\n")
+		e.buf.WriteString(indent + "\t}\n")
+	}
+	e.buf.WriteString(indent + "}\n")
+}
+
+func (e *encoder) writeFrame(pose [][6]float64) {
+	for n, i := range e.order {
+		motion := pose[i]
+		for j := 3; j < 6; j++ {
+			studio.ClipRotations(&motion[j])
+			motion[j] *= 180.0 / math.Pi
+		}
+		if n > 0 {
+			e.buf.WriteString(" ")
+		}
+		e.buf.WriteString(fmt.Sprintf("%f %f %f %f %f %f",
+			motion[0], motion[2], -motion[1], motion[5], -motion[4], motion[3]))
+	}
+	e.buf.WriteString("\n")
+}
+
+// Encode returns a blend of a sequence as a BVH file, or nil if the model
+// has no bones or the sequence no frames. The linear movement of the
+// sequence is baked into the root bones on request.
+func Encode(mdl *studio.Mdl, seq *studio.Sequence, blend int, bakeMovement bool) []byte {
+	bonesNum := len(mdl.Bones)
+	if seq.FramesNum == 0 || bonesNum == 0 || blend >= int(seq.BlendsNum) || len(seq.Anims) < (blend+1)*bonesNum {
+		return nil
+	}
+
+	e := &encoder{bones: mdl.Bones, children: make([][]int, bonesNum)}
+	var roots []int
+	for i, bone := range mdl.Bones {
+		// parents must come first, anything else is taken for a root
+		if parent := int(bone.Parent); parent >= 0 && parent < i {
+			e.children[parent] = append(e.children[parent], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	e.buf.WriteString("HIERARCHY\n")
+	for _, root := range roots {
+		e.writeJoint(root, 0)
+	}
+
+	fps := seq.FPS
+	if fps <= 0 {
+		fps = 30
+	}
+	e.buf.WriteString("MOTION\n")
+	e.buf.WriteString(fmt.Sprintf("Frames: %d\n", seq.FramesNum))
+	e.buf.WriteString(fmt.Sprintf("Frame Time: %f\n", 1/fps))
+
+	for frame := 0; frame < int(seq.FramesNum); frame++ {
+		if bakeMovement {
+			e.writeFrame(studio.CalcSequencePose(seq, mdl.Bones, blend, frame))
+			continue
+		}
+		pose := make([][6]float64, bonesNum)
+		for i, bone := range mdl.Bones {
+			pose[i] = studio.CalcBonePosition(seq.Anims[blend*bonesNum+i], bone, frame)
+		}
+		e.writeFrame(pose)
+	}
+	return e.buf.Bytes()
+}
+
+// Save writes one BVH file per sequence blend into destPath.
+func Save(destPath string, mdl *studio.Mdl, bakeMovement bool) error {
+	return SaveLog(destPath, mdl, bakeMovement, os.Stdout)
+}
+
+// SaveLog is Save printing the written files to log instead of the standard
+// output.
+func SaveLog(destPath string, mdl *studio.Mdl, bakeMovement bool, log io.Writer) error {
+	var firstErr error
+	for _, seq := range mdl.Sequences {
+		for i := 0; i < int(seq.BlendsNum); i++ {
+			data := Encode(mdl, seq, i, bakeMovement)
+			if data == nil {
+				continue
+			}
+
+			bvhName := strings.TrimSuffix(seq.Label.String(), ".smd")
+			if seq.BlendsNum > 1 {
+				bvhName = fmt.Sprintf("%s_blend%d", bvhName, i+1)
+			}
+			bvhName += ".bvh"
+
+			if err := ioutil.WriteFile(filepath.Join(destPath, bvhName), data, 0644); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			fmt.Fprintf(log, "BVH: %s\n", bvhName)
+		}
+	}
+	return firstErr
+}
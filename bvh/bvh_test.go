@@ -0,0 +1,151 @@
+package bvh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// motion is what a BVH file declares.
+type motion struct {
+	joints    []string
+	frames    [][]float64
+	frameTime float64
+}
+
+// readBVH reads a BVH file, checking that its hierarchy is balanced and
+// that every frame has the channels of every joint.
+func readBVH(t *testing.T, data []byte) *motion {
+	var (
+		m         = new(motion)
+		depth     int
+		channels  int
+		framesNum = -1
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() || scanner.Text() != "HIERARCHY" {
+		t.Fatalf("first line %q", scanner.Text())
+	}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		switch {
+		case line == "{":
+			depth++
+		case line == "}":
+			depth--
+		case fields[0] == "ROOT" || fields[0] == "JOINT":
+			if (fields[0] == "ROOT") != (depth == 0) {
+				t.Errorf("%s at depth %d", line, depth)
+			}
+			m.joints = append(m.joints, fields[1])
+		case fields[0] == "CHANNELS":
+			channels += 6
+		case line == "MOTION":
+			if depth != 0 {
+				t.Fatalf("hierarchy ends at depth %d", depth)
+			}
+		case fields[0] == "Frames:":
+			framesNum, _ = strconv.Atoi(fields[1])
+		case strings.HasPrefix(line, "Frame Time:"):
+			m.frameTime, _ = strconv.ParseFloat(fields[2], 64)
+		case framesNum >= 0 && fields[0] != "OFFSET" && line != "End Site":
+			if len(fields) != channels {
+				t.Fatalf("frame %d has %d values for %d channels", len(m.frames), len(fields), channels)
+			}
+			var values []float64
+			for _, s := range fields {
+				v, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+				values = append(values, v)
+			}
+			m.frames = append(m.frames, values)
+		}
+	}
+	if framesNum != len(m.frames) {
+		t.Fatalf("%d frames, %d declared", len(m.frames), framesNum)
+	}
+	return m
+}
+
+func TestEncode(t *testing.T) {
+	mdl, err := studio.Load(filepath.Join("..", "testdata", "box.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range mdl.Sequences {
+		m := readBVH(t, Encode(mdl, seq, 0, false))
+		if len(m.joints) != len(mdl.Bones) || len(m.frames) != int(seq.FramesNum) {
+			t.Errorf("%s: %d joints and %d frames, want %d and %d", seq.Label,
+				len(m.joints), len(m.frames), len(mdl.Bones), seq.FramesNum)
+			continue
+		}
+		if math.Abs(m.frameTime-1/float64(seq.FPS)) > 1e-6 {
+			t.Errorf("%s: frame time %f at %f fps", seq.Label, m.frameTime, seq.FPS)
+		}
+
+		// the linear movement ends up in the root position
+		baked := readBVH(t, Encode(mdl, seq, 0, true))
+		last := len(m.frames) - 1
+		moved := []float64{float64(seq.LinerMovement.X), float64(seq.LinerMovement.Z), -float64(seq.LinerMovement.Y)}
+		for j, d := range moved {
+			if math.Abs(baked.frames[last][j]-m.frames[last][j]-d) > 1e-3 {
+				t.Errorf("%s: baked root position %v, want %v moved by %v", seq.Label,
+					baked.frames[last][:3], m.frames[last][:3], moved)
+				break
+			}
+		}
+	}
+
+	if Encode(mdl, mdl.Sequences[0], 1, false) != nil {
+		t.Error("a missing blend is encoded")
+	}
+}
+
+func TestSave(t *testing.T) {
+	mdl, err := studio.Load(filepath.Join("..", "testdata", "box.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "bvh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := new(bytes.Buffer)
+	if err = SaveLog(dir, mdl, false, log); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, seq := range mdl.Sequences {
+		want = append(want, seq.Label.String()+".bvh")
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(want)
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("files %q, want %q", names, want)
+	}
+	if n := strings.Count(log.String(), "BVH: "); n != len(want) {
+		t.Errorf("log %q lists %d files", log.String(), n)
+	}
+}
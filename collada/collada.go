@@ -0,0 +1,284 @@
+package collada
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+const (
+	colladaNamespace = "http://www.collada.org/2005/11/COLLADASchema"
+	colladaVersion   = "1.4.1"
+)
+
+type document struct {
+	XMLName      xml.Name       `xml:"COLLADA"`
+	Namespace    string         `xml:"xmlns,attr"`
+	Version      string         `xml:"version,attr"`
+	Asset        asset          `xml:"asset"`
+	Images       []*image       `xml:"library_images>image"`
+	Effects      []*effect      `xml:"library_effects>effect"`
+	Materials    []*material    `xml:"library_materials>material"`
+	Geometries   []*geometry    `xml:"library_geometries>geometry"`
+	Controllers  []*controller  `xml:"library_controllers>controller"`
+	Animations   []*animation   `xml:"library_animations>animation"`
+	Clips        []*clip        `xml:"library_animation_clips>animation_clip"`
+	VisualScenes []*visualScene `xml:"library_visual_scenes>visual_scene"`
+	Scene        instanceURL    `xml:"scene>instance_visual_scene"`
+}
+
+type asset struct {
+	AuthoringTool string `xml:"contributor>authoring_tool"`
+	Created       string `xml:"created"`
+	Modified      string `xml:"modified"`
+	UpAxis        string `xml:"up_axis"`
+}
+
+type instanceURL struct {
+	URL string `xml:"url,attr"`
+}
+
+type image struct {
+	ID       string `xml:"id,attr"`
+	Name     string `xml:"name,attr,omitempty"`
+	InitFrom string `xml:"init_from"`
+}
+
+type effect struct {
+	ID        string     `xml:"id,attr"`
+	NewParams []newParam `xml:"profile_COMMON>newparam"`
+	Technique technique  `xml:"profile_COMMON>technique"`
+}
+
+type newParam struct {
+	SID     string     `xml:"sid,attr"`
+	Surface *surface   `xml:"surface,omitempty"`
+	Sampler *sampler2D `xml:"sampler2D,omitempty"`
+}
+
+type surface struct {
+	Type     string `xml:"type,attr"`
+	InitFrom string `xml:"init_from"`
+}
+
+type sampler2D struct {
+	Source string `xml:"source"`
+}
+
+type technique struct {
+	SID     string     `xml:"sid,attr"`
+	Diffuse textureRef `xml:"lambert>diffuse>texture"`
+}
+
+type textureRef struct {
+	Texture  string `xml:"texture,attr"`
+	TexCoord string `xml:"texcoord,attr"`
+}
+
+type material struct {
+	ID             string      `xml:"id,attr"`
+	Name           string      `xml:"name,attr,omitempty"`
+	InstanceEffect instanceURL `xml:"instance_effect"`
+}
+
+type source struct {
+	ID       string      `xml:"id,attr"`
+	Floats   *valueArray `xml:"float_array,omitempty"`
+	Names    *valueArray `xml:"Name_array,omitempty"`
+	Accessor accessor    `xml:"technique_common>accessor"`
+}
+
+type valueArray struct {
+	ID    string `xml:"id,attr"`
+	Count int    `xml:"count,attr"`
+	Data  string `xml:",chardata"`
+}
+
+type accessor struct {
+	Source string  `xml:"source,attr"`
+	Count  int     `xml:"count,attr"`
+	Stride int     `xml:"stride,attr"`
+	Params []param `xml:"param"`
+}
+
+type param struct {
+	Name string `xml:"name,attr,omitempty"`
+	Type string `xml:"type,attr"`
+}
+
+type input struct {
+	Semantic string `xml:"semantic,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+type sharedInput struct {
+	Semantic string `xml:"semantic,attr"`
+	Source   string `xml:"source,attr"`
+	Offset   int    `xml:"offset,attr"`
+	Set      string `xml:"set,attr,omitempty"`
+}
+
+type geometry struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name,attr,omitempty"`
+	Mesh mesh   `xml:"mesh"`
+}
+
+type mesh struct {
+	Sources   []*source    `xml:"source"`
+	Vertices  vertices     `xml:"vertices"`
+	Triangles []*triangles `xml:"triangles"`
+}
+
+type vertices struct {
+	ID     string  `xml:"id,attr"`
+	Inputs []input `xml:"input"`
+}
+
+type triangles struct {
+	Material string        `xml:"material,attr"`
+	Count    int           `xml:"count,attr"`
+	Inputs   []sharedInput `xml:"input"`
+	P        string        `xml:"p"`
+}
+
+type controller struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name,attr,omitempty"`
+	Skin skin   `xml:"skin"`
+}
+
+type skin struct {
+	Source          string        `xml:"source,attr"`
+	BindShapeMatrix string        `xml:"bind_shape_matrix"`
+	Sources         []*source     `xml:"source"`
+	Joints          []input       `xml:"joints>input"`
+	VertexWeights   vertexWeights `xml:"vertex_weights"`
+}
+
+type vertexWeights struct {
+	Count  int           `xml:"count,attr"`
+	Inputs []sharedInput `xml:"input"`
+	VCount string        `xml:"vcount"`
+	V      string        `xml:"v"`
+}
+
+type animation struct {
+	ID         string       `xml:"id,attr"`
+	Name       string       `xml:"name,attr,omitempty"`
+	Sources    []*source    `xml:"source"`
+	Sampler    *sampler     `xml:"sampler,omitempty"`
+	Channel    *channel     `xml:"channel,omitempty"`
+	Animations []*animation `xml:"animation"`
+}
+
+type sampler struct {
+	ID     string  `xml:"id,attr"`
+	Inputs []input `xml:"input"`
+}
+
+type channel struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type clip struct {
+	ID        string        `xml:"id,attr"`
+	Name      string        `xml:"name,attr,omitempty"`
+	Start     float32       `xml:"start,attr"`
+	End       float32       `xml:"end,attr"`
+	Instances []instanceURL `xml:"instance_animation"`
+}
+
+type visualScene struct {
+	ID    string  `xml:"id,attr"`
+	Name  string  `xml:"name,attr,omitempty"`
+	Nodes []*node `xml:"node"`
+}
+
+type node struct {
+	ID                 string              `xml:"id,attr"`
+	Name               string              `xml:"name,attr,omitempty"`
+	SID                string              `xml:"sid,attr,omitempty"`
+	Type               string              `xml:"type,attr,omitempty"`
+	Matrix             *matrix             `xml:"matrix,omitempty"`
+	InstanceController *instanceController `xml:"instance_controller,omitempty"`
+	InstanceGeometry   *instanceGeometry   `xml:"instance_geometry,omitempty"`
+	Nodes              []*node             `xml:"node"`
+}
+
+type matrix struct {
+	SID  string `xml:"sid,attr"`
+	Data string `xml:",chardata"`
+}
+
+type instanceController struct {
+	URL          string        `xml:"url,attr"`
+	Skeletons    []string      `xml:"skeleton"`
+	BindMaterial *bindMaterial `xml:"bind_material,omitempty"`
+}
+
+type instanceGeometry struct {
+	URL          string        `xml:"url,attr"`
+	BindMaterial *bindMaterial `xml:"bind_material,omitempty"`
+}
+
+type bindMaterial struct {
+	Materials []*instanceMaterial `xml:"technique_common>instance_material"`
+}
+
+type instanceMaterial struct {
+	Symbol          string          `xml:"symbol,attr"`
+	Target          string          `xml:"target,attr"`
+	BindVertexInput bindVertexInput `xml:"bind_vertex_input"`
+}
+
+type bindVertexInput struct {
+	Semantic      string `xml:"semantic,attr"`
+	InputSemantic string `xml:"input_semantic,attr"`
+	InputSet      int    `xml:"input_set,attr"`
+}
+
+func floats(values []float32) string {
+	var s = make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+	return strings.Join(s, " ")
+}
+
+func ints(values []int) string {
+	var s = make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, " ")
+}
+
+// floatSource stores values as a source read stride values at a time, named
+// by params.
+func floatSource(id string, values []float32, stride int, params ...param) *source {
+	return &source{
+		ID:     id,
+		Floats: &valueArray{ID: id + "-array", Count: len(values), Data: floats(values)},
+		Accessor: accessor{
+			Source: "#" + id + "-array",
+			Count:  len(values) / stride,
+			Stride: stride,
+			Params: params,
+		},
+	}
+}
+
+func nameSource(id string, names []string, paramName string) *source {
+	return &source{
+		ID:    id,
+		Names: &valueArray{ID: id + "-array", Count: len(names), Data: strings.Join(names, " ")},
+		Accessor: accessor{
+			Source: "#" + id + "-array",
+			Count:  len(names),
+			Stride: 1,
+			Params: []param{{Name: paramName, Type: "name"}},
+		},
+	}
+}
@@ -0,0 +1,149 @@
+package collada
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// checkReferences checks that every "#id" reference of the document, and the
+// node of every channel target, is an element id, and that the arrays hold
+// as many values as they declare.
+func checkReferences(t *testing.T, data []byte) {
+	var (
+		ids  = make(map[string]bool)
+		refs []string
+	)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var array *xml.StartElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tok := token.(type) {
+		case xml.StartElement:
+			for _, attr := range tok.Attr {
+				switch {
+				case attr.Name.Local == "id":
+					if ids[attr.Value] {
+						t.Errorf("id %s is used twice", attr.Value)
+					}
+					ids[attr.Value] = true
+				case strings.HasPrefix(attr.Value, "#"):
+					refs = append(refs, attr.Value[1:])
+				case tok.Name.Local == "channel" && attr.Name.Local == "target":
+					refs = append(refs, strings.Split(attr.Value, "/")[0])
+				}
+			}
+			if tok.Name.Local == "float_array" || tok.Name.Local == "Name_array" {
+				start := tok.Copy()
+				array = &start
+			}
+		case xml.CharData:
+			if array == nil {
+				continue
+			}
+			for _, attr := range array.Attr {
+				if attr.Name.Local != "count" {
+					continue
+				}
+				if count, _ := strconv.Atoi(attr.Value); count != len(strings.Fields(string(tok))) {
+					t.Errorf("%s declares %d values and holds %d", array.Name.Local, count, len(strings.Fields(string(tok))))
+				}
+			}
+			array = nil
+		}
+	}
+	for _, ref := range refs {
+		if !ids[ref] {
+			t.Errorf("reference to the missing id %s", ref)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	mdl, err := studio.Load(filepath.Join("..", "testdata", "box.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Encode(mdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(xml.Header)) {
+		t.Error("no XML header")
+	}
+	checkReferences(t, data)
+
+	doc := new(document)
+	if err = xml.Unmarshal(data, doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != colladaVersion || len(doc.Images) != len(mdl.Textures) || len(doc.Materials) != len(mdl.Textures) {
+		t.Errorf("version %s with %d images and %d materials, want %s and %d", doc.Version,
+			len(doc.Images), len(doc.Materials), colladaVersion, len(mdl.Textures))
+	}
+	if len(doc.Geometries) != 1 || len(doc.Controllers) != 1 {
+		t.Fatalf("%d geometries and %d controllers, want 1", len(doc.Geometries), len(doc.Controllers))
+	}
+
+	for _, tris := range doc.Geometries[0].Mesh.Triangles {
+		offsets := 0
+		for _, in := range tris.Inputs {
+			if in.Offset+1 > offsets {
+				offsets = in.Offset + 1
+			}
+		}
+		if n := len(strings.Fields(tris.P)); n != tris.Count*3*offsets {
+			t.Errorf("triangles of %s: %d indices for %d triangles of %d inputs", tris.Material, n, tris.Count, offsets)
+		}
+	}
+
+	sk := doc.Controllers[0].Skin
+	var joints *source
+	for _, src := range sk.Sources {
+		if src.Names != nil {
+			joints = src
+		}
+	}
+	if joints == nil || joints.Names.Count != len(mdl.Bones) {
+		t.Fatalf("skin joints %+v, want %d", joints, len(mdl.Bones))
+	}
+	var influences int
+	for _, s := range strings.Fields(sk.VertexWeights.VCount) {
+		n, _ := strconv.Atoi(s)
+		influences += n
+	}
+	if n := len(strings.Fields(sk.VertexWeights.V)); n != influences*len(sk.VertexWeights.Inputs) {
+		t.Errorf("%d vertex weight values for %d influences", n, influences)
+	}
+	if len(strings.Fields(sk.VertexWeights.VCount)) != sk.VertexWeights.Count {
+		t.Errorf("vertex weights of %d vertices declare %d", len(strings.Fields(sk.VertexWeights.VCount)),
+			sk.VertexWeights.Count)
+	}
+
+	if len(doc.Clips) != len(mdl.Sequences) {
+		t.Fatalf("%d animation clips, want %d", len(doc.Clips), len(mdl.Sequences))
+	}
+	for i, c := range doc.Clips {
+		seq := mdl.Sequences[i]
+		length := float64(seq.FramesNum-1) / float64(seq.FPS)
+		if c.Name != seq.Label.String() || math.Abs(float64(c.End-c.Start)-length) > 1e-4 || len(c.Instances) != 1 {
+			t.Errorf("clip %d %+v, want sequence %s lasting %f", i, *c, seq.Label, length)
+		}
+		if i > 0 && c.Start < doc.Clips[i-1].End {
+			t.Errorf("clip %s starts before the end of %s", c.Name, doc.Clips[i-1].Name)
+		}
+	}
+}
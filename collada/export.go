@@ -0,0 +1,412 @@
+package collada
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+var identity = floats([]float32{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1})
+
+// Save writes the model to path as a Collada document. The textures are
+// expected in the textures directory next to it, as texture.Save writes them.
+func Save(path string, mdl *studio.Mdl) error {
+	return SaveLog(path, mdl, os.Stdout)
+}
+
+// SaveLog is Save printing the written file to log instead of the standard
+// output.
+func SaveLog(path string, mdl *studio.Mdl, log io.Writer) error {
+	data, err := Encode(mdl)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(log, "Collada: %s\n", filepath.Base(path))
+	return nil
+}
+
+// Encode returns the model as a Collada document.
+func Encode(mdl *studio.Mdl) ([]byte, error) {
+	data, err := xml.MarshalIndent(build(mdl), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// matrixValues returns a transform as the 16 values of a row-major 4x4
+// matrix.
+func matrixValues(m *studio.Matrix3x4) []float32 {
+	return []float32{
+		float32(m[0].X), float32(m[0].Y), float32(m[0].Z), float32(m[0].W),
+		float32(m[1].X), float32(m[1].Y), float32(m[1].Z), float32(m[1].W),
+		float32(m[2].X), float32(m[2].Y), float32(m[2].Z), float32(m[2].W),
+		0, 0, 0, 1,
+	}
+}
+
+func boneMatrix(motion [6]float64) *studio.Matrix3x4 {
+	quat := studio.AngleQuaternion(&studio.Vector3_32{X: float32(motion[3]), Y: float32(motion[4]), Z: float32(motion[5])})
+	return studio.Matrix3x4FromOriginQuat(quat,
+		&studio.Vector3_32{X: float32(motion[0]), Y: float32(motion[1]), Z: float32(motion[2])})
+}
+
+func boneID(i int) string {
+	return fmt.Sprintf("bone%d", i)
+}
+
+// build converts the model: a geometry per body part model, a material per
+// texture, a skin controller binding every geometry to the bones and an
+// animation clip per sequence blend, the clips following each other on the
+// timeline.
+func build(mdl *studio.Mdl) *document {
+	now := time.Now().UTC().Format(time.RFC3339)
+	doc := &document{
+		Namespace: colladaNamespace,
+		Version:   colladaVersion,
+		Asset: asset{
+			AuthoringTool: "mdldec " + studio.Version,
+			Created:       now,
+			Modified:      now,
+			UpAxis:        "Z_UP",
+		},
+		Scene: instanceURL{URL: "#scene"},
+	}
+	vs := &visualScene{ID: "scene", Name: mdl.Header.Name.String()}
+	doc.VisualScenes = []*visualScene{vs}
+
+	addMaterials(doc, mdl)
+	roots := addBones(vs, mdl)
+
+	transforms := studio.CalcBoneTransforms(mdl.Bones)
+	var skinTransforms []*studio.Matrix3x4
+	if mdl.Header.Flags&studio.StudioHasBoneWeights != 0 {
+		skinTransforms = studio.CalcSkinTransforms(transforms, mdl.BonesInfo)
+	}
+
+	var modelsNum int
+	for _, bp := range mdl.BodyParts {
+		for _, m := range bp.Models {
+			if m.Name.String() == "blank" {
+				continue
+			}
+			geom, materials := addGeometry(mdl, m, fmt.Sprintf("model%d", modelsNum), transforms, skinTransforms)
+			if geom == nil {
+				continue
+			}
+			doc.Geometries = append(doc.Geometries, geom)
+			modelsNum++
+
+			n := &node{ID: geom.ID + "-node", Name: geom.Name}
+			bind := &bindMaterial{Materials: materials}
+			if len(mdl.Bones) > 0 {
+				ctrl := addController(mdl, m, geom, transforms, skinTransforms)
+				doc.Controllers = append(doc.Controllers, ctrl)
+				n.InstanceController = &instanceController{URL: "#" + ctrl.ID, BindMaterial: bind}
+				for _, root := range roots {
+					n.InstanceController.Skeletons = append(n.InstanceController.Skeletons, "#"+boneID(root))
+				}
+			} else {
+				n.InstanceGeometry = &instanceGeometry{URL: "#" + geom.ID, BindMaterial: bind}
+			}
+			vs.Nodes = append(vs.Nodes, n)
+		}
+	}
+
+	var start float32
+	for _, seq := range mdl.Sequences {
+		for i := 0; i < int(seq.BlendsNum); i++ {
+			if c, anim := addAnimation(mdl, seq, i, len(doc.Clips), start); c != nil {
+				doc.Clips = append(doc.Clips, c)
+				doc.Animations = append(doc.Animations, anim)
+				start = c.End + 1/sequenceFPS(seq)
+			}
+		}
+	}
+	return doc
+}
+
+// addMaterials adds a material per texture, its image pointing to the BMP
+// file saved by the texture package.
+func addMaterials(doc *document, mdl *studio.Mdl) {
+	for i, tex := range mdl.Textures {
+		var (
+			name     = tex.Name.String()
+			imageID  = fmt.Sprintf("image%d", i)
+			effectID = fmt.Sprintf("effect%d", i)
+		)
+		doc.Images = append(doc.Images, &image{ID: imageID, Name: name, InitFrom: "textures/" + name})
+		doc.Effects = append(doc.Effects, &effect{
+			ID: effectID,
+			NewParams: []newParam{
+				{SID: imageID + "-surface", Surface: &surface{Type: "2D", InitFrom: imageID}},
+				{SID: imageID + "-sampler", Sampler: &sampler2D{Source: imageID + "-surface"}},
+			},
+			Technique: technique{SID: "common", Diffuse: textureRef{Texture: imageID + "-sampler", TexCoord: "UVMap"}},
+		})
+		doc.Materials = append(doc.Materials, &material{
+			ID:             fmt.Sprintf("material%d", i),
+			Name:           name,
+			InstanceEffect: instanceURL{URL: "#" + effectID},
+		})
+	}
+}
+
+// addBones adds the bone hierarchy to the scene as joint nodes in the
+// default pose and returns the root bones.
+func addBones(vs *visualScene, mdl *studio.Mdl) []int {
+	var (
+		nodes = make([]*node, len(mdl.Bones))
+		roots []int
+	)
+	for i, bone := range mdl.Bones {
+		var motion [6]float64
+		for j := range motion {
+			motion[j] = float64(bone.Value[j])
+		}
+		nodes[i] = &node{
+			ID:     boneID(i),
+			Name:   bone.Name.String(),
+			SID:    boneID(i),
+			Type:   "JOINT",
+			Matrix: &matrix{SID: "transform", Data: floats(matrixValues(boneMatrix(motion)))},
+		}
+
+		// parents must come first, anything else is taken for a root
+		if parent := int(bone.Parent); parent >= 0 && parent < i {
+			nodes[parent].Nodes = append(nodes[parent].Nodes, nodes[i])
+		} else {
+			vs.Nodes = append(vs.Nodes, nodes[i])
+			roots = append(roots, i)
+		}
+	}
+	return roots
+}
+
+// addGeometry converts the meshes of a body part model to triangles sharing
+// its vertices and normals, and returns the materials they are bound to.
+func addGeometry(mdl *studio.Mdl, m *studio.Model, id string, transforms, skinTransforms []*studio.Matrix3x4) (*geometry, []*instanceMaterial) {
+	var (
+		positions     = make([]float32, 0, len(m.Vertices)*3)
+		normals       = make([]float32, 0, len(m.Normals)*3)
+		texCoords     []float32
+		texCoordIndex = make(map[[2]float32]int)
+		materials     []*instanceMaterial
+		bound         = make(map[int]bool)
+	)
+	for i := range m.Vertices {
+		v := studio.Matrix3x4VectorTransform(
+			studio.VertexMatrix(m.VerticesInfo[i], m.VerticesWeights, i, transforms, skinTransforms), &m.Vertices[i])
+		positions = append(positions, v.X, v.Y, v.Z)
+	}
+	for i := range m.Normals {
+		n := studio.Matrix3x4VectorRotate(
+			studio.VertexMatrix(m.NormalsInfo[i], m.NormalsWeights, i, transforms, skinTransforms), &m.Normals[i])
+		n.Normalize()
+		normals = append(normals, n.X, n.Y, n.Z)
+	}
+
+	geom := &geometry{ID: id, Name: strings.TrimSuffix(m.Name.String(), ".smd")}
+	for _, me := range m.Meshes {
+		if int(me.SkinRef) >= len(mdl.Textures) {
+			continue
+		}
+		tex := mdl.Textures[me.SkinRef]
+		symbol := fmt.Sprintf("material%d", me.SkinRef)
+		tris := &triangles{
+			Material: symbol,
+			Inputs: []sharedInput{
+				{Semantic: "VERTEX", Source: "#" + id + "-vertices", Offset: 0},
+				{Semantic: "NORMAL", Source: "#" + id + "-normals", Offset: 1},
+				{Semantic: "TEXCOORD", Source: "#" + id + "-texcoords", Offset: 2, Set: "0"},
+			},
+		}
+
+		var p []int
+		for _, tri := range me.Triangles {
+			for _, face := range tri.Faces() {
+				for _, vert := range face {
+					u, v := tex.TexCoords(vert)
+					index, ok := texCoordIndex[[2]float32{u, v}]
+					if !ok {
+						index = len(texCoordIndex)
+						texCoordIndex[[2]float32{u, v}] = index
+						texCoords = append(texCoords, u, v)
+					}
+					p = append(p, int(vert.VertexIndex), int(vert.NormalIndex), index)
+				}
+				tris.Count++
+			}
+		}
+		if tris.Count == 0 {
+			continue
+		}
+		tris.P = ints(p)
+		geom.Mesh.Triangles = append(geom.Mesh.Triangles, tris)
+
+		if !bound[int(me.SkinRef)] {
+			bound[int(me.SkinRef)] = true
+			materials = append(materials, &instanceMaterial{
+				Symbol:          symbol,
+				Target:          "#" + symbol,
+				BindVertexInput: bindVertexInput{Semantic: "UVMap", InputSemantic: "TEXCOORD"},
+			})
+		}
+	}
+	if len(geom.Mesh.Triangles) == 0 {
+		return nil, nil
+	}
+
+	geom.Mesh.Sources = []*source{
+		floatSource(id+"-positions", positions, 3, param{"X", "float"}, param{"Y", "float"}, param{"Z", "float"}),
+		floatSource(id+"-normals", normals, 3, param{"X", "float"}, param{"Y", "float"}, param{"Z", "float"}),
+		floatSource(id+"-texcoords", texCoords, 2, param{"S", "float"}, param{"T", "float"}),
+	}
+	geom.Mesh.Vertices = vertices{
+		ID:     id + "-vertices",
+		Inputs: []input{{Semantic: "POSITION", Source: "#" + id + "-positions"}},
+	}
+	return geom, materials
+}
+
+// addController binds the vertices of a geometry to a single bone each, or
+// to up to MaxBoneWeights bones for weighted models. The inverses of the
+// bone transforms of the default pose are the inverse bind matrices.
+func addController(mdl *studio.Mdl, m *studio.Model, geom *geometry, transforms, skinTransforms []*studio.Matrix3x4) *controller {
+	var (
+		id        = geom.ID + "-skin"
+		joints    = make([]string, len(mdl.Bones))
+		bindPoses = make([]float32, 0, len(mdl.Bones)*16)
+		weights   = []float32{1}
+		vcount    = make([]int, len(m.Vertices))
+		v         []int
+	)
+	for i, transform := range transforms {
+		joints[i] = boneID(i)
+		bindPoses = append(bindPoses, matrixValues(studio.Matrix3x4Invert(transform))...)
+	}
+
+	for i := range m.Vertices {
+		if skinTransforms == nil || i >= len(m.VerticesWeights) {
+			bone := int(m.VerticesInfo[i])
+			if bone >= len(mdl.Bones) {
+				bone = 0
+			}
+			vcount[i] = 1
+			v = append(v, bone, 0)
+			continue
+		}
+
+		bones, blend, count := studio.NormalizedWeights(&m.VerticesWeights[i])
+		for j := 0; j < count; j++ {
+			vcount[i]++
+			v = append(v, int(bones[j]), len(weights))
+			weights = append(weights, blend[j])
+		}
+	}
+
+	return &controller{
+		ID:   id,
+		Name: geom.Name,
+		Skin: skin{
+			Source:          "#" + geom.ID,
+			BindShapeMatrix: identity,
+			Sources: []*source{
+				nameSource(id+"-joints", joints, "JOINT"),
+				floatSource(id+"-bind-poses", bindPoses, 16, param{"TRANSFORM", "float4x4"}),
+				floatSource(id+"-weights", weights, 1, param{"WEIGHT", "float"}),
+			},
+			Joints: []input{
+				{Semantic: "JOINT", Source: "#" + id + "-joints"},
+				{Semantic: "INV_BIND_MATRIX", Source: "#" + id + "-bind-poses"},
+			},
+			VertexWeights: vertexWeights{
+				Count: len(m.Vertices),
+				Inputs: []sharedInput{
+					{Semantic: "JOINT", Source: "#" + id + "-joints", Offset: 0},
+					{Semantic: "WEIGHT", Source: "#" + id + "-weights", Offset: 1},
+				},
+				VCount: ints(vcount),
+				V:      ints(v),
+			},
+		},
+	}
+}
+
+func sequenceFPS(seq *studio.Sequence) float32 {
+	if seq.FPS <= 0 {
+		return 30
+	}
+	return seq.FPS
+}
+
+// addAnimation samples every frame of a sequence blend as bone matrices,
+// starting at the given time.
+func addAnimation(mdl *studio.Mdl, seq *studio.Sequence, blend, index int, start float32) (*clip, *animation) {
+	bonesNum := len(mdl.Bones)
+	framesNum := int(seq.FramesNum)
+	if framesNum == 0 || bonesNum == 0 || len(seq.Anims) < (blend+1)*bonesNum {
+		return nil, nil
+	}
+
+	name := seq.Label.String()
+	if seq.BlendsNum > 1 {
+		name = fmt.Sprintf("%s_blend%d", name, blend+1)
+	}
+	id := fmt.Sprintf("clip%d", index)
+	anim := &animation{ID: id + "-animation", Name: name}
+
+	var (
+		fps           = sequenceFPS(seq)
+		times         = make([]float32, framesNum)
+		interpolation = make([]string, framesNum)
+		matrices      = make([][]float32, bonesNum)
+	)
+	for frame := 0; frame < framesNum; frame++ {
+		times[frame] = start + float32(frame)/fps
+		interpolation[frame] = "LINEAR"
+		for i, motion := range studio.CalcSequencePose(seq, mdl.Bones, blend, frame) {
+			matrices[i] = append(matrices[i], matrixValues(boneMatrix(motion))...)
+		}
+	}
+
+	for i := range mdl.Bones {
+		boneAnimID := fmt.Sprintf("%s-%s", id, boneID(i))
+		anim.Animations = append(anim.Animations, &animation{
+			ID: boneAnimID,
+			Sources: []*source{
+				floatSource(boneAnimID+"-input", times, 1, param{"TIME", "float"}),
+				floatSource(boneAnimID+"-output", matrices[i], 16, param{"TRANSFORM", "float4x4"}),
+				nameSource(boneAnimID+"-interpolation", interpolation, "INTERPOLATION"),
+			},
+			Sampler: &sampler{
+				ID: boneAnimID + "-sampler",
+				Inputs: []input{
+					{Semantic: "INPUT", Source: "#" + boneAnimID + "-input"},
+					{Semantic: "OUTPUT", Source: "#" + boneAnimID + "-output"},
+					{Semantic: "INTERPOLATION", Source: "#" + boneAnimID + "-interpolation"},
+				},
+			},
+			Channel: &channel{Source: "#" + boneAnimID + "-sampler", Target: boneID(i) + "/transform"},
+		})
+	}
+
+	c := &clip{
+		ID:        id,
+		Name:      name,
+		Start:     start,
+		End:       times[framesNum-1],
+		Instances: []instanceURL{{URL: "#" + anim.ID}},
+	}
+	return c, anim
+}
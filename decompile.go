@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/Psycrow101/mdldec-golang/bvh"
+	"github.com/Psycrow101/mdldec-golang/collada"
+	"github.com/Psycrow101/mdldec-golang/gltf"
+	"github.com/Psycrow101/mdldec-golang/inspect"
+	"github.com/Psycrow101/mdldec-golang/iqm"
+	"github.com/Psycrow101/mdldec-golang/obj"
+	"github.com/Psycrow101/mdldec-golang/qc"
+	"github.com/Psycrow101/mdldec-golang/smd"
+	"github.com/Psycrow101/mdldec-golang/studio"
+	"github.com/Psycrow101/mdldec-golang/texture"
+)
+
+// artifacts of a decompiled model
+const (
+	artifactQC         = "qc"
+	artifactReferences = "references"
+	artifactAnimations = "animations"
+	artifactTextures   = "textures"
+)
+
+var defaultArtifacts = []string{artifactQC, artifactReferences, artifactAnimations, artifactTextures}
+
+// overwrite policies
+const (
+	overwriteAlways = "always"
+	overwriteNever  = "never"
+)
+
+type decompileOptions struct {
+	sourcePath  string
+	destPath    string
+	overwrite   string
+	artifacts   map[string]bool
+	recoverMode bool
+	verbose     bool
+	smdWorkers  int
+
+	gltf, glb   bool
+	iqe, iqm    bool
+	obj         bool
+	objBody     int
+	dae         bool
+	bvh         bool
+	bvhMovement bool
+}
+
+func parseArtifacts(list string) (map[string]bool, error) {
+	var artifacts = make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		known := false
+		for _, artifact := range defaultArtifacts {
+			known = known || name == artifact
+		}
+		if !known {
+			return nil, errors.New(fmt.Sprintf("unknown artifact %q", name))
+		}
+		artifacts[name] = true
+	}
+	return artifacts, nil
+}
+
+// setDecompileFlags registers the options shared by the decompile and batch
+// commands and returns the artifacts list to pass to parseArtifacts.
+func setDecompileFlags(fs *flag.FlagSet, opts *decompileOptions) *string {
+	artifacts := fs.String("artifacts", strings.Join(defaultArtifacts, ","),
+		"comma-separated files to produce among "+strings.Join(defaultArtifacts, ", "))
+	fs.StringVar(&opts.overwrite, "overwrite", overwriteAlways,
+		"\"always\" replaces existing files, \"never\" refuses a target directory that is not empty")
+	fs.BoolVar(&opts.recoverMode, "recover", false, "repair damaged sections instead of failing")
+	fs.BoolVar(&opts.verbose, "v", false, "also print a summary of the model")
+	fs.IntVar(&opts.smdWorkers, "smd-workers", runtime.NumCPU(), "number of SMD files of a model written at the same time")
+	fs.BoolVar(&opts.gltf, "gltf", false, "also export the model as glTF")
+	fs.BoolVar(&opts.glb, "glb", false, "also export the model as binary glTF")
+	fs.BoolVar(&opts.iqe, "iqe", false, "also export the model as Inter-Quake Export text")
+	fs.BoolVar(&opts.iqm, "iqm", false, "also export the model as binary Inter-Quake Model")
+	fs.BoolVar(&opts.obj, "obj", false, "also export every body part as OBJ")
+	fs.IntVar(&opts.objBody, "obj-body", -1, "also export the models of this body value as a single OBJ")
+	fs.BoolVar(&opts.dae, "dae", false, "also export the model as Collada")
+	fs.BoolVar(&opts.bvh, "bvh", false, "also export every sequence blend as BVH")
+	fs.BoolVar(&opts.bvhMovement, "bvh-movement", false, "same as -bvh, with the linear movement baked into the root")
+	return artifacts
+}
+
+// checkDecompileFlags validates the shared options once they are parsed.
+func checkDecompileFlags(opts *decompileOptions, artifacts string) bool {
+	if opts.overwrite != overwriteAlways && opts.overwrite != overwriteNever {
+		printError(errors.New(fmt.Sprintf("invalid overwrite policy %q", opts.overwrite)))
+		return false
+	}
+	if opts.smdWorkers < 1 {
+		printError(errors.New(fmt.Sprintf("invalid number of SMD workers %d", opts.smdWorkers)))
+		return false
+	}
+	if opts.objBody < -1 {
+		printError(errors.New(fmt.Sprintf("invalid body value %d", opts.objBody)))
+		return false
+	}
+	var err error
+	if opts.artifacts, err = parseArtifacts(artifacts); err != nil {
+		printError(err)
+		return false
+	}
+	return true
+}
+
+func runDecompile(args []string, stdout io.Writer) int {
+	var (
+		opts      = decompileOptions{}
+		fs        = newFlagSet("decompile", "[options] source_file [target_directory]")
+		artifacts = setDecompileFlags(fs, &opts)
+		quiet     = fs.Bool("q", false, "print errors only")
+	)
+	fs.StringVar(&opts.destPath, "o", "", "target directory, by default decomp_<source_file> next to the source")
+
+	files, ok := parseArgs(fs, args, 1, 2)
+	if !ok || !checkDecompileFlags(&opts, *artifacts) {
+		return exitUsage
+	}
+	out := output(stdout, *quiet)
+
+	opts.sourcePath = files[0]
+	if len(files) > 1 {
+		if len(opts.destPath) > 0 {
+			printError(errors.New("the target directory is given twice"))
+			return exitUsage
+		}
+		opts.destPath = files[1]
+	} else if len(opts.destPath) == 0 {
+		opts.destPath = defaultDestPath(opts.sourcePath)
+	}
+
+	printBanner(out)
+	result := decompile(&opts, out)
+	result.printErrors()
+	return printFooter(out)
+}
+
+// decompileResult is the outcome of decompiling a model.
+type decompileResult struct {
+	repairs  int
+	warnings int // from the decoder and the stages
+	errors   []error
+}
+
+// printErrors reports the failures of a model once its lines are printed.
+func (result *decompileResult) printErrors() {
+	for _, err := range result.errors {
+		printError(err)
+	}
+}
+
+// decompile writes the requested artifacts and exports of a model, each in
+// its own goroutine. The lines of every stage are printed to out once all are
+// done, in a fixed order. Failures are collected in the result for the
+// caller to report after the lines.
+func decompile(opts *decompileOptions, out io.Writer) (result decompileResult) {
+	var errorsMu sync.Mutex
+	fail := func(err error) {
+		errorsMu.Lock()
+		result.errors = append(result.errors, err)
+		errorsMu.Unlock()
+	}
+
+	if opts.overwrite == overwriteNever {
+		empty, err := isEmptyDirectory(opts.destPath)
+		if err != nil {
+			fail(err)
+			return
+		}
+		if !empty {
+			fail(errors.New(fmt.Sprintf("%s is not empty, overwriting is disabled", opts.destPath)))
+			return
+		}
+	}
+
+	if err := createDirectory(opts.destPath); err != nil {
+		fail(err)
+		return
+	}
+
+	mdl, err := loadModel(opts.sourcePath, opts.recoverMode)
+	if err != nil {
+		fail(err)
+		return
+	}
+	printWarnings(out, mdl)
+	result.warnings = len(mdl.Warnings)
+	result.repairs = len(mdl.Repairs)
+	for _, r := range mdl.Repairs {
+		fmt.Fprintf(out, "[REPAIR] %s\n", r)
+	}
+	if opts.recoverMode {
+		fmt.Fprintf(out, "Recovered with %d repairs.\n", len(mdl.Repairs))
+	}
+	if opts.verbose {
+		if err := inspect.WriteSummary(out, mdl); err != nil {
+			fail(err)
+		}
+	}
+
+	var (
+		wg        = &sync.WaitGroup{}
+		name      = modelName(opts.sourcePath)
+		destPath  = opts.destPath
+		animsPath = filepath.Join(destPath, "anims")
+		buffers   []*bytes.Buffer
+		logs      []*studio.Log
+	)
+	export := func(save func(log io.Writer) error) {
+		buf := new(bytes.Buffer)
+		log := studio.NewLog(buf)
+		buffers, logs = append(buffers, buf), append(logs, log)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := save(log)
+			if errs, ok := err.(smd.Errors); ok {
+				for _, err := range errs {
+					fail(err)
+				}
+			} else if err != nil {
+				fail(err)
+			}
+		}()
+	}
+
+	if opts.artifacts[artifactQC] {
+		export(func(log io.Writer) error {
+			return qc.SaveLog(filepath.Join(destPath, name+".qc"), mdl, log)
+		})
+	}
+	if opts.artifacts[artifactReferences] || opts.artifacts[artifactAnimations] {
+		// the references and the animations one after the other, so that the
+		// SMD files are listed in the same order whatever the workers
+		export(func(log io.Writer) error {
+			var failed smd.Errors
+			collect := func(err error) {
+				if errs, ok := err.(smd.Errors); ok {
+					failed = append(failed, errs...)
+				} else if err != nil {
+					failed = append(failed, err)
+				}
+			}
+			if opts.artifacts[artifactReferences] {
+				collect(smd.SaveReferencesN(destPath, mdl, opts.smdWorkers, log))
+			}
+			if opts.artifacts[artifactAnimations] {
+				// shared with the BVH files, which are written at the same time
+				if err := os.MkdirAll(animsPath, 0744); err != nil {
+					collect(err)
+				} else {
+					collect(smd.SaveSequencesN(animsPath, mdl, opts.smdWorkers, log))
+				}
+			}
+			if len(failed) > 0 {
+				return failed
+			}
+			return nil
+		})
+	}
+	if opts.artifacts[artifactTextures] {
+		export(func(log io.Writer) error {
+			texturesPath := filepath.Join(destPath, "textures")
+			if err := createDirectory(texturesPath); err != nil {
+				return err
+			}
+			return texture.Save(texturesPath, mdl)
+		})
+	}
+
+	if opts.dae {
+		export(func(log io.Writer) error {
+			return collada.SaveLog(filepath.Join(destPath, name+".dae"), mdl, log)
+		})
+	}
+	if opts.gltf {
+		export(func(log io.Writer) error {
+			return gltf.SaveLog(filepath.Join(destPath, name+".gltf"), mdl, log)
+		})
+	}
+	if opts.glb {
+		export(func(log io.Writer) error {
+			return gltf.SaveLog(filepath.Join(destPath, name+".glb"), mdl, log)
+		})
+	}
+	if opts.iqe {
+		export(func(log io.Writer) error {
+			return iqm.SaveLog(filepath.Join(destPath, name+".iqe"), mdl, log)
+		})
+	}
+	if opts.iqm {
+		export(func(log io.Writer) error {
+			return iqm.SaveLog(filepath.Join(destPath, name+".iqm"), mdl, log)
+		})
+	}
+	if opts.obj {
+		export(func(log io.Writer) error {
+			return obj.SaveLog(destPath, mdl, log)
+		})
+	}
+	if opts.objBody >= 0 {
+		export(func(log io.Writer) error {
+			return obj.SaveBodyLog(filepath.Join(destPath, fmt.Sprintf("%s_body%d.obj", name, opts.objBody)), mdl, opts.objBody, log)
+		})
+	}
+	if opts.bvh || opts.bvhMovement {
+		export(func(log io.Writer) error {
+			if err := os.MkdirAll(animsPath, 0744); err != nil {
+				return err
+			}
+			return bvh.SaveLog(animsPath, mdl, opts.bvhMovement, log)
+		})
+	}
+
+	wg.Wait()
+	for i, log := range logs {
+		result.warnings += log.Warnings()
+		out.Write(buffers[i].Bytes())
+	}
+	return
+}
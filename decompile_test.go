@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/internal/studiotest"
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// writeModels encodes test models into dir and returns their paths. Models
+// of different names have different poses.
+func writeModels(t *testing.T, dir string, models ...studiotest.Options) []string {
+	var paths []string
+	for _, opts := range models {
+		data, err := studiotest.Model(opts).Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, opts.Name+".mdl")
+		if err = ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// collada files are stamped with the time they are written
+var colladaDates = regexp.MustCompile(`<(created|modified)>[^<]*</`)
+
+// readFiles returns the contents of the files under root by their relative
+// path.
+func readFiles(t *testing.T, root string) map[string]string {
+	var files = make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files[rel] = colladaDates.ReplaceAllString(string(data), "<$1></")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// decompiled is what decompiling a model gave.
+type decompiled struct {
+	result decompileResult
+	out    string
+	files  map[string]string
+}
+
+// decompileTo decompiles a model with every artifact and export into
+// destPath.
+func decompileTo(t *testing.T, sourcePath, destPath string) (decompileResult, string) {
+	opts := &decompileOptions{
+		sourcePath: sourcePath,
+		destPath:   destPath,
+		overwrite:  overwriteAlways,
+		artifacts:  make(map[string]bool),
+		verbose:    true,
+		smdWorkers: 2,
+		gltf:       true, glb: true,
+		iqe: true, iqm: true,
+		obj: true, objBody: 0,
+		dae: true,
+		bvh: true,
+	}
+	for _, artifact := range defaultArtifacts {
+		opts.artifacts[artifact] = true
+	}
+	var out bytes.Buffer
+	result := decompile(opts, &out)
+	return result, strings.Replace(out.String(), destPath, "<dest>", -1)
+}
+
+// TestConcurrentDecompile decompiles two generated models and a compiled one
+// many times at once and checks the files, the lines and the results against
+// the ones of a model decompiled alone, so that state shared between calls
+// or between the stages of a call shows up, and under -race as a data race.
+func TestConcurrentDecompile(t *testing.T) {
+	const rounds = 4
+
+	dir, err := ioutil.TempDir("", "mdldec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	models := writeModels(t, dir,
+		studiotest.Options{Name: "first", Bones: 3, Angle: 0.4, Sequences: 2, Frames: 4, Vertices: 6, Commands: 2},
+		studiotest.Options{Name: "second", Bones: 5, Angle: -1.1, Sequences: 3, Frames: 3, Blends: 2, Vertices: 9,
+			Commands: 3, Textures: 2, TextureSize: 8})
+	models = append(models, filepath.Join("testdata", "box.mdl"))
+
+	for _, name := range []string{"alone", "together"} {
+		if err = os.Mkdir(filepath.Join(dir, name), 0744); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var want = make([]decompiled, len(models))
+	for i, path := range models {
+		destPath := filepath.Join(dir, "alone", modelName(path))
+		want[i].result, want[i].out = decompileTo(t, path, destPath)
+		want[i].files = readFiles(t, destPath)
+	}
+	for i := range want {
+		if len(want[i].result.errors) > 0 || len(want[i].files) == 0 {
+			t.Fatalf("model %d is not decompiled:\n%s", i, want[i].out)
+		}
+	}
+	for i := 1; i < len(want); i++ {
+		if reflect.DeepEqual(want[0].files, want[i].files) {
+			t.Fatal("the test models do not differ")
+		}
+	}
+
+	var (
+		wg  = &sync.WaitGroup{}
+		got = make([]decompiled, rounds*len(models))
+	)
+	for r := 0; r < rounds; r++ {
+		for i, path := range models {
+			wg.Add(1)
+			go func(k int, path string) {
+				defer wg.Done()
+				destPath := filepath.Join(dir, "together", string(rune('a'+k)))
+				got[k].result, got[k].out = decompileTo(t, path, destPath)
+			}(r*len(models)+i, path)
+		}
+	}
+	wg.Wait()
+
+	for k := range got {
+		expected := want[k%len(models)]
+		if !reflect.DeepEqual(got[k].result, expected.result) {
+			t.Errorf("run %d gave %+v, want %+v", k, got[k].result, expected.result)
+		}
+		if got[k].out != expected.out {
+			t.Errorf("run %d printed\n%s\nwant\n%s", k, got[k].out, expected.out)
+		}
+		files := readFiles(t, filepath.Join(dir, "together", string(rune('a'+k))))
+		if len(files) != len(expected.files) {
+			t.Errorf("run %d wrote %d files, want %d", k, len(files), len(expected.files))
+		}
+		for name, data := range expected.files {
+			if files[name] != data {
+				t.Errorf("run %d: %s differs from the model decompiled alone", k, name)
+			}
+		}
+	}
+}
+
+// TestDecompileResult checks that the warnings of the stages are counted and
+// that failures are returned instead of printed.
+func TestDecompileResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mdldec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the sound tables are warned about by the QC stage
+	path := filepath.Join(dir, "extra.mdl")
+	if err = studio.Save(path, studiotest.Model(studiotest.Options{Vertices: 4, Extra: true})); err != nil {
+		t.Fatal(err)
+	}
+
+	result, out := decompileTo(t, path, filepath.Join(dir, "extra"))
+	if len(result.errors) > 0 {
+		t.Fatalf("errors %v", result.errors)
+	}
+	if n := strings.Count(out, "[WARNING] "); result.warnings == 0 || result.warnings != n {
+		t.Errorf("%d warnings counted, %d printed:\n%s", result.warnings, n, out)
+	}
+
+	printed := errorsNum()
+	opts := &decompileOptions{sourcePath: path, destPath: dir, overwrite: overwriteNever}
+	result = decompile(opts, new(bytes.Buffer))
+	if len(result.errors) != 1 || errorsNum() != printed {
+		t.Errorf("errors %v, %d printed", result.errors, errorsNum()-printed)
+	}
+}
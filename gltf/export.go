@@ -0,0 +1,380 @@
+package gltf
+
+import (
+	"bytes"
+	"fmt"
+	goimage "image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// zUpToYUp turns the Z-up space of the model into the Y-up space of glTF.
+var zUpToYUp = [4]float32{-math.Sqrt2 / 2, 0, 0, math.Sqrt2 / 2}
+
+// Save writes the model to path as a binary .glb file or, for any other
+// extension, as a .gltf file with its buffer in a .bin file next to it.
+func Save(path string, mdl *studio.Mdl) error {
+	return SaveLog(path, mdl, os.Stdout)
+}
+
+// SaveLog is Save printing the written file to log instead of the standard
+// output.
+func SaveLog(path string, mdl *studio.Mdl, log io.Writer) error {
+	b, err := build(mdl)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".glb") {
+		data, err := b.encodeGLB()
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	} else if err = b.saveGLTF(path); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(log, "glTF: %s\n", filepath.Base(path))
+	return nil
+}
+
+// EncodeGLB returns the model as a binary glTF file.
+func EncodeGLB(mdl *studio.Mdl) ([]byte, error) {
+	b, err := build(mdl)
+	if err != nil {
+		return nil, err
+	}
+	return b.encodeGLB()
+}
+
+// build converts the model: the bones become a node hierarchy used as the
+// skin of every body part model, the textures become materials and every
+// sequence blend becomes an animation.
+func build(mdl *studio.Mdl) (*builder, error) {
+	b := new(builder)
+	b.doc.Asset = asset{Version: "2.0", Generator: "mdldec " + studio.Version}
+
+	root := b.addNode(&node{Name: mdl.Header.Name.String(), Rotation: &zUpToYUp})
+	sc := &scene{Nodes: []int{root}}
+	b.doc.Scenes = []*scene{sc}
+
+	joints := b.addBones(mdl, root)
+
+	materials, err := b.addMaterials(mdl)
+	if err != nil {
+		return nil, err
+	}
+
+	var skinIndex *int
+	if len(joints) > 0 {
+		idx := b.addSkin(mdl, joints, root)
+		skinIndex = &idx
+	}
+
+	transforms := studio.CalcBoneTransforms(mdl.Bones)
+	var skinTransforms []*studio.Matrix3x4
+	if mdl.Header.Flags&studio.StudioHasBoneWeights != 0 {
+		skinTransforms = studio.CalcSkinTransforms(transforms, mdl.BonesInfo)
+	}
+
+	for _, bp := range mdl.BodyParts {
+		for _, m := range bp.Models {
+			if m.Name.String() == "blank" {
+				continue
+			}
+			meshIndex, ok := b.addModel(mdl, m, materials, transforms, skinTransforms, skinIndex != nil)
+			if !ok {
+				continue
+			}
+			n := &node{Name: strings.TrimSuffix(m.Name.String(), ".smd"), Mesh: &meshIndex, Skin: skinIndex}
+			// skinned meshes are placed by their joints, the others by the root
+			if skinIndex != nil {
+				sc.Nodes = append(sc.Nodes, b.addNode(n))
+			} else {
+				b.doc.Nodes[root].Children = append(b.doc.Nodes[root].Children, b.addNode(n))
+			}
+		}
+	}
+
+	for _, seq := range mdl.Sequences {
+		for i := 0; i < int(seq.BlendsNum); i++ {
+			b.addAnimation(mdl, seq, i, joints)
+		}
+	}
+
+	return b, nil
+}
+
+// addBones adds a node per bone under root and returns their indices.
+func (b *builder) addBones(mdl *studio.Mdl, root int) []int {
+	var joints = make([]int, len(mdl.Bones))
+	for i, bone := range mdl.Bones {
+		translation := [3]float32{bone.Value[0], bone.Value[1], bone.Value[2]}
+		rotation := quaternion(float64(bone.Value[3]), float64(bone.Value[4]), float64(bone.Value[5]))
+		joints[i] = b.addNode(&node{Name: bone.Name.String(), Translation: &translation, Rotation: &rotation})
+
+		parent := root
+		if bone.Parent > -1 && int(bone.Parent) < i {
+			parent = joints[bone.Parent]
+		}
+		b.doc.Nodes[parent].Children = append(b.doc.Nodes[parent].Children, joints[i])
+	}
+	return joints
+}
+
+// addSkin uses the inverses of the bone transforms of the default pose as
+// the inverse bind matrices.
+func (b *builder) addSkin(mdl *studio.Mdl, joints []int, root int) int {
+	var matrices = make([][16]float32, len(joints))
+	for i, transform := range studio.CalcBoneTransforms(mdl.Bones) {
+		m := studio.Matrix3x4Invert(transform)
+		matrices[i] = [16]float32{
+			float32(m[0].X), float32(m[1].X), float32(m[2].X), 0,
+			float32(m[0].Y), float32(m[1].Y), float32(m[2].Y), 0,
+			float32(m[0].Z), float32(m[1].Z), float32(m[2].Z), 0,
+			float32(m[0].W), float32(m[1].W), float32(m[2].W), 1,
+		}
+	}
+
+	b.doc.Skins = append(b.doc.Skins, &skin{
+		InverseBindMatrices: b.addAccessor(matrices, typeFloat, len(matrices), "MAT4", 0),
+		Skeleton:            &root,
+		Joints:              joints,
+	})
+	return len(b.doc.Skins) - 1
+}
+
+// addMaterials stores every texture as a PNG image and returns the material
+// of each texture.
+func (b *builder) addMaterials(mdl *studio.Mdl) ([]int, error) {
+	var materials = make([]int, len(mdl.Textures))
+	for i, tex := range mdl.Textures {
+		var palette = make(color.Palette, 256)
+		for p := range palette {
+			palette[p] = color.NRGBA{R: tex.Pallets[p*3], G: tex.Pallets[p*3+1], B: tex.Pallets[p*3+2], A: 0xff}
+		}
+		mat := &material{
+			Name:        tex.Name.String(),
+			PBR:         pbr{RoughnessFactor: 1},
+			DoubleSided: tex.Flags&studio.StudioNfTwoside != 0,
+		}
+		// masked textures are transparent where the last palette color is used
+		if tex.Flags&studio.StudioNfMasked != 0 {
+			palette[255] = color.NRGBA{}
+			mat.AlphaMode = "MASK"
+		}
+
+		if tex.Width > 0 && tex.Height > 0 {
+			img := goimage.NewPaletted(goimage.Rect(0, 0, int(tex.Width), int(tex.Height)), palette)
+			copy(img.Pix, tex.Indices)
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, img); err != nil {
+				return nil, err
+			}
+
+			b.doc.Images = append(b.doc.Images, &image{
+				Name:       tex.Name.String(),
+				BufferView: b.addView(buf.Bytes(), 0),
+				MimeType:   "image/png",
+			})
+			b.doc.Textures = append(b.doc.Textures, &texture{Source: len(b.doc.Images) - 1})
+			mat.PBR.BaseColorTexture = &textureInfo{len(b.doc.Textures) - 1}
+		}
+		b.doc.Materials = append(b.doc.Materials, mat)
+		materials[i] = len(b.doc.Materials) - 1
+	}
+	return materials, nil
+}
+
+type vertexKey struct {
+	vertex, normal uint16
+	s, t           int16
+}
+
+// primitiveData holds the vertices of a mesh, shared between its triangles.
+type primitiveData struct {
+	indexOf   map[vertexKey]uint32
+	positions [][3]float32
+	normals   [][3]float32
+	uvs       [][2]float32
+	joints    [][4]uint8
+	weights   [][4]float32
+	indices   []uint32
+}
+
+// addModel converts the meshes of a body part model to primitives, with the
+// vertices in the default pose as the SMD references have them.
+func (b *builder) addModel(mdl *studio.Mdl, m *studio.Model, materials []int,
+	transforms, skinTransforms []*studio.Matrix3x4, skinned bool) (int, bool) {
+
+	gm := &mesh{Name: strings.TrimSuffix(m.Name.String(), ".smd")}
+	for _, me := range m.Meshes {
+		if int(me.SkinRef) >= len(mdl.Textures) {
+			continue
+		}
+		tex := mdl.Textures[me.SkinRef]
+		pd := &primitiveData{indexOf: make(map[vertexKey]uint32)}
+
+		for _, tri := range me.Triangles {
+			for _, face := range tri.Faces() {
+				for _, vert := range face {
+					pd.indices = append(pd.indices, pd.addVertex(m, tex, vert, transforms, skinTransforms))
+				}
+			}
+		}
+		if len(pd.indices) == 0 {
+			continue
+		}
+
+		material := materials[me.SkinRef]
+		p := &primitive{Attributes: make(map[string]int), Material: &material}
+		p.Attributes["POSITION"] = b.addAccessor(pd.positions, typeFloat, len(pd.positions), "VEC3", targetArrayBuffer)
+		min, max := bounds(pd.positions)
+		b.doc.Accessors[p.Attributes["POSITION"]].Min = min[:]
+		b.doc.Accessors[p.Attributes["POSITION"]].Max = max[:]
+		p.Attributes["NORMAL"] = b.addAccessor(pd.normals, typeFloat, len(pd.normals), "VEC3", targetArrayBuffer)
+		p.Attributes["TEXCOORD_0"] = b.addAccessor(pd.uvs, typeFloat, len(pd.uvs), "VEC2", targetArrayBuffer)
+		if skinned {
+			p.Attributes["JOINTS_0"] = b.addAccessor(pd.joints, typeUnsignedByte, len(pd.joints), "VEC4", targetArrayBuffer)
+			p.Attributes["WEIGHTS_0"] = b.addAccessor(pd.weights, typeFloat, len(pd.weights), "VEC4", targetArrayBuffer)
+		}
+		p.Indices = b.addAccessor(pd.indices, typeUnsignedInt, len(pd.indices), "SCALAR", targetElementArrayBuffer)
+		gm.Primitives = append(gm.Primitives, p)
+	}
+
+	if len(gm.Primitives) == 0 {
+		return 0, false
+	}
+	b.doc.Meshes = append(b.doc.Meshes, gm)
+	return len(b.doc.Meshes) - 1, true
+}
+
+func (pd *primitiveData) addVertex(m *studio.Model, tex *studio.Texture, vert *studio.StudioTriangle,
+	transforms, skinTransforms []*studio.Matrix3x4) uint32 {
+
+	key := vertexKey{vert.VertexIndex, vert.NormalIndex, vert.S, vert.T}
+	if index, ok := pd.indexOf[key]; ok {
+		return index
+	}
+
+	var (
+		joints  [4]uint8
+		weights [4]float32
+		bone    = m.VerticesInfo[vert.VertexIndex]
+		mat     = studio.VertexMatrix(bone, m.VerticesWeights, int(vert.VertexIndex), transforms, skinTransforms)
+	)
+	if skinTransforms != nil && int(vert.VertexIndex) < len(m.VerticesWeights) {
+		joints, weights, _ = studio.NormalizedWeights(&m.VerticesWeights[vert.VertexIndex])
+	} else {
+		joints[0], weights[0] = bone, 1
+	}
+
+	pos := studio.Matrix3x4VectorTransform(mat, &m.Vertices[vert.VertexIndex])
+	norm := studio.Matrix3x4VectorRotate(mat, &m.Normals[vert.NormalIndex])
+	norm.Normalize()
+	if norm.X == 0 && norm.Y == 0 && norm.Z == 0 || math.IsNaN(float64(norm.X)) {
+		norm = &studio.Vector3_32{Z: 1}
+	}
+	u, v := tex.TexCoords(vert)
+
+	index := uint32(len(pd.positions))
+	pd.indexOf[key] = index
+	pd.positions = append(pd.positions, [3]float32{pos.X, pos.Y, pos.Z})
+	pd.normals = append(pd.normals, [3]float32{norm.X, norm.Y, norm.Z})
+	pd.uvs = append(pd.uvs, [2]float32{u, 1 - v})
+	pd.joints = append(pd.joints, joints)
+	pd.weights = append(pd.weights, weights)
+	return index
+}
+
+// addAnimation samples every frame of a sequence blend.
+func (b *builder) addAnimation(mdl *studio.Mdl, seq *studio.Sequence, blend int, joints []int) {
+	bonesNum := len(mdl.Bones)
+	framesNum := int(seq.FramesNum)
+	if framesNum == 0 || bonesNum == 0 || len(seq.Anims) < (blend+1)*bonesNum {
+		return
+	}
+
+	name := seq.Label.String()
+	if seq.BlendsNum > 1 {
+		name = fmt.Sprintf("%s_blend%d", name, blend+1)
+	}
+	anim := &animation{Name: name}
+
+	fps := seq.FPS
+	if fps <= 0 {
+		fps = 30
+	}
+	var times = make([]float32, framesNum)
+	for i := range times {
+		times[i] = float32(i) / fps
+	}
+	input := b.addAccessor(times, typeFloat, framesNum, "SCALAR", 0)
+	b.doc.Accessors[input].Min = []float32{times[0]}
+	b.doc.Accessors[input].Max = []float32{times[framesNum-1]}
+
+	var poses = make([][][6]float64, framesNum)
+	for frame := range poses {
+		poses[frame] = studio.CalcSequencePose(seq, mdl.Bones, blend, frame)
+	}
+
+	for i := range mdl.Bones {
+		var (
+			translations = make([][3]float32, framesNum)
+			rotations    = make([][4]float32, framesNum)
+		)
+		for frame := 0; frame < framesNum; frame++ {
+			motion := poses[frame][i]
+			translations[frame] = [3]float32{float32(motion[0]), float32(motion[1]), float32(motion[2])}
+			rotations[frame] = quaternion(motion[3], motion[4], motion[5])
+
+			// keep the shortest path between frames
+			if frame > 0 {
+				prev, q := rotations[frame-1], &rotations[frame]
+				if prev[0]*q[0]+prev[1]*q[1]+prev[2]*q[2]+prev[3]*q[3] < 0 {
+					q[0], q[1], q[2], q[3] = -q[0], -q[1], -q[2], -q[3]
+				}
+			}
+		}
+
+		anim.addChannel(joints[i], "translation", input, b.addAccessor(translations, typeFloat, framesNum, "VEC3", 0))
+		anim.addChannel(joints[i], "rotation", input, b.addAccessor(rotations, typeFloat, framesNum, "VEC4", 0))
+	}
+
+	b.doc.Animations = append(b.doc.Animations, anim)
+}
+
+func (anim *animation) addChannel(node int, path string, input, output int) {
+	anim.Samplers = append(anim.Samplers, &sampler{Input: input, Output: output, Interpolation: "LINEAR"})
+	anim.Channels = append(anim.Channels, &channel{
+		Sampler: len(anim.Samplers) - 1,
+		Target:  target{Node: node, Path: path},
+	})
+}
+
+func quaternion(x, y, z float64) [4]float32 {
+	q := studio.AngleQuaternion(&studio.Vector3_32{X: float32(x), Y: float32(y), Z: float32(z)})
+	return [4]float32{float32(q.X), float32(q.Y), float32(q.Z), float32(q.W)}
+}
+
+func bounds(positions [][3]float32) ([3]float32, [3]float32) {
+	min, max := positions[0], positions[0]
+	for _, p := range positions[1:] {
+		for i := 0; i < 3; i++ {
+			min[i] = float32(math.Min(float64(min[i]), float64(p[i])))
+			max[i] = float32(math.Max(float64(max[i]), float64(p[i])))
+		}
+	}
+	return min, max
+}
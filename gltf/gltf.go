@@ -0,0 +1,245 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// component types
+const (
+	typeUnsignedByte = 5121
+	typeUnsignedInt  = 5125
+	typeFloat        = 5126
+)
+
+// buffer view targets
+const (
+	targetArrayBuffer        = 34962
+	targetElementArrayBuffer = 34963
+)
+
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbChunkJSON = 0x4E4F534A
+	glbChunkBIN  = 0x004E4942
+)
+
+type document struct {
+	Asset       asset         `json:"asset"`
+	Scene       int           `json:"scene"`
+	Scenes      []*scene      `json:"scenes"`
+	Nodes       []*node       `json:"nodes"`
+	Meshes      []*mesh       `json:"meshes,omitempty"`
+	Skins       []*skin       `json:"skins,omitempty"`
+	Animations  []*animation  `json:"animations,omitempty"`
+	Materials   []*material   `json:"materials,omitempty"`
+	Textures    []*texture    `json:"textures,omitempty"`
+	Images      []*image      `json:"images,omitempty"`
+	Accessors   []*accessor   `json:"accessors,omitempty"`
+	BufferViews []*bufferView `json:"bufferViews,omitempty"`
+	Buffers     []*buffer     `json:"buffers,omitempty"`
+}
+
+type asset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator,omitempty"`
+}
+
+type scene struct {
+	Name  string `json:"name,omitempty"`
+	Nodes []int  `json:"nodes"`
+}
+
+type node struct {
+	Name        string      `json:"name,omitempty"`
+	Children    []int       `json:"children,omitempty"`
+	Mesh        *int        `json:"mesh,omitempty"`
+	Skin        *int        `json:"skin,omitempty"`
+	Translation *[3]float32 `json:"translation,omitempty"`
+	Rotation    *[4]float32 `json:"rotation,omitempty"`
+}
+
+type mesh struct {
+	Name       string       `json:"name,omitempty"`
+	Primitives []*primitive `json:"primitives"`
+}
+
+type primitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Material   *int           `json:"material,omitempty"`
+}
+
+type skin struct {
+	Name                string `json:"name,omitempty"`
+	InverseBindMatrices int    `json:"inverseBindMatrices"`
+	Skeleton            *int   `json:"skeleton,omitempty"`
+	Joints              []int  `json:"joints"`
+}
+
+type animation struct {
+	Name     string     `json:"name,omitempty"`
+	Channels []*channel `json:"channels"`
+	Samplers []*sampler `json:"samplers"`
+}
+
+type channel struct {
+	Sampler int    `json:"sampler"`
+	Target  target `json:"target"`
+}
+
+type target struct {
+	Node int    `json:"node"`
+	Path string `json:"path"`
+}
+
+type sampler struct {
+	Input         int    `json:"input"`
+	Output        int    `json:"output"`
+	Interpolation string `json:"interpolation"`
+}
+
+type material struct {
+	Name        string `json:"name,omitempty"`
+	PBR         pbr    `json:"pbrMetallicRoughness"`
+	AlphaMode   string `json:"alphaMode,omitempty"`
+	DoubleSided bool   `json:"doubleSided,omitempty"`
+}
+
+type pbr struct {
+	BaseColorTexture *textureInfo `json:"baseColorTexture,omitempty"`
+	MetallicFactor   float32      `json:"metallicFactor"`
+	RoughnessFactor  float32      `json:"roughnessFactor"`
+}
+
+type textureInfo struct {
+	Index int `json:"index"`
+}
+
+type texture struct {
+	Source int `json:"source"`
+}
+
+type image struct {
+	Name       string `json:"name,omitempty"`
+	BufferView int    `json:"bufferView"`
+	MimeType   string `json:"mimeType"`
+}
+
+type accessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type bufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target,omitempty"`
+}
+
+type buffer struct {
+	ByteLength int    `json:"byteLength"`
+	URI        string `json:"uri,omitempty"`
+}
+
+// builder collects the document and its binary buffer.
+type builder struct {
+	doc document
+	bin bytes.Buffer
+}
+
+func (b *builder) addView(data []byte, target int) int {
+	for b.bin.Len()%4 != 0 {
+		b.bin.WriteByte(0)
+	}
+	b.doc.BufferViews = append(b.doc.BufferViews, &bufferView{
+		ByteOffset: b.bin.Len(),
+		ByteLength: len(data),
+		Target:     target,
+	})
+	b.bin.Write(data)
+	return len(b.doc.BufferViews) - 1
+}
+
+// addAccessor stores data, a slice of fixed size values, in a buffer view of
+// its own.
+func (b *builder) addAccessor(data interface{}, componentType, count int, typ string, target int) int {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, data)
+
+	b.doc.Accessors = append(b.doc.Accessors, &accessor{
+		BufferView:    b.addView(buf.Bytes(), target),
+		ComponentType: componentType,
+		Count:         count,
+		Type:          typ,
+	})
+	return len(b.doc.Accessors) - 1
+}
+
+func (b *builder) addNode(n *node) int {
+	b.doc.Nodes = append(b.doc.Nodes, n)
+	return len(b.doc.Nodes) - 1
+}
+
+func (b *builder) encodeJSON() ([]byte, error) {
+	if b.bin.Len() > 0 {
+		for b.bin.Len()%4 != 0 {
+			b.bin.WriteByte(0)
+		}
+		b.doc.Buffers[0].ByteLength = b.bin.Len()
+	} else {
+		b.doc.Buffers = nil
+	}
+	return json.Marshal(&b.doc)
+}
+
+func (b *builder) encodeGLB() ([]byte, error) {
+	b.doc.Buffers = []*buffer{{}}
+	data, err := b.encodeJSON()
+	if err != nil {
+		return nil, err
+	}
+	for len(data)%4 != 0 {
+		data = append(data, ' ')
+	}
+
+	var out bytes.Buffer
+	length := 12 + 8 + len(data)
+	if b.bin.Len() > 0 {
+		length += 8 + b.bin.Len()
+	}
+	binary.Write(&out, binary.LittleEndian, [3]uint32{glbMagic, 2, uint32(length)})
+	binary.Write(&out, binary.LittleEndian, [2]uint32{uint32(len(data)), glbChunkJSON})
+	out.Write(data)
+	if b.bin.Len() > 0 {
+		binary.Write(&out, binary.LittleEndian, [2]uint32{uint32(b.bin.Len()), glbChunkBIN})
+		out.Write(b.bin.Bytes())
+	}
+	return out.Bytes(), nil
+}
+
+// saveGLTF writes the document to path and the buffer next to it.
+func (b *builder) saveGLTF(path string) error {
+	binName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".bin"
+	b.doc.Buffers = []*buffer{{URI: binName}}
+	data, err := b.encodeJSON()
+	if err != nil {
+		return err
+	}
+
+	if b.bin.Len() > 0 {
+		if err = ioutil.WriteFile(filepath.Join(filepath.Dir(path), binName), b.bin.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
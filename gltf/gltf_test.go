@@ -0,0 +1,200 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+var componentSizes = map[int]int{typeUnsignedByte: 1, typeUnsignedInt: 4, typeFloat: 4}
+
+var typeSizes = map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4, "MAT4": 16}
+
+func loadBox(t *testing.T) *studio.Mdl {
+	mdl, err := studio.Load(filepath.Join("..", "testdata", "box.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mdl
+}
+
+// splitGLB checks the header and chunks of a binary glTF file and returns
+// its document and buffer.
+func splitGLB(t *testing.T, data []byte) (*document, []byte) {
+	var header [5]uint32
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+	if header[0] != glbMagic || header[1] != 2 || int(header[2]) != len(data) || header[4] != glbChunkJSON {
+		t.Fatalf("header %x of a %d bytes file", header, len(data))
+	}
+	jsonEnd := 20 + int(header[3])
+	doc := new(document)
+	if err := json.Unmarshal(data[20:jsonEnd], doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var chunk [2]uint32
+	if err := binary.Read(bytes.NewReader(data[jsonEnd:]), binary.LittleEndian, &chunk); err != nil {
+		t.Fatal(err)
+	}
+	bin := data[jsonEnd+8:]
+	if chunk[1] != glbChunkBIN || int(chunk[0]) != len(bin) {
+		t.Fatalf("binary chunk %x with %d bytes left", chunk, len(bin))
+	}
+	return doc, bin
+}
+
+// checkDocument checks that the document only refers to existing parts and
+// that the accessors fit in the buffer.
+func checkDocument(t *testing.T, doc *document, bin []byte) {
+	if len(doc.Buffers) != 1 || doc.Buffers[0].ByteLength != len(bin) {
+		t.Fatalf("buffers %+v, want one of %d bytes", doc.Buffers, len(bin))
+	}
+	for i, v := range doc.BufferViews {
+		if v.Buffer != 0 || v.ByteOffset%4 != 0 || v.ByteOffset+v.ByteLength > len(bin) {
+			t.Errorf("buffer view %d %+v is outside of the buffer", i, *v)
+		}
+	}
+	for i, a := range doc.Accessors {
+		if a.BufferView >= len(doc.BufferViews) {
+			t.Errorf("accessor %d: missing buffer view %d", i, a.BufferView)
+			continue
+		}
+		size := a.Count * componentSizes[a.ComponentType] * typeSizes[a.Type]
+		if size == 0 || size > doc.BufferViews[a.BufferView].ByteLength {
+			t.Errorf("accessor %d %+v does not fit its buffer view", i, *a)
+		}
+	}
+
+	for i, n := range doc.Nodes {
+		for _, c := range n.Children {
+			if c <= i || c >= len(doc.Nodes) {
+				t.Errorf("node %d: child %d", i, c)
+			}
+		}
+		if (n.Mesh != nil && *n.Mesh >= len(doc.Meshes)) || (n.Skin != nil && *n.Skin >= len(doc.Skins)) {
+			t.Errorf("node %d: mesh or skin missing", i)
+		}
+	}
+	for i, m := range doc.Meshes {
+		for _, p := range m.Primitives {
+			count := doc.Accessors[p.Attributes["POSITION"]].Count
+			for name, a := range p.Attributes {
+				if doc.Accessors[a].Count != count {
+					t.Errorf("mesh %d: %d %s values for %d positions", i, doc.Accessors[a].Count, name, count)
+				}
+			}
+			indices := doc.Accessors[p.Indices]
+			if indices.ComponentType != typeUnsignedInt || indices.Count%3 != 0 {
+				t.Errorf("mesh %d: indices %+v, want triangles of unsigned ints", i, *indices)
+				continue
+			}
+			view := doc.BufferViews[indices.BufferView]
+			values := make([]uint32, indices.Count)
+			binary.Read(bytes.NewReader(bin[view.ByteOffset:]), binary.LittleEndian, values)
+			for _, v := range values {
+				if int(v) >= count {
+					t.Errorf("mesh %d: index %d of %d positions", i, v, count)
+					break
+				}
+			}
+			if p.Material != nil && *p.Material >= len(doc.Materials) {
+				t.Errorf("mesh %d: material %d missing", i, *p.Material)
+			}
+		}
+	}
+	for i, a := range doc.Animations {
+		for _, c := range a.Channels {
+			if c.Sampler >= len(a.Samplers) || c.Target.Node >= len(doc.Nodes) {
+				t.Errorf("animation %d: channel %+v", i, *c)
+			}
+		}
+		for _, s := range a.Samplers {
+			if doc.Accessors[s.Input].Count != doc.Accessors[s.Output].Count {
+				t.Errorf("animation %d: %d key times for %d values", i,
+					doc.Accessors[s.Input].Count, doc.Accessors[s.Output].Count)
+			}
+		}
+	}
+}
+
+func TestEncodeGLB(t *testing.T) {
+	mdl := loadBox(t)
+	data, err := EncodeGLB(mdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, bin := splitGLB(t, data)
+	checkDocument(t, doc, bin)
+
+	if len(doc.Skins) != 1 || len(doc.Skins[0].Joints) != len(mdl.Bones) {
+		t.Fatalf("skins %+v, want one with %d joints", doc.Skins, len(mdl.Bones))
+	}
+	for i, j := range doc.Skins[0].Joints {
+		if doc.Nodes[j].Name != mdl.Bones[i].Name.String() {
+			t.Errorf("joint %d is node %s, want bone %s", i, doc.Nodes[j].Name, mdl.Bones[i].Name)
+		}
+	}
+	if len(doc.Meshes) != 1 || len(doc.Materials) != len(mdl.Textures) || len(doc.Images) != len(mdl.Textures) {
+		t.Errorf("%d meshes, %d materials and %d images, want 1 and %d", len(doc.Meshes),
+			len(doc.Materials), len(doc.Images), len(mdl.Textures))
+	}
+	if len(doc.Animations) != len(mdl.Sequences) {
+		t.Fatalf("%d animations, want %d", len(doc.Animations), len(mdl.Sequences))
+	}
+	for i, a := range doc.Animations {
+		if a.Name != mdl.Sequences[i].Label.String() {
+			t.Errorf("animation %d is named %s, want %s", i, a.Name, mdl.Sequences[i].Label)
+		}
+	}
+}
+
+// TestSaveGLTF checks that the .gltf file refers to the .bin written next to
+// it, with the same content as the buffer of the binary file.
+func TestSaveGLTF(t *testing.T) {
+	mdl := loadBox(t)
+	dir, err := ioutil.TempDir("", "gltf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := new(bytes.Buffer)
+	if err = SaveLog(filepath.Join(dir, "box.gltf"), mdl, log); err != nil {
+		t.Fatal(err)
+	}
+	if log.String() != "glTF: box.gltf\n" {
+		t.Errorf("log %q", log.String())
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "box.gltf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := new(document)
+	if err = json.Unmarshal(data, doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Buffers) != 1 || doc.Buffers[0].URI != "box.bin" {
+		t.Fatalf("buffers %+v, want box.bin", doc.Buffers)
+	}
+	bin, err := ioutil.ReadFile(filepath.Join(dir, "box.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDocument(t, doc, bin)
+
+	glb, err := EncodeGLB(mdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, glbBin := splitGLB(t, glb); !bytes.Equal(bin, glbBin) {
+		t.Error("the .bin file differs from the buffer of the binary file")
+	}
+}
@@ -0,0 +1,482 @@
+package inspect
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// SchemaVersion is increased whenever a field of the dump changes.
+const SchemaVersion = 2
+
+// number is a float written in its shortest form. JSON has no NaN nor
+// infinities, damaged models write them as strings.
+type number float32
+
+func (n number) String() string {
+	f := float64(n)
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 32)
+}
+
+func (n number) MarshalJSON() ([]byte, error) {
+	f := float64(n)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return []byte(strconv.Quote(n.String())), nil
+	}
+	return []byte(n.String()), nil
+}
+
+type vector [3]number
+
+func toVector(v studio.Vector3_32) vector {
+	return vector{number(v.X), number(v.Y), number(v.Z)}
+}
+
+type box struct {
+	Min vector `json:"min"`
+	Max vector `json:"max"`
+}
+
+// Model is the dump of a decoded model. Offsets are left out, so that the
+// dump only changes with the content of the model.
+type Model struct {
+	Schema         int    `json:"schema"`
+	Name           string `json:"name"`
+	Version        uint32 `json:"version"`
+	Flags          uint32 `json:"flags"`
+	EyePosition    vector `json:"eye_position"`
+	Hull           box    `json:"hull"`
+	ClipBox        box    `json:"clip_box"`
+	SoundTable     string `json:"sound_table"` // raw bytes in hexadecimal
+	SoundGroups    uint32 `json:"sound_groups"`
+	SoundGroupData string `json:"sound_group_data"` // raw bytes in hexadecimal
+
+	Bones          []*Bone          `json:"bones"`
+	HitBoxes       []*HitBox        `json:"hit_boxes"`
+	HitBoxSets     []*HitBoxSet     `json:"hit_box_sets"`
+	Attachments    []*Attachment    `json:"attachments"`
+	Sequences      []*Sequence      `json:"sequences"`
+	SequenceGroups []*SequenceGroup `json:"sequence_groups"`
+	Transitions    [][]int          `json:"transitions"`
+	BodyParts      []*BodyPart      `json:"body_parts"`
+	Textures       []*Texture       `json:"textures"`
+	SkinFamilies   [][]string       `json:"skin_families"`
+	PoseParameters []*PoseParameter `json:"pose_parameters"`
+	KeyValues      string           `json:"key_values"`
+	Repairs        []string         `json:"repairs"`
+}
+
+type Bone struct {
+	Name        string        `json:"name"`
+	Parent      int32         `json:"parent"`
+	Flags       uint32        `json:"flags"`
+	Position    vector        `json:"position"`
+	Rotation    vector        `json:"rotation"`
+	Scale       [6]number     `json:"scale"`
+	Controllers []*Controller `json:"controllers"`
+}
+
+type Controller struct {
+	Index uint32 `json:"index"`
+	Type  string `json:"type"`
+	Loop  bool   `json:"loop"`
+	Start number `json:"start"`
+	End   number `json:"end"`
+	Rest  uint32 `json:"rest"`
+}
+
+type HitBox struct {
+	Bone  string `json:"bone"`
+	Group uint32 `json:"group"`
+	Box   box    `json:"box"`
+}
+
+type HitBoxSet struct {
+	Name     string    `json:"name"`
+	HitBoxes []*HitBox `json:"hit_boxes"`
+}
+
+type Attachment struct {
+	Name    string    `json:"name"`
+	Type    uint32    `json:"type"`
+	Bone    string    `json:"bone"`
+	Origin  vector    `json:"origin"`
+	Vectors [3]vector `json:"vectors"`
+}
+
+type Sequence struct {
+	Label          string   `json:"label"`
+	FPS            number   `json:"fps"`
+	Frames         uint32   `json:"frames"`
+	Flags          uint32   `json:"flags"`
+	Loop           bool     `json:"loop"`
+	Activity       string   `json:"activity"`
+	ActivityWeight int32    `json:"activity_weight"`
+	MotionType     string   `json:"motion_type"`
+	MotionBone     uint32   `json:"motion_bone"`
+	LinearMovement vector   `json:"linear_movement"`
+	Box            box      `json:"box"`
+	Blend          Blend    `json:"blend"`
+	Group          uint32   `json:"group"`
+	EntryNode      int32    `json:"entry_node"`
+	ExitNode       int32    `json:"exit_node"`
+	NodeFlags      uint32   `json:"node_flags"`
+	NextSequence   int32    `json:"next_sequence"`
+	Events         []*Event `json:"events"`
+	Pivots         []*Pivot `json:"pivots"`
+}
+
+type Blend struct {
+	Count  uint32    `json:"count"`
+	Types  [2]string `json:"types"`
+	Start  [2]number `json:"start"`
+	End    [2]number `json:"end"`
+	Parent int32     `json:"parent"`
+}
+
+type Event struct {
+	Frame   uint32 `json:"frame"`
+	Event   int32  `json:"event"`
+	Type    uint32 `json:"type"`
+	Options string `json:"options"`
+}
+
+type Pivot struct {
+	Origin vector `json:"origin"`
+	Start  int32  `json:"start"`
+	End    int32  `json:"end"`
+}
+
+type SequenceGroup struct {
+	Label string `json:"label"`
+	Name  string `json:"name"`
+}
+
+type BodyPart struct {
+	Name   string       `json:"name"`
+	Base   uint32       `json:"base"`
+	Models []*BodyModel `json:"models"`
+}
+
+type BodyModel struct {
+	Name           string  `json:"name"`
+	Type           int32   `json:"type"`
+	BoundingRadius number  `json:"bounding_radius"`
+	Vertices       int     `json:"vertices"`
+	Normals        int     `json:"normals"`
+	Weighted       bool    `json:"weighted"`
+	Meshes         []*Mesh `json:"meshes"`
+}
+
+type Mesh struct {
+	Texture   string `json:"texture"`
+	Triangles uint32 `json:"triangles"`
+	Normals   uint32 `json:"normals"`
+}
+
+type Texture struct {
+	Name        string   `json:"name"`
+	Width       uint32   `json:"width"`
+	Height      uint32   `json:"height"`
+	Flags       uint32   `json:"flags"`
+	RenderModes []string `json:"render_modes"`
+}
+
+type PoseParameter struct {
+	Name  string `json:"name"`
+	Flags uint32 `json:"flags"`
+	Start number `json:"start"`
+	End   number `json:"end"`
+	Loop  number `json:"loop"`
+}
+
+var renderModes = []struct {
+	flag uint32
+	name string
+}{
+	{studio.StudioNfFlatshade, "flatshade"},
+	{studio.StudioNfChrome, "chrome"},
+	{studio.StudioNfFullbright, "fullbright"},
+	{studio.StudioNfNomips, "nomips"},
+	{studio.StudioNfNosmooth, "nosmooth"},
+	{studio.StudioNfAdditive, "additive"},
+	{studio.StudioNfMasked, "masked"},
+	{studio.StudioNfNormalmap, "normalmap"},
+	{studio.StudioNfSolid, "masked_solid"},
+	{studio.StudioNfTwoside, "twoside"},
+	{studio.StudioNfColormap, "colormap"},
+	{studio.StudioNfUvCoords, "uvcoords"},
+}
+
+func boneName(mdl *studio.Mdl, bone int64) string {
+	if bone < 0 || bone >= int64(len(mdl.Bones)) {
+		return ""
+	}
+	return mdl.Bones[bone].Name.String()
+}
+
+func textureName(mdl *studio.Mdl, index int) string {
+	if index < 0 || index >= len(mdl.Textures) {
+		return ""
+	}
+	return mdl.Textures[index].Name.String()
+}
+
+func hitBoxes(mdl *studio.Mdl, hitBoxes []*studio.StudioHitBox) []*HitBox {
+	var out = make([]*HitBox, 0, len(hitBoxes))
+	for _, hb := range hitBoxes {
+		out = append(out, &HitBox{
+			Bone:  boneName(mdl, int64(hb.Bone)),
+			Group: hb.Group,
+			Box:   box{toVector(hb.BBMin), toVector(hb.BBMax)},
+		})
+	}
+	return out
+}
+
+// Build converts a decoded model to its dump.
+func Build(mdl *studio.Mdl) *Model {
+	hdr := mdl.Header
+	m := &Model{
+		Schema:         SchemaVersion,
+		Name:           hdr.Name.String(),
+		Version:        hdr.Version,
+		Flags:          hdr.Flags,
+		EyePosition:    toVector(hdr.EyePosition),
+		Hull:           box{toVector(hdr.Min), toVector(hdr.Max)},
+		ClipBox:        box{toVector(hdr.BBMin), toVector(hdr.BBMax)},
+		SoundTable:     hex.EncodeToString(mdl.Sounds),
+		SoundGroups:    hdr.SoundGroupsNum,
+		SoundGroupData: hex.EncodeToString(mdl.SoundGroups),
+		Bones:          make([]*Bone, 0, len(mdl.Bones)),
+		HitBoxes:       hitBoxes(mdl, mdl.HitBoxes),
+		HitBoxSets:     make([]*HitBoxSet, 0, len(mdl.HitBoxSets)),
+		Attachments:    make([]*Attachment, 0, len(mdl.Attachments)),
+		Sequences:      make([]*Sequence, 0, len(mdl.Sequences)),
+		SequenceGroups: make([]*SequenceGroup, 0, len(mdl.SeqGroups)),
+		Transitions:    make([][]int, 0, len(mdl.Transitions)),
+		BodyParts:      make([]*BodyPart, 0, len(mdl.BodyParts)),
+		Textures:       make([]*Texture, 0, len(mdl.Textures)),
+		SkinFamilies:   [][]string{},
+		PoseParameters: make([]*PoseParameter, 0, len(mdl.PoseParams)),
+		KeyValues:      strings.TrimSpace(mdl.KeyValues),
+		Repairs:        make([]string, 0, len(mdl.Repairs)),
+	}
+
+	for _, bone := range mdl.Bones {
+		b := &Bone{
+			Name:        bone.Name.String(),
+			Parent:      bone.Parent,
+			Flags:       bone.Flags,
+			Position:    vector{number(bone.Value[0]), number(bone.Value[1]), number(bone.Value[2])},
+			Rotation:    vector{number(bone.Value[3]), number(bone.Value[4]), number(bone.Value[5])},
+			Controllers: []*Controller{},
+		}
+		for i, s := range bone.Scale {
+			b.Scale[i] = number(s)
+		}
+		m.Bones = append(m.Bones, b)
+	}
+	for _, bc := range mdl.BoneControllers {
+		if bc.Bone < 0 || int(bc.Bone) >= len(m.Bones) {
+			continue
+		}
+		b := m.Bones[bc.Bone]
+		b.Controllers = append(b.Controllers, &Controller{
+			Index: bc.Index,
+			Type:  strings.TrimSpace(studio.MotionTypeString(int(bc.Type)&^studio.StudioMotionRLoop, false)),
+			Loop:  bc.Type&studio.StudioMotionRLoop != 0,
+			Start: number(bc.Start),
+			End:   number(bc.End),
+			Rest:  bc.Rest,
+		})
+	}
+
+	for _, set := range mdl.HitBoxSets {
+		m.HitBoxSets = append(m.HitBoxSets, &HitBoxSet{Name: set.Name.String(), HitBoxes: hitBoxes(mdl, set.HitBoxes)})
+	}
+
+	for _, a := range mdl.Attachments {
+		m.Attachments = append(m.Attachments, &Attachment{
+			Name:    a.Name.String(),
+			Type:    a.Type,
+			Bone:    boneName(mdl, int64(a.Bone)),
+			Origin:  toVector(a.Origins),
+			Vectors: [3]vector{toVector(a.Vectors[0]), toVector(a.Vectors[1]), toVector(a.Vectors[2])},
+		})
+	}
+
+	for _, seq := range mdl.Sequences {
+		m.Sequences = append(m.Sequences, buildSequence(seq))
+	}
+	for _, sg := range mdl.SeqGroups {
+		m.SequenceGroups = append(m.SequenceGroups, &SequenceGroup{Label: sg.Label.String(), Name: sg.Name.String()})
+	}
+	for _, row := range mdl.Transitions {
+		var nodes = make([]int, len(row))
+		for i, node := range row {
+			nodes[i] = int(node)
+		}
+		m.Transitions = append(m.Transitions, nodes)
+	}
+
+	for _, bp := range mdl.BodyParts {
+		part := &BodyPart{Name: bp.Name.String(), Base: bp.Base, Models: make([]*BodyModel, 0, len(bp.Models))}
+		for _, sm := range bp.Models {
+			model := &BodyModel{
+				Name:           sm.Name.String(),
+				Type:           sm.Type,
+				BoundingRadius: number(sm.BoundingRadius),
+				Vertices:       len(sm.Vertices),
+				Normals:        len(sm.Normals),
+				Weighted:       len(sm.VerticesWeights) > 0,
+				Meshes:         make([]*Mesh, 0, len(sm.Meshes)),
+			}
+			for _, me := range sm.Meshes {
+				model.Meshes = append(model.Meshes, &Mesh{
+					Texture:   textureName(mdl, int(me.SkinRef)),
+					Triangles: me.TrianglesNum,
+					Normals:   me.NormalsNum,
+				})
+			}
+			part.Models = append(part.Models, model)
+		}
+		m.BodyParts = append(m.BodyParts, part)
+	}
+
+	for _, tex := range mdl.Textures {
+		t := &Texture{
+			Name:        tex.Name.String(),
+			Width:       tex.Width,
+			Height:      tex.Height,
+			Flags:       tex.Flags,
+			RenderModes: []string{},
+		}
+		for _, mode := range renderModes {
+			if tex.Flags&mode.flag != 0 {
+				t.RenderModes = append(t.RenderModes, mode.name)
+			}
+		}
+		m.Textures = append(m.Textures, t)
+	}
+
+	if mdl.Skins != nil {
+		for _, family := range *mdl.Skins {
+			var names = make([]string, len(family))
+			for i, ref := range family {
+				names[i] = textureName(mdl, int(ref))
+			}
+			m.SkinFamilies = append(m.SkinFamilies, names)
+		}
+	}
+
+	for _, pp := range mdl.PoseParams {
+		m.PoseParameters = append(m.PoseParameters, &PoseParameter{
+			Name:  pp.Name.String(),
+			Flags: pp.Flags,
+			Start: number(pp.Start),
+			End:   number(pp.End),
+			Loop:  number(pp.Loop),
+		})
+	}
+
+	for _, r := range mdl.Repairs {
+		m.Repairs = append(m.Repairs, r.String())
+	}
+	return m
+}
+
+func buildSequence(seq *studio.Sequence) *Sequence {
+	s := &Sequence{
+		Label:          seq.Label.String(),
+		FPS:            number(seq.FPS),
+		Frames:         seq.FramesNum,
+		Flags:          seq.Flags,
+		Loop:           seq.Flags&studio.StudioLooping != 0,
+		ActivityWeight: seq.ActWight,
+		MotionType:     strings.TrimSpace(studio.MotionTypeString(int(seq.MotionType), true)),
+		MotionBone:     seq.MotionBone,
+		LinearMovement: toVector(seq.LinerMovement),
+		Box:            box{toVector(seq.BBMin), toVector(seq.BBMax)},
+		Blend: Blend{
+			Count:  seq.BlendsNum,
+			Start:  [2]number{number(seq.BlendStart[0]), number(seq.BlendStart[1])},
+			End:    [2]number{number(seq.BlendEnd[0]), number(seq.BlendEnd[1])},
+			Parent: seq.BlendParent,
+		},
+		Group:        seq.SeqGroup,
+		EntryNode:    seq.EntryNode,
+		ExitNode:     seq.ExitNode,
+		NodeFlags:    seq.NodeFlags,
+		NextSequence: seq.NextSeq,
+		Events:       make([]*Event, 0, len(seq.Events)),
+		Pivots:       make([]*Pivot, 0, len(seq.Pivots)),
+	}
+
+	if int(seq.Activity) < len(studio.ActivityNames) {
+		s.Activity = studio.ActivityNames[seq.Activity]
+	} else {
+		s.Activity = fmt.Sprintf("ACT_%d", seq.Activity)
+	}
+	for i, t := range seq.BlendTypes {
+		s.Blend.Types[i] = studio.MotionTypeString(int(t), false)
+	}
+
+	for _, ev := range seq.Events {
+		s.Events = append(s.Events, &Event{Frame: ev.Frame, Event: ev.Event, Type: ev.Type, Options: ev.Options.String()})
+	}
+	for _, pv := range seq.Pivots {
+		s.Pivots = append(s.Pivots, &Pivot{Origin: toVector(pv.Org), Start: pv.Start, End: pv.End})
+	}
+	return s
+}
+
+// EncodeJSON returns the dump of the model as indented JSON.
+func EncodeJSON(mdl *studio.Mdl) ([]byte, error) {
+	data, err := json.MarshalIndent(Build(mdl), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// EncodeYAML returns the dump of the model as YAML, with the keys of the
+// JSON dump.
+func EncodeYAML(mdl *studio.Mdl) ([]byte, error) {
+	return marshalYAML(Build(mdl)), nil
+}
+
+// IsYAML reports whether a dump file name asks for YAML.
+func IsYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Save writes the dump of the model to path, as YAML for .yaml and .yml
+// files and as JSON otherwise.
+func Save(path string, mdl *studio.Mdl) error {
+	encode := EncodeJSON
+	if IsYAML(path) {
+		encode = EncodeYAML
+	}
+	data, err := encode(mdl)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,94 @@
+package inspect
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+func loadBox(t *testing.T) *studio.Mdl {
+	mdl, err := studio.Load(filepath.Join("..", "testdata", "box.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mdl
+}
+
+func TestEncodeJSON(t *testing.T) {
+	mdl := loadBox(t)
+	data, err := EncodeJSON(mdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Model)
+	if err = json.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+	if want := Build(mdl); !reflect.DeepEqual(got, want) {
+		t.Errorf("the JSON dump reads back as\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got.Schema != SchemaVersion || got.Name != "box.mdl" || len(got.Bones) != 2 || len(got.Sequences) != 3 {
+		t.Fatalf("dump of %s: schema %d, %d bones, %d sequences", got.Name, got.Schema, len(got.Bones), len(got.Sequences))
+	}
+	if arm := got.Bones[1]; arm.Name != "arm" || len(arm.Controllers) != 1 || arm.Controllers[0].Type != "ZR" {
+		t.Errorf("bone %+v, want arm with its ZR controller", *arm)
+	}
+	if len(got.HitBoxes) != 2 || got.HitBoxes[1].Bone != "arm" || len(got.Attachments) != 1 {
+		t.Errorf("hitboxes %+v and attachments %+v", got.HitBoxes, got.Attachments)
+	}
+}
+
+// TestEncodeYAML checks that the YAML dump has the keys of the JSON dump in
+// the same order, and writes NaN the way YAML does.
+func TestEncodeYAML(t *testing.T) {
+	mdl := loadBox(t)
+	mdl.Bones[0].Value[3] = float32(math.NaN())
+
+	data, err := EncodeJSON(mdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(fields["bones"]), `"NaN"`) {
+		t.Error("NaN is not a string in the JSON dump")
+	}
+
+	yaml, err := EncodeYAML(mdl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, line := range strings.Split(string(yaml), "\n") {
+		if len(line) > 0 && line[0] != ' ' {
+			keys = append(keys, strings.SplitN(line, ":", 2)[0])
+		}
+	}
+	if len(keys) != len(fields) {
+		t.Fatalf("YAML keys %q, want the %d JSON keys", keys, len(fields))
+	}
+	for i, key := range keys {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("YAML key %d %q is not in the JSON dump", i, key)
+		}
+	}
+	for _, want := range []string{
+		"schema: 2\n",
+		"name: \"box.mdl\"\n",
+		"  - name: \"root\"\n    parent: -1\n",
+		"    rotation: [.nan, ",
+		"repairs: []\n",
+	} {
+		if !strings.Contains(string(yaml), want) {
+			t.Errorf("YAML dump does not contain %q", want)
+		}
+	}
+}
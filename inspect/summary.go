@@ -0,0 +1,102 @@
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// textureSize returns the memory taken by a texture: an index per texel and
+// its palette.
+func textureSize(tex *studio.Texture) int {
+	return int(tex.Width)*int(tex.Height) + len(tex.Pallets)
+}
+
+func renderModeNames(flags uint32) string {
+	var names []string
+	for _, mode := range renderModes {
+		if flags&mode.flag != 0 {
+			names = append(names, mode.name)
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
+
+func activityName(activity uint32) string {
+	if activity == 0 {
+		return "-"
+	}
+	if int(activity) < len(studio.ActivityNames) {
+		return studio.ActivityNames[activity]
+	}
+	return fmt.Sprintf("ACT_%d", activity)
+}
+
+// WriteSummary writes a human readable summary of the model: counts of its
+// parts and tables of its body part models, textures and sequences.
+func WriteSummary(out io.Writer, mdl *studio.Mdl) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Model:\t%s\n", mdl.Header.Name)
+	fmt.Fprintf(w, "Bones:\t%d\n", len(mdl.Bones))
+	fmt.Fprintf(w, "Bone controllers:\t%d\n", len(mdl.BoneControllers))
+	fmt.Fprintf(w, "Hit boxes:\t%d\n", len(mdl.HitBoxes))
+	fmt.Fprintf(w, "Attachments:\t%d\n", len(mdl.Attachments))
+	fmt.Fprintf(w, "Skin families:\t%d\n", mdl.Header.SkinFamiliesNum)
+	if len(mdl.Sounds) > 0 || len(mdl.SoundGroups) > 0 {
+		fmt.Fprintf(w, "Sound tables:\t%d bytes, %d sound groups in %d bytes\n",
+			len(mdl.Sounds), mdl.Header.SoundGroupsNum, len(mdl.SoundGroups))
+	}
+	if len(mdl.Repairs) > 0 {
+		fmt.Fprintf(w, "Repairs:\t%d\n", len(mdl.Repairs))
+	}
+
+	var totalPolys, totalVerts int
+	fmt.Fprintf(w, "\nBODY PART\tMODEL\tPOLYGONS\tVERTICES\tNORMALS\tMESHES\n")
+	for _, bp := range mdl.BodyParts {
+		for _, m := range bp.Models {
+			var polys int
+			for _, me := range m.Meshes {
+				for _, tri := range me.Triangles {
+					polys += len(tri.Faces())
+				}
+			}
+			totalPolys += polys
+			totalVerts += len(m.Vertices)
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n",
+				bp.Name, m.Name, polys, len(m.Vertices), len(m.Normals), len(m.Meshes))
+		}
+	}
+	fmt.Fprintf(w, "total\t\t%d\t%d\n", totalPolys, totalVerts)
+
+	var totalSize int
+	fmt.Fprintf(w, "\nTEXTURE\tSIZE\tRENDER MODES\tMEMORY\n")
+	for _, tex := range mdl.Textures {
+		size := textureSize(tex)
+		totalSize += size
+		fmt.Fprintf(w, "%s\t%dx%d\t%s\t%d\n", tex.Name, tex.Width, tex.Height, renderModeNames(tex.Flags), size)
+	}
+	fmt.Fprintf(w, "total\t\t\t%d\n", totalSize)
+
+	fmt.Fprintf(w, "\nSEQUENCE\tFRAMES\tFPS\tDURATION\tLOOP\tACTIVITY\tEVENTS\n")
+	for _, seq := range mdl.Sequences {
+		var duration float32
+		if seq.FPS > 0 {
+			duration = float32(seq.FramesNum) / seq.FPS
+		}
+		loop := "no"
+		if seq.Flags&studio.StudioLooping != 0 {
+			loop = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%g\t%.2fs\t%s\t%s\t%d\n",
+			seq.Label, seq.FramesNum, seq.FPS, duration, loop, activityName(seq.Activity), len(seq.Events))
+	}
+
+	return w.Flush()
+}
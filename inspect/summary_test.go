@@ -0,0 +1,28 @@
+package inspect
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteSummary(t *testing.T) {
+	var out strings.Builder
+	if err := WriteSummary(&out, loadBox(t)); err != nil {
+		t.Fatal(err)
+	}
+	var rows []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		rows = append(rows, strings.Join(strings.Fields(line), " "))
+	}
+	summary := strings.Join(rows, "\n")
+	for _, want := range []string{
+		"Model: box.mdl\nBones: 2\nBone controllers: 1\nHit boxes: 2\nAttachments: 1\nSkin families: 1\n",
+		"\nbody box_ref 20 16 10 1\ntotal 20 16\n",
+		"\nbox.bmp 8x8 masked 832\ntotal 832\n",
+		"\nidle 1 10 0.10s yes ACT_IDLE 0\nwalk 5 10 0.50s yes ACT_WALK 1\nwave 4 15 0.27s no - 0\n",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package inspect
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// yamlEncoder writes the dump structures as block YAML, naming the fields
+// by their JSON keys. Lists of scalars are written in flow style.
+type yamlEncoder struct {
+	buf bytes.Buffer
+}
+
+func marshalYAML(v interface{}) []byte {
+	e := new(yamlEncoder)
+	e.writeStruct(reflect.Indirect(reflect.ValueOf(v)), "", "")
+	return e.buf.Bytes()
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func scalar(v reflect.Value) string {
+	if n, ok := v.Interface().(number); ok {
+		switch s := n.String(); s {
+		case "NaN":
+			return ".nan"
+		case "+Inf":
+			return ".inf"
+		case "-Inf":
+			return "-.inf"
+		default:
+			return s
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	default:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	}
+}
+
+// writeStruct writes the fields of a struct at indent, the first one after
+// first instead, which starts list items.
+func (e *yamlEncoder) writeStruct(v reflect.Value, indent, first string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if len(key) == 0 || key == "-" {
+			continue
+		}
+		if i == 0 {
+			e.buf.WriteString(first)
+		} else {
+			e.buf.WriteString(indent)
+		}
+		e.buf.WriteString(key + ":")
+		e.writeValue(v.Field(i), indent)
+	}
+}
+
+// writeValue writes a value following a key or a list item dash, nested
+// values going one level deeper than indent.
+func (e *yamlEncoder) writeValue(v reflect.Value, indent string) {
+	v = reflect.Indirect(v)
+	switch {
+	case isScalar(v.Type()):
+		e.buf.WriteString(" " + scalar(v) + "\n")
+
+	case v.Kind() == reflect.Struct:
+		e.buf.WriteString("\n")
+		e.writeStruct(v, indent+"  ", indent+"  ")
+
+	case v.Len() == 0:
+		e.buf.WriteString(" []\n")
+
+	case isScalar(v.Type().Elem()):
+		var items = make([]string, v.Len())
+		for i := range items {
+			items[i] = scalar(v.Index(i))
+		}
+		e.buf.WriteString(" [" + strings.Join(items, ", ") + "]\n")
+
+	default:
+		e.buf.WriteString("\n")
+		for i := 0; i < v.Len(); i++ {
+			item := reflect.Indirect(v.Index(i))
+			if item.Kind() == reflect.Struct {
+				e.writeStruct(item, indent+"    ", indent+"  - ")
+				continue
+			}
+			e.buf.WriteString(indent + "  -")
+			e.writeValue(item, indent+"  ")
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package studiotest builds studio models for the tests of this module.
+package studiotest
+
+import (
+	"math/rand"
+	"strconv"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// Options describe the model built by Model. Zero counts are taken as one.
+type Options struct {
+	Name        string
+	Bones       int     // a chain of bones
+	Angle       float32 // turns the bones, models built with other angles have other poses
+	Sequences   int
+	Frames      int
+	Blends      int
+	BodyParts   int
+	Vertices    int // of the model of every body part
+	Commands    int // strips and fans of every mesh
+	Textures    int // one mesh per texture
+	TextureSize int
+	Seed        int64 // random animations and vertices when not zero
+
+	// Extra adds the sections the compiler does not write: controllers, hit
+	// boxes, attachments, events, pivots, a second sequence group holding the
+	// last sequence, transitions, skin families, the Xash3D secondary header
+	// and sound tables.
+	Extra bool
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Model returns a weighted model with the counts of opts. Offsets and the
+// counts an encoder computes from the data are left zero.
+func Model(opts Options) *studio.Mdl {
+	var (
+		rnd         = rand.New(rand.NewSource(opts.Seed))
+		bonesNum    = atLeastOne(opts.Bones)
+		vertsNum    = atLeastOne(opts.Vertices)
+		texturesNum = atLeastOne(opts.Textures)
+		texSize     = atLeastOne(opts.TextureSize)
+	)
+	if len(opts.Name) == 0 {
+		opts.Name = "test"
+	}
+
+	mdl := new(studio.Mdl)
+	mdl.Header = &studio.StudioHdr{Ident: studio.MdlIdent, Version: studio.StudioVersion,
+		Flags: studio.StudioHasBoneInfo | studio.StudioHasBoneWeights}
+	mdl.Header.Name.FromString(opts.Name + ".mdl")
+
+	for i := 0; i < bonesNum; i++ {
+		b := &studio.StudioBone{Parent: int32(i - 1)}
+		b.Name.FromString(opts.Name + "_bone" + strconv.Itoa(i))
+		b.Value = [6]float32{float32(i), 2, 0, opts.Angle, 0, opts.Angle * float32(i)}
+		b.Scale = [6]float32{0.01, 0.01, 0.01, 0.001, 0.001, 0.001}
+		for j := range b.BoneControllers {
+			b.BoneControllers[j] = 0xffffffff
+		}
+		mdl.Bones = append(mdl.Bones, b)
+	}
+	for _, transform := range studio.CalcBoneTransforms(mdl.Bones) {
+		inv := studio.Matrix3x4Invert(transform)
+		bi := new(studio.StudioBoneInfo)
+		for j := 0; j < 3; j++ {
+			bi.PoseToBone[j] = studio.Vector4_32{X: float32(inv[j].X), Y: float32(inv[j].Y), Z: float32(inv[j].Z), W: float32(inv[j].W)}
+		}
+		mdl.BonesInfo = append(mdl.BonesInfo, bi)
+	}
+
+	for s := 0; s < atLeastOne(opts.Sequences); s++ {
+		mdl.Sequences = append(mdl.Sequences, sequence(&opts, rnd, s, bonesNum))
+	}
+
+	for p := 0; p < atLeastOne(opts.BodyParts); p++ {
+		bp := &studio.BodyPart{Models: []*studio.Model{model(&opts, rnd, p, bonesNum, vertsNum, texturesNum)}}
+		bp.Name.FromString("body" + strconv.Itoa(p))
+		bp.Base = 1
+		mdl.BodyParts = append(mdl.BodyParts, bp)
+	}
+
+	var skins = [][]uint16{make([]uint16, texturesNum)}
+	for k := 0; k < texturesNum; k++ {
+		tex := new(studio.Texture)
+		tex.Name.FromString(opts.Name + "_skin" + strconv.Itoa(k) + ".bmp")
+		tex.Width, tex.Height = uint32(texSize), uint32(texSize)
+		tex.Indices = make([]byte, texSize*texSize)
+		for i := range tex.Indices {
+			tex.Indices[i] = byte(i + k)
+		}
+		for i := range tex.Pallets {
+			tex.Pallets[i] = byte(i*7 + k)
+		}
+		mdl.Textures = append(mdl.Textures, tex)
+		skins[0][k] = uint16(k)
+	}
+	mdl.Skins = &skins
+
+	if opts.Extra {
+		addExtra(mdl, texturesNum)
+	}
+	return mdl
+}
+
+// sequence returns a sequence animating every channel of every bone with
+// runs of two frames.
+func sequence(opts *Options, rnd *rand.Rand, s, bonesNum int) *studio.Sequence {
+	seq := new(studio.Sequence)
+	seq.Label.FromString("seq" + strconv.Itoa(s))
+	seq.FPS = 30
+	seq.FramesNum = uint32(atLeastOne(opts.Frames))
+	seq.BlendsNum = uint32(atLeastOne(opts.Blends))
+	if seq.BlendsNum > 1 {
+		seq.BlendTypes[0], seq.BlendStart[0], seq.BlendEnd[0] = studio.StudioMotionXR, -45, 45
+	}
+	for k := 0; k < int(seq.BlendsNum)*bonesNum; k++ {
+		a := new(studio.Anim)
+		for c := range a.AnimValues {
+			for f := 0; f < int(seq.FramesNum); f += 2 {
+				value := int16((s + k + c + f) % 7)
+				if opts.Seed != 0 {
+					value = int16(rnd.Intn(100))
+				}
+				total := uint8(2)
+				if f+1 == int(seq.FramesNum) {
+					total = 1
+				}
+				a.AnimValues[c] = append(a.AnimValues[c], &studio.AnimValue{Valid: 1, Total: total, Values: []int16{value}})
+			}
+		}
+		seq.Anims = append(seq.Anims, a)
+	}
+	return seq
+}
+
+// model returns a model with a normal per vertex, every vertex weighted to
+// two bones, and a mesh per texture of alternating fans and strips.
+func model(opts *Options, rnd *rand.Rand, p, bonesNum, vertsNum, texturesNum int) *studio.Model {
+	m := new(studio.Model)
+	m.Name.FromString(opts.Name + "_ref" + strconv.Itoa(p))
+	for v := 0; v < vertsNum; v++ {
+		pos := studio.Vector3_32{X: float32(v), Y: float32(p + 1), Z: opts.Angle}
+		if opts.Seed != 0 {
+			pos = studio.Vector3_32{X: rnd.Float32(), Y: rnd.Float32(), Z: rnd.Float32()}
+		}
+		m.Vertices = append(m.Vertices, pos)
+		m.VerticesInfo = append(m.VerticesInfo, byte(v%bonesNum))
+		m.Normals = append(m.Normals, studio.Vector3_32{Z: 1})
+		m.NormalsInfo = append(m.NormalsInfo, byte(v%bonesNum))
+		w := studio.StudioBoneWeight{Weight: [4]uint8{200, 55, 0, 0}, Bone: [4]int8{int8(v % bonesNum), int8((v + 1) % bonesNum), -1, -1}}
+		if bonesNum == 1 {
+			w = studio.StudioBoneWeight{Weight: [4]uint8{255, 0, 0, 0}, Bone: [4]int8{0, -1, -1, -1}}
+		}
+		m.VerticesWeights = append(m.VerticesWeights, w)
+		m.NormalsWeights = append(m.NormalsWeights, w)
+	}
+
+	cmdVerts := 12
+	if vertsNum < cmdVerts {
+		cmdVerts = vertsNum
+	}
+	for k := 0; k < texturesNum; k++ {
+		me := new(studio.Mesh)
+		me.SkinRef = uint32(k)
+		if k == 0 {
+			me.NormalsNum = uint32(vertsNum)
+		}
+		for n := 0; n < atLeastOne(opts.Commands); n++ {
+			tri := &studio.Triangle{IsStrip: n%2 == 1}
+			for i := 0; i < cmdVerts; i++ {
+				v := uint16((n + i) % vertsNum)
+				if opts.Seed != 0 {
+					v = uint16(rnd.Intn(vertsNum))
+				}
+				tri.Vertices = append(tri.Vertices, &studio.StudioTriangle{VertexIndex: v, NormalIndex: v, S: int16(i), T: int16(n % 64)})
+			}
+			me.Triangles = append(me.Triangles, tri)
+		}
+		m.Meshes = append(m.Meshes, me)
+	}
+	return m
+}
+
+// addExtra fills the optional sections of a model.
+func addExtra(mdl *studio.Mdl, texturesNum int) {
+	hdr := mdl.Header
+	hdr.EyePosition = studio.Vector3_32{Z: 60}
+	hdr.Min, hdr.Max = studio.Vector3_32{X: -16, Y: -16}, studio.Vector3_32{X: 16, Y: 16, Z: 72}
+	hdr.BBMin, hdr.BBMax = studio.Vector3_32{X: -20, Y: -20, Z: -2}, studio.Vector3_32{X: 20, Y: 20, Z: 80}
+
+	last := len(mdl.Bones) - 1
+	mdl.BoneControllers = []*studio.StudioBoneController{{Bone: int32(last), Type: studio.StudioMotionXR, Start: -30, End: 30}}
+	mdl.Bones[last].BoneControllers[3] = 0
+	mdl.HitBoxes = []*studio.StudioHitBox{{Bone: uint32(last), Group: 1,
+		BBMin: studio.Vector3_32{X: -1, Y: -1, Z: -1}, BBMax: studio.Vector3_32{X: 1, Y: 1, Z: 1}}}
+	attachment := &studio.StudioAttachment{Bone: uint32(last), Origins: studio.Vector3_32{X: 1, Y: 2, Z: 3}}
+	attachment.Name.FromString("hand")
+	mdl.Attachments = []*studio.StudioAttachment{attachment}
+
+	for i, seq := range mdl.Sequences {
+		ev := &studio.StudioEvent{Frame: 0, Event: 5001}
+		ev.Options.FromString(strconv.Itoa(10 + i))
+		seq.Events = []*studio.StudioEvent{ev}
+		seq.Pivots = []*studio.StudioPivot{{Org: studio.Vector3_32{X: float32(i)}, Start: 0, End: int32(seq.FramesNum - 1)}}
+		seq.LinerMovement = studio.Vector3_32{X: float32(i * 10)}
+		seq.EntryNode, seq.ExitNode = int32(i%2+1), int32((i+1)%2+1)
+	}
+	name := mdl.Header.Name.String()
+	def, group := new(studio.StudioSeqGroup), new(studio.StudioSeqGroup)
+	def.Label.FromString("default")
+	group.Label.FromString("anims")
+	group.Name.FromString(name[:len(name)-len(".mdl")] + "01.mdl")
+	mdl.SeqGroups = []*studio.StudioSeqGroup{def, group}
+	mdl.Sequences[len(mdl.Sequences)-1].SeqGroup = 1
+	mdl.Transitions = studio.BuildTransitions(mdl.Sequences)
+
+	var families = make([][]uint16, 2)
+	for k := 0; k < texturesNum; k++ {
+		families[0] = append(families[0], uint16(k))
+		families[1] = append(families[1], uint16(texturesNum-1-k))
+	}
+	mdl.Skins = &families
+
+	mdl.Header2 = new(studio.StudioHdr2)
+	pp := &studio.StudioPoseParam{Start: -45, End: 45}
+	pp.Name.FromString("aim")
+	mdl.PoseParams = []*studio.StudioPoseParam{pp}
+	mdl.KeyValues = "{\n\"mass\" \"10\"\n}"
+	set := &studio.HitBoxSet{HitBoxes: []*studio.StudioHitBox{{Bone: 0, BBMax: studio.Vector3_32{X: 2, Y: 2, Z: 2}}}}
+	set.Name.FromString("default")
+	mdl.HitBoxSets = []*studio.HitBoxSet{set}
+
+	mdl.Sounds = []byte("sounds/step1.wav\x00\x00\x00\x00")
+	mdl.Header.SoundGroupsNum = 1
+	mdl.SoundGroups = []byte("group\x00\x00\x00")
+}
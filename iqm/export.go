@@ -0,0 +1,237 @@
+package iqm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// pose is a joint transform: a translation followed by a rotation
+// quaternion.
+type pose [7]float32
+
+type joint struct {
+	name   string
+	parent int
+	pose   pose
+}
+
+type vertex struct {
+	position [3]float32
+	normal   [3]float32
+	texCoord [2]float32
+	bones    [4]uint8
+	weights  [4]uint8
+}
+
+type mesh struct {
+	name      string
+	material  string
+	vertices  []*vertex
+	triangles [][3]uint32 // wound counterclockwise
+}
+
+type animation struct {
+	name   string
+	fps    float32
+	loop   bool
+	frames [][]pose
+}
+
+// model is the part of a studio model both IQE and IQM can hold.
+type model struct {
+	joints     []*joint
+	meshes     []*mesh
+	animations []*animation
+}
+
+// Save writes the model to path as a binary .iqm file or, for any other
+// extension, as an .iqe text file.
+func Save(path string, mdl *studio.Mdl) error {
+	return SaveLog(path, mdl, os.Stdout)
+}
+
+// SaveLog is Save printing the written file to log instead of the standard
+// output.
+func SaveLog(path string, mdl *studio.Mdl, log io.Writer) error {
+	data, format := build(mdl).encodeIQE(), "IQE"
+	if strings.EqualFold(filepath.Ext(path), ".iqm") {
+		data, format = build(mdl).encodeIQM(), "IQM"
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(log, "%s: %s\n", format, filepath.Base(path))
+	return nil
+}
+
+// EncodeIQM returns the model as a binary IQM file.
+func EncodeIQM(mdl *studio.Mdl) []byte {
+	return build(mdl).encodeIQM()
+}
+
+// EncodeIQE returns the model as an IQE text file.
+func EncodeIQE(mdl *studio.Mdl) []byte {
+	return build(mdl).encodeIQE()
+}
+
+// build converts the bones to joints, the meshes of every body part model
+// in the default pose and every sequence blend.
+func build(mdl *studio.Mdl) *model {
+	m := new(model)
+	for _, bone := range mdl.Bones {
+		parent := int(bone.Parent)
+		if parent >= len(m.joints) {
+			parent = -1
+		}
+		m.joints = append(m.joints, &joint{
+			name:   bone.Name.String(),
+			parent: parent,
+			pose: makePose(float64(bone.Value[0]), float64(bone.Value[1]), float64(bone.Value[2]),
+				float64(bone.Value[3]), float64(bone.Value[4]), float64(bone.Value[5])),
+		})
+	}
+
+	transforms := studio.CalcBoneTransforms(mdl.Bones)
+	var skinTransforms []*studio.Matrix3x4
+	if mdl.Header.Flags&studio.StudioHasBoneWeights != 0 {
+		skinTransforms = studio.CalcSkinTransforms(transforms, mdl.BonesInfo)
+	}
+
+	for _, bp := range mdl.BodyParts {
+		for _, sm := range bp.Models {
+			if sm.Name.String() == "blank" {
+				continue
+			}
+			for _, me := range sm.Meshes {
+				if int(me.SkinRef) >= len(mdl.Textures) {
+					continue
+				}
+				if mesh := buildMesh(sm, me, mdl.Textures[me.SkinRef], transforms, skinTransforms); len(mesh.triangles) > 0 {
+					m.meshes = append(m.meshes, mesh)
+				}
+			}
+		}
+	}
+
+	for _, seq := range mdl.Sequences {
+		for i := 0; i < int(seq.BlendsNum); i++ {
+			if anim := buildAnimation(mdl, seq, i); anim != nil {
+				m.animations = append(m.animations, anim)
+			}
+		}
+	}
+	return m
+}
+
+type vertexKey struct {
+	vertex, normal uint16
+	s, t           int16
+}
+
+func buildMesh(sm *studio.Model, me *studio.Mesh, tex *studio.Texture, transforms, skinTransforms []*studio.Matrix3x4) *mesh {
+	var (
+		m       = &mesh{name: strings.TrimSuffix(sm.Name.String(), ".smd"), material: tex.Name.String()}
+		indexOf = make(map[vertexKey]uint32)
+	)
+
+	for _, tri := range me.Triangles {
+		for _, face := range tri.Faces() {
+			var triangle [3]uint32
+			for i, vert := range face {
+				key := vertexKey{vert.VertexIndex, vert.NormalIndex, vert.S, vert.T}
+				index, ok := indexOf[key]
+				if !ok {
+					index = uint32(len(m.vertices))
+					indexOf[key] = index
+					m.vertices = append(m.vertices, makeVertex(sm, tex, vert, transforms, skinTransforms))
+				}
+				triangle[i] = index
+			}
+			m.triangles = append(m.triangles, triangle)
+		}
+	}
+	return m
+}
+
+func makeVertex(sm *studio.Model, tex *studio.Texture, vert *studio.StudioTriangle, transforms, skinTransforms []*studio.Matrix3x4) *vertex {
+	var (
+		v    = new(vertex)
+		bone = sm.VerticesInfo[vert.VertexIndex]
+		mat  = studio.VertexMatrix(bone, sm.VerticesWeights, int(vert.VertexIndex), transforms, skinTransforms)
+	)
+	if skinTransforms != nil && int(vert.VertexIndex) < len(sm.VerticesWeights) {
+		v.bones, v.weights = blendWeights(&sm.VerticesWeights[vert.VertexIndex])
+	} else {
+		v.bones[0], v.weights[0] = bone, 255
+	}
+
+	pos := studio.Matrix3x4VectorTransform(mat, &sm.Vertices[vert.VertexIndex])
+	norm := studio.Matrix3x4VectorRotate(mat, &sm.Normals[vert.NormalIndex])
+	norm.Normalize()
+	u, t := tex.TexCoords(vert)
+
+	v.position = [3]float32{pos.X, pos.Y, pos.Z}
+	v.normal = [3]float32{norm.X, norm.Y, norm.Z}
+	v.texCoord = [2]float32{u, 1 - t}
+	return v
+}
+
+// blendWeights scales the normalized weights of a vertex to a sum of 255,
+// the rounding going to the first bone.
+func blendWeights(boneWeights *studio.StudioBoneWeight) ([4]uint8, [4]uint8) {
+	var (
+		weights [4]uint8
+		total   int
+	)
+	bones, normalized, count := studio.NormalizedWeights(boneWeights)
+	for i := 1; i < count; i++ {
+		weights[i] = uint8(normalized[i] * 255)
+		total += int(weights[i])
+	}
+	weights[0] = uint8(255 - total)
+	return bones, weights
+}
+
+func buildAnimation(mdl *studio.Mdl, seq *studio.Sequence, blend int) *animation {
+	bonesNum := len(mdl.Bones)
+	if seq.FramesNum == 0 || bonesNum == 0 || len(seq.Anims) < (blend+1)*bonesNum {
+		return nil
+	}
+
+	anim := &animation{
+		name: seq.Label.String(),
+		fps:  seq.FPS,
+		loop: seq.Flags&studio.StudioLooping != 0,
+	}
+	if seq.BlendsNum > 1 {
+		anim.name = fmt.Sprintf("%s_blend%d", anim.name, blend+1)
+	}
+
+	for frame := 0; frame < int(seq.FramesNum); frame++ {
+		var poses = make([]pose, bonesNum)
+		for i, motion := range studio.CalcSequencePose(seq, mdl.Bones, blend, frame) {
+			poses[i] = makePose(motion[0], motion[1], motion[2], motion[3], motion[4], motion[5])
+		}
+		anim.frames = append(anim.frames, poses)
+	}
+	return anim
+}
+
+func makePose(x, y, z, rx, ry, rz float64) pose {
+	q := studio.AngleQuaternion(&studio.Vector3_32{X: float32(rx), Y: float32(ry), Z: float32(rz)})
+	// IQM expects normalized quaternions with a non-negative w
+	if q.W < 0 {
+		q.X, q.Y, q.Z, q.W = -q.X, -q.Y, -q.Z, -q.W
+	}
+	l := math.Sqrt(q.X*q.X + q.Y*q.Y + q.Z*q.Z + q.W*q.W)
+	return pose{float32(x), float32(y), float32(z),
+		float32(q.X / l), float32(q.Y / l), float32(q.Z / l), float32(q.W / l)}
+}
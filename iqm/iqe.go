@@ -0,0 +1,62 @@
+package iqm
+
+import (
+	"bytes"
+	"fmt"
+)
+
+func writePose(buf *bytes.Buffer, p pose) {
+	buf.WriteString(fmt.Sprintf("pq %f %f %f %f %f %f %f\n", p[0], p[1], p[2], p[3], p[4], p[5], p[6]))
+}
+
+// encodeIQE writes the model in the Inter-Quake Export text format.
+func (m *model) encodeIQE() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Inter-Quake Export\n")
+
+	if len(m.joints) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, j := range m.joints {
+		buf.WriteString(fmt.Sprintf("joint \"%s\" %d\n", j.name, j.parent))
+		writePose(&buf, j.pose)
+	}
+
+	for _, me := range m.meshes {
+		buf.WriteString(fmt.Sprintf("\nmesh \"%s\"\n", me.name))
+		buf.WriteString(fmt.Sprintf("material \"%s\"\n", me.material))
+		for _, v := range me.vertices {
+			buf.WriteString(fmt.Sprintf("vp %f %f %f\n", v.position[0], v.position[1], v.position[2]))
+			buf.WriteString(fmt.Sprintf("vt %f %f\n", v.texCoord[0], v.texCoord[1]))
+			buf.WriteString(fmt.Sprintf("vn %f %f %f\n", v.normal[0], v.normal[1], v.normal[2]))
+			if len(m.joints) > 0 {
+				buf.WriteString("vb")
+				for i, w := range v.weights {
+					if w > 0 || i == 0 {
+						buf.WriteString(fmt.Sprintf(" %d %f", v.bones[i], float32(w)/255.0))
+					}
+				}
+				buf.WriteString("\n")
+			}
+		}
+		for _, t := range me.triangles {
+			buf.WriteString(fmt.Sprintf("fm %d %d %d\n", t[0], t[1], t[2]))
+		}
+	}
+
+	for _, anim := range m.animations {
+		buf.WriteString(fmt.Sprintf("\nanimation \"%s\"\n", anim.name))
+		buf.WriteString(fmt.Sprintf("framerate %f\n", anim.fps))
+		if anim.loop {
+			buf.WriteString("loop\n")
+		}
+		for _, frame := range anim.frames {
+			buf.WriteString("frame\n")
+			for _, p := range frame {
+				writePose(&buf, p)
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
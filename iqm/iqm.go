@@ -0,0 +1,303 @@
+package iqm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+const iqmMagic = "INTERQUAKEMODEL\x00"
+const iqmVersion = 2
+
+// vertex array types
+const (
+	iqmPosition     = 0
+	iqmTexCoord     = 1
+	iqmNormal       = 2
+	iqmBlendIndexes = 4
+	iqmBlendWeights = 5
+)
+
+// vertex array formats
+const (
+	iqmUByte = 1
+	iqmFloat = 7
+)
+
+const iqmLoop = 1 << 0
+
+type iqmHeader struct {
+	Magic                                    [16]byte
+	Version, FileSize, Flags                 uint32
+	TextNum, TextOff                         uint32
+	MeshesNum, MeshesOff                     uint32
+	VertexArraysNum, VertexesNum             uint32
+	VertexArraysOff                          uint32
+	TrianglesNum, TrianglesOff, AdjacencyOff uint32
+	JointsNum, JointsOff                     uint32
+	PosesNum, PosesOff                       uint32
+	AnimsNum, AnimsOff                       uint32
+	FramesNum, FrameChannelsNum, FramesOff   uint32
+	BoundsOff                                uint32
+	CommentNum, CommentOff                   uint32
+	ExtensionsNum, ExtensionsOff             uint32
+}
+
+type iqmMesh struct {
+	Name, Material              uint32
+	FirstVertex, VertexesNum    uint32
+	FirstTriangle, TrianglesNum uint32
+}
+
+type iqmVertexArray struct {
+	Type, Flags, Format, Size, Offset uint32
+}
+
+type iqmJoint struct {
+	Name      uint32
+	Parent    int32
+	Translate [3]float32
+	Rotate    [4]float32
+	Scale     [3]float32
+}
+
+type iqmPose struct {
+	Parent        int32
+	ChannelMask   uint32
+	ChannelOffset [10]float32
+	ChannelScale  [10]float32
+}
+
+type iqmAnim struct {
+	Name                  uint32
+	FirstFrame, FramesNum uint32
+	FrameRate             float32
+	Flags                 uint32
+}
+
+// iqmText is the string table, starting with the empty string.
+type iqmText struct {
+	data    []byte
+	offsets map[string]uint32
+}
+
+func (t *iqmText) add(s string) uint32 {
+	if len(s) == 0 {
+		return 0
+	}
+	if off, ok := t.offsets[s]; ok {
+		return off
+	}
+	off := uint32(len(t.data))
+	t.data = append(append(t.data, s...), 0)
+	t.offsets[s] = off
+	return off
+}
+
+// channels returns the ten channels of a pose: translation, rotation and a
+// constant unit scale.
+func (p pose) channels() [10]float32 {
+	return [10]float32{p[0], p[1], p[2], p[3], p[4], p[5], p[6], 1, 1, 1}
+}
+
+// encodeIQM writes the model in the binary Inter-Quake Model format. IQM
+// triangles are wound clockwise.
+func (m *model) encodeIQM() []byte {
+	var (
+		hdr  iqmHeader
+		buf  bytes.Buffer
+		text = &iqmText{data: []byte{0}, offsets: make(map[string]uint32)}
+	)
+	copy(hdr.Magic[:], iqmMagic)
+	hdr.Version = iqmVersion
+
+	write := func(data interface{}) uint32 {
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+		off := uint32(buf.Len())
+		binary.Write(&buf, binary.LittleEndian, data)
+		return off
+	}
+	// room for the header, written last
+	write(&hdr)
+
+	var (
+		meshes    = make([]iqmMesh, len(m.meshes))
+		positions [][3]float32
+		texCoords [][2]float32
+		normals   [][3]float32
+		bones     [][4]uint8
+		weights   [][4]uint8
+		triangles [][3]uint32
+	)
+	for i, me := range m.meshes {
+		meshes[i] = iqmMesh{
+			Name:          text.add(me.name),
+			Material:      text.add(me.material),
+			FirstVertex:   uint32(len(positions)),
+			VertexesNum:   uint32(len(me.vertices)),
+			FirstTriangle: uint32(len(triangles)),
+			TrianglesNum:  uint32(len(me.triangles)),
+		}
+		for _, v := range me.vertices {
+			positions = append(positions, v.position)
+			texCoords = append(texCoords, v.texCoord)
+			normals = append(normals, v.normal)
+			bones = append(bones, v.bones)
+			weights = append(weights, v.weights)
+		}
+		first := meshes[i].FirstVertex
+		for _, t := range me.triangles {
+			triangles = append(triangles, [3]uint32{first + t[0], first + t[2], first + t[1]})
+		}
+	}
+
+	hdr.MeshesNum = uint32(len(meshes))
+	if len(meshes) > 0 {
+		hdr.MeshesOff = write(meshes)
+	}
+
+	if len(positions) > 0 {
+		arrays := []iqmVertexArray{
+			{Type: iqmPosition, Format: iqmFloat, Size: 3},
+			{Type: iqmTexCoord, Format: iqmFloat, Size: 2},
+			{Type: iqmNormal, Format: iqmFloat, Size: 3},
+		}
+		if len(m.joints) > 0 {
+			arrays = append(arrays,
+				iqmVertexArray{Type: iqmBlendIndexes, Format: iqmUByte, Size: 4},
+				iqmVertexArray{Type: iqmBlendWeights, Format: iqmUByte, Size: 4})
+		}
+		hdr.VertexArraysNum = uint32(len(arrays))
+		hdr.VertexesNum = uint32(len(positions))
+		hdr.VertexArraysOff = write(arrays)
+
+		arrays[0].Offset = write(positions)
+		arrays[1].Offset = write(texCoords)
+		arrays[2].Offset = write(normals)
+		if len(m.joints) > 0 {
+			arrays[3].Offset = write(bones)
+			arrays[4].Offset = write(weights)
+		}
+		patch(buf.Bytes(), hdr.VertexArraysOff, arrays)
+
+		hdr.TrianglesNum = uint32(len(triangles))
+		hdr.TrianglesOff = write(triangles)
+	}
+
+	if len(m.joints) > 0 {
+		var joints = make([]iqmJoint, len(m.joints))
+		for i, j := range m.joints {
+			joints[i] = iqmJoint{
+				Name:      text.add(j.name),
+				Parent:    int32(j.parent),
+				Translate: [3]float32{j.pose[0], j.pose[1], j.pose[2]},
+				Rotate:    [4]float32{j.pose[3], j.pose[4], j.pose[5], j.pose[6]},
+				Scale:     [3]float32{1, 1, 1},
+			}
+		}
+		hdr.JointsNum = uint32(len(joints))
+		hdr.JointsOff = write(joints)
+	}
+
+	if len(m.animations) > 0 && len(m.joints) > 0 {
+		poses, frames, channelsNum := m.encodeFrames()
+		var anims = make([]iqmAnim, len(m.animations))
+		var firstFrame uint32
+		for i, anim := range m.animations {
+			anims[i] = iqmAnim{
+				Name:       text.add(anim.name),
+				FirstFrame: firstFrame,
+				FramesNum:  uint32(len(anim.frames)),
+				FrameRate:  anim.fps,
+			}
+			if anim.loop {
+				anims[i].Flags = iqmLoop
+			}
+			firstFrame += uint32(len(anim.frames))
+		}
+
+		hdr.PosesNum = uint32(len(poses))
+		hdr.PosesOff = write(poses)
+		hdr.AnimsNum = uint32(len(anims))
+		hdr.AnimsOff = write(anims)
+		hdr.FramesNum = firstFrame
+		hdr.FrameChannelsNum = channelsNum
+		hdr.FramesOff = write(frames)
+	}
+
+	hdr.TextNum = uint32(len(text.data))
+	hdr.TextOff = write(text.data)
+
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	hdr.FileSize = uint32(buf.Len())
+	patch(buf.Bytes(), 0, &hdr)
+	return buf.Bytes()
+}
+
+// encodeFrames quantizes the animated channels of every joint over all
+// frames of all animations to 16 bits.
+func (m *model) encodeFrames() ([]iqmPose, []uint16, uint32) {
+	var (
+		poses       = make([]iqmPose, len(m.joints))
+		channelsNum uint32
+	)
+
+	for i, j := range m.joints {
+		p := &poses[i]
+		p.Parent = int32(j.parent)
+
+		var min, max [10]float32
+		first := true
+		for _, anim := range m.animations {
+			for _, frame := range anim.frames {
+				ch := frame[i].channels()
+				for c := range ch {
+					if first || ch[c] < min[c] {
+						min[c] = ch[c]
+					}
+					if first || ch[c] > max[c] {
+						max[c] = ch[c]
+					}
+				}
+				first = false
+			}
+		}
+
+		for c := 0; c < 10; c++ {
+			p.ChannelOffset[c] = min[c]
+			if max[c]-min[c] > 1e-6 {
+				p.ChannelMask |= 1 << uint(c)
+				p.ChannelScale[c] = (max[c] - min[c]) / 65535
+				channelsNum++
+			}
+		}
+	}
+
+	var frames []uint16
+	for _, anim := range m.animations {
+		for _, frame := range anim.frames {
+			for i := range m.joints {
+				p := &poses[i]
+				ch := frame[i].channels()
+				for c := 0; c < 10; c++ {
+					if p.ChannelMask&(1<<uint(c)) == 0 {
+						continue
+					}
+					v := math.Round(float64((ch[c] - p.ChannelOffset[c]) / p.ChannelScale[c]))
+					frames = append(frames, uint16(math.Max(0, math.Min(65535, v))))
+				}
+			}
+		}
+	}
+	return poses, frames, channelsNum
+}
+
+func patch(data []byte, off uint32, value interface{}) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, value)
+	copy(data[off:], buf.Bytes())
+}
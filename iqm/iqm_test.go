@@ -0,0 +1,157 @@
+package iqm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+func loadBox(t *testing.T) *studio.Mdl {
+	mdl, err := studio.Load(filepath.Join("..", "testdata", "box.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mdl
+}
+
+// readArray decodes count values at off, failing when they are not all in
+// data.
+func readArray(t *testing.T, data []byte, off, count uint32, values interface{}) {
+	size := uint32(binary.Size(values))
+	if off+size > uint32(len(data)) {
+		t.Fatalf("%d values at %d are outside of the %d bytes file", count, off, len(data))
+	}
+	if err := binary.Read(bytes.NewReader(data[off:]), binary.LittleEndian, values); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func text(data []byte, hdr *iqmHeader, off uint32) string {
+	s := data[hdr.TextOff+off:]
+	return string(s[:bytes.IndexByte(s, 0)])
+}
+
+func TestEncodeIQM(t *testing.T) {
+	mdl := loadBox(t)
+	data := EncodeIQM(mdl)
+
+	hdr := new(iqmHeader)
+	readArray(t, data, 0, 1, hdr)
+	if string(hdr.Magic[:]) != iqmMagic || hdr.Version != iqmVersion || int(hdr.FileSize) != len(data) {
+		t.Fatalf("header %+v of a %d bytes file", *hdr, len(data))
+	}
+	if hdr.TextOff+hdr.TextNum > hdr.FileSize || data[hdr.TextOff+hdr.TextNum-1] != 0 {
+		t.Fatal("the text table is not terminated inside the file")
+	}
+
+	joints := make([]iqmJoint, hdr.JointsNum)
+	readArray(t, data, hdr.JointsOff, hdr.JointsNum, joints)
+	if len(joints) != len(mdl.Bones) {
+		t.Fatalf("%d joints, want %d", len(joints), len(mdl.Bones))
+	}
+	for i, j := range joints {
+		if name := text(data, hdr, j.Name); name != mdl.Bones[i].Name.String() || j.Parent != mdl.Bones[i].Parent {
+			t.Errorf("joint %d: %s parent %d, want %s parent %d", i, name, j.Parent, mdl.Bones[i].Name, mdl.Bones[i].Parent)
+		}
+	}
+
+	arrays := make([]iqmVertexArray, hdr.VertexArraysNum)
+	readArray(t, data, hdr.VertexArraysOff, hdr.VertexArraysNum, arrays)
+	formatSizes := map[uint32]uint32{iqmUByte: 1, iqmFloat: 4}
+	for _, va := range arrays {
+		if va.Offset+va.Size*formatSizes[va.Format]*hdr.VertexesNum > hdr.FileSize {
+			t.Errorf("vertex array %+v is outside of the file", va)
+		}
+	}
+
+	meshes := make([]iqmMesh, hdr.MeshesNum)
+	readArray(t, data, hdr.MeshesOff, hdr.MeshesNum, meshes)
+	triangles := make([][3]uint32, hdr.TrianglesNum)
+	readArray(t, data, hdr.TrianglesOff, hdr.TrianglesNum, triangles)
+	if len(meshes) == 0 {
+		t.Fatal("no meshes")
+	}
+	for i, me := range meshes {
+		if me.FirstVertex+me.VertexesNum > hdr.VertexesNum || me.FirstTriangle+me.TrianglesNum > hdr.TrianglesNum {
+			t.Errorf("mesh %d %+v is outside of the %d vertices and %d triangles", i, me, hdr.VertexesNum, hdr.TrianglesNum)
+			continue
+		}
+		for _, tri := range triangles[me.FirstTriangle : me.FirstTriangle+me.TrianglesNum] {
+			for _, v := range tri {
+				if v < me.FirstVertex || v >= me.FirstVertex+me.VertexesNum {
+					t.Errorf("mesh %d: triangle %v uses a vertex of another mesh", i, tri)
+				}
+			}
+		}
+	}
+
+	anims := make([]iqmAnim, hdr.AnimsNum)
+	readArray(t, data, hdr.AnimsOff, hdr.AnimsNum, anims)
+	if len(anims) != len(mdl.Sequences) || hdr.PosesNum != hdr.JointsNum {
+		t.Fatalf("%d animations of %d poses, want %d of %d", len(anims), hdr.PosesNum, len(mdl.Sequences), hdr.JointsNum)
+	}
+	for i, a := range anims {
+		seq := mdl.Sequences[i]
+		if name := text(data, hdr, a.Name); name != seq.Label.String() || a.FramesNum != seq.FramesNum ||
+			a.FirstFrame+a.FramesNum > hdr.FramesNum {
+			t.Errorf("animation %d: %s frames %d..%d, want %s with %d of %d", i, name, a.FirstFrame,
+				a.FirstFrame+a.FramesNum, seq.Label, seq.FramesNum, hdr.FramesNum)
+		}
+	}
+	if hdr.FramesOff+hdr.FramesNum*hdr.FrameChannelsNum*2 > hdr.FileSize {
+		t.Error("the frames are outside of the file")
+	}
+}
+
+func TestEncodeIQE(t *testing.T) {
+	mdl := loadBox(t)
+	var (
+		joints, meshes, vertices int
+		frames                   []int
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(EncodeIQE(mdl)))
+	if !scanner.Scan() || scanner.Text() != "# Inter-Quake Export" {
+		t.Fatalf("first line %q", scanner.Text())
+	}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "joint":
+			joints++
+		case "mesh":
+			meshes++
+			vertices = 0
+		case "vp":
+			vertices++
+		case "fm":
+			for _, s := range fields[1:] {
+				if v, err := strconv.Atoi(s); err != nil || v < 0 || v >= vertices {
+					t.Errorf("mesh %d: face %q, with %d vertices", meshes, scanner.Text(), vertices)
+				}
+			}
+		case "animation":
+			frames = append(frames, 0)
+		case "frame":
+			frames[len(frames)-1]++
+		}
+	}
+
+	if joints != len(mdl.Bones) || meshes == 0 || len(frames) != len(mdl.Sequences) {
+		t.Fatalf("%d joints, %d meshes and %d animations, want %d, some and %d",
+			joints, meshes, len(frames), len(mdl.Bones), len(mdl.Sequences))
+	}
+	for i, n := range frames {
+		if n != int(mdl.Sequences[i].FramesNum) {
+			t.Errorf("animation %d: %d frames, want %d", i, n, mdl.Sequences[i].FramesNum)
+		}
+	}
+}
@@ -1,284 +1,307 @@
 package main
 
 import (
-	"encoding/binary"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
-	"sync"
+
+	"github.com/Psycrow101/mdldec-golang/inspect"
+	"github.com/Psycrow101/mdldec-golang/studio"
+	"github.com/Psycrow101/mdldec-golang/studiomdl"
+	"github.com/Psycrow101/mdldec-golang/texture"
 )
 
-func isValidName(name string) bool {
-	return checkReg(name, `^[\w\-.][\w\-. ]*$`)
-}
+// exit codes
+const (
+	exitOK      = 0
+	exitFailure = 1 // an error was printed
+	exitUsage   = 2 // invalid command line
+)
 
-func checkReg(str, pattern string) bool {
-	if matched, err := regexp.Match(pattern, []byte(str)); matched && err == nil {
-		return true
-	}
-	return false
+var appName = filepath.Base(os.Args[0])
+
+func showHelp(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s [command] [options] arguments\n", appName)
+	fmt.Fprintln(w, "commands:")
+	fmt.Fprintln(w, "  decompile  source_file [target_directory]       decompile a model, the default command")
+	fmt.Fprintln(w, "  batch      source_directory [target_directory]  decompile every model of a directory tree")
+	fmt.Fprintln(w, "  compile    qc_file [target_file]                compile a QC script into a model")
+	fmt.Fprintln(w, "  textures   source_file [target_directory]       export the textures of a model")
+	fmt.Fprintln(w, "  info       source_file                          print a summary of a model")
+	fmt.Fprintln(w, "  inspect    source_file [target_file]            dump the structure of a model as JSON or YAML")
+	fmt.Fprintln(w, "  validate   source_file...                       check that models decode")
+	fmt.Fprintf(w, "run \"%s command -h\" for the options of a command.\n", appName)
 }
 
-func fixNames(mdl *Mdl) {
-	var str string
-
-	texPattern := `(_texture)(\d+)(.bmp)`
-	modelPattern := `(_body)(\d+)(_)(\d+)`
-	seqPattern := `(_seq)(\d+)`
+func printBanner(w io.Writer) {
+	fmt.Fprintf(w, "\nHalf-Life Studio Model Decompiler %s on Go\n", studio.Version)
+	fmt.Fprintln(w, "--------------------------------------------------")
+}
 
-	var usedNames [3]map[string]bool
-	for i := 0; i < len(usedNames); i++ {
-		usedNames[i] = make(map[string]bool)
-	}
-	isNameUsed := func(name string, t int) bool {
-		if _, ok := usedNames[t][name]; ok {
-			return true
-		}
-		return false
+func printFooter(w io.Writer) int {
+	defer fmt.Fprintln(w, "--------------------------------------------------")
+	if n := errorsNum(); n > 0 {
+		fmt.Fprintf(w, "Failed with %d error(s).\n", n)
+		return exitFailure
 	}
+	fmt.Fprintln(w, "Done.")
+	return exitOK
+}
 
-	for i, tex := range mdl.Textures {
-		str = tex.Name.String()
-		if !isValidName(str) || checkReg(str, texPattern) || isNameUsed(str, 0) {
-			str = fmt.Sprintf("_texture%d.bmp", i+1)
-			tex.Name.FromString(str)
-			usedNames[0][str] = true
-		}
+// newFlagSet returns the flag set of a command, printing usage as its
+// synopsis followed by the options.
+func newFlagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s %s\n", appName, name, synopsis)
+		fmt.Fprintln(os.Stderr, "options:")
+		fs.PrintDefaults()
 	}
+	return fs
+}
 
-	for i, bp := range mdl.BodyParts {
-		str = bp.Name.String()
-		if !isValidName(str) {
-			str = fmt.Sprintf("_bodypart%d", i+1)
-			bp.Name.FromString(str)
+// parseArgs parses the options of a command, which may come before, between
+// or after its arguments, and returns the arguments.
+func parseArgs(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, bool) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, false
 		}
-		for j, m := range bp.Models {
-			str = m.Name.String()
-			if !isValidName(str) || checkReg(str, modelPattern) || isNameUsed(str, 1) {
-				str = fmt.Sprintf("_body%d_%d", i+1, j+1)
-				m.Name.FromString(str)
-				usedNames[1][str] = true
-			}
+		if fs.NArg() == 0 {
+			break
 		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
 	}
-
-	for i, seq := range mdl.Sequences {
-		str = seq.Label.String()
-		if !isValidName(str) || checkReg(str, seqPattern) || isNameUsed(str, 2) {
-			str = fmt.Sprintf("_seq%d", i+1)
-			seq.Label.FromString(str)
-			usedNames[2][str] = true
-		}
+	if len(positional) < minArgs || maxArgs >= 0 && len(positional) > maxArgs {
+		fs.Usage()
+		return nil, false
 	}
+	return positional, true
 }
 
-func loadSeqMDL(modelPath string, mdl *Mdl, seqGroupId uint32) error {
-	var (
-		err  error
-		file *os.File
-	)
-
-	file, err = os.Open(modelPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	studioHdr := new(StudioHdr)
-	err = binary.Read(file, binary.LittleEndian, studioHdr)
-	if err != nil {
-		return err
+// output returns where a command prints its lines: nowhere in quiet mode,
+// where only the errors are printed, on the standard error.
+func output(stdout io.Writer, quiet bool) io.Writer {
+	if quiet {
+		return ioutil.Discard
 	}
+	return stdout
+}
 
-	if studioHdr.Ident != SeqIdent {
-		return errors.New(fmt.Sprintf("%s is not a valid sequence file", modelPath))
+func loadModel(path string, recoverMode bool) (*studio.Mdl, error) {
+	if recoverMode {
+		return studio.Recover(path)
 	}
+	return studio.Load(path)
+}
 
-	for _, seq := range mdl.Sequences {
-		if seq.SeqGroup != seqGroupId || seq.Anims != nil {
-			continue
-		}
-		seq.SeqGroup = 0
-		if err = seq.readAnims(file, mdl.Header.BonesNum); err != nil {
-			return err
-		}
+// printWarnings lists what strict decoding dropped from a model.
+func printWarnings(w io.Writer, mdl *studio.Mdl) {
+	for _, r := range mdl.Warnings {
+		studio.Warnf(w, "%s", r)
 	}
+}
 
-	return nil
+// modelName returns the file name of a model without its extension, the
+// base name of the files exported from it.
+func modelName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
 }
 
-func loadMDL(modelPath string) (*Mdl, error) {
-	var (
-		err  error
-		file *os.File
-	)
+func defaultDestPath(sourcePath string) string {
+	return filepath.Join(filepath.Dir(sourcePath), "decomp_"+filepath.Base(sourcePath))
+}
 
-	ext := filepath.Ext(modelPath)
-	if len(ext) == 0 {
-		return nil, errors.New("source file does not have extension")
+func runCompile(args []string, stdout io.Writer) int {
+	fs := newFlagSet("compile", "[options] qc_file [target_file]")
+	quiet := fs.Bool("q", false, "print errors only")
+	files, ok := parseArgs(fs, args, 1, 2)
+	if !ok {
+		return exitUsage
 	}
+	out := output(stdout, *quiet)
 
-	if ext != ".mdl" {
-		return nil, errors.New("only .mdl-files is supported")
+	var outPath string
+	if len(files) > 1 {
+		outPath = files[1]
 	}
 
-	file, err = os.Open(modelPath)
+	printBanner(out)
+	warnings, err := studiomdl.CompileFile(files[0], outPath, out)
 	if err != nil {
-		return nil, err
+		printError(err)
 	}
-	defer file.Close()
-
-	studioHdr := new(StudioHdr)
-	err = binary.Read(file, binary.LittleEndian, studioHdr)
-	if err != nil {
-		return nil, err
+	for _, w := range warnings {
+		studio.Warnf(out, "%s", w)
 	}
+	return printFooter(out)
+}
 
-	if studioHdr.Ident != MdlIdent {
-		if studioHdr.Ident == SeqIdent {
-			return nil, errors.New(fmt.Sprintf("%s is not a main HL model file", modelPath))
-		} else {
-			return nil, errors.New(fmt.Sprintf("%s is not a valid HL model file", modelPath))
-		}
+func runTextures(args []string, stdout io.Writer) int {
+	fs := newFlagSet("textures", "[options] source_file [target_directory]")
+	recoverMode := fs.Bool("recover", false, "repair damaged sections instead of failing")
+	quiet := fs.Bool("q", false, "print errors only")
+	files, ok := parseArgs(fs, args, 1, 2)
+	if !ok {
+		return exitUsage
 	}
+	out := output(stdout, *quiet)
 
-	if studioHdr.Version != StudioVersion {
-		return nil, errors.New(fmt.Sprintf("%s has unknown Studio MDL format version", modelPath))
+	destPath := filepath.Join(defaultDestPath(files[0]), "textures")
+	if len(files) > 1 {
+		destPath = files[1]
 	}
 
-	mdl := new(Mdl)
-	mdl.Header = studioHdr
-	mdl.FilePath = modelPath
-
-	if err = mdl.ReadBones(file); err != nil {
-		return nil, err
+	printBanner(out)
+	mdl, err := loadModel(files[0], *recoverMode)
+	if err == nil {
+		printWarnings(out, mdl)
+		err = os.MkdirAll(destPath, 0744)
 	}
-	if err = mdl.ReadBoneControllers(file); err != nil {
-		return nil, err
+	if err == nil {
+		err = texture.Save(destPath, mdl)
 	}
-	if err = mdl.ReadHitBoxes(file); err != nil {
-		return nil, err
+	if err != nil {
+		printError(err)
 	}
-	if err = mdl.ReadSequences(file); err != nil {
-		return nil, err
+	return printFooter(out)
+}
+
+func runInfo(args []string, stdout io.Writer) int {
+	fs := newFlagSet("info", "[options] source_file")
+	recoverMode := fs.Bool("recover", false, "repair damaged sections instead of failing")
+	files, ok := parseArgs(fs, args, 1, 1)
+	if !ok {
+		return exitUsage
 	}
-	if err = mdl.ReadBodyParts(file); err != nil {
-		return nil, err
+
+	mdl, err := loadModel(files[0], *recoverMode)
+	if err == nil {
+		printWarnings(os.Stderr, mdl)
+		err = inspect.WriteSummary(stdout, mdl)
 	}
-	if err = mdl.ReadAttachments(file); err != nil {
-		return nil, err
+	if err != nil {
+		printError(err)
+		return exitFailure
 	}
-	if err = mdl.ReadTextures(file); err != nil {
-		return nil, err
+	return exitOK
+}
+
+// runInspect dumps the structure of a model to the target file or to the
+// standard output, which then holds nothing else.
+func runInspect(args []string, stdout io.Writer) int {
+	fs := newFlagSet("inspect", "[options] source_file [target_file]")
+	recoverMode := fs.Bool("recover", false, "repair damaged sections instead of failing")
+	yaml := fs.Bool("yaml", false, "write YAML instead of JSON, the default for .yaml and .yml targets")
+	files, ok := parseArgs(fs, args, 1, 2)
+	if !ok {
+		return exitUsage
 	}
-	if err = mdl.ReadSkins(file); err != nil {
-		return nil, err
+
+	mdl, err := loadModel(files[0], *recoverMode)
+	if err != nil {
+		printError(err)
+		return exitFailure
 	}
+	printWarnings(os.Stderr, mdl)
 
-	if studioHdr.TexturesNum == 0 {
-		mdlTPath := strings.TrimSuffix(modelPath, ".mdl") + "T.mdl"
-		var mdlT *Mdl
-		mdlT, err = loadMDL(mdlTPath)
-		if err != nil {
-			return nil, err
+	encode := inspect.EncodeJSON
+	if *yaml || len(files) > 1 && inspect.IsYAML(files[1]) {
+		encode = inspect.EncodeYAML
+	}
+	data, err := encode(mdl)
+	if err == nil {
+		if len(files) > 1 {
+			err = ioutil.WriteFile(files[1], data, 0644)
 		} else {
-			mdl.Textures = mdlT.Textures
-			mdl.Skins = mdlT.Skins
+			_, err = stdout.Write(data)
 		}
 	}
-
-	if studioHdr.SequenceGroupsNum > 1 {
-		for i := 1; i < int(studioHdr.SequenceGroupsNum); i++ {
-			seqPath := strings.TrimSuffix(modelPath, ".mdl")
-			seqPath += fmt.Sprintf("%02d.mdl", i)
-			err = loadSeqMDL(seqPath, mdl, uint32(i))
-			if err != nil {
-				return nil, err
-			}
-		}
+	if err != nil {
+		printError(err)
+		return exitFailure
 	}
+	return exitOK
+}
 
-	if studioHdr.HitBoxesNum > MaxHitboxes {
-		fmt.Printf("[WARNING] Invalid hitboxes number (%d) \n", studioHdr.HitBoxesNum)
-		studioHdr.HitBoxesNum = 0
-	} else if studioHdr.HitBoxesOff+studioHdr.HitBoxesNum*68 > studioHdr.Length {
-		fmt.Printf("[WARNING] Invalid hitboxes offset (%d) \n", studioHdr.HitBoxesOff)
-		studioHdr.HitBoxesNum = 0
+// runValidate decodes every model strictly. The damaged parts of failing
+// models are listed in verbose mode.
+func runValidate(args []string, stdout io.Writer) int {
+	fs := newFlagSet("validate", "[options] source_file...")
+	quiet := fs.Bool("q", false, "print errors only")
+	verbose := fs.Bool("v", false, "list every damaged part of failing models")
+	files, ok := parseArgs(fs, args, 1, -1)
+	if !ok {
+		return exitUsage
 	}
+	out := output(stdout, *quiet)
 
-	fixNames(mdl)
-
-	return mdl, nil
-}
-
-func showHelp(appName string) {
-	fmt.Printf("usage: %s source_file\n", appName)
-	fmt.Printf("       %s source_file target_directory\n", appName)
+	printBanner(out)
+	for _, path := range files {
+		mdl, err := studio.Load(path)
+		if err != nil {
+			printError(err)
+			if *verbose {
+				if mdl, err := studio.Recover(path); err == nil {
+					for _, r := range mdl.Repairs {
+						fmt.Fprintf(out, "[REPAIR] %s\n", r)
+					}
+				}
+			}
+			continue
+		}
+		printWarnings(out, mdl)
+		fmt.Fprintf(out, "OK: %s\n", path)
+	}
+	return printFooter(out)
 }
 
-func main() {
-	fmt.Printf("\nHalf-Life Studio Model Decompiler %s on Go\n", appVersion)
-	fmt.Println("--------------------------------------------------")
-	defer fmt.Println("--------------------------------------------------")
-
-	args := os.Args
-	argsNum := len(args)
-	var destPath string
-
-	if argsNum == 1 {
-		showHelp(args[0])
-		return
-	} else if argsNum == 2 {
-		destPath = filepath.Join(filepath.Dir(args[1]), "decomp_"+filepath.Base(args[1]))
-	} else {
-		destPath = args[2]
+// run runs the command of args, printing its lines to stdout.
+func run(args []string, stdout io.Writer) int {
+	resetErrors()
+	if len(args) == 0 {
+		showHelp(os.Stderr)
+		return exitUsage
 	}
 
-	if err := createDirectory(destPath); err != nil {
-		printError(err)
-		return
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		showHelp(stdout)
+		return exitOK
+	case "decompile":
+		return runDecompile(args[1:], stdout)
+	case "batch":
+		return runBatch(args[1:], stdout)
+	case "compile":
+		return runCompile(args[1:], stdout)
+	case "textures":
+		return runTextures(args[1:], stdout)
+	case "info":
+		return runInfo(args[1:], stdout)
+	case "inspect":
+		return runInspect(args[1:], stdout)
+	case "validate":
+		return runValidate(args[1:], stdout)
 	}
 
-	if mdl, err := loadMDL(args[1]); err != nil {
-		printError(err)
-	} else {
-		wg := &sync.WaitGroup{}
-		wg.Add(3)
-
-		go func() {
-			defer wg.Done()
-			qcFileName := filepath.Base(args[1])
-			qcFileName = qcFileName[:len(qcFileName)-3] + "qc"
-			if err = saveQCScript(filepath.Join(destPath, qcFileName), mdl); err != nil {
-				printError(err)
-			}
-		}()
-
-		go func() {
-			defer wg.Done()
-			if err = saveSMDs(destPath, mdl); err != nil {
-				printError(err)
-			}
-		}()
-
-		go func() {
-			defer wg.Done()
-			texturesPath := filepath.Join(destPath, "textures")
-			if err := createDirectory(texturesPath); err != nil {
-				printError(err)
-				return
-			}
-			
-			if err = saveTextures(texturesPath, mdl); err != nil {
-				printError(err)
-			}
-		}()
-
-		wg.Wait()
+	// a model and options alone decompile it
+	if !strings.HasPrefix(args[0], "-") && filepath.Ext(args[0]) == "" {
+		if _, err := os.Stat(args[0]); os.IsNotExist(err) {
+			printError(errors.New(fmt.Sprintf("unknown command %q", args[0])))
+			showHelp(os.Stderr)
+			return exitUsage
+		}
 	}
+	return runDecompile(args, stdout)
+}
 
-	fmt.Println("Done.")
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout))
 }
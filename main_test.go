@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// writeDamaged writes box.mdl into dir with its attachment table moved past
+// the end of the file.
+func writeDamaged(t *testing.T, dir string) string {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "box.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hdr studio.StudioHdr
+	if err = binary.Read(bytes.NewReader(data), binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	hdr.AttachmentsOff = uint32(len(data) + 64)
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &hdr)
+	copy(data, buf.Bytes())
+
+	path := filepath.Join(dir, "damaged.mdl")
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mdldec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	box := filepath.Join("testdata", "box.mdl")
+	qc := filepath.Join("testdata", "src", "box.qc")
+	damaged := writeDamaged(t, dir)
+	missing := filepath.Join(dir, "missing.mdl")
+	out := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	tests := []struct {
+		args   []string
+		code   int
+		output []string // printed to stdout, in this order
+	}{
+		{nil, exitUsage, nil},
+		{[]string{"help"}, exitOK, []string{"usage: ", "commands:"}},
+		{[]string{"nosuchcommand"}, exitUsage, nil},
+
+		{[]string{"decompile"}, exitUsage, nil},
+		{[]string{"decompile", "-nosuchflag", box}, exitUsage, nil},
+		{[]string{"decompile", "-overwrite", "sometimes", box}, exitUsage, nil},
+		{[]string{"decompile", "-artifacts", "qc,nothing", box}, exitUsage, nil},
+		{[]string{"decompile", "-smd-workers", "0", box}, exitUsage, nil},
+		{[]string{"decompile", "-o", out("a"), box, out("b")}, exitUsage, nil},
+		{[]string{"decompile", box, out("box")}, exitOK, []string{"QC Script: box.qc", "Done."}},
+		{[]string{"decompile", missing, out("missing")}, exitFailure, []string{"Failed with 1 error(s)."}},
+		{[]string{"decompile", damaged, out("damaged")}, exitFailure, []string{"Failed with 1 error(s)."}},
+		{[]string{"decompile", "-recover", damaged, out("recovered")}, exitOK,
+			[]string{"[REPAIR] ", "attachment", "kept 0 of 1 elements", "Recovered with 1 repairs.", "Done."}},
+		{[]string{out("nomodel.mdl")}, exitFailure, []string{"Failed with 1 error(s)."}},
+
+		{[]string{"batch", "-j", "0", "testdata"}, exitUsage, nil},
+		{[]string{"batch", "-j", "many", "testdata"}, exitUsage, nil},
+		{[]string{"batch", "testdata", out("batch")}, exitOK, []string{"Done."}},
+
+		{[]string{"compile", "-x", qc}, exitUsage, nil},
+		{[]string{"compile", qc, out("box.mdl"), "extra"}, exitUsage, nil},
+		{[]string{"compile", qc, out("box.mdl")}, exitOK, []string{"Model: " + out("box.mdl"), "Done."}},
+		{[]string{"compile", missing}, exitFailure, []string{"Failed with 1 error(s)."}},
+
+		{[]string{"textures"}, exitUsage, nil},
+		{[]string{"textures", box, out("textures")}, exitOK, []string{"Done."}},
+
+		{[]string{"info", box, "extra"}, exitUsage, nil},
+		{[]string{"info", box}, exitOK, []string{"Model:", "box.mdl", "SEQUENCE"}},
+		{[]string{"info", missing}, exitFailure, nil},
+
+		{[]string{"inspect", "-yaml=maybe", box}, exitUsage, nil},
+		{[]string{"inspect", box}, exitOK, []string{"{\n", `"name": "box.mdl"`}},
+		{[]string{"inspect", "-yaml", box}, exitOK, []string{"schema: ", "name: \"box.mdl\""}},
+		{[]string{"inspect", damaged}, exitFailure, nil},
+
+		{[]string{"validate"}, exitUsage, nil},
+		{[]string{"validate", box}, exitOK, []string{"OK: " + box, "Done."}},
+		{[]string{"validate", "-v", box, damaged}, exitFailure,
+			[]string{"OK: " + box, "[REPAIR] ", "attachment", "Failed with 1 error(s)."}},
+		{[]string{"validate", "-q", damaged}, exitFailure, nil},
+	}
+
+	for _, test := range tests {
+		stdout := new(bytes.Buffer)
+		if code := run(test.args, stdout); code != test.code {
+			t.Errorf("%q: exit code %d, want %d", test.args, code, test.code)
+		}
+		rest := stdout.String()
+		for _, want := range test.output {
+			i := strings.Index(rest, want)
+			if i < 0 {
+				t.Errorf("%q: output %q does not print %q after the previous lines", test.args, stdout.String(), want)
+				break
+			}
+			rest = rest[i+len(want):]
+		}
+		if test.output == nil && test.code != exitOK && strings.Contains(stdout.String(), "Done.") {
+			t.Errorf("%q: output %q reports success", test.args, stdout.String())
+		}
+	}
+
+	if _, err := studio.Load(out("box.mdl")); err != nil {
+		t.Errorf("the compiled model does not load: %v", err)
+	}
+}
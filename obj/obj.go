@@ -0,0 +1,251 @@
+package obj
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// objWriter numbers the vertices written to an OBJ file, which are shared by
+// all of its groups.
+type objWriter struct {
+	writer        *bufio.Writer
+	vertsNum      int
+	normalsNum    int
+	texCoordIndex map[[2]float32]int
+}
+
+// pose returns the vertices and normals of a model in the default pose, in
+// the Y-up space most OBJ importers expect.
+func pose(m *studio.Model, transforms, skinTransforms []*studio.Matrix3x4) ([]*studio.Vector3_32, []*studio.Vector3_32) {
+	var (
+		verts   = make([]*studio.Vector3_32, len(m.Vertices))
+		normals = make([]*studio.Vector3_32, len(m.Normals))
+	)
+
+	for i := range m.Vertices {
+		v := studio.Matrix3x4VectorTransform(studio.VertexMatrix(m.VerticesInfo[i], m.VerticesWeights, i, transforms, skinTransforms), &m.Vertices[i])
+		verts[i] = &studio.Vector3_32{X: v.X, Y: v.Z, Z: -v.Y}
+	}
+	for i := range m.Normals {
+		n := studio.Matrix3x4VectorRotate(studio.VertexMatrix(m.NormalsInfo[i], m.NormalsWeights, i, transforms, skinTransforms), &m.Normals[i])
+		n.Normalize()
+		normals[i] = &studio.Vector3_32{X: n.X, Y: n.Z, Z: -n.Y}
+	}
+	return verts, normals
+}
+
+func (w *objWriter) writeModel(mdl *studio.Mdl, m *studio.Model, transforms, skinTransforms []*studio.Matrix3x4) {
+	verts, normals := pose(m, transforms, skinTransforms)
+
+	w.writer.WriteString(fmt.Sprintf("\ng %s\n", strings.TrimSuffix(m.Name.String(), ".smd")))
+	for _, v := range verts {
+		w.writer.WriteString(fmt.Sprintf("v %f %f %f\n", v.X, v.Y, v.Z))
+	}
+	for _, n := range normals {
+		w.writer.WriteString(fmt.Sprintf("vn %f %f %f\n", n.X, n.Y, n.Z))
+	}
+
+	for _, me := range m.Meshes {
+		if int(me.SkinRef) >= len(mdl.Textures) {
+			continue
+		}
+		texture := mdl.Textures[me.SkinRef]
+		w.writer.WriteString(fmt.Sprintf("usemtl %s\n", materialName(texture)))
+
+		for _, tri := range me.Triangles {
+			for _, face := range tri.Faces() {
+				var indices [3]int
+				for i, vert := range face {
+					indices[i] = w.texCoord(texture, vert)
+				}
+				w.writer.WriteString("f")
+				for i, vert := range face {
+					w.writer.WriteString(fmt.Sprintf(" %d/%d/%d",
+						w.vertsNum+int(vert.VertexIndex)+1, indices[i], w.normalsNum+int(vert.NormalIndex)+1))
+				}
+				w.writer.WriteString("\n")
+			}
+		}
+	}
+
+	w.vertsNum += len(verts)
+	w.normalsNum += len(normals)
+}
+
+// texCoord returns the index of the texture coordinates of a vertex, writing
+// them first if they are new.
+func (w *objWriter) texCoord(texture *studio.Texture, vert *studio.StudioTriangle) int {
+	u, v := texture.TexCoords(vert)
+	key := [2]float32{u, v}
+	if index, ok := w.texCoordIndex[key]; ok {
+		return index
+	}
+	w.writer.WriteString(fmt.Sprintf("vt %f %f\n", u, v))
+	w.texCoordIndex[key] = len(w.texCoordIndex) + 1
+	return len(w.texCoordIndex)
+}
+
+func materialName(texture *studio.Texture) string {
+	return strings.Replace(strings.TrimSuffix(texture.Name.String(), filepath.Ext(texture.Name.String())), " ", "_", -1)
+}
+
+func mtlName(mdl *studio.Mdl) string {
+	name := strings.TrimSuffix(filepath.Base(mdl.FilePath), filepath.Ext(mdl.FilePath))
+	if len(name) == 0 || name == "." {
+		name = "model"
+	}
+	return name + ".mtl"
+}
+
+// writeMaterials writes a material per texture, pointing to the BMP files
+// saved by the texture package into the textures subdirectory.
+func writeMaterials(writer *bufio.Writer, mdl *studio.Mdl) {
+	for _, tex := range mdl.Textures {
+		writer.WriteString(fmt.Sprintf("newmtl %s\n", materialName(tex)))
+		writer.WriteString("Ka 0.000000 0.000000 0.000000\n")
+		writer.WriteString("Kd 1.000000 1.000000 1.000000\n")
+		writer.WriteString("Ks 0.000000 0.000000 0.000000\n")
+		writer.WriteString("illum 1\n")
+		writer.WriteString(fmt.Sprintf("map_Kd textures/%s\n\n", tex.Name))
+	}
+}
+
+func createFile(filePath string, write func(writer *bufio.Writer)) error {
+	if err := os.RemoveAll(filePath); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	write(writer)
+	return writer.Flush()
+}
+
+// saveModels writes the given body part models to a single OBJ file using
+// the materials of the model.
+func saveModels(filePath string, mdl *studio.Mdl, models []*studio.Model) error {
+	transforms := studio.CalcBoneTransforms(mdl.Bones)
+	var skinTransforms []*studio.Matrix3x4
+	if mdl.Header.Flags&studio.StudioHasBoneWeights != 0 {
+		skinTransforms = studio.CalcSkinTransforms(transforms, mdl.BonesInfo)
+	}
+
+	return createFile(filePath, func(writer *bufio.Writer) {
+		w := &objWriter{writer: writer, texCoordIndex: make(map[[2]float32]int)}
+		writer.WriteString(fmt.Sprintf("# %s\n", mdl.Header.Name))
+		writer.WriteString(fmt.Sprintf("mtllib %s\n", mtlName(mdl)))
+		for _, m := range models {
+			w.writeModel(mdl, m, transforms, skinTransforms)
+		}
+	})
+}
+
+// SaveMaterials writes the MTL file shared by the OBJ files into destPath.
+func SaveMaterials(destPath string, mdl *studio.Mdl) error {
+	return createFile(filepath.Join(destPath, mtlName(mdl)), func(writer *bufio.Writer) {
+		writeMaterials(writer, mdl)
+	})
+}
+
+// SaveBodyParts writes one OBJ file per body part into destPath, holding
+// every model of the body part as a group, in the default pose.
+func SaveBodyParts(destPath string, mdl *studio.Mdl) error {
+	return saveBodyParts(destPath, mdl, os.Stdout)
+}
+
+func saveBodyParts(destPath string, mdl *studio.Mdl, log io.Writer) error {
+	var firstErr error
+	for _, bp := range mdl.BodyParts {
+		var models []*studio.Model
+		for _, m := range bp.Models {
+			if m.Name.String() != "blank" {
+				models = append(models, m)
+			}
+		}
+		if len(models) == 0 {
+			continue
+		}
+
+		objName := bp.Name.String() + ".obj"
+		if err := saveModels(filepath.Join(destPath, objName), mdl, models); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		fmt.Fprintf(log, "OBJ: %s\n", objName)
+	}
+	return firstErr
+}
+
+// BodyModels returns the model shown for every body part with the given
+// body value, as the engine picks them.
+func BodyModels(mdl *studio.Mdl, body int) ([]*studio.Model, error) {
+	var models []*studio.Model
+	for _, bp := range mdl.BodyParts {
+		if len(bp.Models) == 0 {
+			continue
+		}
+		base := int(bp.Base)
+		if base == 0 {
+			base = 1
+		}
+		index := (body / base) % len(bp.Models)
+		if index < 0 {
+			return nil, errors.New(fmt.Sprintf("invalid body value %d", body))
+		}
+		if m := bp.Models[index]; m.Name.String() != "blank" {
+			models = append(models, m)
+		}
+	}
+	return models, nil
+}
+
+// SaveBody writes the models shown with the given body value merged into a
+// single OBJ file at filePath, with its MTL file next to it.
+func SaveBody(filePath string, mdl *studio.Mdl, body int) error {
+	return SaveBodyLog(filePath, mdl, body, os.Stdout)
+}
+
+// SaveBodyLog is SaveBody printing the written file to log instead of the
+// standard output.
+func SaveBodyLog(filePath string, mdl *studio.Mdl, body int, log io.Writer) error {
+	models, err := BodyModels(mdl, body)
+	if err != nil {
+		return err
+	}
+	if err = SaveMaterials(filepath.Dir(filePath), mdl); err != nil {
+		return err
+	}
+	if err = saveModels(filePath, mdl, models); err != nil {
+		return err
+	}
+	fmt.Fprintf(log, "OBJ: %s\n", filepath.Base(filePath))
+	return nil
+}
+
+// Save writes the MTL file and one OBJ file per body part into destPath.
+func Save(destPath string, mdl *studio.Mdl) error {
+	return SaveLog(destPath, mdl, os.Stdout)
+}
+
+// SaveLog is Save printing the written files to log instead of the standard
+// output.
+func SaveLog(destPath string, mdl *studio.Mdl, log io.Writer) error {
+	if err := SaveMaterials(destPath, mdl); err != nil {
+		return err
+	}
+	return saveBodyParts(destPath, mdl, log)
+}
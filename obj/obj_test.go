@@ -0,0 +1,164 @@
+package obj
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// objCounts holds what an OBJ file declares.
+type objCounts struct {
+	vertices, normals, texCoords, faces int
+	groups, materials                   []string
+	mtllib                              string
+}
+
+// readOBJ reads an OBJ file and checks that its faces only refer to the
+// vertices, normals and texture coordinates declared before them.
+func readOBJ(t *testing.T, path string) *objCounts {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	c := new(objCounts)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "v":
+			c.vertices++
+		case "vn":
+			c.normals++
+		case "vt":
+			c.texCoords++
+		case "g":
+			c.groups = append(c.groups, fields[1])
+		case "usemtl":
+			c.materials = append(c.materials, fields[1])
+		case "mtllib":
+			c.mtllib = fields[1]
+		case "f":
+			c.faces++
+			if len(fields) != 4 {
+				t.Errorf("face %q is not a triangle", scanner.Text())
+			}
+			for _, vert := range fields[1:] {
+				indices := strings.Split(vert, "/")
+				limits := []int{c.vertices, c.texCoords, c.normals}
+				for i, s := range indices {
+					if n, err := strconv.Atoi(s); err != nil || n < 1 || n > limits[i] {
+						t.Errorf("face %q: index %q out of 1..%d", scanner.Text(), s, limits[i])
+					}
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSave(t *testing.T) {
+	mdl, err := studio.Load(filepath.Join("..", "testdata", "box.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := new(bytes.Buffer)
+	if err = SaveLog(dir, mdl, log); err != nil {
+		t.Fatal(err)
+	}
+	if log.String() != "OBJ: body.obj\n" {
+		t.Errorf("log %q", log.String())
+	}
+
+	mtl, err := ioutil.ReadFile(filepath.Join(dir, "box.mtl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := readOBJ(t, filepath.Join(dir, "body.obj"))
+	if c.mtllib != "box.mtl" {
+		t.Errorf("mtllib %q, want box.mtl", c.mtllib)
+	}
+	for _, name := range c.materials {
+		if !strings.Contains(string(mtl), "newmtl "+name+"\n") {
+			t.Errorf("material %s is not in box.mtl", name)
+		}
+	}
+
+	m := mdl.BodyParts[0].Models[0]
+	var faces int
+	for _, mesh := range m.Meshes {
+		for _, tri := range mesh.Triangles {
+			faces += len(tri.Faces())
+		}
+	}
+	if c.vertices != int(m.VertsNum) || c.normals != int(m.NormalsNum) || c.faces != faces {
+		t.Errorf("%d vertices, %d normals and %d faces, want %d, %d and %d",
+			c.vertices, c.normals, c.faces, m.VertsNum, m.NormalsNum, faces)
+	}
+	if len(c.groups) != 1 || c.groups[0] != strings.TrimSuffix(m.Name.String(), ".smd") {
+		t.Errorf("groups %q, want the model %s", c.groups, m.Name)
+	}
+}
+
+func TestBodyModels(t *testing.T) {
+	bodyPart := func(base uint32, names ...string) *studio.BodyPart {
+		bp := &studio.BodyPart{StudioBodyPart: studio.StudioBodyPart{Base: base}}
+		for _, name := range names {
+			m := new(studio.Model)
+			m.Name.FromString(name)
+			bp.Models = append(bp.Models, m)
+		}
+		return bp
+	}
+	mdl := &studio.Mdl{BodyParts: []*studio.BodyPart{
+		bodyPart(1, "head1", "head2"),
+		bodyPart(2, "blank", "hat1", "hat2"),
+	}}
+
+	tests := []struct {
+		body int
+		want string
+	}{
+		{0, "head1"},
+		{1, "head2"},
+		{2, "head1 hat1"},
+		{5, "head2 hat2"},
+		{6, "head1"},
+	}
+	for _, test := range tests {
+		models, err := BodyModels(mdl, test.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, m := range models {
+			names = append(names, m.Name.String())
+		}
+		if got := strings.Join(names, " "); got != test.want {
+			t.Errorf("body %d: models %q, want %q", test.body, got, test.want)
+		}
+	}
+	if _, err := BodyModels(mdl, -1); err == nil {
+		t.Error("no error for a negative body value")
+	}
+}
@@ -0,0 +1,977 @@
+package qc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+type Pos struct {
+	Line, Column int
+}
+
+type Error struct {
+	File string
+	Pos  Pos
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// Errors collects every diagnostic found while parsing a script.
+type Errors []*Error
+
+func (errs Errors) Error() string {
+	var sb strings.Builder
+	for i, e := range errs {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(e.Error())
+	}
+	return sb.String()
+}
+
+type Script struct {
+	FileName string
+
+	ModelName        string
+	Cd               string
+	CdTexture        string
+	Scale            float32
+	ClipToTextures   bool
+	ExternalTextures bool
+	Flags            uint32
+
+	BBox        [2]studio.Vector3_32
+	CBox        [2]studio.Vector3_32
+	EyePosition studio.Vector3_32
+
+	BodyGroups        []*BodyGroup
+	TexRenderModes    []*TexRenderMode
+	TextureGroups     []*TextureGroup
+	Attachments       []*Attachment
+	Pivots            []*PivotBone
+	Controllers       []*Controller
+	HitBoxes          []*HitBox
+	HitBoxSets        []*HitBoxSet
+	PoseParameters    []*PoseParameter
+	KeyValues         string
+	SequenceGroupSize int
+	SequenceGroups    []*SequenceGroup
+	Sequences         []*Sequence
+
+	// commands outside of the supported dialect, kept as is
+	Unknown  []*Command
+	Warnings Errors
+}
+
+type Command struct {
+	Pos  Pos
+	Name string
+	Args []string
+}
+
+type BodyGroup struct {
+	Pos    Pos
+	Name   string
+	Models []*BodyModel
+}
+
+type BodyModel struct {
+	Pos   Pos
+	Name  string
+	Blank bool
+}
+
+type TexRenderMode struct {
+	Pos     Pos
+	Texture string
+	Mode    string
+}
+
+type TextureGroup struct {
+	Pos      Pos
+	Name     string
+	Families [][]string
+}
+
+type Attachment struct {
+	Pos    Pos
+	Index  int
+	Bone   string
+	Origin studio.Vector3_32
+}
+
+// PivotBone is a $pivot declaration, naming the bone of a pivot the sequences
+// refer to by its index.
+type PivotBone struct {
+	Pos   Pos
+	Index int
+	Bone  string
+}
+
+type Controller struct {
+	Pos   Pos
+	Index int
+	Bone  string
+	Type  uint32
+	Start float32
+	End   float32
+}
+
+type HitBox struct {
+	Pos   Pos
+	Group int
+	Bone  string
+	BBMin studio.Vector3_32
+	BBMax studio.Vector3_32
+}
+
+// HitBoxSet is a named set of hit boxes of the Xash3D extension. Hit boxes
+// declared outside of any set belong to the default one.
+type HitBoxSet struct {
+	Pos      Pos
+	Name     string
+	HitBoxes []*HitBox
+}
+
+type PoseParameter struct {
+	Pos   Pos
+	Name  string
+	Start float32
+	End   float32
+	Loop  float32
+}
+
+// SequenceGroup is a group of demand loaded sequences stored in a file of its
+// own. Sequences declared before the first group belong to the default one.
+type SequenceGroup struct {
+	Pos   Pos
+	Label string
+}
+
+type Sequence struct {
+	Pos   Pos
+	Name  string
+	Group int // sequence group, 0 for the default group, n for SequenceGroups[n-1]
+	Files []string
+
+	FPS        float32
+	Loop       bool
+	MotionType uint32
+
+	Activity     int
+	ActivityName string
+	ActWeight    int
+
+	Blends []*Blend
+	Events []*Event
+	Pivots []*Pivot
+
+	EntryNode int32
+	ExitNode  int32
+	NodeFlags uint32
+}
+
+type Blend struct {
+	Pos   Pos
+	Type  uint32
+	Start float32
+	End   float32
+}
+
+type Pivot struct {
+	Pos   Pos
+	Index int
+	Start int
+	End   int
+}
+
+type Event struct {
+	Pos     Pos
+	Event   int32
+	Frame   int
+	Options string
+}
+
+type qcToken struct {
+	text   string
+	quoted bool
+	pos    Pos
+}
+
+func (tok *qcToken) is(text string) bool {
+	return !tok.quoted && strings.EqualFold(tok.text, text)
+}
+
+func tokenizeQC(data []byte, fileName string) ([]*qcToken, Errors) {
+	var (
+		tokens []*qcToken
+		errs   Errors
+	)
+
+	line, col := 1, 1
+	advance := func(n int) {
+		for ; n > 0 && len(data) > 0; n-- {
+			if data[0] == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+			data = data[1:]
+		}
+	}
+
+	for len(data) > 0 {
+		c := data[0]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			advance(1)
+
+		case c == ';' || c == '#' || (c == '/' && len(data) > 1 && data[1] == '/'):
+			for len(data) > 0 && data[0] != '\n' {
+				advance(1)
+			}
+
+		case c == '/' && len(data) > 1 && data[1] == '*':
+			pos := Pos{line, col}
+			advance(2)
+			for len(data) > 0 && !(data[0] == '*' && len(data) > 1 && data[1] == '/') {
+				advance(1)
+			}
+			if len(data) == 0 {
+				errs = append(errs, &Error{fileName, pos, "unterminated comment"})
+				break
+			}
+			advance(2)
+
+		case c == '"':
+			pos := Pos{line, col}
+			advance(1)
+			end := 0
+			for end < len(data) && data[end] != '"' && data[end] != '\n' {
+				end++
+			}
+			if end == len(data) || data[end] == '\n' {
+				errs = append(errs, &Error{fileName, pos, "unterminated string"})
+			}
+			tokens = append(tokens, &qcToken{string(data[:end]), true, pos})
+			advance(end + 1)
+
+		case c == '{' || c == '}':
+			tokens = append(tokens, &qcToken{string(c), false, Pos{line, col}})
+			advance(1)
+
+		default:
+			end := 0
+			for end < len(data) && !strings.ContainsRune(" \t\r\n{}\";", rune(data[end])) {
+				end++
+			}
+			tokens = append(tokens, &qcToken{string(data[:end]), false, Pos{line, col}})
+			advance(end)
+		}
+	}
+
+	return tokens, errs
+}
+
+type qcParser struct {
+	fileName  string
+	tokens    []*qcToken
+	index     int
+	last      *qcToken
+	errs      Errors
+	seqGroup  int
+	hitBoxSet *HitBoxSet
+}
+
+func (p *qcParser) errorf(pos Pos, format string, args ...interface{}) {
+	p.errs = append(p.errs, &Error{p.fileName, pos, fmt.Sprintf(format, args...)})
+}
+
+func (p *qcParser) peek() *qcToken {
+	if p.index < len(p.tokens) {
+		return p.tokens[p.index]
+	}
+	return nil
+}
+
+func (p *qcParser) next() *qcToken {
+	tok := p.peek()
+	if tok != nil {
+		p.index++
+		p.last = tok
+	}
+	return tok
+}
+
+// available reports whether another token follows on the line of the last one.
+func (p *qcParser) available() bool {
+	tok := p.peek()
+	return tok != nil && p.last != nil && tok.pos.Line == p.last.pos.Line
+}
+
+func (p *qcParser) endPos() Pos {
+	if p.last == nil {
+		return Pos{1, 1}
+	}
+	end := p.last.pos.Column + len(p.last.text)
+	if p.last.quoted {
+		end += 2
+	}
+	return Pos{p.last.pos.Line, end}
+}
+
+func (p *qcParser) arg(what string) (*qcToken, bool) {
+	if !p.available() {
+		p.errorf(p.endPos(), "missing %s", what)
+		return nil, false
+	}
+	return p.next(), true
+}
+
+func (p *qcParser) argString(what string) (string, bool) {
+	tok, ok := p.arg(what)
+	if !ok {
+		return "", false
+	}
+	return tok.text, true
+}
+
+func (p *qcParser) argInt(what string) (int, bool) {
+	tok, ok := p.arg(what)
+	if !ok {
+		return 0, false
+	}
+	val, err := strconv.Atoi(tok.text)
+	if err != nil {
+		p.errorf(tok.pos, "expected integer %s, got %q", what, tok.text)
+		return 0, false
+	}
+	return val, true
+}
+
+func (p *qcParser) argFloat(what string) (float32, bool) {
+	tok, ok := p.arg(what)
+	if !ok {
+		return 0, false
+	}
+	val, err := strconv.ParseFloat(tok.text, 32)
+	if err != nil {
+		p.errorf(tok.pos, "expected number %s, got %q", what, tok.text)
+		return 0, false
+	}
+	return float32(val), true
+}
+
+func (p *qcParser) argVector(what string) (studio.Vector3_32, bool) {
+	var (
+		vec studio.Vector3_32
+		ok  bool
+	)
+	if vec.X, ok = p.argFloat(what); !ok {
+		return vec, false
+	}
+	if vec.Y, ok = p.argFloat(what); !ok {
+		return vec, false
+	}
+	vec.Z, ok = p.argFloat(what)
+	return vec, ok
+}
+
+// openBlock consumes an opening brace that may be placed on the following line.
+func (p *qcParser) openBlock(what string) bool {
+	tok := p.peek()
+	if tok == nil || !tok.is("{") {
+		p.errorf(p.endPos(), "expected '{' after %s", what)
+		return false
+	}
+	p.next()
+	return true
+}
+
+// skipCommand drops the remaining tokens of a malformed command.
+func (p *qcParser) skipCommand() {
+	for tok := p.peek(); tok != nil && !(!tok.quoted && strings.HasPrefix(tok.text, "$")); tok = p.peek() {
+		p.next()
+	}
+}
+
+func lookupMotionType(name string) int {
+	for i := 0; i < 15; i++ {
+		if strings.EqualFold(studio.MotionTypeString(1<<uint(i), false), name) {
+			return 1 << uint(i)
+		}
+	}
+	return -1
+}
+
+func lookupActivity(name string) int {
+	for i, act := range studio.ActivityNames {
+		if strings.EqualFold(act, name) {
+			return i
+		}
+	}
+	if len(name) > 4 && strings.EqualFold(name[:4], "ACT_") {
+		if act, err := strconv.Atoi(name[4:]); err == nil && act > 0 {
+			return act
+		}
+	}
+	return 0
+}
+
+// Load reads and parses the QC script at path.
+func Load(path string) (*Script, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, path)
+}
+
+// Parse builds a script description from the QC dialect written by
+// Save. On failure the returned error is an Errors list with the
+// position of every problem found.
+func Parse(data []byte, fileName string) (*Script, error) {
+	tokens, errs := tokenizeQC(data, fileName)
+	p := &qcParser{fileName: fileName, tokens: tokens, errs: errs}
+
+	qc := &Script{FileName: fileName, Scale: 1.0}
+
+	for tok := p.next(); tok != nil; tok = p.next() {
+		if tok.quoted || !strings.HasPrefix(tok.text, "$") {
+			p.errorf(tok.pos, "unexpected %q, expected a $command", tok.text)
+			p.skipCommand()
+			continue
+		}
+
+		errsNum := len(p.errs)
+		p.parseCommand(qc, tok)
+		if len(p.errs) > errsNum {
+			p.skipCommand()
+		}
+	}
+
+	if len(p.errs) > 0 {
+		return qc, p.errs
+	}
+	return qc, nil
+}
+
+func (p *qcParser) parseCommand(qc *Script, cmd *qcToken) {
+	var ok bool
+	errsNum := len(p.errs)
+
+	switch strings.ToLower(cmd.text) {
+	case "$modelname":
+		qc.ModelName, _ = p.argString("model name")
+	case "$cd":
+		qc.Cd, _ = p.argString("directory")
+	case "$cdtexture":
+		qc.CdTexture, _ = p.argString("texture directory")
+	case "$scale":
+		qc.Scale, _ = p.argFloat("scale")
+	case "$cliptotextures":
+		qc.ClipToTextures = true
+	case "$externaltextures":
+		qc.ExternalTextures = true
+	case "$flags":
+		var flags int
+		if flags, ok = p.argInt("flags"); ok {
+			qc.Flags = uint32(flags)
+		}
+	case "$bbox":
+		if qc.BBox[0], ok = p.argVector("bbox min"); ok {
+			qc.BBox[1], _ = p.argVector("bbox max")
+		}
+	case "$cbox":
+		if qc.CBox[0], ok = p.argVector("cbox min"); ok {
+			qc.CBox[1], _ = p.argVector("cbox max")
+		}
+	case "$eyeposition":
+		qc.EyePosition, _ = p.argVector("eye position")
+	case "$body":
+		p.parseBody(qc, cmd)
+	case "$bodygroup":
+		p.parseBodyGroup(qc, cmd)
+	case "$texrendermode":
+		p.parseTexRenderMode(qc, cmd)
+	case "$texturegroup":
+		p.parseTextureGroup(qc, cmd)
+	case "$attachment":
+		p.parseAttachment(qc, cmd)
+	case "$pivot":
+		p.parsePivot(qc, cmd)
+	case "$controller":
+		p.parseController(qc, cmd)
+	case "$hbox":
+		p.parseHitBox(qc, cmd)
+	case "$hboxset":
+		p.parseHitBoxSet(qc, cmd)
+	case "$poseparameter":
+		p.parsePoseParameter(qc, cmd)
+	case "$keyvalues":
+		p.parseKeyValues(qc, cmd)
+	case "$sequencegroupsize":
+		qc.SequenceGroupSize, _ = p.argInt("sequence group size")
+	case "$sequencegroup":
+		p.parseSequenceGroup(qc, cmd)
+	case "$sequence":
+		p.parseSequence(qc, cmd)
+	default:
+		c := &Command{Pos: cmd.pos, Name: cmd.text}
+		for p.available() {
+			c.Args = append(c.Args, p.next().text)
+		}
+		qc.Unknown = append(qc.Unknown, c)
+		qc.Warnings = append(qc.Warnings, &Error{p.fileName, cmd.pos,
+			fmt.Sprintf("unsupported command %s", cmd.text)})
+		return
+	}
+
+	// the rest of a failed command is skipped without more errors
+	if len(p.errs) == errsNum && p.available() {
+		tok := p.next()
+		p.errorf(tok.pos, "unexpected %q after %s", tok.text, cmd.text)
+	}
+}
+
+func (p *qcParser) parseBody(qc *Script, cmd *qcToken) {
+	bg := &BodyGroup{Pos: cmd.pos}
+	var ok bool
+	if bg.Name, ok = p.argString("body name"); !ok {
+		return
+	}
+	tok, ok := p.arg("reference file")
+	if !ok {
+		return
+	}
+	bg.Models = []*BodyModel{{Pos: tok.pos, Name: tok.text}}
+	qc.BodyGroups = append(qc.BodyGroups, bg)
+}
+
+func (p *qcParser) parseBodyGroup(qc *Script, cmd *qcToken) {
+	bg := &BodyGroup{Pos: cmd.pos}
+	var ok bool
+	if bg.Name, ok = p.argString("bodygroup name"); !ok {
+		return
+	}
+	if !p.openBlock("$bodygroup") {
+		return
+	}
+
+	for {
+		tok := p.next()
+		switch {
+		case tok == nil:
+			p.errorf(p.endPos(), "unexpected end of file in $bodygroup")
+			return
+		case tok.is("}"):
+			qc.BodyGroups = append(qc.BodyGroups, bg)
+			return
+		case tok.is("studio"):
+			var name string
+			if name, ok = p.argString("reference file"); !ok {
+				return
+			}
+			bg.Models = append(bg.Models, &BodyModel{Pos: tok.pos, Name: name})
+		case tok.is("blank"):
+			bg.Models = append(bg.Models, &BodyModel{Pos: tok.pos, Name: "blank", Blank: true})
+		default:
+			p.errorf(tok.pos, "unexpected %q in $bodygroup", tok.text)
+			return
+		}
+	}
+}
+
+func (p *qcParser) parseTexRenderMode(qc *Script, cmd *qcToken) {
+	rm := &TexRenderMode{Pos: cmd.pos}
+	var ok bool
+	if rm.Texture, ok = p.argString("texture name"); !ok {
+		return
+	}
+	tok, ok := p.arg("render mode")
+	if !ok {
+		return
+	}
+
+	switch strings.ToLower(tok.text) {
+	case "flatshade", "chrome", "fullbright", "nomips", "alpha", "nosmooth",
+		"additive", "masked", "masked_solid", "twoside":
+		rm.Mode = strings.ToLower(tok.text)
+		qc.TexRenderModes = append(qc.TexRenderModes, rm)
+	default:
+		p.errorf(tok.pos, "unknown render mode %q", tok.text)
+	}
+}
+
+func (p *qcParser) parseTextureGroup(qc *Script, cmd *qcToken) {
+	tg := &TextureGroup{Pos: cmd.pos}
+	var ok bool
+	if tg.Name, ok = p.argString("texture group name"); !ok {
+		return
+	}
+	if !p.openBlock("$texturegroup") {
+		return
+	}
+
+	for {
+		tok := p.next()
+		switch {
+		case tok == nil:
+			p.errorf(p.endPos(), "unexpected end of file in $texturegroup")
+			return
+		case tok.is("}"):
+			qc.TextureGroups = append(qc.TextureGroups, tg)
+			return
+		case tok.is("{"):
+			family := make([]string, 0)
+			for tok = p.next(); tok != nil && !tok.is("}"); tok = p.next() {
+				if tok.is("{") {
+					p.errorf(tok.pos, "unexpected '{' in skin family")
+					return
+				}
+				family = append(family, tok.text)
+			}
+			if tok == nil {
+				p.errorf(p.endPos(), "unexpected end of file in skin family")
+				return
+			}
+			tg.Families = append(tg.Families, family)
+		default:
+			p.errorf(tok.pos, "expected '{' to start a skin family, got %q", tok.text)
+			return
+		}
+	}
+}
+
+func (p *qcParser) parseAttachment(qc *Script, cmd *qcToken) {
+	a := &Attachment{Pos: cmd.pos}
+	var ok bool
+	if a.Index, ok = p.argInt("attachment index"); !ok {
+		return
+	}
+	if a.Bone, ok = p.argString("bone name"); !ok {
+		return
+	}
+	if a.Origin, ok = p.argVector("attachment origin"); !ok {
+		return
+	}
+	qc.Attachments = append(qc.Attachments, a)
+}
+
+func (p *qcParser) parsePivot(qc *Script, cmd *qcToken) {
+	pv := &PivotBone{Pos: cmd.pos}
+	var ok bool
+	if pv.Index, ok = p.argInt("pivot index"); !ok {
+		return
+	}
+	if pv.Bone, ok = p.argString("bone name"); !ok {
+		return
+	}
+	if pv.Index < 0 || pv.Index >= studio.MaxPivots {
+		p.errorf(pv.Pos, "pivot index %d is out of range", pv.Index)
+		return
+	}
+	qc.Pivots = append(qc.Pivots, pv)
+}
+
+func (p *qcParser) parseController(qc *Script, cmd *qcToken) {
+	c := &Controller{Pos: cmd.pos}
+
+	tok, ok := p.arg("controller index")
+	if !ok {
+		return
+	}
+	if tok.is("mouth") {
+		c.Index = 4
+	} else if c.Index, ok = p.parseInt(tok, "controller index"); !ok {
+		return
+	}
+
+	if c.Bone, ok = p.argString("bone name"); !ok {
+		return
+	}
+
+	if tok, ok = p.arg("controller type"); !ok {
+		return
+	}
+	motionType := lookupMotionType(tok.text)
+	if motionType < 0 {
+		p.errorf(tok.pos, "unknown controller type %q", tok.text)
+		return
+	}
+	c.Type = uint32(motionType)
+
+	if c.Start, ok = p.argFloat("controller start"); !ok {
+		return
+	}
+	if c.End, ok = p.argFloat("controller end"); !ok {
+		return
+	}
+	qc.Controllers = append(qc.Controllers, c)
+}
+
+func (p *qcParser) parseHitBox(qc *Script, cmd *qcToken) {
+	hb := &HitBox{Pos: cmd.pos}
+	var ok bool
+	if hb.Group, ok = p.argInt("hitbox group"); !ok {
+		return
+	}
+	if hb.Bone, ok = p.argString("bone name"); !ok {
+		return
+	}
+	if hb.BBMin, ok = p.argVector("hitbox min"); !ok {
+		return
+	}
+	if hb.BBMax, ok = p.argVector("hitbox max"); !ok {
+		return
+	}
+	if p.hitBoxSet != nil {
+		p.hitBoxSet.HitBoxes = append(p.hitBoxSet.HitBoxes, hb)
+	} else {
+		qc.HitBoxes = append(qc.HitBoxes, hb)
+	}
+}
+
+// parseHitBoxSet makes the following hit boxes members of the set.
+func (p *qcParser) parseHitBoxSet(qc *Script, cmd *qcToken) {
+	name, ok := p.argString("hitbox set name")
+	if !ok {
+		return
+	}
+	if strings.EqualFold(name, "default") {
+		p.hitBoxSet = nil
+		return
+	}
+	for _, set := range qc.HitBoxSets {
+		if strings.EqualFold(set.Name, name) {
+			p.hitBoxSet = set
+			return
+		}
+	}
+	p.hitBoxSet = &HitBoxSet{Pos: cmd.pos, Name: name}
+	qc.HitBoxSets = append(qc.HitBoxSets, p.hitBoxSet)
+}
+
+func (p *qcParser) parsePoseParameter(qc *Script, cmd *qcToken) {
+	pp := &PoseParameter{Pos: cmd.pos}
+	var ok bool
+	if pp.Name, ok = p.argString("pose parameter name"); !ok {
+		return
+	}
+	if pp.Start, ok = p.argFloat("pose parameter start"); !ok {
+		return
+	}
+	if pp.End, ok = p.argFloat("pose parameter end"); !ok {
+		return
+	}
+	for p.available() {
+		tok := p.next()
+		if !tok.is("loop") {
+			p.errorf(tok.pos, "unknown pose parameter option %q", tok.text)
+			return
+		}
+		if pp.Loop, ok = p.argFloat("pose parameter loop"); !ok {
+			return
+		}
+	}
+	qc.PoseParameters = append(qc.PoseParameters, pp)
+}
+
+// parseKeyValues keeps the text of the block, with one line per line of the
+// script and the quotes restored.
+func (p *qcParser) parseKeyValues(qc *Script, cmd *qcToken) {
+	if !p.openBlock("$keyvalues") {
+		return
+	}
+
+	var sb strings.Builder
+	depth, line := 0, 0
+	for {
+		tok := p.next()
+		if tok == nil {
+			p.errorf(p.endPos(), "unexpected end of file in $keyvalues")
+			return
+		}
+		if tok.is("}") {
+			if depth == 0 {
+				break
+			}
+			depth--
+		} else if tok.is("{") {
+			depth++
+		}
+
+		if sb.Len() > 0 {
+			if tok.pos.Line != line {
+				sb.WriteString("\n")
+			} else {
+				sb.WriteString(" ")
+			}
+		}
+		line = tok.pos.Line
+		if tok.quoted {
+			sb.WriteString("\"" + tok.text + "\"")
+		} else {
+			sb.WriteString(tok.text)
+		}
+	}
+
+	if len(qc.KeyValues) > 0 {
+		qc.KeyValues += "\n"
+	}
+	qc.KeyValues += sb.String()
+}
+
+func (p *qcParser) parseInt(tok *qcToken, what string) (int, bool) {
+	val, err := strconv.Atoi(tok.text)
+	if err != nil {
+		p.errorf(tok.pos, "expected integer %s, got %q", what, tok.text)
+		return 0, false
+	}
+	return val, true
+}
+
+// parseSequenceGroup makes the following sequences members of a new group.
+// Like in studiomdl every command opens a group, whatever its label.
+func (p *qcParser) parseSequenceGroup(qc *Script, cmd *qcToken) {
+	label, ok := p.argString("sequence group label")
+	if !ok {
+		return
+	}
+	qc.SequenceGroups = append(qc.SequenceGroups, &SequenceGroup{Pos: cmd.pos, Label: label})
+	p.seqGroup = len(qc.SequenceGroups)
+}
+
+// parseSequence follows studiomdl: options stay on the command line unless
+// they are enclosed in braces, which may span several lines.
+func (p *qcParser) parseSequence(qc *Script, cmd *qcToken) {
+	seq := &Sequence{Pos: cmd.pos, Group: p.seqGroup, FPS: 30.0}
+	var ok bool
+	if seq.Name, ok = p.argString("sequence name"); !ok {
+		return
+	}
+
+	depth := 0
+	for {
+		var tok *qcToken
+		if depth > 0 {
+			if tok = p.next(); tok == nil {
+				p.errorf(p.endPos(), "unexpected end of file in $sequence %q", seq.Name)
+				return
+			}
+		} else {
+			if !p.available() {
+				break
+			}
+			tok = p.next()
+		}
+
+		switch {
+		case tok.is("{"):
+			depth++
+		case tok.is("}"):
+			depth--
+			if depth < 0 {
+				p.errorf(tok.pos, "unbalanced '}' in $sequence %q", seq.Name)
+				return
+			}
+		case tok.is("event"):
+			ev := &Event{Pos: tok.pos}
+			var event int
+			if event, ok = p.argInt("event number"); !ok {
+				return
+			}
+			ev.Event = int32(event)
+			if ev.Frame, ok = p.argInt("event frame"); !ok {
+				return
+			}
+			if next := p.peek(); p.available() && !next.is("}") {
+				ev.Options = p.next().text
+			}
+			seq.Events = append(seq.Events, ev)
+		case tok.is("pivot"):
+			pv := &Pivot{Pos: tok.pos}
+			if pv.Index, ok = p.argInt("pivot index"); !ok {
+				return
+			}
+			if pv.Start, ok = p.argInt("pivot start"); !ok {
+				return
+			}
+			if pv.End, ok = p.argInt("pivot end"); !ok {
+				return
+			}
+			if pv.Index < 0 || pv.Index >= studio.MaxPivots {
+				p.errorf(pv.Pos, "pivot index %d is out of range", pv.Index)
+				return
+			}
+			seq.Pivots = append(seq.Pivots, pv)
+		case tok.is("fps"):
+			if seq.FPS, ok = p.argFloat("fps"); !ok {
+				return
+			}
+		case tok.is("loop"):
+			seq.Loop = true
+		case tok.is("blend"):
+			b := &Blend{Pos: tok.pos}
+			if tok, ok = p.arg("blend type"); !ok {
+				return
+			}
+			motionType := lookupMotionType(tok.text)
+			if motionType < 0 {
+				p.errorf(tok.pos, "unknown blend type %q", tok.text)
+				return
+			}
+			b.Type = uint32(motionType)
+			if b.Start, ok = p.argFloat("blend start"); !ok {
+				return
+			}
+			if b.End, ok = p.argFloat("blend end"); !ok {
+				return
+			}
+			seq.Blends = append(seq.Blends, b)
+		case tok.is("node"):
+			var node int
+			if node, ok = p.argInt("node"); !ok {
+				return
+			}
+			seq.EntryNode, seq.ExitNode = int32(node), int32(node)
+		case tok.is("transition"), tok.is("rtransition"):
+			var entry, exit int
+			if entry, ok = p.argInt("entry node"); !ok {
+				return
+			}
+			if exit, ok = p.argInt("exit node"); !ok {
+				return
+			}
+			seq.EntryNode, seq.ExitNode = int32(entry), int32(exit)
+			if tok.is("rtransition") {
+				seq.NodeFlags = 1
+			}
+		case !tok.quoted && lookupMotionType(tok.text) > 0:
+			seq.MotionType |= uint32(lookupMotionType(tok.text))
+		case !tok.quoted && lookupActivity(tok.text) > 0:
+			seq.Activity = lookupActivity(tok.text)
+			seq.ActivityName = tok.text
+			if seq.ActWeight, ok = p.argInt("activity weight"); !ok {
+				return
+			}
+		default:
+			seq.Files = append(seq.Files, tok.text)
+		}
+	}
+
+	if len(seq.Files) == 0 {
+		p.errorf(cmd.pos, "$sequence %q has no animation files", seq.Name)
+		return
+	}
+	qc.Sequences = append(qc.Sequences, seq)
+}
@@ -0,0 +1,126 @@
+package qc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		qc   string
+		errs []string
+	}{
+		{"missing argument", "$modelname\n", []string{
+			"test.qc:1:11: missing model name"}},
+		{"bad number", "$scale big\n", []string{
+			"test.qc:1:8: expected number scale, got \"big\""}},
+		{"short vector", "$bbox 0 0 0 1 1\n$eyeposition 0 0 1\n", []string{
+			"test.qc:1:16: missing bbox max"}},
+		{"extra argument", "$cliptotextures yes\n", []string{
+			"test.qc:1:17: unexpected \"yes\" after $cliptotextures"}},
+		{"not a command", "$cd \".\"\nmodel\n$cdtexture \".\"\n", []string{
+			"test.qc:2:1: unexpected \"model\", expected a $command"}},
+		{"unterminated string", "$modelname \"test.mdl\n", []string{
+			"test.qc:1:12: unterminated string"}},
+		{"unterminated comment", "$scale 1\n/* comment\n", []string{
+			"test.qc:2:1: unterminated comment"}},
+		{"errors go on", "$scale x\n$flags y\n\t$texrendermode \"a.bmp\" shiny\n", []string{
+			"test.qc:1:8: expected number scale, got \"x\"",
+			"test.qc:2:8: expected integer flags, got \"y\"",
+			"test.qc:3:25: unknown render mode \"shiny\""}},
+		{"bodygroup without braces", "$bodygroup body\nstudio \"ref\"\n", []string{
+			"test.qc:1:16: expected '{' after $bodygroup"}},
+		{"open bodygroup", "$bodygroup body\n{\nstudio \"ref\"\n", []string{
+			"test.qc:3:13: unexpected end of file in $bodygroup"}},
+		{"controller type", "$controller 0 \"bone\" QR 0 90\n", []string{
+			"test.qc:1:22: unknown controller type \"QR\""}},
+		{"pivot index", "$pivot 300 \"bone\"\n", []string{
+			"test.qc:1:1: pivot index 300 is out of range"}},
+		{"sequence files", "$sequence idle fps 30 loop\n", []string{
+			"test.qc:1:1: $sequence \"idle\" has no animation files"}},
+		{"sequence blend", "$sequence aim \"aim\" blend QR -45 45\n", []string{
+			"test.qc:1:27: unknown blend type \"QR\""}},
+		{"sequence event", "$sequence walk \"walk\" { event 5001 first }\n", []string{
+			"test.qc:1:36: expected integer event frame, got \"first\""}},
+		{"sequence braces", "$sequence walk \"walk\" }\n", []string{
+			"test.qc:1:23: unbalanced '}' in $sequence \"walk\""}},
+		{"open sequence", "$sequence walk \"walk\" {\nevent 5001 1\n", []string{
+			"test.qc:2:13: unexpected end of file in $sequence \"walk\""}},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.qc), "test.qc")
+		errs, ok := err.(Errors)
+		if !ok {
+			t.Errorf("%s: got %v, want Errors", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, e := range errs {
+			got = append(got, e.Error())
+		}
+		if !reflect.DeepEqual(got, tt.errs) {
+			t.Errorf("%s: got errors %q, want %q", tt.name, got, tt.errs)
+		}
+	}
+}
+
+func TestParseUnknownCommands(t *testing.T) {
+	qc, err := Parse([]byte("$modelname \"a.mdl\"\n$mirrorbone \"b\" 1\n$scale 2\n$gamma 1.8\n"), "test.qc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Command{{Pos{2, 1}, "$mirrorbone", []string{"b", "1"}}, {Pos{4, 1}, "$gamma", []string{"1.8"}}}
+	if !reflect.DeepEqual(qc.Unknown, want) {
+		t.Errorf("unknown commands %+v, want %+v", qc.Unknown, want)
+	}
+	if qc.Warnings.Error() != "test.qc:2:1: unsupported command $mirrorbone\ntest.qc:4:1: unsupported command $gamma" {
+		t.Errorf("warnings %q", qc.Warnings.Error())
+	}
+	if qc.ModelName != "a.mdl" || qc.Scale != 2 {
+		t.Errorf("commands around the unknown ones are lost: %q, %f", qc.ModelName, qc.Scale)
+	}
+}
+
+func TestParseSequences(t *testing.T) {
+	qc, err := Parse([]byte(`$sequence idle "idle" fps 15 loop ACT_IDLE 1
+$sequencegroup "walks"
+$sequence walk "walk" {
+	event 5001 2 "10"
+	pivot 0 1 4
+	LX transition 1 2
+}
+$sequence run "run_a" "run_b" blend XR -45 45 rtransition 2 1
+`), "test.qc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(qc.SequenceGroups) != 1 || qc.SequenceGroups[0].Label != "walks" {
+		t.Fatalf("sequence groups %+v", qc.SequenceGroups)
+	}
+	if len(qc.Sequences) != 3 {
+		t.Fatalf("%d sequences, want 3", len(qc.Sequences))
+	}
+	idle, walk, run := qc.Sequences[0], qc.Sequences[1], qc.Sequences[2]
+	if idle.Group != 0 || idle.FPS != 15 || !idle.Loop || idle.ActivityName != "ACT_IDLE" || idle.ActWeight != 1 {
+		t.Errorf("idle %+v", idle)
+	}
+	if walk.Group != 1 || walk.MotionType != studio.StudioMotionLX || walk.EntryNode != 1 || walk.ExitNode != 2 ||
+		!reflect.DeepEqual(walk.Files, []string{"walk"}) {
+		t.Errorf("walk %+v", walk)
+	}
+	if len(walk.Events) != 1 || *walk.Events[0] != (Event{Pos{4, 2}, 5001, 2, "10"}) {
+		t.Errorf("walk events %+v", walk.Events)
+	}
+	if len(walk.Pivots) != 1 || *walk.Pivots[0] != (Pivot{Pos{5, 2}, 0, 1, 4}) {
+		t.Errorf("walk pivots %+v", walk.Pivots)
+	}
+	if run.Group != 1 || run.NodeFlags != 1 || !reflect.DeepEqual(run.Files, []string{"run_a", "run_b"}) ||
+		len(run.Blends) != 1 || *run.Blends[0] != (Blend{Pos{8, 31}, studio.StudioMotionXR, -45, 45}) {
+		t.Errorf("run %+v", run)
+	}
+}
@@ -1,207 +1,17 @@
-package main
+package qc
 
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
-)
-
-var activityNames = []string{
-	"ACT_RESET",
-	"ACT_IDLE",
-	"ACT_GUARD",
-	"ACT_WALK",
-	"ACT_RUN",
-	"ACT_FLY",
-	"ACT_SWIM",
-	"ACT_HOP",
-	"ACT_LEAP",
-	"ACT_FALL",
-	"ACT_LAND",
-	"ACT_STRAFE_LEFT",
-	"ACT_STRAFE_RIGHT",
-	"ACT_ROLL_LEFT",
-	"ACT_ROLL_RIGHT",
-	"ACT_TURN_LEFT",
-	"ACT_TURN_RIGHT",
-	"ACT_CROUCH",
-	"ACT_CROUCHIDLE",
-	"ACT_STAND",
-	"ACT_USE",
-	"ACT_SIGNAL1",
-	"ACT_SIGNAL2",
-	"ACT_SIGNAL3",
-	"ACT_TWITCH",
-	"ACT_COWER",
-	"ACT_SMALL_FLINCH",
-	"ACT_BIG_FLINCH",
-	"ACT_RANGE_ATTACK1",
-	"ACT_RANGE_ATTACK2",
-	"ACT_MELEE_ATTACK1",
-	"ACT_MELEE_ATTACK2",
-	"ACT_RELOAD",
-	"ACT_ARM",
-	"ACT_DISARM",
-	"ACT_EAT",
-	"ACT_DIESIMPLE",
-	"ACT_DIEBACKWARD",
-	"ACT_DIEFORWARD",
-	"ACT_DIEVIOLENT",
-	"ACT_BARNACLE_HIT",
-	"ACT_BARNACLE_PULL",
-	"ACT_BARNACLE_CHOMP",
-	"ACT_BARNACLE_CHEW",
-	"ACT_SLEEP",
-	"ACT_INSPECT_FLOOR",
-	"ACT_INSPECT_WALL",
-	"ACT_IDLE_ANGRY",
-	"ACT_WALK_HURT",
-	"ACT_RUN_HURT",
-	"ACT_HOVER",
-	"ACT_GLIDE",
-	"ACT_FLY_LEFT",
-	"ACT_FLY_RIGHT",
-	"ACT_DETECT_SCENT",
-	"ACT_SNIFF",
-	"ACT_BITE",
-	"ACT_THREAT_DISPLAY",
-	"ACT_FEAR_DISPLAY",
-	"ACT_EXCITED",
-	"ACT_SPECIAL_ATTACK1",
-	"ACT_SPECIAL_ATTACK2",
-	"ACT_COMBAT_IDLE",
-	"ACT_WALK_SCARED",
-	"ACT_RUN_SCARED",
-	"ACT_VICTORY_DANCE",
-	"ACT_DIE_HEADSHOT",
-	"ACT_DIE_CHESTSHOT",
-	"ACT_DIE_GUTSHOT",
-	"ACT_DIE_BACKSHOT",
-	"ACT_FLINCH_HEAD",
-	"ACT_FLINCH_CHEST",
-	"ACT_FLINCH_STOMACH",
-	"ACT_FLINCH_LEFTARM",
-	"ACT_FLINCH_RIGHTARM",
-	"ACT_FLINCH_LEFTLEG",
-	"ACT_FLINCH_RIGHTLEG",
-	"ACT_VM_NONE",
-	"ACT_VM_DEPLOY",
-	"ACT_VM_DEPLOY_EMPTY",
-	"ACT_VM_HOLSTER",
-	"ACT_VM_HOLSTER_EMPTY",
-	"ACT_VM_IDLE1",
-	"ACT_VM_IDLE2",
-	"ACT_VM_IDLE3",
-	"ACT_VM_RANGE_ATTACK1",
-	"ACT_VM_RANGE_ATTACK2",
-	"ACT_VM_RANGE_ATTACK3",
-	"ACT_VM_MELEE_ATTACK1",
-	"ACT_VM_MELEE_ATTACK2",
-	"ACT_VM_MELEE_ATTACK3",
-	"ACT_VM_SHOOT_EMPTY",
-	"ACT_VM_START_RELOAD",
-	"ACT_VM_RELOAD",
-	"ACT_VM_RELOAD_EMPTY",
-	"ACT_VM_TURNON",
-	"ACT_VM_TURNOFF",
-	"ACT_VM_PUMP",
-	"ACT_VM_PUMP_EMPTY",
-	"ACT_VM_START_CHARGE",
-	"ACT_VM_CHARGE",
-	"ACT_VM_OVERLOAD",
-	"ACT_VM_IDLE_EMPTY",
-}
 
-func getMotionTypeString(motionType int, isComposite bool) string {
-	if isComposite {
-		var sb strings.Builder
-		if motionType&StudioMotionX > 0 {
-			sb.WriteString(" X")
-		}
-		if motionType&StudioMotionY > 0 {
-			sb.WriteString(" Y")
-		}
-		if motionType&StudioMotionZ > 0 {
-			sb.WriteString(" Z")
-		}
-		if motionType&StudioMotionXR > 0 {
-			sb.WriteString(" XR")
-		}
-		if motionType&StudioMotionYR > 0 {
-			sb.WriteString(" YR")
-		}
-		if motionType&StudioMotionZR > 0 {
-			sb.WriteString(" ZR")
-		}
-		if motionType&StudioMotionLX > 0 {
-			sb.WriteString(" LX")
-		}
-		if motionType&StudioMotionLY > 0 {
-			sb.WriteString(" LY")
-		}
-		if motionType&StudioMotionLZ > 0 {
-			sb.WriteString(" LZ")
-		}
-		if motionType&StudioMotionAX > 0 {
-			sb.WriteString(" AX")
-		}
-		if motionType&StudioMotionAY > 0 {
-			sb.WriteString(" AY")
-		}
-		if motionType&StudioMotionAZ > 0 {
-			sb.WriteString(" AZ")
-		}
-		if motionType&StudioMotionAXR > 0 {
-			sb.WriteString(" AXR")
-		}
-		if motionType&StudioMotionAYR > 0 {
-			sb.WriteString(" AYR")
-		}
-		if motionType&StudioMotionAZR > 0 {
-			sb.WriteString(" AZR")
-		}
-		return sb.String()
-	} else {
-		motionType &= StudioMotionTypes
-		switch motionType {
-		case StudioMotionX:
-			return "X"
-		case StudioMotionY:
-			return "Y"
-		case StudioMotionZ:
-			return "Z"
-		case StudioMotionXR:
-			return "XR"
-		case StudioMotionYR:
-			return "YR"
-		case StudioMotionZR:
-			return "ZR"
-		case StudioMotionLX:
-			return "LX"
-		case StudioMotionLY:
-			return "LY"
-		case StudioMotionLZ:
-			return "LZ"
-		case StudioMotionAX:
-			return "AX"
-		case StudioMotionAY:
-			return "AY"
-		case StudioMotionAZ:
-			return "AZ"
-		case StudioMotionAXR:
-			return "AXR"
-		case StudioMotionAYR:
-			return "AYR"
-		case StudioMotionAZR:
-			return "AZR"
-		}
-	}
-	return ""
-}
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
 
-func writeBodyGroupInfo(writer *bufio.Writer, mdl *Mdl) {
+func writeBodyGroupInfo(writer *bufio.Writer, mdl *studio.Mdl) {
 	writer.WriteString("\n// reference mesh(es)\n")
 
 	for _, bg := range mdl.BodyParts {
@@ -227,40 +37,40 @@ func writeBodyGroupInfo(writer *bufio.Writer, mdl *Mdl) {
 	}
 }
 
-func writeTextureRenderMode(writer *bufio.Writer, mdl *Mdl) {
+func writeTextureRenderMode(writer *bufio.Writer, mdl *studio.Mdl) {
 	for _, tex := range mdl.Textures {
-		if tex.Flags&StudioNfFlatshade > 0 {
+		if tex.Flags&studio.StudioNfFlatshade > 0 {
 			writer.WriteString(fmt.Sprintf("$texrendermode \"%s\" \"flatshade\" \n", tex.Name))
 		}
-		if tex.Flags&StudioNfChrome > 0 {
+		if tex.Flags&studio.StudioNfChrome > 0 {
 			writer.WriteString(fmt.Sprintf("$texrendermode \"%s\" \"chrome\" \n", tex.Name))
 		}
-		if tex.Flags&StudioNfFullbright > 0 {
+		if tex.Flags&studio.StudioNfFullbright > 0 {
 			writer.WriteString(fmt.Sprintf("$texrendermode \"%s\" \"fullbright\" \n", tex.Name))
 		}
-		if tex.Flags&StudioNfNomips > 0 {
+		if tex.Flags&studio.StudioNfNomips > 0 {
 			writer.WriteString(fmt.Sprintf("$texrendermode \"%s\" \"nomips\" \n", tex.Name))
 		}
-		if tex.Flags&StudioNfNosmooth > 0 {
+		if tex.Flags&studio.StudioNfNosmooth > 0 {
 			writer.WriteString(fmt.Sprintf("$texrendermode \"%s\" \"alpha\" \n", tex.Name))
 			writer.WriteString(fmt.Sprintf("$texrendermode \"%s\" \"nosmooth\" \n", tex.Name))
 		}
-		if tex.Flags&StudioNfAdditive > 0 {
+		if tex.Flags&studio.StudioNfAdditive > 0 {
 			writer.WriteString(fmt.Sprintf("$texrendermode \"%s\" \"additive\" \n", tex.Name))
 		}
-		if tex.Flags&StudioNfMasked > 0 {
+		if tex.Flags&studio.StudioNfMasked > 0 {
 			writer.WriteString(fmt.Sprintf("$texrendermode \"%s\" \"masked\" \n", tex.Name))
 		}
-		if tex.Flags&(StudioNfMasked|StudioNfSolid) > 0 {
+		if tex.Flags&studio.StudioNfSolid > 0 {
 			writer.WriteString(fmt.Sprintf("$texrendermode \"%s\" \"masked_solid\" \n", tex.Name))
 		}
-		if tex.Flags&StudioNfTwoside > 0 {
+		if tex.Flags&studio.StudioNfTwoside > 0 {
 			writer.WriteString(fmt.Sprintf("$texrendermode \"%s\" \"twoside\" \n", tex.Name))
 		}
 	}
 }
 
-func writeSkinFamilyInfo(writer *bufio.Writer, mdl *Mdl) {
+func writeSkinFamilyInfo(writer *bufio.Writer, mdl *studio.Mdl) {
 	if mdl.Header.SkinFamiliesNum < 2 {
 		return
 	}
@@ -283,7 +93,7 @@ func writeSkinFamilyInfo(writer *bufio.Writer, mdl *Mdl) {
 	writer.WriteString("}\n")
 }
 
-func writeAttachmentInfo(writer *bufio.Writer, mdl *Mdl) {
+func writeAttachmentInfo(writer *bufio.Writer, mdl *studio.Mdl) {
 	if mdl.Header.AttachmentsNum == 0 {
 		return
 	}
@@ -297,7 +107,30 @@ func writeAttachmentInfo(writer *bufio.Writer, mdl *Mdl) {
 	}
 }
 
-func writeControllerInfo(writer *bufio.Writer, mdl *Mdl) {
+// writePivotInfo declares the pivots the sequences use. The model stores
+// neither the bones of the pivots nor how their origins were computed, so
+// they are all declared on the root bone: the compiled model gets the pivot
+// frames back with zero origins. Pivots with an origin are warned about by
+// writeSequenceInfo.
+func writePivotInfo(writer *bufio.Writer, mdl *studio.Mdl) {
+	var pivotsNum int
+	for _, seq := range mdl.Sequences {
+		if len(seq.Pivots) > pivotsNum {
+			pivotsNum = len(seq.Pivots)
+		}
+	}
+	if pivotsNum == 0 || len(mdl.Bones) == 0 {
+		return
+	}
+
+	writer.WriteString(fmt.Sprintf("\n// %d pivot(s) on the root bone, their bones are not stored in the model\n", pivotsNum))
+
+	for i := 0; i < pivotsNum; i++ {
+		writer.WriteString(fmt.Sprintf("$pivot %d \"%s\"\n", i, mdl.Bones[0].Name))
+	}
+}
+
+func writeControllerInfo(writer *bufio.Writer, mdl *studio.Mdl) {
 	if mdl.Header.BoneControllersNum == 0 {
 		return
 	}
@@ -306,20 +139,30 @@ func writeControllerInfo(writer *bufio.Writer, mdl *Mdl) {
 
 	for _, bc := range mdl.BoneControllers {
 		bone := mdl.Bones[bc.Bone]
-		motionType := getMotionTypeString(int(bc.Type) & ^StudioMotionRLoop, false)
+		motionType := studio.MotionTypeString(int(bc.Type) & ^studio.StudioMotionRLoop, false)
 		writer.WriteString(fmt.Sprintf("$controller %d \"%s\" %s %f %f\n",
 			bc.Index, bone.Name, motionType, bc.Start, bc.End))
 	}
 }
 
-func writeHitBoxInfo(writer *bufio.Writer, mdl *Mdl) {
-	if mdl.Header.HitBoxesNum == 0 {
-		return
+func writeHitBoxInfo(writer *bufio.Writer, mdl *studio.Mdl) {
+	if mdl.Header.HitBoxesNum > 0 {
+		writer.WriteString(fmt.Sprintf("\n// %d hit box(es)\n", mdl.Header.HitBoxesNum))
+		writeHitBoxes(writer, mdl, mdl.HitBoxes)
 	}
 
-	writer.WriteString(fmt.Sprintf("\n// %d hit box(es)\n", mdl.Header.HitBoxesNum))
+	for _, set := range mdl.HitBoxSets {
+		// the default set repeats the hit boxes of the main header
+		if strings.EqualFold(set.Name.String(), "default") {
+			continue
+		}
+		writer.WriteString(fmt.Sprintf("\n$hboxset \"%s\"\n", set.Name))
+		writeHitBoxes(writer, mdl, set.HitBoxes)
+	}
+}
 
-	for _, hb := range mdl.HitBoxes {
+func writeHitBoxes(writer *bufio.Writer, mdl *studio.Mdl, hitBoxes []*studio.StudioHitBox) {
+	for _, hb := range hitBoxes {
 		bone := mdl.Bones[hb.Bone]
 		writer.WriteString(fmt.Sprintf("$hbox %d \"%s\" %f %f %f %f %f %f\n",
 			hb.Group, bone.Name,
@@ -328,16 +171,70 @@ func writeHitBoxInfo(writer *bufio.Writer, mdl *Mdl) {
 	}
 }
 
-func writeSequenceInfo(writer *bufio.Writer, mdl *Mdl) {
-	if mdl.Header.SequenceGroupsNum > 1 {
-		writer.WriteString("\n$sequencegroupsize 64\n")
+func writePoseParameterInfo(writer *bufio.Writer, mdl *studio.Mdl) {
+	if len(mdl.PoseParams) == 0 {
+		return
+	}
+
+	writer.WriteString(fmt.Sprintf("\n// %d pose parameter(s)\n", len(mdl.PoseParams)))
+
+	for _, pp := range mdl.PoseParams {
+		writer.WriteString(fmt.Sprintf("$poseparameter \"%s\" %f %f", pp.Name, pp.Start, pp.End))
+		if pp.Loop != 0 {
+			writer.WriteString(fmt.Sprintf(" loop %f", pp.Loop))
+		}
+		writer.WriteString("\n")
+	}
+}
+
+func writeKeyValues(writer *bufio.Writer, mdl *studio.Mdl) {
+	if len(mdl.KeyValues) == 0 {
+		return
 	}
 
+	writer.WriteString("\n$keyvalues\n{\n")
+	writer.WriteString(strings.TrimSpace(mdl.KeyValues))
+	writer.WriteString("\n}\n")
+}
+
+// keepSequenceGroups tells whether the sequence groups can be kept: every
+// $sequencegroup opens the next group, so the sequences of the default group
+// have to come first and the others follow in the order of their groups. The
+// group sizes $sequencegroupsize splits by are not stored in the model. When
+// the groups can not be kept, all the sequences go to the default group.
+func keepSequenceGroups(log io.Writer, mdl *studio.Mdl) bool {
+	var seqGroup uint32
+	for _, seq := range mdl.Sequences {
+		if seq.SeqGroup > 0 && int(seq.SeqGroup) >= len(mdl.SeqGroups) {
+			studio.Warnf(log, "Sequence %s is in group %d of %d, all the sequences are written to the default group",
+				seq.Label, seq.SeqGroup, len(mdl.SeqGroups))
+			return false
+		}
+		if seq.SeqGroup < seqGroup {
+			studio.Warnf(log, "Sequence %s of group %d follows group %d, all the sequences are written to the default group",
+				seq.Label, seq.SeqGroup, seqGroup)
+			return false
+		}
+		seqGroup = seq.SeqGroup
+	}
+	return true
+}
+
+func writeSequenceInfo(writer *bufio.Writer, log io.Writer, mdl *studio.Mdl) {
 	if mdl.Header.SequencesNum > 0 {
 		writer.WriteString(fmt.Sprintf("\n// %d animation sequence(s)\n", mdl.Header.SequencesNum))
 	}
 
+	var (
+		seqGroup   uint32
+		keepGroups = keepSequenceGroups(log, mdl)
+	)
 	for _, seq := range mdl.Sequences {
+		for keepGroups && seqGroup < seq.SeqGroup {
+			seqGroup++
+			writer.WriteString(fmt.Sprintf("$sequencegroup \"%s\"\n", mdl.SeqGroups[seqGroup].Label))
+		}
+
 		writer.WriteString(fmt.Sprintf("$sequence \"%s\" ", seq.Label))
 
 		if seq.BlendsNum > 1 {
@@ -354,14 +251,14 @@ func writeSequenceInfo(writer *bufio.Writer, mdl *Mdl) {
 				writer.WriteString(fmt.Sprintf("\"anims/%s_blend2\" ", seq.Label))
 			}
 			writer.WriteString(fmt.Sprintf("blend %s %.0f %.0f",
-				getMotionTypeString(int(seq.BlendTypes[0]), false),
+				studio.MotionTypeString(int(seq.BlendTypes[0]), false),
 				seq.BlendStart[0], seq.BlendEnd[0]))
 		} else {
 			writer.WriteString(fmt.Sprintf("\"anims/%s\"", seq.Label))
 		}
 
 		if seq.MotionType > 0 {
-			writer.WriteString(getMotionTypeString(int(seq.MotionType), true))
+			writer.WriteString(studio.MotionTypeString(int(seq.MotionType), true))
 		}
 
 		writer.WriteString(fmt.Sprintf(" fps %.0f ", seq.FPS))
@@ -371,11 +268,11 @@ func writeSequenceInfo(writer *bufio.Writer, mdl *Mdl) {
 		}
 
 		if seq.Activity > 0 {
-			if int(seq.Activity) < len(activityNames) {
+			if int(seq.Activity) < len(studio.ActivityNames) {
 				writer.WriteString(fmt.Sprintf("%s %d ",
-					activityNames[seq.Activity], seq.ActWight))
+					studio.ActivityNames[seq.Activity], seq.ActWight))
 			} else {
-				fmt.Printf("WARNING: Sequence %s has a custom activity flag (ACT_%d %d).\n",
+				studio.Warnf(log, "Sequence %s has a custom activity flag (ACT_%d %d)",
 					seq.Label, seq.Activity, seq.ActWight)
 				writer.WriteString(fmt.Sprintf("ACT_%d %d ",
 					seq.Activity, seq.ActWight))
@@ -394,6 +291,14 @@ func writeSequenceInfo(writer *bufio.Writer, mdl *Mdl) {
 			}
 		}
 
+		for j, pv := range seq.Pivots {
+			writer.WriteString(fmt.Sprintf("pivot %d %d %d ", j, pv.Start, pv.End))
+			if pv.Org != (studio.Vector3_32{}) {
+				studio.Warnf(log, "Sequence %s pivot %d has an origin (%f %f %f) that QC can not keep",
+					seq.Label, j, pv.Org.X, pv.Org.Y, pv.Org.Z)
+			}
+		}
+
 		if seq.EventsNum > 2 {
 			writer.WriteString("{\n ")
 			for _, ev := range seq.Events {
@@ -426,14 +331,33 @@ func writeSequenceInfo(writer *bufio.Writer, mdl *Mdl) {
 			writer.WriteString("}\n")
 		}
 
-		if seq.PivotsNum > 0 {
-			fmt.Printf("WARNING: Sequence %s uses %d foot pivots, feature not supported.\n",
-				seq.Label, seq.PivotsNum)
+	}
+}
+
+// checkTransitions warns about transitions that the node, transition and
+// rtransition options of the sequences will not regenerate.
+func checkTransitions(log io.Writer, mdl *studio.Mdl) {
+	const maxWarnings = 10
+
+	mismatches := studio.CheckTransitions(mdl.Transitions, mdl.Sequences)
+	for i, m := range mismatches {
+		if i == maxWarnings {
+			studio.Warnf(log, "%d more transitions differ from the QC options", len(mismatches)-maxWarnings)
+			break
 		}
+		studio.Warnf(log, "Transition from node %d to node %d goes through node %d, QC options give %d",
+			m.From, m.To, m.Node, m.Expected)
 	}
 }
 
-func saveQCScript(outPath string, mdl *Mdl) error {
+// Save writes the QC script describing mdl to outPath.
+func Save(outPath string, mdl *studio.Mdl) error {
+	return SaveLog(outPath, mdl, os.Stdout)
+}
+
+// SaveLog is Save printing the warnings and the written file to log instead
+// of the standard output.
+func SaveLog(outPath string, mdl *studio.Mdl, log io.Writer) error {
 	var (
 		err    error
 		file   *os.File
@@ -451,12 +375,11 @@ func saveQCScript(outPath string, mdl *Mdl) error {
 	defer file.Close()
 
 	writer = bufio.NewWriter(file)
-	defer writer.Flush()
 
 	writer.WriteString("/*\n")
 	writer.WriteString("==============================================================================\n\n")
 	writer.WriteString(fmt.Sprintf("QC script generated by Half-Life Studio Model Decompiler on Go %s\n\n",
-		appVersion))
+		studio.Version))
 	writer.WriteString(fmt.Sprintf("%s\n\n", mdl.FilePath))
 	writer.WriteString("Original internal name:\n")
 	writer.WriteString(fmt.Sprintf("\"%s\"\n\n", mdl.Header.Name))
@@ -475,14 +398,25 @@ func saveQCScript(outPath string, mdl *Mdl) error {
 
 	if mdl.Header.Flags != 0 {
 		writer.WriteString(fmt.Sprintf("$flags %d\n", mdl.Header.Flags))
-		fmt.Printf("WARNING: This model uses the $flags keyword set to %d\n", mdl.Header.Flags)
+		studio.Warnf(log, "This model uses the $flags keyword set to %d", mdl.Header.Flags)
+	}
+
+	if hdr2 := mdl.Header2; hdr2 != nil && (hdr2.IKChainsNum > 0 || hdr2.IKAutoplayLocksNum > 0) {
+		studio.Warnf(log, "This model has %d IK chains and %d IK autoplay locks that are not supported",
+			hdr2.IKChainsNum, hdr2.IKAutoplayLocksNum)
+	}
+
+	// studiomdl never fills the sound tables and their layout is not defined
+	if mdl.Header.SoundsOff != 0 || mdl.Header.SoundGroupsNum != 0 {
+		studio.Warnf(log, "This model has sound tables (%d sound groups) that QC can not keep",
+			mdl.Header.SoundGroupsNum)
 	}
 
 	writer.WriteString("\n")
 	writer.WriteString(fmt.Sprintf("$bbox %f %f %f",
-		mdl.Header.BBMin.X, mdl.Header.BBMin.Y, mdl.Header.BBMin.Z))
+		mdl.Header.Min.X, mdl.Header.Min.Y, mdl.Header.Min.Z))
 	writer.WriteString(fmt.Sprintf(" %f %f %f\n",
-		mdl.Header.BBMax.X, mdl.Header.BBMax.Y, mdl.Header.BBMax.Z))
+		mdl.Header.Max.X, mdl.Header.Max.Y, mdl.Header.Max.Z))
 	writer.WriteString(fmt.Sprintf("$cbox %f %f %f",
 		mdl.Header.BBMin.X, mdl.Header.BBMin.Y, mdl.Header.BBMin.Z))
 	writer.WriteString(fmt.Sprintf(" %f %f %f\n",
@@ -495,12 +429,19 @@ func saveQCScript(outPath string, mdl *Mdl) error {
 	writeTextureRenderMode(writer, mdl)
 	writeSkinFamilyInfo(writer, mdl)
 	writeAttachmentInfo(writer, mdl)
+	writePivotInfo(writer, mdl)
 	writeControllerInfo(writer, mdl)
+	writePoseParameterInfo(writer, mdl)
 	writeHitBoxInfo(writer, mdl)
-	writeSequenceInfo(writer, mdl)
+	writeKeyValues(writer, mdl)
+	writeSequenceInfo(writer, log, mdl)
+	checkTransitions(log, mdl)
 
 	writer.WriteString("\n// End of QC script.\n")
+	if err = writer.Flush(); err != nil {
+		return err
+	}
 
-	fmt.Printf("QC Script: %s\n", filepath.Base(outPath))
+	fmt.Fprintf(log, "QC Script: %s\n", filepath.Base(outPath))
 	return nil
 }
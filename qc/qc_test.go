@@ -0,0 +1,316 @@
+package qc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/internal/studiotest"
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// saveText writes the QC of a model and returns it.
+func saveText(t *testing.T, mdl *studio.Mdl) string {
+	dir, err := ioutil.TempDir("", "qc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.qc")
+	if err = SaveLog(path, mdl, new(bytes.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSaveBoxesAndRenderModes(t *testing.T) {
+	mdl := studiotest.Model(studiotest.Options{Textures: 3, Extra: true})
+	mdl.FilePath = "test.mdl"
+	mdl.Header.TexturesNum = uint32(len(mdl.Textures))
+	mdl.Textures[0].Flags = studio.StudioNfMasked
+	mdl.Textures[1].Flags = studio.StudioNfSolid
+	mdl.Textures[2].Flags = studio.StudioNfMasked | studio.StudioNfSolid
+
+	text := saveText(t, mdl)
+	for _, line := range []string{
+		"$bbox -16.000000 -16.000000 0.000000 16.000000 16.000000 72.000000\n",
+		"$cbox -20.000000 -20.000000 -2.000000 20.000000 20.000000 80.000000\n",
+		"$texrendermode \"test_skin0.bmp\" \"masked\" \n",
+		"$texrendermode \"test_skin1.bmp\" \"masked_solid\" \n",
+		"$texrendermode \"test_skin2.bmp\" \"masked\" \n",
+		"$texrendermode \"test_skin2.bmp\" \"masked_solid\" \n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("missing %q", line)
+		}
+	}
+	if strings.Contains(text, "\"test_skin0.bmp\" \"masked_solid\"") {
+		t.Error("a masked texture without StudioNfSolid is written as masked_solid")
+	}
+	if strings.Contains(text, "\"test_skin1.bmp\" \"masked\" ") {
+		t.Error("a solid texture without StudioNfMasked is written as masked")
+	}
+}
+
+// TestSavePivots checks the known limitation of the pivots: they are all
+// declared on the root bone and their origins are only warned about.
+func TestSavePivots(t *testing.T) {
+	mdl := studiotest.Model(studiotest.Options{Bones: 2, Sequences: 2, Frames: 4, Vertices: 4})
+	mdl.FilePath = "test.mdl"
+	seq := mdl.Sequences[1]
+	seq.Pivots = []*studio.StudioPivot{{Start: 0, End: 2}, {Org: studio.Vector3_32{X: 1}, Start: 1, End: 3}}
+	seq.PivotsNum = 2
+
+	dir, err := ioutil.TempDir("", "qc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.qc")
+	buf := new(bytes.Buffer)
+	log := studio.NewLog(buf)
+	if err = SaveLog(path, mdl, log); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "[WARNING] Sequence seq1 pivot 1 has an origin"); n != 1 {
+		t.Errorf("log %q, want one warning for the pivot origin", buf.String())
+	}
+	if strings.Contains(buf.String(), "pivot 0") {
+		t.Errorf("log %q warns about the pivot without origin", buf.String())
+	}
+
+	script, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := mdl.Bones[0].Name.String()
+	if len(script.Pivots) != 2 || script.Pivots[0].Bone != root || script.Pivots[1].Bone != root {
+		t.Errorf("pivots %+v, want 2 on %s", script.Pivots, root)
+	}
+	pivots := script.Sequences[1].Pivots
+	if len(pivots) != 2 || pivots[1].Index != 1 || pivots[1].Start != 1 || pivots[1].End != 3 {
+		t.Errorf("sequence pivots %+v", pivots)
+	}
+}
+
+// TestSaveSequenceGroups checks that the groups of a model are kept by
+// $sequencegroup and that the sequences of groups the script can not keep
+// are written to the default group.
+func TestSaveSequenceGroups(t *testing.T) {
+	mdl, err := studio.Load(filepath.Join("..", "testdata", "boxgroup.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := saveText(t, mdl); !strings.Contains(text, "$sequencegroup \"anims\"\n$sequence \"wave\"") {
+		t.Errorf("the sequence group is not kept:\n%s", text)
+	}
+
+	last := mdl.Sequences[len(mdl.Sequences)-1]
+	mdl.Sequences[0].SeqGroup, last.SeqGroup = last.SeqGroup, 0
+	dir, err := ioutil.TempDir("", "qc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "groups.qc")
+	log := new(bytes.Buffer)
+	if err = SaveLog(path, mdl, log); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log.String(), "all the sequences are written to the default group") {
+		t.Errorf("out of order groups are not warned about: %q", log.String())
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	if strings.Contains(text, "$sequencegroup") {
+		t.Errorf("out of order groups are kept:\n%s", text)
+	}
+	for _, seq := range mdl.Sequences {
+		if !strings.Contains(text, fmt.Sprintf("$sequence \"%s\"", seq.Label)) {
+			t.Errorf("sequence %s is not written", seq.Label)
+		}
+	}
+}
+
+// loadModel encodes a test model with its sequence group files and loads it
+// back, so that the header counts the QC writer reads are set.
+func loadModel(t *testing.T, mdl *studio.Mdl) *studio.Mdl {
+	data, groups, err := mdl.EncodeFiles("test.mdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files = make(map[string][]byte)
+	for i := 1; i < len(groups); i++ {
+		files[fmt.Sprintf("test%02d.mdl", i)] = groups[i]
+	}
+	loaded, err := studio.LoadFrom(bytes.NewReader(data), "test.mdl", studio.BytesResolver(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+// TestSaveParse saves the QC of decoded models, parses it and checks that the
+// script describes the models.
+func TestSaveParse(t *testing.T) {
+	box, err := studio.Load(filepath.Join("..", "testdata", "box.mdl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := loadModel(t, studiotest.Model(studiotest.Options{Bones: 3, Sequences: 3, Frames: 4, Blends: 2,
+		BodyParts: 2, Vertices: 4, Textures: 2, Extra: true}))
+
+	for _, mdl := range []*studio.Mdl{box, generated} {
+		name := filepath.Base(mdl.FilePath)
+		script, err := Parse([]byte(saveText(t, mdl)), "test.qc")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkScript(t, name, mdl, script)
+	}
+}
+
+func checkScript(t *testing.T, name string, mdl *studio.Mdl, qc *Script) {
+	errorf := func(format string, args ...interface{}) {
+		t.Errorf("%s: %s", name, fmt.Sprintf(format, args...))
+	}
+	boneName := func(i uint32) string {
+		return mdl.Bones[i].Name.String()
+	}
+
+	hdr := mdl.Header
+	if qc.ModelName != name {
+		errorf("$modelname %q", qc.ModelName)
+	}
+	if qc.BBox != [2]studio.Vector3_32{hdr.Min, hdr.Max} || qc.CBox != [2]studio.Vector3_32{hdr.BBMin, hdr.BBMax} {
+		errorf("$bbox %v, $cbox %v", qc.BBox, qc.CBox)
+	}
+	if qc.EyePosition != hdr.EyePosition {
+		errorf("$eyeposition %v", qc.EyePosition)
+	}
+
+	if len(qc.BodyGroups) != len(mdl.BodyParts) {
+		errorf("%d body groups, want %d", len(qc.BodyGroups), len(mdl.BodyParts))
+	} else {
+		for i, bp := range mdl.BodyParts {
+			bg := qc.BodyGroups[i]
+			if bg.Name != bp.Name.String() || len(bg.Models) != len(bp.Models) || bg.Models[0].Name != bp.Models[0].Name.String() {
+				errorf("body group %d is %q with %d models", i, bg.Name, len(bg.Models))
+			}
+		}
+	}
+
+	if len(qc.Attachments) != len(mdl.Attachments) {
+		errorf("%d attachments, want %d", len(qc.Attachments), len(mdl.Attachments))
+	} else {
+		for i, a := range mdl.Attachments {
+			if got := qc.Attachments[i]; got.Bone != boneName(a.Bone) || got.Origin != a.Origins {
+				errorf("attachment %d on %q at %v", i, got.Bone, got.Origin)
+			}
+		}
+	}
+
+	if len(qc.Controllers) != len(mdl.BoneControllers) {
+		errorf("%d controllers, want %d", len(qc.Controllers), len(mdl.BoneControllers))
+	} else {
+		for i, bc := range mdl.BoneControllers {
+			got := qc.Controllers[i]
+			if got.Index != int(bc.Index) || got.Bone != boneName(uint32(bc.Bone)) || got.Type != bc.Type ||
+				got.Start != bc.Start || got.End != bc.End {
+				errorf("controller %d is %+v", i, *got)
+			}
+		}
+	}
+
+	var sets = make(map[string]*HitBoxSet)
+	for _, set := range qc.HitBoxSets {
+		sets[set.Name] = set
+	}
+	check := func(setName string, want []*studio.StudioHitBox, got []*HitBox) {
+		if len(got) != len(want) {
+			errorf("%d hit boxes in %q, want %d", len(got), setName, len(want))
+			return
+		}
+		for i, hb := range want {
+			if got[i].Group != int(hb.Group) || got[i].Bone != boneName(hb.Bone) ||
+				got[i].BBMin != hb.BBMin || got[i].BBMax != hb.BBMax {
+				errorf("hit box %d of %q is %+v", i, setName, *got[i])
+			}
+		}
+	}
+	check("", mdl.HitBoxes, qc.HitBoxes)
+	for _, set := range mdl.HitBoxSets {
+		if setName := set.Name.String(); setName != "default" {
+			if sets[setName] == nil {
+				errorf("missing hit box set %q", setName)
+			} else {
+				check(setName, set.HitBoxes, sets[setName].HitBoxes)
+			}
+		}
+	}
+
+	if len(qc.PoseParameters) != len(mdl.PoseParams) {
+		errorf("%d pose parameters, want %d", len(qc.PoseParameters), len(mdl.PoseParams))
+	} else {
+		for i, pp := range mdl.PoseParams {
+			if got := qc.PoseParameters[i]; got.Name != pp.Name.String() || got.Start != pp.Start || got.End != pp.End || got.Loop != pp.Loop {
+				errorf("pose parameter %d is %+v", i, *got)
+			}
+		}
+	}
+	if strings.TrimSpace(qc.KeyValues) != strings.TrimSpace(mdl.KeyValues) {
+		errorf("$keyvalues %q", qc.KeyValues)
+	}
+
+	if len(qc.Sequences) != len(mdl.Sequences) {
+		errorf("%d sequences, want %d", len(qc.Sequences), len(mdl.Sequences))
+		return
+	}
+	for i, seq := range mdl.Sequences {
+		got := qc.Sequences[i]
+		if got.Name != seq.Label.String() || got.Group != int(seq.SeqGroup) || got.FPS != seq.FPS ||
+			got.Loop != (seq.Flags == 1) || got.MotionType != seq.MotionType ||
+			got.Activity != int(seq.Activity) || seq.Activity > 0 && got.ActWeight != int(seq.ActWight) ||
+			got.EntryNode != seq.EntryNode || got.ExitNode != seq.ExitNode {
+			errorf("sequence %d is %+v", i, *got)
+		}
+		if len(got.Files) != int(seq.BlendsNum) {
+			errorf("sequence %s has %d files, want %d", got.Name, len(got.Files), seq.BlendsNum)
+		}
+		if seq.BlendsNum > 1 && (len(got.Blends) != 1 || got.Blends[0].Type != seq.BlendTypes[0] ||
+			got.Blends[0].Start != seq.BlendStart[0] || got.Blends[0].End != seq.BlendEnd[0]) {
+			errorf("sequence %s blends %v", got.Name, got.Blends)
+		}
+		if len(got.Events) != len(seq.Events) {
+			errorf("sequence %s has %d events, want %d", got.Name, len(got.Events), len(seq.Events))
+		} else {
+			for j, ev := range seq.Events {
+				if e := got.Events[j]; e.Event != ev.Event || e.Frame != int(ev.Frame) || e.Options != ev.Options.String() {
+					errorf("sequence %s event %d is %+v", got.Name, j, *e)
+				}
+			}
+		}
+		if len(got.Pivots) != len(seq.Pivots) {
+			errorf("sequence %s has %d pivots, want %d", got.Name, len(got.Pivots), len(seq.Pivots))
+		} else {
+			for j, pv := range seq.Pivots {
+				if p := got.Pivots[j]; p.Index != j || p.Start != int(pv.Start) || p.End != int(pv.End) {
+					errorf("sequence %s pivot %d is %+v", got.Name, j, *p)
+				}
+			}
+		}
+	}
+}
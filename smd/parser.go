@@ -0,0 +1,422 @@
+package smd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+type Error struct {
+	File         string
+	Line, Column int
+	Msg          string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+}
+
+type File struct {
+	FileName  string
+	Version   int
+	Nodes     []*Node
+	Frames    []*Frame
+	Triangles []*Triangle
+}
+
+type Node struct {
+	Name   string
+	Parent int
+}
+
+type Frame struct {
+	Time  int
+	Bones []*BonePose
+}
+
+type BonePose struct {
+	Bone     int
+	Position studio.Vector3_32
+	Rotation studio.Vector3_32
+}
+
+type Triangle struct {
+	Line     int
+	Material string
+	Vertices [3]*Vertex
+}
+
+type Vertex struct {
+	Bone     int
+	Position studio.Vector3_32
+	Normal   studio.Vector3_32
+	U, V     float32
+	Links    []Link // vertex weights of the Xash3D extension
+}
+
+type Link struct {
+	Bone   int
+	Weight float32
+}
+
+type smdField struct {
+	text string
+	col  int
+}
+
+type smdParser struct {
+	fileName string
+	scanner  *bufio.Scanner
+	line     int
+	text     string
+	fields   []smdField
+	err      *Error
+}
+
+func (p *smdParser) errorf(col int, format string, args ...interface{}) bool {
+	if p.err == nil {
+		p.err = &Error{p.fileName, p.line, col, fmt.Sprintf(format, args...)}
+	}
+	return false
+}
+
+// nextLine advances to the next non-empty line and splits it into fields.
+func (p *smdParser) nextLine() bool {
+	for p.scanner.Scan() {
+		p.line++
+		p.text = strings.TrimRight(p.scanner.Text(), "\r")
+		if !p.splitLine() {
+			return false
+		}
+		if len(p.fields) > 0 {
+			return true
+		}
+	}
+	if err := p.scanner.Err(); err != nil {
+		p.errorf(1, "%s", err)
+	}
+	return false
+}
+
+func (p *smdParser) splitLine() bool {
+	p.fields = p.fields[:0]
+	text := p.text
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '/' && i+1 < len(text) && text[i+1] == '/':
+			return true
+		case c == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				return p.errorf(i+1, "unterminated string")
+			}
+			p.fields = append(p.fields, smdField{text[i+1 : i+1+end], i + 1})
+			i += end + 2
+		default:
+			end := i
+			for end < len(text) && text[end] != ' ' && text[end] != '\t' {
+				end++
+			}
+			p.fields = append(p.fields, smdField{text[i:end], i + 1})
+			i = end
+		}
+	}
+	return true
+}
+
+func (p *smdParser) is(keyword string) bool {
+	return len(p.fields) > 0 && strings.EqualFold(p.fields[0].text, keyword)
+}
+
+func (p *smdParser) expectFields(num int, what string) bool {
+	if len(p.fields) < num {
+		return p.errorf(len(p.text)+1, "expected %d values for %s, got %d", num, what, len(p.fields))
+	}
+	return true
+}
+
+func (p *smdParser) int(i int, what string) (int, bool) {
+	val, err := strconv.Atoi(p.fields[i].text)
+	if err != nil {
+		return 0, p.errorf(p.fields[i].col, "expected integer %s, got %q", what, p.fields[i].text)
+	}
+	return val, true
+}
+
+func (p *smdParser) float(i int, what string) (float32, bool) {
+	val, err := strconv.ParseFloat(p.fields[i].text, 32)
+	if err != nil {
+		return 0, p.errorf(p.fields[i].col, "expected number %s, got %q", what, p.fields[i].text)
+	}
+	return float32(val), true
+}
+
+func (p *smdParser) vector(i int, what string) (studio.Vector3_32, bool) {
+	var (
+		vec studio.Vector3_32
+		ok  bool
+	)
+	if vec.X, ok = p.float(i, what); !ok {
+		return vec, false
+	}
+	if vec.Y, ok = p.float(i+1, what); !ok {
+		return vec, false
+	}
+	vec.Z, ok = p.float(i+2, what)
+	return vec, ok
+}
+
+func (p *smdParser) bone(i int, smd *File) (int, bool) {
+	bone, ok := p.int(i, "bone index")
+	if !ok {
+		return 0, false
+	}
+	if bone < 0 || bone >= len(smd.Nodes) {
+		return 0, p.errorf(p.fields[i].col, "bone index %d is out of range", bone)
+	}
+	return bone, true
+}
+
+// Load reads and parses the SMD file at path.
+func Load(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, path)
+}
+
+// Parse reads a reference or animation SMD, including the vertex weight
+// links written for models with StudioHasBoneWeights.
+func Parse(data []byte, fileName string) (*File, error) {
+	p := &smdParser{fileName: fileName, scanner: bufio.NewScanner(bytes.NewReader(data))}
+	smd := &File{FileName: fileName}
+
+	if !p.nextLine() {
+		if p.err != nil {
+			return nil, p.err
+		}
+		return nil, &Error{fileName, p.line + 1, 1, "empty file"}
+	}
+	if !p.is("version") || !p.expectFields(2, "version") {
+		p.errorf(1, "expected version line")
+		return nil, p.err
+	}
+	version, ok := p.int(1, "version")
+	if !ok {
+		return nil, p.err
+	}
+	if version != 1 {
+		p.errorf(p.fields[1].col, "unsupported version %d", version)
+		return nil, p.err
+	}
+	smd.Version = version
+
+	for p.nextLine() {
+		switch {
+		case p.is("nodes"):
+			ok = p.parseNodes(smd)
+		case p.is("skeleton"):
+			ok = p.parseSkeleton(smd)
+		case p.is("triangles"):
+			ok = p.parseTriangles(smd)
+		case p.is("vertexanimation"):
+			ok = p.skipSection()
+		default:
+			ok = p.errorf(p.fields[0].col, "unknown section %q", p.fields[0].text)
+		}
+		if !ok {
+			break
+		}
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	return smd, nil
+}
+
+func (p *smdParser) unexpectedEOF(section string) bool {
+	if p.err != nil {
+		return false
+	}
+	p.line++
+	return p.errorf(1, "unexpected end of file in %s section", section)
+}
+
+func (p *smdParser) skipSection() bool {
+	for p.nextLine() {
+		if p.is("end") {
+			return true
+		}
+	}
+	return p.unexpectedEOF("vertexanimation")
+}
+
+func (p *smdParser) parseNodes(smd *File) bool {
+	if smd.Nodes != nil {
+		return p.errorf(1, "duplicate nodes section")
+	}
+	smd.Nodes = make([]*Node, 0)
+
+	for p.nextLine() {
+		if p.is("end") {
+			return true
+		}
+		if !p.expectFields(3, "node") {
+			return false
+		}
+
+		index, ok := p.int(0, "node index")
+		if !ok {
+			return false
+		}
+		if index != len(smd.Nodes) {
+			return p.errorf(p.fields[0].col, "expected node index %d, got %d", len(smd.Nodes), index)
+		}
+
+		parent, ok := p.int(2, "parent index")
+		if !ok {
+			return false
+		}
+		if parent < -1 || parent >= index {
+			return p.errorf(p.fields[2].col, "invalid parent %d for node %d", parent, index)
+		}
+
+		smd.Nodes = append(smd.Nodes, &Node{Name: p.fields[1].text, Parent: parent})
+	}
+	return p.unexpectedEOF("nodes")
+}
+
+func (p *smdParser) parseSkeleton(smd *File) bool {
+	var frame *Frame
+
+	if smd.Nodes == nil {
+		return p.errorf(1, "skeleton section before nodes section")
+	}
+
+	for p.nextLine() {
+		switch {
+		case p.is("end"):
+			return true
+
+		case p.is("time"):
+			if !p.expectFields(2, "time") {
+				return false
+			}
+			time, ok := p.int(1, "frame time")
+			if !ok {
+				return false
+			}
+			frame = &Frame{Time: time}
+			smd.Frames = append(smd.Frames, frame)
+
+		default:
+			if frame == nil {
+				return p.errorf(p.fields[0].col, "bone position outside of a time block")
+			}
+			if !p.expectFields(7, "bone position") {
+				return false
+			}
+
+			var ok bool
+			pose := new(BonePose)
+			if pose.Bone, ok = p.bone(0, smd); !ok {
+				return false
+			}
+			if pose.Position, ok = p.vector(1, "position"); !ok {
+				return false
+			}
+			if pose.Rotation, ok = p.vector(4, "rotation"); !ok {
+				return false
+			}
+			frame.Bones = append(frame.Bones, pose)
+		}
+	}
+	return p.unexpectedEOF("skeleton")
+}
+
+func (p *smdParser) parseTriangles(smd *File) bool {
+	if smd.Nodes == nil {
+		return p.errorf(1, "triangles section before nodes section")
+	}
+
+	for p.nextLine() {
+		if p.is("end") {
+			return true
+		}
+
+		tri := &Triangle{Line: p.line, Material: strings.TrimSpace(p.text)}
+		for i := 0; i < 3; i++ {
+			if !p.nextLine() {
+				return p.unexpectedEOF("triangles")
+			}
+			v, ok := p.parseVertex(smd)
+			if !ok {
+				return false
+			}
+			tri.Vertices[i] = v
+		}
+		smd.Triangles = append(smd.Triangles, tri)
+	}
+	return p.unexpectedEOF("triangles")
+}
+
+func (p *smdParser) parseVertex(smd *File) (*Vertex, bool) {
+	var ok bool
+
+	if !p.expectFields(9, "vertex") {
+		return nil, false
+	}
+
+	v := new(Vertex)
+	if v.Bone, ok = p.bone(0, smd); !ok {
+		return nil, false
+	}
+	if v.Position, ok = p.vector(1, "position"); !ok {
+		return nil, false
+	}
+	if v.Normal, ok = p.vector(4, "normal"); !ok {
+		return nil, false
+	}
+	if v.U, ok = p.float(7, "u"); !ok {
+		return nil, false
+	}
+	if v.V, ok = p.float(8, "v"); !ok {
+		return nil, false
+	}
+
+	if len(p.fields) == 9 {
+		return v, true
+	}
+
+	linksNum, ok := p.int(9, "links number")
+	if !ok {
+		return nil, false
+	}
+	if linksNum < 0 || linksNum > studio.MaxBoneWeights {
+		return nil, p.errorf(p.fields[9].col, "invalid number of links %d", linksNum)
+	}
+	if len(p.fields) != 10+linksNum*2 {
+		return nil, p.errorf(len(p.text)+1, "expected %d values for %d links, got %d",
+			linksNum*2, linksNum, len(p.fields)-10)
+	}
+
+	v.Links = make([]Link, linksNum)
+	for i := range v.Links {
+		if v.Links[i].Bone, ok = p.bone(10+i*2, smd); !ok {
+			return nil, false
+		}
+		if v.Links[i].Weight, ok = p.float(11+i*2, "link weight"); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,112 @@
+package smd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+const testSMD = `version 1
+// a comment line
+nodes
+  0 "root" -1
+  1 "arm bone" 0
+end
+skeleton
+time 0
+  0 0 0 0 0 0 0
+  1 0 0 8 0.5 0 -0.5
+time 1
+  1 1 2 3 0 0 0
+end
+triangles
+skin.bmp
+0 0 0 0 0 0 1 0 0
+1 1 0 8 0 0 1 1 0 2 0 0.75 1 0.25
+1 0 1 8 0 0 1 0 1 1 1 1
+end
+`
+
+func TestParse(t *testing.T) {
+	smd, err := Parse([]byte(testSMD), "test.smd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if smd.Version != 1 {
+		t.Errorf("version %d", smd.Version)
+	}
+	if want := []*Node{{"root", -1}, {"arm bone", 0}}; !reflect.DeepEqual(smd.Nodes, want) {
+		t.Errorf("nodes %v", smd.Nodes)
+	}
+
+	want := []*Frame{
+		{Time: 0, Bones: []*BonePose{{Bone: 0}, {Bone: 1, Position: studio.Vector3_32{Z: 8}, Rotation: studio.Vector3_32{X: 0.5, Z: -0.5}}}},
+		{Time: 1, Bones: []*BonePose{{Bone: 1, Position: studio.Vector3_32{X: 1, Y: 2, Z: 3}}}},
+	}
+	if !reflect.DeepEqual(smd.Frames, want) {
+		t.Errorf("frames differ")
+	}
+
+	if len(smd.Triangles) != 1 {
+		t.Fatalf("%d triangles", len(smd.Triangles))
+	}
+	tri := smd.Triangles[0]
+	if tri.Material != "skin.bmp" || tri.Line != 15 {
+		t.Errorf("triangle of %q at line %d", tri.Material, tri.Line)
+	}
+	wantVerts := [3]*Vertex{
+		{Bone: 0, Normal: studio.Vector3_32{Z: 1}},
+		{Bone: 1, Position: studio.Vector3_32{X: 1, Z: 8}, Normal: studio.Vector3_32{Z: 1}, U: 1,
+			Links: []Link{{0, 0.75}, {1, 0.25}}},
+		{Bone: 1, Position: studio.Vector3_32{Y: 1, Z: 8}, Normal: studio.Vector3_32{Z: 1}, V: 1,
+			Links: []Link{{1, 1}}},
+	}
+	for i := range wantVerts {
+		if !reflect.DeepEqual(tri.Vertices[i], wantVerts[i]) {
+			t.Errorf("vertex %d is %+v, want %+v", i, *tri.Vertices[i], *wantVerts[i])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	const header = "version 1\nnodes\n0 \"root\" -1\n1 \"arm\" 0\nend\n"
+	tests := []struct {
+		name string
+		smd  string
+		err  string
+	}{
+		{"empty", "\n\n", "test.smd:3:1: empty file"},
+		{"no version", "nodes\nend\n", "test.smd:1:1: expected version line"},
+		{"version", "version 2\n", "test.smd:1:9: unsupported version 2"},
+		{"section", "version 1\nbones\n", "test.smd:2:1: unknown section \"bones\""},
+		{"node index", "version 1\nnodes\n1 \"root\" -1\nend\n", "test.smd:3:1: expected node index 0, got 1"},
+		{"node parent", "version 1\nnodes\n  0 \"root\" 0\nend\n", "test.smd:3:12: invalid parent 0 for node 0"},
+		{"open nodes", "version 1\nnodes\n0 \"root\" -1\n", "test.smd:4:1: unexpected end of file in nodes section"},
+		{"unterminated name", "version 1\nnodes\n0 \"root -1\n", "test.smd:3:3: unterminated string"},
+		{"skeleton first", "version 1\nskeleton\n", "test.smd:2:1: skeleton section before nodes section"},
+		{"pose outside time", header + "skeleton\n0 0 0 0 0 0 0\nend\n", "test.smd:7:1: bone position outside of a time block"},
+		{"pose bone", header + "skeleton\ntime 0\n2 0 0 0 0 0 0\nend\n", "test.smd:8:1: bone index 2 is out of range"},
+		{"pose value", header + "skeleton\ntime 0\n0 0 x 0 0 0 0\nend\n", "test.smd:8:5: expected number position, got \"x\""},
+		{"short pose", header + "skeleton\ntime 0\n0 0 0 0\nend\n", "test.smd:8:8: expected 7 values for bone position, got 4"},
+		{"vertex bone", header + "triangles\nskin.bmp\n0 0 0 0 0 0 1 0 0\n5 0 0 0 0 0 1 0 0\n", "test.smd:9:1: bone index 5 is out of range"},
+		{"open triangle", header + "triangles\nskin.bmp\n0 0 0 0 0 0 1 0 0\n", "test.smd:9:1: unexpected end of file in triangles section"},
+		{"links number", header + "triangles\nskin.bmp\n0 0 0 0 0 0 1 0 0 5 0 1\n", "test.smd:8:19: invalid number of links 5"},
+		{"links values", header + "triangles\nskin.bmp\n0 0 0 0 0 0 1 0 0 2 0 1\n", "test.smd:8:24: expected 4 values for 2 links, got 2"},
+		{"link bone", header + "triangles\nskin.bmp\n0 0 0 0 0 0 1 0 0 2 0 0.5 2 0.5\n", "test.smd:8:27: bone index 2 is out of range"},
+		{"negative link bone", header + "triangles\nskin.bmp\n0 0 0 0 0 0 1 0 0 1 -1 1\n", "test.smd:8:21: bone index -1 is out of range"},
+		{"link weight", header + "triangles\nskin.bmp\n0 0 0 0 0 0 1 0 0 1 0 heavy\n", "test.smd:8:23: expected number link weight, got \"heavy\""},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.smd), "test.smd")
+		if err == nil {
+			t.Errorf("%s: no error, want %s", tt.name, tt.err)
+			continue
+		}
+		if _, ok := err.(*Error); !ok || err.Error() != tt.err {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.err)
+		}
+	}
+}
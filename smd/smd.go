@@ -0,0 +1,352 @@
+package smd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// pose holds the default pose of a model, computed once per SaveReferences
+// call so that several models can be written at the same time.
+type pose struct {
+	boneTransforms []*studio.Matrix3x4
+	worldTransform []*studio.Matrix3x4
+}
+
+func newPose(mdl *studio.Mdl) *pose {
+	boneTransforms := studio.CalcBoneTransforms(mdl.Bones)
+	return &pose{
+		boneTransforms: boneTransforms,
+		worldTransform: studio.CalcSkinTransforms(boneTransforms, mdl.BonesInfo),
+	}
+}
+
+func (p *pose) skinMatrix(boneWeights *studio.StudioBoneWeight) *studio.Matrix3x4 {
+	return studio.SkinMatrix(p.worldTransform, boneWeights)
+}
+
+func properBoneRotationZ(seq *studio.Sequence, motion *[6]float64, frame int, angle float64) {
+	if seq.FramesNum > 1 {
+		progress := float64(frame) / float64(seq.FramesNum-1)
+		motion[0] += progress * float64(seq.LinerMovement.X)
+		motion[1] += progress * float64(seq.LinerMovement.Y)
+		motion[2] += progress * float64(seq.LinerMovement.Z)
+	}
+
+	rot := angle * math.Pi / 180.0
+	s, c := math.Sin(rot), math.Cos(rot)
+	x, y := motion[0], motion[1]
+	motion[0] = c*x - s*y
+	motion[1] = s*x + c*y
+	motion[5] += rot
+}
+
+func writeNodes(writer *bufio.Writer, bones []*studio.StudioBone) {
+	writer.WriteString("nodes\n")
+	for i, b := range bones {
+		writer.WriteString(fmt.Sprintf("%3d \"%s\" %d\n", i, b.Name, b.Parent))
+	}
+	writer.WriteString("end\n")
+}
+
+func writeSkeleton(writer *bufio.Writer, bones []*studio.StudioBone) {
+	writer.WriteString("skeleton\n")
+	writer.WriteString("time 0\n")
+	for i, b := range bones {
+		writer.WriteString(fmt.Sprintf("%3d", i))
+		for _, v := range b.Value {
+			writer.WriteString(fmt.Sprintf(" %f", v))
+		}
+		writer.WriteString("\n")
+	}
+	writer.WriteString("end\n")
+}
+
+func writeTriangleInfo(writer *bufio.Writer, model *studio.Model, mdl *studio.Mdl, pose *pose,
+	skinRef uint32, triangle [3]*studio.StudioTriangle) {
+
+	var (
+		vertIndex, normIndex uint16
+		boneIndex            byte
+		vert                 *studio.StudioTriangle
+		u, v                 float32
+		vertPos, vertNorm    *studio.Vector3_32
+		vertWeightsNum       int
+		vertWeight           *studio.StudioBoneWeight
+	)
+
+	texture := mdl.Textures[skinRef]
+
+	writer.WriteString(fmt.Sprintf("%s\n", texture.Name))
+
+	for i := 0; i < 3; i++ {
+		vert = triangle[i]
+		vertIndex = vert.VertexIndex
+		normIndex = vert.NormalIndex
+		boneIndex = model.VerticesInfo[vertIndex]
+
+		u, v = texture.TexCoords(vert)
+
+		if mdl.Header.Flags&studio.StudioHasBoneWeights != 0 {
+			vertWeight = &model.VerticesWeights[vertIndex]
+			mat := pose.skinMatrix(vertWeight)
+			vertPos = studio.Matrix3x4VectorTransform(mat, &model.Vertices[vertIndex])
+			vertNorm = studio.Matrix3x4VectorRotate(mat, &model.Normals[normIndex])
+			vertNorm.Normalize()
+
+			writer.WriteString(fmt.Sprintf("%3d %f %f %f %f %f %f %f %f",
+				boneIndex,
+				vertPos.X, vertPos.Y, vertPos.Z,
+				vertNorm.X, vertNorm.Y, vertNorm.Z,
+				u, v))
+
+			vertWeightsNum = 0
+
+			for _, b := range vertWeight.Bone {
+				if b != -1 {
+					vertWeightsNum++
+				}
+			}
+
+			if vertWeightsNum > 0 {
+				writer.WriteString(fmt.Sprintf(" %d", vertWeightsNum))
+				for b := 0; b < vertWeightsNum; b++ {
+					writer.WriteString(fmt.Sprintf(" %d %f",
+						vertWeight.Bone[b], float32(vertWeight.Weight[b])/255.0))
+				}
+			}
+			writer.WriteString("\n")
+
+		} else {
+			vertPos = studio.Matrix3x4VectorTransform(pose.boneTransforms[boneIndex], &model.Vertices[vertIndex])
+			vertNorm = studio.Matrix3x4VectorRotate(pose.boneTransforms[boneIndex], &model.Normals[normIndex])
+			vertNorm.Normalize()
+
+			writer.WriteString(fmt.Sprintf("%3d %f %f %f %f %f %f %f %f\n",
+				boneIndex,
+				vertPos.X, vertPos.Y, vertPos.Z,
+				vertNorm.X, vertNorm.Y, vertNorm.Z,
+				u, v))
+		}
+	}
+}
+
+func writeTriangles(writer *bufio.Writer, model *studio.Model, mdl *studio.Mdl, pose *pose) {
+	writer.WriteString("triangles\n")
+	for _, me := range model.Meshes {
+		for _, tri := range me.Triangles {
+			for _, face := range tri.Faces() {
+				writeTriangleInfo(writer, model, mdl, pose, me.SkinRef, face)
+			}
+		}
+	}
+	writer.WriteString("end\n")
+}
+
+func writeFrameInfo(writer *bufio.Writer, seq *studio.Sequence, bones []*studio.StudioBone, blendId int, frame int) {
+	writer.WriteString(fmt.Sprintf("time %d\n", frame))
+
+	for i, bone := range bones {
+		motion := studio.CalcBonePosition(seq.Anims[blendId*len(bones)+i], bone, frame)
+
+		if bone.Parent == -1 {
+			properBoneRotationZ(seq, &motion, frame, 270.0)
+		}
+		studio.ClipRotations(&motion[3])
+		studio.ClipRotations(&motion[4])
+		studio.ClipRotations(&motion[5])
+
+		writer.WriteString(fmt.Sprintf("%3d  ", i))
+		for j := 0; j < 6; j++ {
+			writer.WriteString(fmt.Sprintf(" %f", motion[j]))
+		}
+
+		writer.WriteString("\n")
+	}
+}
+
+func writeAnimations(writer *bufio.Writer, bones []*studio.StudioBone, seq *studio.Sequence, blendId int) {
+	writer.WriteString("skeleton\n")
+
+	for i := 0; i < int(seq.FramesNum); i++ {
+		writeFrameInfo(writer, seq, bones, blendId, i)
+	}
+
+	writer.WriteString("end\n")
+}
+
+// Errors lists the files that could not be written, in the order of the
+// model.
+type Errors []error
+
+func (e Errors) Error() string {
+	var messages = make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// smdFile is an SMD file to write and the function writing its body.
+type smdFile struct {
+	name  string
+	write func(writer *bufio.Writer)
+}
+
+func saveFile(filePath string, write func(writer *bufio.Writer)) error {
+	if err := os.RemoveAll(filePath); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	writer.WriteString("version 1\n")
+	write(writer)
+	if err = writer.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// saveFiles writes files into outPath with up to workers of them at a time.
+// The written files are printed after label in the order of the list,
+// whichever finishes first.
+func saveFiles(outPath, label string, files []smdFile, workers int, log io.Writer) error {
+	if workers > len(files) {
+		workers = len(files)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		errs = make([]error, len(files))
+		done = make([]chan struct{}, len(files))
+		jobs = make(chan int)
+	)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				errs[i] = saveFile(filepath.Join(outPath, files[i].name), files[i].write)
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range files {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	var failed Errors
+	for i, f := range files {
+		<-done[i]
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+			continue
+		}
+		fmt.Fprintf(log, "%s: %s\n", label, f.name)
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// SaveReferences writes one reference SMD per body part model into outPath,
+// as many at a time as there are CPUs.
+func SaveReferences(outPath string, mdl *studio.Mdl) error {
+	return SaveReferencesN(outPath, mdl, runtime.NumCPU(), os.Stdout)
+}
+
+// SaveReferencesN writes the reference SMDs with up to workers files at a
+// time and lists them to log. Failing files do not stop the others, they are
+// returned as Errors.
+func SaveReferencesN(outPath string, mdl *studio.Mdl, workers int, log io.Writer) error {
+	var (
+		files []smdFile
+		pose  = newPose(mdl)
+	)
+	for _, bp := range mdl.BodyParts {
+		for _, m := range bp.Models {
+			if m.Name.String() == "blank" {
+				continue
+			}
+			m := m
+			files = append(files, smdFile{
+				name: strings.TrimSuffix(m.Name.String(), ".smd") + ".smd",
+				write: func(writer *bufio.Writer) {
+					writeNodes(writer, mdl.Bones)
+					writeSkeleton(writer, mdl.Bones)
+					writeTriangles(writer, m, mdl, pose)
+				},
+			})
+		}
+	}
+	return saveFiles(outPath, "Reference", files, workers, log)
+}
+
+// SaveSequences writes one animation SMD per sequence blend into outPath,
+// as many at a time as there are CPUs.
+func SaveSequences(outPath string, mdl *studio.Mdl) error {
+	return SaveSequencesN(outPath, mdl, runtime.NumCPU(), os.Stdout)
+}
+
+// SaveSequencesN writes the animation SMDs with up to workers files at a
+// time and lists them to log. Failing files do not stop the others, they are
+// returned as Errors.
+func SaveSequencesN(outPath string, mdl *studio.Mdl, workers int, log io.Writer) error {
+	var files []smdFile
+	for _, seq := range mdl.Sequences {
+		for i := 0; i < int(seq.BlendsNum); i++ {
+			seq, blend := seq, i
+			name := strings.TrimSuffix(seq.Label.String(), ".smd")
+			if seq.BlendsNum > 1 {
+				name = fmt.Sprintf("%s_blend%d", name, i+1)
+			}
+			files = append(files, smdFile{
+				name: name + ".smd",
+				write: func(writer *bufio.Writer) {
+					writeNodes(writer, mdl.Bones)
+					writeAnimations(writer, mdl.Bones, seq, blend)
+				},
+			})
+		}
+	}
+	return saveFiles(outPath, "Sequence", files, workers, log)
+}
+
+// Save writes the reference SMDs into destPath and the animations into its
+// anims subdirectory. Failing files do not stop the others of their kind,
+// they are returned as Errors.
+func Save(destPath string, mdl *studio.Mdl) error {
+	if err := SaveReferences(destPath, mdl); err != nil {
+		return err
+	}
+
+	sequencesPath := filepath.Join(destPath, "anims")
+	if err := os.MkdirAll(sequencesPath, 0744); err != nil {
+		return err
+	}
+
+	if err := SaveSequences(sequencesPath, mdl); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package smd
+
+import (
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+func TestLinearMovement(t *testing.T) {
+	seq := &studio.Sequence{StudioSequence: studio.StudioSequence{FramesNum: 5,
+		LinerMovement: studio.Vector3_32{X: 40, Y: -8, Z: 4}}}
+
+	for frame, want := range []float64{0, 10, 20, 30, 40} {
+		var motion [6]float64
+		properBoneRotationZ(seq, &motion, frame, 0)
+		if motion[0] != want || motion[1] != -want/5 || motion[2] != want/10 {
+			t.Errorf("frame %d moved by %v, want %v", frame, motion[:3], [3]float64{want, -want / 5, want / 10})
+		}
+	}
+
+	seq.FramesNum = 1
+	var motion [6]float64
+	properBoneRotationZ(seq, &motion, 0, 0)
+	if motion[0] != 0 || motion[1] != 0 || motion[2] != 0 {
+		t.Errorf("a single frame moved by %v", motion[:3])
+	}
+}
@@ -0,0 +1,111 @@
+package studio_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/internal/studiotest"
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// benchData returns a large weighted model: 64 bones, 200 sequences of 60
+// frames and 4 body parts of 8000 vertices with 4 textures of 512x512.
+func benchData(b *testing.B) []byte {
+	mdl := studiotest.Model(studiotest.Options{Name: "bench", Bones: 64, Sequences: 200, Frames: 60,
+		BodyParts: 4, Vertices: 8000, Commands: 800, Textures: 4, TextureSize: 512, Seed: 1})
+	data, err := mdl.Encode()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// benchFile writes the benchmark model into a temporary directory, removed
+// by the returned function.
+func benchFile(b *testing.B) (string, []byte, func()) {
+	data := benchData(b)
+	dir, err := ioutil.TempDir("", "studio")
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(dir, "bench.mdl")
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		os.RemoveAll(dir)
+		b.Fatal(err)
+	}
+	return path, data, func() { os.RemoveAll(dir) }
+}
+
+func BenchmarkLoad(b *testing.B) {
+	path, data, done := benchFile(b)
+	defer done()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := studio.Load(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func decodeReference(b *testing.B, path string) *studio.Mdl {
+	f, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	mdl, err := studio.DecodeReference(f)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return mdl
+}
+
+// BenchmarkLoadBinary is the reference for BenchmarkLoad: the same file
+// decoded by the reference decoder of the tests, with a read and
+// encoding/binary for every value as before the buffer.
+func BenchmarkLoadBinary(b *testing.B) {
+	path, data, done := benchFile(b)
+	defer done()
+
+	want, err := studio.DecodeBytes(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if !reflect.DeepEqual(decodeReference(b, path), want) {
+		b.Fatal("the model decoded by the reference decoder differs")
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decodeReference(b, path)
+	}
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+	data := benchData(b)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := studio.DecodeBytes(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoadFixture loads a small compiled model, where opening the file
+// weighs more than decoding it.
+func BenchmarkLoadFixture(b *testing.B) {
+	path := filepath.Join("..", "testdata", "box.mdl")
+	for i := 0; i < b.N; i++ {
+		if _, err := studio.Load(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
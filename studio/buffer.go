@@ -0,0 +1,427 @@
+package studio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// buffer holds a whole file in memory. Values are decoded straight from its
+// bytes instead of with a read call each.
+type buffer struct {
+	data []byte
+	off  int64
+}
+
+func newBuffer(data []byte) *buffer {
+	return &buffer{data: data}
+}
+
+func (b *buffer) Size() int64 {
+	return int64(len(b.data))
+}
+
+func (b *buffer) Read(p []byte) (int, error) {
+	if b.off >= int64(len(b.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data[b.off:])
+	b.off += int64(n)
+	return n, nil
+}
+
+func (b *buffer) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(b.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (b *buffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.off
+	case io.SeekEnd:
+		offset += int64(len(b.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	b.off = offset
+	return offset, nil
+}
+
+// next returns the following n bytes and moves past them.
+func (b *buffer) next(n int) ([]byte, error) {
+	if b.off > int64(len(b.data)) || int64(n) > int64(len(b.data))-b.off {
+		return nil, ErrOutOfBounds
+	}
+	data := b.data[b.off : b.off+int64(n)]
+	b.off += int64(n)
+	return data, nil
+}
+
+// readBuffer reads the first size bytes of r into memory. Data shorter than
+// size is returned as is, reads past its end then fail as out of bounds.
+func readBuffer(r io.ReaderAt, size int64) (*buffer, error) {
+	if buf, ok := r.(*buffer); ok {
+		if size > buf.Size() {
+			size = buf.Size()
+		}
+		return newBuffer(buf.data[:size]), nil
+	}
+
+	var data []byte
+	if dataSize := readerSize(r); dataSize < 0 {
+		// the length from the header may be bogus, so let the data grow
+		var err error
+		if data, err = ioutil.ReadAll(io.NewSectionReader(r, 0, size)); err != nil {
+			return nil, err
+		}
+	} else {
+		if size > dataSize {
+			size = dataSize
+		}
+		data = make([]byte, size)
+		n, err := r.ReadAt(data, 0)
+		if n < len(data) && err != nil && err != io.EOF {
+			return nil, err
+		}
+		data = data[:n]
+	}
+	return newBuffer(data), nil
+}
+
+// fields decodes the little-endian fields of a structure in order.
+type fields struct {
+	b   []byte
+	off int
+}
+
+func (f *fields) u8() uint8 {
+	v := f.b[f.off]
+	f.off++
+	return v
+}
+
+func (f *fields) i8() int8 {
+	return int8(f.u8())
+}
+
+func (f *fields) u16() uint16 {
+	v := binary.LittleEndian.Uint16(f.b[f.off:])
+	f.off += 2
+	return v
+}
+
+func (f *fields) i16() int16 {
+	return int16(f.u16())
+}
+
+func (f *fields) u32() uint32 {
+	v := binary.LittleEndian.Uint32(f.b[f.off:])
+	f.off += 4
+	return v
+}
+
+func (f *fields) i32() int32 {
+	return int32(f.u32())
+}
+
+func (f *fields) f32() float32 {
+	return math.Float32frombits(f.u32())
+}
+
+func (f *fields) bytes(dst []byte) {
+	f.off += copy(dst, f.b[f.off:])
+}
+
+func (f *fields) vector3(v *Vector3_32) {
+	v.X, v.Y, v.Z = f.f32(), f.f32(), f.f32()
+}
+
+func (f *fields) vector4(v *Vector4_32) {
+	v.X, v.Y, v.Z, v.W = f.f32(), f.f32(), f.f32(), f.f32()
+}
+
+func (f *fields) boneWeight(w *StudioBoneWeight) {
+	for i := range w.Weight {
+		w.Weight[i] = f.u8()
+	}
+	for i := range w.Bone {
+		w.Bone[i] = f.i8()
+	}
+}
+
+// valueSize returns the size in the file of the values readValue decodes,
+// other types can not be decoded.
+func valueSize(data interface{}) (int, error) {
+	switch v := data.(type) {
+	case *uint8:
+		return 1, nil
+	case *int16:
+		return 2, nil
+	case *uint32:
+		return 4, nil
+	case *[]byte:
+		return len(*v), nil
+	case *[]int16:
+		return 2 * len(*v), nil
+	case *[]uint16:
+		return 2 * len(*v), nil
+	case *[]Vector3_32:
+		return 12 * len(*v), nil
+	case *[]StudioBoneWeight:
+		return 8 * len(*v), nil
+	case *[256 * 3]byte:
+		return len(*v), nil
+	case *StudioHdr:
+		return 244, nil
+	case *StudioSeqHdr:
+		return 76, nil
+	case *StudioBone:
+		return 112, nil
+	case *StudioBoneInfo:
+		return 128, nil
+	case *StudioBoneController:
+		return 24, nil
+	case *StudioHitBox:
+		return 32, nil
+	case *StudioSeqGroup:
+		return 104, nil
+	case *StudioSequence:
+		return 176, nil
+	case *StudioEvent:
+		return 76, nil
+	case *StudioPivot:
+		return 20, nil
+	case *StudioAnim:
+		return 12, nil
+	case *StudioTexture:
+		return 80, nil
+	case *StudioBodyPart:
+		return 76, nil
+	case *StudioModel:
+		return 112, nil
+	case *StudioMesh:
+		return 20, nil
+	case *StudioTriangle:
+		return 8, nil
+	case *StudioAttachment:
+		return 88, nil
+	case *StudioHdr2:
+		return 64, nil
+	case *StudioPoseParam:
+		return 48, nil
+	case *StudioHitBoxSet:
+		return 40, nil
+	}
+	return 0, errors.New(fmt.Sprintf("can not decode %T", data))
+}
+
+// decodeValue fills data, one of the types valueSize knows, from b.
+func decodeValue(b []byte, data interface{}) {
+	f := &fields{b: b}
+	switch v := data.(type) {
+	case *uint8:
+		*v = f.u8()
+	case *int16:
+		*v = f.i16()
+	case *uint32:
+		*v = f.u32()
+	case *[]byte:
+		f.bytes(*v)
+	case *[]int16:
+		for i := range *v {
+			(*v)[i] = f.i16()
+		}
+	case *[]uint16:
+		for i := range *v {
+			(*v)[i] = f.u16()
+		}
+	case *[]Vector3_32:
+		for i := range *v {
+			f.vector3(&(*v)[i])
+		}
+	case *[]StudioBoneWeight:
+		for i := range *v {
+			f.boneWeight(&(*v)[i])
+		}
+	case *[256 * 3]byte:
+		f.bytes(v[:])
+	case *StudioHdr:
+		v.decode(f)
+	case *StudioSeqHdr:
+		v.Ident, v.Version = f.u32(), f.u32()
+		f.bytes(v.Name[:])
+		v.Length = f.u32()
+	case *StudioBone:
+		f.bytes(v.Name[:])
+		v.Parent, v.Flags = f.i32(), f.u32()
+		for i := range v.BoneControllers {
+			v.BoneControllers[i] = f.u32()
+		}
+		for i := range v.Value {
+			v.Value[i] = f.f32()
+		}
+		for i := range v.Scale {
+			v.Scale[i] = f.f32()
+		}
+	case *StudioBoneInfo:
+		for i := range v.PoseToBone {
+			f.vector4(&v.PoseToBone[i])
+		}
+		f.vector4(&v.QAlignment)
+		v.ProcType, v.ProcIndex = f.i32(), f.i32()
+		f.vector4(&v.Quat)
+		for i := range v.Reserved {
+			v.Reserved[i] = f.i32()
+		}
+	case *StudioBoneController:
+		v.Bone, v.Type, v.Start, v.End, v.Rest, v.Index = f.i32(), f.u32(), f.f32(), f.f32(), f.u32(), f.u32()
+	case *StudioHitBox:
+		v.Bone, v.Group = f.u32(), f.u32()
+		f.vector3(&v.BBMin)
+		f.vector3(&v.BBMax)
+	case *StudioSeqGroup:
+		f.bytes(v.Label[:])
+		f.bytes(v.Name[:])
+		v.Unused1, v.Unused2 = f.i32(), f.i32()
+	case *StudioSequence:
+		v.decode(f)
+	case *StudioEvent:
+		v.Frame, v.Event, v.Type = f.u32(), f.i32(), f.u32()
+		f.bytes(v.Options[:])
+	case *StudioPivot:
+		f.vector3(&v.Org)
+		v.Start, v.End = f.i32(), f.i32()
+	case *StudioAnim:
+		for i := range v.Offsets {
+			v.Offsets[i] = f.u16()
+		}
+	case *StudioTexture:
+		f.bytes(v.Name[:])
+		v.Flags, v.Width, v.Height, v.Offset = f.u32(), f.u32(), f.u32(), f.u32()
+	case *StudioBodyPart:
+		f.bytes(v.Name[:])
+		v.ModelsNum, v.Base, v.ModelsOff = f.u32(), f.u32(), f.u32()
+	case *StudioModel:
+		f.bytes(v.Name[:])
+		v.Type, v.BoundingRadius = f.i32(), f.f32()
+		v.MeshesNum, v.MeshesOff = f.u32(), f.u32()
+		v.VertsNum, v.VertsInfoOff, v.VertsOff = f.u32(), f.u32(), f.u32()
+		v.NormalsNum, v.NormalsInfoOff, v.NormalsOff = f.u32(), f.u32(), f.u32()
+		v.BlendVertInfoOff, v.BlendNormInfoOff = f.u32(), f.u32()
+	case *StudioMesh:
+		v.TrianglesNum, v.TrianglesOff, v.SkinRef, v.NormalsNum, v.NormalsOff = f.u32(), f.u32(), f.u32(), f.u32(), f.u32()
+	case *StudioTriangle:
+		v.VertexIndex, v.NormalIndex, v.S, v.T = f.u16(), f.u16(), f.i16(), f.i16()
+	case *StudioAttachment:
+		f.bytes(v.Name[:])
+		v.Type, v.Bone = f.u32(), f.u32()
+		f.vector3(&v.Origins)
+		for i := range v.Vectors {
+			f.vector3(&v.Vectors[i])
+		}
+	case *StudioHdr2:
+		v.PoseParamsNum, v.PoseParamsOff = f.u32(), f.u32()
+		v.IKAutoplayLocksNum, v.IKAutoplayLocksOff = f.u32(), f.u32()
+		v.IKChainsNum, v.IKChainsOff = f.u32(), f.u32()
+		v.KeyValuesOff, v.KeyValuesSize = f.u32(), f.u32()
+		v.HitBoxSetsNum, v.HitBoxSetsOff = f.u32(), f.u32()
+		for i := range v.Unused {
+			v.Unused[i] = f.i32()
+		}
+	case *StudioPoseParam:
+		f.bytes(v.Name[:])
+		v.Flags, v.Start, v.End, v.Loop = f.u32(), f.f32(), f.f32(), f.f32()
+	case *StudioHitBoxSet:
+		f.bytes(v.Name[:])
+		v.HitBoxesNum, v.HitBoxesOff = f.u32(), f.u32()
+	}
+}
+
+func (hdr *StudioHdr) decode(f *fields) {
+	hdr.Ident, hdr.Version = f.u32(), f.u32()
+	f.bytes(hdr.Name[:])
+	hdr.Length = f.u32()
+	f.vector3(&hdr.EyePosition)
+	f.vector3(&hdr.Min)
+	f.vector3(&hdr.Max)
+	f.vector3(&hdr.BBMin)
+	f.vector3(&hdr.BBMax)
+	hdr.Flags = f.u32()
+	hdr.BonesNum, hdr.BonesOffset = f.u32(), f.u32()
+	hdr.BoneControllersNum, hdr.BoneControllersOff = f.u32(), f.u32()
+	hdr.HitBoxesNum, hdr.HitBoxesOff = f.u32(), f.u32()
+	hdr.SequencesNum, hdr.SequencesOff = f.u32(), f.u32()
+	hdr.SequenceGroupsNum, hdr.SequenceGroupsOff = f.u32(), f.u32()
+	hdr.TexturesNum, hdr.TexturesOff, hdr.TexturesDataOff = f.u32(), f.u32(), f.u32()
+	hdr.SkinRefsNum, hdr.SkinFamiliesNum, hdr.SkinsOff = f.u32(), f.u32(), f.u32()
+	hdr.BodyPartsNum, hdr.BodyPartsOff = f.u32(), f.u32()
+	hdr.AttachmentsNum, hdr.AttachmentsOff = f.u32(), f.u32()
+	hdr.StudioHdr2Off, hdr.SoundsOff = f.u32(), f.u32()
+	hdr.SoundGroupsNum, hdr.SoundGroupsOff = f.u32(), f.u32()
+	hdr.TransitionsNum, hdr.TransitionsOff = f.u32(), f.u32()
+}
+
+func (seq *StudioSequence) decode(f *fields) {
+	f.bytes(seq.Label[:])
+	seq.FPS, seq.Flags = f.f32(), f.u32()
+	seq.Activity, seq.ActWight = f.u32(), f.i32()
+	seq.EventsNum, seq.EventsOff = f.u32(), f.u32()
+	seq.FramesNum = f.u32()
+	seq.PivotsNum, seq.PivotsOff = f.u32(), f.u32()
+	seq.MotionType, seq.MotionBone = f.u32(), f.u32()
+	f.vector3(&seq.LinerMovement)
+	seq.AutoMovePosOff, seq.AutoMoveAngleOff = f.u32(), f.u32()
+	f.vector3(&seq.BBMin)
+	f.vector3(&seq.BBMax)
+	seq.BlendsNum, seq.AnimOff = f.u32(), f.u32()
+	seq.BlendTypes[0], seq.BlendTypes[1] = f.u32(), f.u32()
+	seq.BlendStart[0], seq.BlendStart[1] = f.f32(), f.f32()
+	seq.BlendEnd[0], seq.BlendEnd[1] = f.f32(), f.f32()
+	seq.BlendParent, seq.SeqGroup = f.i32(), f.u32()
+	seq.EntryNode, seq.ExitNode, seq.NodeFlags = f.i32(), f.i32(), f.u32()
+	seq.NextSeq = f.i32()
+}
+
+// readValue decodes data at the current offset, reporting failures as
+// located decode errors.
+func readValue(file io.ReadSeeker, section string, index int, data interface{}) error {
+	var (
+		b   []byte
+		off int64
+	)
+	size, err := valueSize(data)
+	if err != nil {
+		return err
+	}
+	if buf, ok := file.(*buffer); ok {
+		off = buf.off
+		b, err = buf.next(size)
+	} else if off, err = file.Seek(0, io.SeekCurrent); err != nil {
+		return err
+	} else {
+		b = make([]byte, size)
+		_, err = io.ReadFull(file, b)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrOutOfBounds
+	}
+	if err != nil {
+		return &DecodeError{"", section, index, off, err}
+	}
+	decodeValue(b, data)
+	return nil
+}
@@ -0,0 +1,81 @@
+package studio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// decodedValues returns a new value of every type readValue decodes, the
+// slices with a few elements.
+func decodedValues() []interface{} {
+	return []interface{}{
+		new(uint8), new(int16), &[]byte{0, 0, 0}, &[]int16{0, 0}, &[]uint16{0, 0, 0},
+		&[]Vector3_32{{}, {}}, &[]StudioBoneWeight{{}, {}}, new([256 * 3]byte),
+		new(StudioHdr), new(StudioSeqHdr), new(StudioBone), new(StudioBoneInfo), new(StudioBoneController),
+		new(StudioHitBox), new(StudioSeqGroup), new(StudioSequence), new(StudioEvent), new(StudioPivot),
+		new(StudioAnim), new(StudioTexture), new(StudioBodyPart), new(StudioModel), new(StudioMesh),
+		new(StudioTriangle), new(StudioAttachment), new(StudioHdr2), new(StudioPoseParam), new(StudioHitBoxSet),
+	}
+}
+
+// TestDecodeValues checks the sizes and the decoding of every type against
+// encoding/binary, on random bytes.
+func TestDecodeValues(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := range decodedValues() {
+		for k := 0; k < 20; k++ {
+			want, got, read := decodedValues()[i], decodedValues()[i], decodedValues()[i]
+			size, err := valueSize(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != binary.Size(want) {
+				t.Errorf("%T: size %d, encoding/binary gives %d", got, size, binary.Size(want))
+				break
+			}
+
+			data := make([]byte, size)
+			rnd.Read(data)
+			if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, want); err != nil {
+				t.Fatal(err)
+			}
+			decodeValue(data, got)
+			// compared encoded, random bytes make NaNs that are never equal
+			wantBytes := encodeValue(want)
+			if !bytes.Equal(encodeValue(got), wantBytes) {
+				t.Errorf("%T: decoded differently from encoding/binary", got)
+				break
+			}
+
+			if err := readValue(bytes.NewReader(data), "value", -1, read); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encodeValue(read), wantBytes) {
+				t.Errorf("%T: read from a reader differently from encoding/binary", read)
+				break
+			}
+		}
+	}
+
+	buf := newBuffer(make([]byte, 10))
+	if err := readValue(buf, "triangle", 0, new(StudioTriangle)); err != nil {
+		t.Fatal(err)
+	}
+	err := readValue(buf, "triangle", 1, new(StudioTriangle))
+	if de, ok := err.(*DecodeError); !ok || de.Offset != 8 || de.Err != ErrOutOfBounds {
+		t.Errorf("reading past the end: %v", err)
+	}
+
+	if err := readValue(buf, "value", -1, new(float64)); err == nil || err.Error() != "can not decode *float64" {
+		t.Errorf("reading an unknown type: %v", err)
+	}
+}
+
+// encodeValue returns the bytes of a value as encoding/binary writes them.
+func encodeValue(data interface{}) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, data)
+	return b.Bytes()
+}
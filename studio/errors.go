@@ -0,0 +1,60 @@
+package studio
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrOutOfBounds = errors.New("data lies outside of the file")
+	ErrLimit       = errors.New("value exceeds the decoding limit")
+	ErrBadIndex    = errors.New("index refers to a missing element")
+	ErrBadAnim     = errors.New("malformed animation data")
+	ErrBadName     = errors.New("name can not be used as a file name")
+)
+
+// DecodeError locates a part of a model file that can not be decoded.
+// Index is the element within the section, or -1 for the section itself,
+// and Offset is -1 when the location in the file is unknown.
+type DecodeError struct {
+	File    string
+	Section string
+	Index   int
+	Offset  int64
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	var prefix, location string
+	if len(e.File) > 0 {
+		prefix = e.File + ": "
+	}
+	if e.Index >= 0 {
+		location = fmt.Sprintf(" %d", e.Index)
+	}
+	if e.Offset >= 0 {
+		location += fmt.Sprintf(" at offset %d", e.Offset)
+	}
+	return fmt.Sprintf("%s%s%s: %s", prefix, e.Section, location, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func limitError(value, limit int64) error {
+	return fmt.Errorf("%w (%d, limit %d)", ErrLimit, value, limit)
+}
+
+func indexError(index, count int64) error {
+	return fmt.Errorf("%w (%d of %d)", ErrBadIndex, index, count)
+}
+
+// fileError attaches the file name to decode errors and prefixes others.
+func fileError(name string, err error) error {
+	if de, ok := err.(*DecodeError); ok {
+		de.File = name
+		return de
+	}
+	return errors.New(fmt.Sprintf("%s: %s", name, err))
+}
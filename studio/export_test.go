@@ -0,0 +1,9 @@
+package studio
+
+import "os"
+
+// DecodeReference decodes a main model with the reference decoder, which
+// reads every value from the file on its own with encoding/binary.
+func DecodeReference(f *os.File) (*Mdl, error) {
+	return decodeReference(f)
+}
@@ -0,0 +1,529 @@
+package studio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+func isValidName(name string) bool {
+	return checkReg(name, `^[\w\-.][\w\-. ]*$`)
+}
+
+func checkReg(str, pattern string) bool {
+	if matched, err := regexp.Match(pattern, []byte(str)); matched && err == nil {
+		return true
+	}
+	return false
+}
+
+func fixNames(mdl *Mdl, rc *recovery) {
+	var str string
+
+	renamed := func(section string, index int, name, str string) {
+		if len(name) > 0 && !isValidName(name) {
+			rc.fix(&DecodeError{"", section, index, -1, ErrBadName}, "renamed %q to %s", name, str)
+		}
+	}
+
+	texPattern := `(_texture)(\d+)(.bmp)`
+	modelPattern := `(_body)(\d+)(_)(\d+)`
+	seqPattern := `(_seq)(\d+)`
+	groupPattern := `(_group)(\d+)`
+
+	var usedNames [4]map[string]bool
+	for i := 0; i < len(usedNames); i++ {
+		usedNames[i] = make(map[string]bool)
+	}
+	isNameUsed := func(name string, t int) bool {
+		if _, ok := usedNames[t][name]; ok {
+			return true
+		}
+		return false
+	}
+
+	for i, tex := range mdl.Textures {
+		str = tex.Name.String()
+		if !isValidName(str) || checkReg(str, texPattern) || isNameUsed(str, 0) {
+			str = fmt.Sprintf("_texture%d.bmp", i+1)
+			renamed("texture", i, tex.Name.String(), str)
+			tex.Name.FromString(str)
+			usedNames[0][str] = true
+		}
+	}
+
+	for i, bp := range mdl.BodyParts {
+		str = bp.Name.String()
+		if !isValidName(str) {
+			str = fmt.Sprintf("_bodypart%d", i+1)
+			renamed("body part", i, bp.Name.String(), str)
+			bp.Name.FromString(str)
+		}
+		for j, m := range bp.Models {
+			str = m.Name.String()
+			if !isValidName(str) || checkReg(str, modelPattern) || isNameUsed(str, 1) {
+				str = fmt.Sprintf("_body%d_%d", i+1, j+1)
+				renamed(fmt.Sprintf("body part %d model", i), j, m.Name.String(), str)
+				m.Name.FromString(str)
+				usedNames[1][str] = true
+			}
+		}
+	}
+
+	for i, seq := range mdl.Sequences {
+		str = seq.Label.String()
+		if !isValidName(str) || checkReg(str, seqPattern) || isNameUsed(str, 2) {
+			str = fmt.Sprintf("_seq%d", i+1)
+			renamed("sequence", i, seq.Label.String(), str)
+			seq.Label.FromString(str)
+			usedNames[2][str] = true
+		}
+	}
+
+	// the default group is the one every QC script starts with
+	usedNames[3]["default"] = true
+	for i, sg := range mdl.SeqGroups {
+		if i == 0 {
+			continue
+		}
+		str = sg.Label.String()
+		if !isValidName(str) || checkReg(str, groupPattern) || isNameUsed(strings.ToLower(str), 3) {
+			str = fmt.Sprintf("_group%d", i+1)
+			renamed("sequence group", i, sg.Label.String(), str)
+			sg.Label.FromString(str)
+		}
+		usedNames[3][strings.ToLower(str)] = true
+	}
+}
+
+// Resolver opens a companion file of a model: the T.mdl file holding its
+// textures or a NN.mdl sequence group file. Readers implementing io.Closer
+// are closed once decoded.
+type Resolver func(name string) (io.ReaderAt, error)
+
+// FileResolver opens companion files from disk.
+func FileResolver(name string) (io.ReaderAt, error) {
+	return os.Open(name)
+}
+
+// BytesResolver serves companion files from memory, keyed by name.
+func BytesResolver(files map[string][]byte) Resolver {
+	return func(name string) (io.ReaderAt, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("%s not found", name))
+		}
+		return newBuffer(data), nil
+	}
+}
+
+func resolve(resolver Resolver, name string) (io.ReaderAt, func(), error) {
+	if resolver == nil {
+		return nil, nil, errors.New(fmt.Sprintf("%s is required, but no resolver is given", name))
+	}
+	r, err := resolver(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, func() {
+		if closer, ok := r.(io.Closer); ok {
+			closer.Close()
+		}
+	}, nil
+}
+
+// readerSize returns the size of the data behind r or -1 when it is unknown.
+func readerSize(r io.ReaderAt) int64 {
+	switch v := r.(type) {
+	case interface{ Size() int64 }:
+		return v.Size()
+	case *os.File:
+		if info, err := v.Stat(); err == nil {
+			return info.Size()
+		}
+	}
+	return -1
+}
+
+// fileSection reads the file into memory up to the length stored in its
+// header. When recovering, a wrong length is replaced with the size of the
+// data.
+func fileSection(r io.ReaderAt, length uint32, headerSize int64, rc *recovery) (*buffer, error) {
+	size := int64(length)
+	dataSize := readerSize(r)
+	if dataSize >= 0 && dataSize < size {
+		err := &DecodeError{"", "header", -1, 0, fmt.Errorf(
+			"%w (file is truncated to %d of %d bytes)", ErrOutOfBounds, dataSize, size)}
+		if !rc.fix(err, "read the remaining %d bytes", dataSize) {
+			return nil, err
+		}
+		size = dataSize
+	}
+	if size < headerSize {
+		err := &DecodeError{"", "header", -1, 0, errors.New(fmt.Sprintf(
+			"invalid file length (%d)", size))}
+		if dataSize < headerSize || !rc.fix(err, "read all %d bytes", dataSize) {
+			return nil, err
+		}
+		size = dataSize
+	}
+	return readBuffer(r, size)
+}
+
+func decodeSeqGroup(r io.ReaderAt, name string, mdl *Mdl, seqGroupId uint32) error {
+	rc := mdl.recovery
+	if rc != nil {
+		defer rc.setFile(name)()
+	}
+
+	seqHdr := new(StudioSeqHdr)
+	if err := readValue(io.NewSectionReader(r, 0, 76), "header", -1, seqHdr); err != nil {
+		return fileError(name, err)
+	}
+
+	if seqHdr.Ident != SeqIdent {
+		return errors.New(fmt.Sprintf("%s is not a valid sequence file", name))
+	}
+
+	file, err := fileSection(r, seqHdr.Length, 76, rc)
+	if err != nil {
+		return fileError(name, err)
+	}
+
+	for i, seq := range mdl.Sequences {
+		if seq.SeqGroup != seqGroupId {
+			continue
+		}
+		if err = seq.readAnims(file, fmt.Sprintf("sequence %d", i), mdl.Header.BonesNum, rc); err != nil {
+			return fileError(name, err)
+		}
+	}
+
+	return nil
+}
+
+// Decode reads a main studio model. Textures kept in a separate T.mdl and
+// animations kept in NN.mdl sequence group files are not loaded. Damaged
+// sections are reported as *DecodeError.
+func Decode(r io.ReaderAt) (*Mdl, error) {
+	return decode(r, nil)
+}
+
+func decode(r io.ReaderAt, rc *recovery) (*Mdl, error) {
+	// the sequence group files are shorter than the main header
+	var ident uint32
+	if err := readValue(io.NewSectionReader(r, 0, 4), "header", -1, &ident); err != nil {
+		return nil, err
+	}
+	if ident != MdlIdent {
+		if ident == SeqIdent {
+			return nil, errors.New("not a main HL model file")
+		} else {
+			return nil, errors.New("not a valid HL model file")
+		}
+	}
+
+	studioHdr := new(StudioHdr)
+	if err := readValue(io.NewSectionReader(r, 0, 244), "header", -1, studioHdr); err != nil {
+		return nil, err
+	}
+
+	if studioHdr.Version != StudioVersion {
+		return nil, errors.New("unknown Studio MDL format version")
+	}
+
+	file, err := fileSection(r, studioHdr.Length, 244, rc)
+	if err != nil {
+		return nil, err
+	}
+
+	// the hitboxes of a strictly decoded model may be dropped with a warning
+	var hitBoxesErr *DecodeError
+	if studioHdr.HitBoxesNum > MaxHitboxes {
+		hitBoxesErr = &DecodeError{"", "hitbox", -1, int64(studioHdr.HitBoxesOff),
+			limitError(int64(studioHdr.HitBoxesNum), MaxHitboxes)}
+	} else if int64(studioHdr.HitBoxesOff)+int64(studioHdr.HitBoxesNum)*32 > file.Size() {
+		hitBoxesErr = &DecodeError{"", "hitbox", -1, int64(studioHdr.HitBoxesOff), ErrOutOfBounds}
+	}
+	var warnings []Repair
+	if hitBoxesErr != nil {
+		if !rc.fix(hitBoxesErr, "dropped all hitboxes") {
+			warnings = append(warnings, Repair{hitBoxesErr, "dropped all hitboxes"})
+		}
+		studioHdr.HitBoxesNum = 0
+	}
+
+	mdl := new(Mdl)
+	mdl.Header = studioHdr
+	mdl.Warnings = warnings
+	mdl.recovery = rc
+
+	if err = mdl.ReadBones(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadBoneControllers(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadHitBoxes(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadSequenceGroups(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadSequences(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadTransitions(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadBodyParts(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadAttachments(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadHeader2(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadTextures(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadSkins(file); err != nil {
+		return nil, err
+	}
+	if err = mdl.ReadSounds(file); err != nil {
+		return nil, err
+	}
+
+	return mdl, nil
+}
+
+// DecodeBytes reads a main studio model held in memory.
+func DecodeBytes(data []byte) (*Mdl, error) {
+	return Decode(newBuffer(data))
+}
+
+// LoadFrom reads the model named modelPath from r. Its T.mdl texture file and
+// the sequence group files named in its group table are opened through
+// resolver, which may be nil for self-contained models. Group files missing
+// under their stored names are looked up as NN.mdl files of the model.
+// Entries whose names can not be used as file names are renamed.
+func LoadFrom(r io.ReaderAt, modelPath string, resolver Resolver) (*Mdl, error) {
+	return loadFrom(r, modelPath, resolver, nil)
+}
+
+// RecoverFrom reads the model like LoadFrom, but skips or repairs damaged
+// sections instead of failing on them. What was done is listed in the
+// Repairs of the model.
+func RecoverFrom(r io.ReaderAt, modelPath string, resolver Resolver) (*Mdl, error) {
+	rc := &recovery{file: modelPath}
+	mdl, err := loadFrom(r, modelPath, resolver, rc)
+	if err != nil {
+		return nil, err
+	}
+	mdl.Repairs = rc.repairs
+	mdl.recovery = nil
+	return mdl, nil
+}
+
+func loadFrom(r io.ReaderAt, modelPath string, resolver Resolver, rc *recovery) (*Mdl, error) {
+	if rc != nil {
+		defer rc.setFile(modelPath)()
+	}
+
+	mdl, err := decode(r, rc)
+	if err != nil {
+		return nil, fileError(modelPath, err)
+	}
+	mdl.FilePath = modelPath
+	for _, w := range mdl.Warnings {
+		w.Err.File = modelPath
+	}
+	studioHdr := mdl.Header
+
+	if studioHdr.TexturesNum == 0 {
+		mdlTPath := strings.TrimSuffix(modelPath, ".mdl") + "T.mdl"
+		mdlT, err := loadTextures(mdlTPath, resolver, rc)
+		if err != nil {
+			if !rc.missing(mdlTPath, "textures", err, "replaced with blank textures") {
+				return nil, err
+			}
+			mdlT = placeholderTextures(mdl)
+		}
+		mdl.Textures = mdlT.Textures
+		mdl.Skins = mdlT.Skins
+		mdl.Warnings = append(mdl.Warnings, mdlT.Warnings...)
+	}
+
+	for i := 1; i < len(mdl.SeqGroups); i++ {
+		if rc != nil && !usesSeqGroup(mdl, uint32(i)) {
+			continue
+		}
+		seqPath := seqGroupPath(modelPath, mdl.SeqGroups[i], i)
+		if err = loadSeqGroup(seqPath, resolver, mdl, uint32(i)); err != nil {
+			if !rc.missing(seqPath, "sequence group", err, "replaced its sequences with the default pose") {
+				return nil, err
+			}
+			for _, seq := range mdl.Sequences {
+				if seq.SeqGroup == uint32(i) {
+					seq.Anims = restAnims(seq.BlendsNum * studioHdr.BonesNum)
+				}
+			}
+		}
+	}
+
+	if err = checkSkins(mdl, rc); err != nil {
+		return nil, fileError(modelPath, err)
+	}
+
+	fixNames(mdl, rc)
+
+	return mdl, nil
+}
+
+func usesSeqGroup(mdl *Mdl, seqGroupId uint32) bool {
+	for _, seq := range mdl.Sequences {
+		if seq.SeqGroup == seqGroupId {
+			return true
+		}
+	}
+	return false
+}
+
+func loadTextures(mdlTPath string, resolver Resolver, rc *recovery) (*Mdl, error) {
+	texReader, done, err := resolve(resolver, mdlTPath)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return loadFrom(texReader, mdlTPath, nil, rc)
+}
+
+// seqGroupPath returns where the file of a sequence group is expected: the
+// file named in the group table, looked up next to the model.
+func seqGroupPath(modelPath string, seqGroup *StudioSeqGroup, seqGroupId int) string {
+	name := strings.Replace(seqGroup.Name.String(), "\\", "/", -1)
+	if len(name) == 0 {
+		return legacySeqGroupPath(modelPath, seqGroupId)
+	}
+	return filepath.Join(filepath.Dir(modelPath), path.Base(name))
+}
+
+// legacySeqGroupPath is the NN.mdl file studiomdl names after the model.
+func legacySeqGroupPath(modelPath string, seqGroupId int) string {
+	return strings.TrimSuffix(modelPath, ".mdl") + fmt.Sprintf("%02d.mdl", seqGroupId)
+}
+
+func loadSeqGroup(seqPath string, resolver Resolver, mdl *Mdl, seqGroupId uint32) error {
+	seqReader, done, err := resolve(resolver, seqPath)
+	if err != nil {
+		// the model may have been renamed since it was compiled
+		legacyPath := legacySeqGroupPath(mdl.FilePath, int(seqGroupId))
+		if legacyPath == seqPath {
+			return err
+		}
+		var lerr error
+		if seqReader, done, lerr = resolve(resolver, legacyPath); lerr != nil {
+			return err
+		}
+		seqPath = legacyPath
+	}
+	defer done()
+	return decodeSeqGroup(seqReader, seqPath, mdl, seqGroupId)
+}
+
+// checkSkins makes sure that skin families and meshes refer to textures of
+// the model, which may come from its T.mdl file. When recovering, broken
+// references are pointed at the first texture.
+func checkSkins(mdl *Mdl, rc *recovery) error {
+	if rc != nil && len(mdl.Textures) == 0 && hasMeshes(mdl) {
+		rc.fix(&DecodeError{"", "texture", -1, int64(mdl.Header.TexturesOff), ErrOutOfBounds},
+			"added a blank texture for the meshes")
+		mdl.Textures = []*Texture{placeholderTexture("blank.bmp")}
+	}
+	texturesNum := int64(len(mdl.Textures))
+
+	if mdl.Skins != nil {
+		for i, family := range *mdl.Skins {
+			for j, ref := range family {
+				if int64(ref) >= texturesNum {
+					err := &DecodeError{"", "skin family", i, int64(mdl.Header.SkinsOff), indexError(int64(ref), texturesNum)}
+					if !rc.fix(err, "pointed skin reference %d at texture 0", j) {
+						return err
+					}
+					family[j] = 0
+				}
+			}
+		}
+	}
+
+	for i, bp := range mdl.BodyParts {
+		for j, m := range bp.Models {
+			for k, mesh := range m.Meshes {
+				if int64(mesh.SkinRef) >= texturesNum {
+					section := fmt.Sprintf("body part %d model %d mesh", i, j)
+					err := &DecodeError{"", section, k, int64(m.MeshesOff) + int64(k)*20,
+						indexError(int64(mesh.SkinRef), texturesNum)}
+					if !rc.fix(err, "pointed at texture 0") {
+						return err
+					}
+					mesh.SkinRef = 0
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func hasMeshes(mdl *Mdl) bool {
+	for _, bp := range mdl.BodyParts {
+		for _, m := range bp.Models {
+			if len(m.Meshes) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Load reads the model at modelPath together with its T.mdl texture file and
+// NN.mdl sequence group files found next to it.
+func Load(modelPath string) (*Mdl, error) {
+	file, err := openModel(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadFrom(file, modelPath, FileResolver)
+}
+
+// Recover reads the model at modelPath like Load, repairing damaged sections
+// as RecoverFrom does.
+func Recover(modelPath string) (*Mdl, error) {
+	file, err := openModel(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return RecoverFrom(file, modelPath, FileResolver)
+}
+
+func openModel(modelPath string) (*os.File, error) {
+	ext := filepath.Ext(modelPath)
+	if len(ext) == 0 {
+		return nil, errors.New("source file does not have extension")
+	}
+
+	if ext != ".mdl" {
+		return nil, errors.New("only .mdl-files is supported")
+	}
+
+	return os.Open(modelPath)
+}
@@ -0,0 +1,44 @@
+package studio
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Log is a writer for the lines printed while exporting a model. It counts
+// the warnings written to it with Warnf, so that callers do not have to
+// parse the lines. It is safe for concurrent use.
+type Log struct {
+	mu       sync.Mutex
+	w        io.Writer
+	warnings int
+}
+
+func NewLog(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+func (l *Log) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// Warnings returns the number of warnings written to the log.
+func (l *Log) Warnings() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.warnings
+}
+
+// Warnf writes a warning line to log with the prefix shared by every command.
+// The warning is counted when log is a Log.
+func Warnf(log io.Writer, format string, args ...interface{}) {
+	if l, ok := log.(*Log); ok {
+		l.mu.Lock()
+		l.warnings++
+		l.mu.Unlock()
+	}
+	fmt.Fprintf(log, "[WARNING] %s.\n", fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,295 @@
+package studio
+
+import "math"
+
+type Vector4 struct{ X, Y, Z, W float64 }
+type Matrix3x4 [3]Vector4
+
+type Vector4_32 struct{ X, Y, Z, W float32 }
+type Matrix3x4_32 [3]Vector4_32
+
+func (mat *Matrix3x4) From32(mat32 *Matrix3x4_32) {
+	for i := 0; i < 3; i++ {
+		mat[i].X = float64(mat32[i].X)
+		mat[i].Y = float64(mat32[i].Y)
+		mat[i].Z = float64(mat32[i].Z)
+		mat[i].W = float64(mat32[i].W)
+	}
+}
+
+func Matrix3x4ConcatTransforms(m1, m2 *Matrix3x4) *Matrix3x4 {
+	var out Matrix3x4
+	out[0].X = m1[0].X*m2[0].X + m1[0].Y*m2[1].X + m1[0].Z*m2[2].X
+	out[0].Y = m1[0].X*m2[0].Y + m1[0].Y*m2[1].Y + m1[0].Z*m2[2].Y
+	out[0].Z = m1[0].X*m2[0].Z + m1[0].Y*m2[1].Z + m1[0].Z*m2[2].Z
+	out[0].W = m1[0].X*m2[0].W + m1[0].Y*m2[1].W + m1[0].Z*m2[2].W + m1[0].W
+	out[1].X = m1[1].X*m2[0].X + m1[1].Y*m2[1].X + m1[1].Z*m2[2].X
+	out[1].Y = m1[1].X*m2[0].Y + m1[1].Y*m2[1].Y + m1[1].Z*m2[2].Y
+	out[1].Z = m1[1].X*m2[0].Z + m1[1].Y*m2[1].Z + m1[1].Z*m2[2].Z
+	out[1].W = m1[1].X*m2[0].W + m1[1].Y*m2[1].W + m1[1].Z*m2[2].W + m1[1].W
+	out[2].X = m1[2].X*m2[0].X + m1[2].Y*m2[1].X + m1[2].Z*m2[2].X
+	out[2].Y = m1[2].X*m2[0].Y + m1[2].Y*m2[1].Y + m1[2].Z*m2[2].Y
+	out[2].Z = m1[2].X*m2[0].Z + m1[2].Y*m2[1].Z + m1[2].Z*m2[2].Z
+	out[2].W = m1[2].X*m2[0].W + m1[2].Y*m2[1].W + m1[2].Z*m2[2].W + m1[2].W
+	return &out
+}
+
+func AngleQuaternion(angles *Vector3_32) *Vector4 {
+	var sr, sp, sy, cr, cp, cy float64
+
+	sy, cy = math.Sincos(float64(angles.Z) * 0.5)
+	sp, cp = math.Sincos(float64(angles.Y) * 0.5)
+	sr, cr = math.Sincos(float64(angles.X) * 0.5)
+
+	return &Vector4{
+		X: sr*cp*cy - cr*sp*sy,
+		Y: cr*sp*cy + sr*cp*sy,
+		Z: cr*cp*sy - sr*sp*cy,
+		W: cr*cp*cy + sr*sp*sy,
+	}
+}
+
+func Matrix3x4FromOriginQuat(quat *Vector4, origin *Vector3_32) *Matrix3x4 {
+	var out Matrix3x4
+
+	out[0].X = 1.0 - 2.0*quat.Y*quat.Y - 2.0*quat.Z*quat.Z
+	out[1].X = 2.0*quat.X*quat.Y + 2.0*quat.W*quat.Z
+	out[2].X = 2.0*quat.X*quat.Z - 2.0*quat.W*quat.Y
+
+	out[0].Y = 2.0*quat.X*quat.Y - 2.0*quat.W*quat.Z
+	out[1].Y = 1.0 - 2.0*quat.X*quat.X - 2.0*quat.Z*quat.Z
+	out[2].Y = 2.0*quat.Y*quat.Z + 2.0*quat.W*quat.X
+
+	out[0].Z = 2.0*quat.X*quat.Z + 2.0*quat.W*quat.Y
+	out[1].Z = 2.0*quat.Y*quat.Z - 2.0*quat.W*quat.X
+	out[2].Z = 1.0 - 2.0*quat.X*quat.X - 2.0*quat.Y*quat.Y
+
+	out[0].W = float64(origin.X)
+	out[1].W = float64(origin.Y)
+	out[2].W = float64(origin.Z)
+
+	return &out
+}
+
+// Matrix3x4Invert inverts a transform made of a rotation and a translation.
+func Matrix3x4Invert(m *Matrix3x4) *Matrix3x4 {
+	var out Matrix3x4
+	out[0].X, out[0].Y, out[0].Z = m[0].X, m[1].X, m[2].X
+	out[1].X, out[1].Y, out[1].Z = m[0].Y, m[1].Y, m[2].Y
+	out[2].X, out[2].Y, out[2].Z = m[0].Z, m[1].Z, m[2].Z
+	out[0].W = -(m[0].W*out[0].X + m[1].W*out[0].Y + m[2].W*out[0].Z)
+	out[1].W = -(m[0].W*out[1].X + m[1].W*out[1].Y + m[2].W*out[1].Z)
+	out[2].W = -(m[0].W*out[2].X + m[1].W*out[2].Y + m[2].W*out[2].Z)
+	return &out
+}
+
+func Matrix3x4VectorTransform(m *Matrix3x4, v *Vector3_32) *Vector3_32 {
+	var out [3]float64
+	out[0] = float64(v.X)*m[0].X + float64(v.Y)*m[0].Y + float64(v.Z)*m[0].Z + m[0].W
+	out[1] = float64(v.X)*m[1].X + float64(v.Y)*m[1].Y + float64(v.Z)*m[1].Z + m[1].W
+	out[2] = float64(v.X)*m[2].X + float64(v.Y)*m[2].Y + float64(v.Z)*m[2].Z + m[2].W
+	return &Vector3_32{float32(out[0]), float32(out[1]), float32(out[2])}
+}
+
+func Matrix3x4VectorRotate(m *Matrix3x4, v *Vector3_32) *Vector3_32 {
+	var out [3]float64
+	out[0] = float64(v.X)*m[0].X + float64(v.Y)*m[0].Y + float64(v.Z)*m[0].Z
+	out[1] = float64(v.X)*m[1].X + float64(v.Y)*m[1].Y + float64(v.Z)*m[1].Z
+	out[2] = float64(v.X)*m[2].X + float64(v.Y)*m[2].Y + float64(v.Z)*m[2].Z
+	return &Vector3_32{float32(out[0]), float32(out[1]), float32(out[2])}
+}
+
+// CalcBoneTransforms computes the bone-to-model matrices of the default pose.
+func CalcBoneTransforms(bones []*StudioBone) []*Matrix3x4 {
+	var transforms = make([]*Matrix3x4, len(bones))
+
+	for i, bone := range bones {
+		quat := AngleQuaternion(&Vector3_32{bone.Value[3], bone.Value[4], bone.Value[5]})
+		transforms[i] = Matrix3x4FromOriginQuat(quat,
+			&Vector3_32{bone.Value[0], bone.Value[1], bone.Value[2]})
+
+		if bone.Parent > -1 {
+			transforms[i] = Matrix3x4ConcatTransforms(transforms[bone.Parent], transforms[i])
+		}
+	}
+	return transforms
+}
+
+// CalcSkinTransforms combines the bone-to-model matrices with the
+// pose-to-bone matrices of weighted models. Bones without a pose-to-bone
+// matrix keep their bone-to-model one.
+func CalcSkinTransforms(transforms []*Matrix3x4, bonesInfo []*StudioBoneInfo) []*Matrix3x4 {
+	var skin = make([]*Matrix3x4, len(transforms))
+	poseToBone := new(Matrix3x4)
+
+	for i, transform := range transforms {
+		if i >= len(bonesInfo) {
+			skin[i] = transform
+			continue
+		}
+		poseToBone.From32(&bonesInfo[i].PoseToBone)
+		skin[i] = Matrix3x4ConcatTransforms(transform, poseToBone)
+	}
+	return skin
+}
+
+// SkinMatrix blends the skin matrices of the bones weighting a vertex. The
+// weight missing to a full one goes to the first bone.
+func SkinMatrix(skin []*Matrix3x4, boneWeights *StudioBoneWeight) *Matrix3x4 {
+	var (
+		weights  [MaxBoneWeights]float64
+		boneMats [MaxBoneWeights]*Matrix3x4
+		bonesNum int
+		total    float64
+		out      = Matrix3x4{}
+	)
+
+	for _, b := range boneWeights.Bone {
+		if b != -1 {
+			bonesNum++
+		}
+	}
+
+	for i := 0; i < bonesNum; i++ {
+		boneMats[i] = skin[boneWeights.Bone[i]]
+		weights[i] = float64(boneWeights.Weight[i]) / 255.0
+		total += weights[i]
+	}
+
+	if total < 1.0 {
+		weights[0] += 1.0 - total
+	}
+
+	for i := 0; i < bonesNum; i++ {
+		for j := 0; j < 3; j++ {
+			out[j].X += boneMats[i][j].X * weights[i]
+			out[j].Y += boneMats[i][j].Y * weights[i]
+			out[j].Z += boneMats[i][j].Z * weights[i]
+			out[j].W += boneMats[i][j].W * weights[i]
+		}
+	}
+
+	return &out
+}
+
+// VertexMatrix returns the matrix placing the vertex or normal i, bound to
+// bone, in the default pose: the blend of its weights in a weighted model,
+// the matrix of its bone otherwise and the identity for an unknown bone.
+func VertexMatrix(bone byte, weights []StudioBoneWeight, i int, transforms, skinTransforms []*Matrix3x4) *Matrix3x4 {
+	if skinTransforms != nil && i < len(weights) {
+		return SkinMatrix(skinTransforms, &weights[i])
+	}
+	if int(bone) < len(transforms) {
+		return transforms[bone]
+	}
+	return &Matrix3x4{{X: 1}, {Y: 1}, {Z: 1}}
+}
+
+// NormalizedWeights returns the count bones weighting a vertex and their
+// weights summing to one. The weight missing to a full one goes to the first
+// bone as SkinMatrix blends them, larger sums are scaled down.
+func NormalizedWeights(boneWeights *StudioBoneWeight) (bones [MaxBoneWeights]uint8, weights [MaxBoneWeights]float32, count int) {
+	var total float32
+	for ; count < MaxBoneWeights && boneWeights.Bone[count] != -1; count++ {
+		bones[count] = uint8(boneWeights.Bone[count])
+		weights[count] = float32(boneWeights.Weight[count]) / 255.0
+		total += weights[count]
+	}
+	if total < 1.0 {
+		weights[0] += 1.0 - total
+	} else {
+		for i := 0; i < count; i++ {
+			weights[i] /= total
+		}
+	}
+	return bones, weights, count
+}
+
+func CalcBonePosition(anim *Anim, bone *StudioBone, frame int) [6]float64 {
+	var (
+		motion   [6]float64
+		animVals []*AnimValue
+		value    float64
+		j        int
+	)
+
+	for i := 0; i < 6; i++ {
+		motion[i] = float64(bone.Value[i])
+		animVals = anim.AnimValues[i]
+		if animVals == nil {
+			continue
+		}
+
+		j = frame
+		for _, av := range animVals {
+			if j >= int(av.Total) {
+				j -= int(av.Total)
+				continue
+			}
+			if int(av.Valid) > j {
+				value = float64(av.Values[j])
+			} else {
+				value = float64(av.Values[av.Valid-1])
+			}
+			break
+		}
+		motion[i] += value * float64(bone.Scale[i])
+	}
+
+	return motion
+}
+
+// CalcSequencePose returns the position of every bone at a frame of a
+// sequence blend, with the root bones following the linear movement.
+func CalcSequencePose(seq *Sequence, bones []*StudioBone, blend, frame int) [][6]float64 {
+	var pose = make([][6]float64, len(bones))
+	for i, bone := range bones {
+		pose[i] = CalcBonePosition(seq.Anims[blend*len(bones)+i], bone, frame)
+		if bone.Parent == -1 && seq.FramesNum > 1 {
+			progress := float64(frame) / float64(seq.FramesNum-1)
+			pose[i][0] += progress * float64(seq.LinerMovement.X)
+			pose[i][1] += progress * float64(seq.LinerMovement.Y)
+			pose[i][2] += progress * float64(seq.LinerMovement.Z)
+		}
+	}
+	return pose
+}
+
+func ClipRotations(val *float64) {
+	if math.IsNaN(*val) || math.IsInf(*val, 0) {
+		*val = 0
+		return
+	}
+	if math.Abs(*val) > math.Pi*64.0 {
+		*val = math.Mod(*val, math.Pi*2.0)
+	}
+	for *val >= math.Pi {
+		*val -= math.Pi * 2.0
+	}
+	for *val < -math.Pi {
+		*val += math.Pi * 2.0
+	}
+}
+
+// HalfToFloat converts an IEEE 754 half precision number.
+func HalfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+
+	switch {
+	case exp == 0x1f:
+		// infinity or NaN
+		return math.Float32frombits(sign | 0xff<<23 | mant<<13)
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// subnormal, 2^-24 units
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			return -f
+		}
+		return f
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
@@ -0,0 +1,209 @@
+package studio
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Repair records a damaged part of a model and what recovery did with it.
+type Repair struct {
+	Err    *DecodeError
+	Action string
+}
+
+func (r Repair) String() string {
+	return fmt.Sprintf("%s: %s", r.Err, r.Action)
+}
+
+// recovery collects the repairs made while decoding in recovery mode. A nil
+// recovery decodes strictly and fails on the first damaged section.
+type recovery struct {
+	file    string
+	repairs []Repair
+}
+
+// fix records err as repaired by action and reports whether decoding can go
+// on. Only located decode errors can be repaired.
+func (rc *recovery) fix(err error, format string, args ...interface{}) bool {
+	de, ok := err.(*DecodeError)
+	if rc == nil || !ok {
+		return false
+	}
+	if len(de.File) == 0 {
+		de.File = rc.file
+	}
+	rc.repairs = append(rc.repairs, Repair{de, fmt.Sprintf(format, args...)})
+	return true
+}
+
+// setFile makes name the file of the repairs that follow and returns a
+// function restoring the previous one.
+func (rc *recovery) setFile(name string) func() {
+	prev := rc.file
+	rc.file = name
+	return func() {
+		rc.file = prev
+	}
+}
+
+// missing records a companion file that can not be loaded.
+func (rc *recovery) missing(name, section string, err error, format string, args ...interface{}) bool {
+	if rc == nil {
+		return false
+	}
+	de, ok := err.(*DecodeError)
+	if !ok {
+		de = &DecodeError{name, section, -1, -1, err}
+	}
+	return rc.fix(de, format, args...)
+}
+
+// clampArray is seekArray that, when recovering, shrinks count to the
+// elements lying inside the file instead of failing.
+func (rc *recovery) clampArray(file io.ReadSeeker, section string, off uint32, count *uint32, size, limit int64) error {
+	err := seekArray(file, section, -1, off, *count, size, limit)
+	if err == nil || rc == nil {
+		return err
+	}
+
+	fit := fitCount(file, off, *count, size)
+	if fit > limit {
+		fit = limit
+	}
+	if !rc.fix(err, "kept %d of %d elements", fit, *count) {
+		return err
+	}
+	*count = uint32(fit)
+	return seekArray(file, section, -1, off, *count, size, limit)
+}
+
+// fitCount returns how many of count elements of size bytes at off lie
+// inside the file.
+func fitCount(file io.ReadSeeker, off, count uint32, size int64) int64 {
+	var fit int64
+	if end, err := file.Seek(0, io.SeekEnd); err == nil && int64(off) < end {
+		fit = (end - int64(off)) / size
+	}
+	if fit > int64(count) {
+		fit = int64(count)
+	}
+	return fit
+}
+
+// readPartial reads up to len(data) bytes at off and zero-fills the part
+// missing from the file, returning the number of bytes filled.
+func readPartial(file io.ReadSeeker, off uint32, data []byte) (int, error) {
+	for i := range data {
+		data[i] = 0
+	}
+	end, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	avail := end - int64(off)
+	if avail <= 0 {
+		return len(data), nil
+	}
+	if avail > int64(len(data)) {
+		avail = int64(len(data))
+	}
+	if _, err = file.Seek(int64(off), io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err = io.ReadFull(file, data[:avail]); err != nil {
+		return 0, err
+	}
+	return len(data) - int(avail), nil
+}
+
+// restAnims returns animations holding every bone in its default pose.
+func restAnims(animsNum uint32) []*Anim {
+	var anims = make([]*Anim, animsNum)
+	for i := range anims {
+		anims[i] = new(Anim)
+	}
+	return anims
+}
+
+// rootBone stands in for a skeleton that can not be recovered.
+func rootBone() *StudioBone {
+	b := new(StudioBone)
+	b.Name.FromString("root")
+	b.Parent = -1
+	for i := range b.BoneControllers {
+		b.BoneControllers[i] = math.MaxUint32
+	}
+	return b
+}
+
+// restBonesInfo rebuilds the pose-to-bone matrices from the default pose.
+func restBonesInfo(bones []*StudioBone) []*StudioBoneInfo {
+	var bonesInfo = make([]*StudioBoneInfo, len(bones))
+	for i, transform := range CalcBoneTransforms(bones) {
+		m := Matrix3x4Invert(transform)
+		bi := new(StudioBoneInfo)
+		for j := 0; j < 3; j++ {
+			bi.PoseToBone[j] = Vector4_32{float32(m[j].X), float32(m[j].Y), float32(m[j].Z), float32(m[j].W)}
+		}
+		bi.Quat.W = 1
+		bonesInfo[i] = bi
+	}
+	return bonesInfo
+}
+
+// placeholderTexture stands in for a texture that can not be recovered.
+func placeholderTexture(name string) *Texture {
+	t := new(Texture)
+	t.Name.FromString(name)
+	t.Width, t.Height = 8, 8
+	t.Indices = make([]byte, t.Width*t.Height)
+	for i := 0; i < len(t.Pallets); i++ {
+		t.Pallets[i] = 0x80
+	}
+	return t
+}
+
+// placeholderTextures stands in for a missing T.mdl file, with a texture for
+// every skin reference of the meshes.
+func placeholderTextures(mdl *Mdl) *Mdl {
+	var texturesNum uint32 = 1
+	for _, bp := range mdl.BodyParts {
+		for _, m := range bp.Models {
+			for _, mesh := range m.Meshes {
+				if mesh.SkinRef >= texturesNum {
+					texturesNum = mesh.SkinRef + 1
+				}
+			}
+		}
+	}
+
+	mdlT := new(Mdl)
+	skins := [][]uint16{make([]uint16, texturesNum)}
+	for i := range skins[0] {
+		mdlT.Textures = append(mdlT.Textures, placeholderTexture(fmt.Sprintf("blank%d.bmp", i+1)))
+		skins[0][i] = uint16(i)
+	}
+	mdlT.Skins = &skins
+	return mdlT
+}
+
+// meshTableOffsets lists where studiomdl usually places the mesh table of a
+// model, right after the normals or after the normal weights.
+func (m *Model) meshTableOffsets(hasBoneWeights bool) []uint32 {
+	align := func(off int64) uint32 {
+		off = (off + 3) &^ 3
+		if off > math.MaxUint32 {
+			return 0
+		}
+		return uint32(off)
+	}
+	offsets := []uint32{
+		align(int64(m.NormalsOff) + int64(m.NormalsNum)*12),
+		align(int64(m.VertsOff) + int64(m.VertsNum)*12),
+	}
+	if hasBoneWeights {
+		offsets = append(offsets, align(int64(m.BlendNormInfoOff)+int64(m.NormalsNum)*8))
+	}
+	return offsets
+}
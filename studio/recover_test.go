@@ -0,0 +1,107 @@
+package studio_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("..", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// TestDecodeSeqGroupFile checks that a sequence group file, shorter than the
+// header of a main model, is told apart from a damaged model.
+func TestDecodeSeqGroupFile(t *testing.T) {
+	_, err := studio.DecodeBytes(readFixture(t, "boxgroup01.mdl"))
+	if err == nil || err.Error() != "not a main HL model file" {
+		t.Errorf("error %v, want \"not a main HL model file\"", err)
+	}
+}
+
+// TestRecoverHeader moves the hitbox and attachment tables of a model past
+// the end of the file: decoding fails on the attachments and recovery drops
+// both tables, with one repair each.
+func TestRecoverHeader(t *testing.T) {
+	data := readFixture(t, "box.mdl")
+	var hdr studio.StudioHdr
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	if hdr.HitBoxesNum == 0 || hdr.AttachmentsNum == 0 {
+		t.Fatal("box.mdl has no hitboxes or attachments")
+	}
+	attachmentsNum := hdr.AttachmentsNum
+	hdr.HitBoxesOff = uint32(len(data) + 64)
+	hdr.AttachmentsOff = uint32(len(data) + 64)
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &hdr)
+	copy(data, buf.Bytes())
+
+	_, err := studio.DecodeBytes(data)
+	var de *studio.DecodeError
+	if !errors.As(err, &de) || de.Section != "attachment" || !errors.Is(err, studio.ErrOutOfBounds) {
+		t.Fatalf("error %v, want an out of bounds attachment table", err)
+	}
+
+	mdl, err := studio.RecoverFrom(bytes.NewReader(data), "box.mdl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ section, action string }{
+		{"hitbox", "dropped all hitboxes"},
+		{"attachment", fmt.Sprintf("kept 0 of %d elements", attachmentsNum)},
+	}
+	if len(mdl.Repairs) != len(want) {
+		t.Fatalf("repairs %v, want %d", mdl.Repairs, len(want))
+	}
+	for i, r := range mdl.Repairs {
+		if r.Err.File != "box.mdl" || r.Err.Section != want[i].section || r.Action != want[i].action {
+			t.Errorf("repair %q, want %s: %s", r, want[i].section, want[i].action)
+		}
+	}
+	if len(mdl.HitBoxes) != 0 || len(mdl.Attachments) != 0 {
+		t.Errorf("%d hitboxes and %d attachments kept, want none", len(mdl.HitBoxes), len(mdl.Attachments))
+	}
+	if len(mdl.Bones) == 0 || len(mdl.Sequences) == 0 || len(mdl.BodyParts) == 0 {
+		t.Error("the undamaged sections are not decoded")
+	}
+}
+
+// TestRecoverSeqGroup loads a model without the file of its second sequence
+// group: loading fails and recovery gives the sequences the default pose.
+func TestRecoverSeqGroup(t *testing.T) {
+	data := readFixture(t, "boxgroup.mdl")
+	files := studio.BytesResolver(map[string][]byte{})
+	if _, err := studio.LoadFrom(bytes.NewReader(data), "boxgroup.mdl", files); err == nil {
+		t.Fatal("loaded without the sequence group file")
+	}
+
+	mdl, err := studio.RecoverFrom(bytes.NewReader(data), "boxgroup.mdl", files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mdl.Repairs) != 1 {
+		t.Fatalf("repairs %v, want one", mdl.Repairs)
+	}
+	r := mdl.Repairs[0]
+	if r.Err.File != "boxgroup01.mdl" || r.Err.Section != "sequence group" ||
+		r.Action != "replaced its sequences with the default pose" {
+		t.Errorf("repair %q", r)
+	}
+	for _, seq := range mdl.Sequences {
+		if seq.SeqGroup == 1 && len(seq.Anims) != int(seq.BlendsNum*mdl.Header.BonesNum) {
+			t.Errorf("sequence %s: %d animations, want the default pose", seq.Label, len(seq.Anims))
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package studio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// referenceDecoder decodes a valid main model file the way it was done
+// before the buffer: every value read from the file on its own with
+// encoding/binary, seeking to each table. It does not check anything and
+// stays apart from the decoder, for the benchmark to compare both.
+type referenceDecoder struct {
+	r   io.ReadSeeker
+	err error
+}
+
+// at reads the values in order from off.
+func (d *referenceDecoder) at(off uint32, data ...interface{}) {
+	if d.err != nil {
+		return
+	}
+	if _, d.err = d.r.Seek(int64(off), io.SeekStart); d.err != nil {
+		return
+	}
+	d.read(data...)
+}
+
+// read reads the values in order from the current offset.
+func (d *referenceDecoder) read(data ...interface{}) {
+	for _, v := range data {
+		if d.err != nil {
+			return
+		}
+		d.err = binary.Read(d.r, binary.LittleEndian, v)
+	}
+}
+
+func decodeReference(r io.ReadSeeker) (*Mdl, error) {
+	d := &referenceDecoder{r: r}
+	mdl := &Mdl{Header: new(StudioHdr)}
+	hdr := mdl.Header
+	d.at(0, hdr)
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	mdl.Bones = make([]*StudioBone, hdr.BonesNum)
+	d.at(hdr.BonesOffset)
+	for i := range mdl.Bones {
+		mdl.Bones[i] = new(StudioBone)
+		d.read(mdl.Bones[i])
+	}
+	if hdr.Flags&StudioHasBoneInfo != 0 {
+		mdl.BonesInfo = make([]*StudioBoneInfo, hdr.BonesNum)
+		for i := range mdl.BonesInfo {
+			mdl.BonesInfo[i] = new(StudioBoneInfo)
+			d.read(mdl.BonesInfo[i])
+		}
+	}
+
+	mdl.BoneControllers = make([]*StudioBoneController, hdr.BoneControllersNum)
+	d.at(hdr.BoneControllersOff)
+	for i := range mdl.BoneControllers {
+		mdl.BoneControllers[i] = new(StudioBoneController)
+		d.read(mdl.BoneControllers[i])
+	}
+
+	mdl.HitBoxes = make([]*StudioHitBox, hdr.HitBoxesNum)
+	d.at(hdr.HitBoxesOff)
+	for i := range mdl.HitBoxes {
+		mdl.HitBoxes[i] = new(StudioHitBox)
+		d.read(mdl.HitBoxes[i])
+	}
+
+	mdl.SeqGroups = make([]*StudioSeqGroup, hdr.SequenceGroupsNum)
+	d.at(hdr.SequenceGroupsOff)
+	for i := range mdl.SeqGroups {
+		mdl.SeqGroups[i] = new(StudioSeqGroup)
+		d.read(mdl.SeqGroups[i])
+	}
+
+	mdl.Sequences = make([]*Sequence, hdr.SequencesNum)
+	for i := range mdl.Sequences {
+		seq := new(Sequence)
+		d.at(hdr.SequencesOff+uint32(i)*176, &seq.StudioSequence)
+		d.referenceSequence(seq, hdr.BonesNum)
+		mdl.Sequences[i] = seq
+	}
+
+	mdl.Transitions = make([][]byte, hdr.TransitionsNum)
+	d.at(hdr.TransitionsOff)
+	for i := range mdl.Transitions {
+		mdl.Transitions[i] = make([]byte, hdr.TransitionsNum)
+		d.read(mdl.Transitions[i])
+	}
+
+	mdl.BodyParts = make([]*BodyPart, hdr.BodyPartsNum)
+	for i := range mdl.BodyParts {
+		bp := new(BodyPart)
+		d.at(hdr.BodyPartsOff+uint32(i)*76, &bp.StudioBodyPart)
+		bp.Models = make([]*Model, bp.ModelsNum)
+		for j := range bp.Models {
+			m := new(Model)
+			d.at(bp.ModelsOff+uint32(j)*112, &m.StudioModel)
+			d.referenceModel(m, hdr.Flags&StudioHasBoneWeights != 0)
+			bp.Models[j] = m
+		}
+		mdl.BodyParts[i] = bp
+	}
+
+	mdl.Attachments = make([]*StudioAttachment, hdr.AttachmentsNum)
+	d.at(hdr.AttachmentsOff)
+	for i := range mdl.Attachments {
+		mdl.Attachments[i] = new(StudioAttachment)
+		d.read(mdl.Attachments[i])
+	}
+
+	if hdr.StudioHdr2Off != 0 {
+		d.referenceHeader2(mdl)
+	}
+
+	mdl.Textures = make([]*Texture, hdr.TexturesNum)
+	for i := range mdl.Textures {
+		t := new(Texture)
+		d.at(hdr.TexturesOff+uint32(i)*80, &t.StudioTexture)
+		t.Indices = make([]byte, t.Width*t.Height)
+		d.at(t.Offset, t.Indices, &t.Pallets)
+		mdl.Textures[i] = t
+	}
+
+	var skins = make([][]uint16, hdr.SkinFamiliesNum)
+	d.at(hdr.SkinsOff)
+	for i := range skins {
+		skins[i] = make([]uint16, hdr.SkinRefsNum)
+		d.read(skins[i])
+	}
+	mdl.Skins = &skins
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return mdl, nil
+}
+
+func (d *referenceDecoder) referenceSequence(seq *Sequence, bonesNum uint32) {
+	seq.Events = make([]*StudioEvent, seq.EventsNum)
+	d.at(seq.EventsOff)
+	for i := range seq.Events {
+		seq.Events[i] = new(StudioEvent)
+		d.read(seq.Events[i])
+	}
+
+	seq.Pivots = make([]*StudioPivot, seq.PivotsNum)
+	d.at(seq.PivotsOff)
+	for i := range seq.Pivots {
+		seq.Pivots[i] = new(StudioPivot)
+		d.read(seq.Pivots[i])
+	}
+
+	if seq.SeqGroup != 0 {
+		return
+	}
+	seq.Anims = make([]*Anim, seq.BlendsNum*bonesNum)
+	for i := range seq.Anims {
+		var a StudioAnim
+		animOff := seq.AnimOff + uint32(i)*12
+		d.at(animOff, &a)
+
+		anim := new(Anim)
+		for j, off := range a.Offsets {
+			if off == 0 {
+				continue
+			}
+			d.at(animOff + uint32(off))
+			values := make([]*AnimValue, 0, seq.FramesNum)
+			for f := int(seq.FramesNum); f > 0 && d.err == nil; {
+				av := new(AnimValue)
+				d.read(&av.Valid, &av.Total)
+				av.Values = make([]int16, av.Valid)
+				d.read(av.Values)
+				values = append(values, av)
+				f -= int(av.Total)
+			}
+			anim.AnimValues[j] = values
+		}
+		seq.Anims[i] = anim
+	}
+}
+
+func (d *referenceDecoder) referenceModel(m *Model, hasBoneWeights bool) {
+	m.Vertices = make([]Vector3_32, m.VertsNum)
+	m.VerticesInfo = make([]byte, m.VertsNum)
+	m.Normals = make([]Vector3_32, m.NormalsNum)
+	m.NormalsInfo = make([]byte, m.NormalsNum)
+	d.at(m.VertsOff, m.Vertices)
+	d.at(m.VertsInfoOff, m.VerticesInfo)
+	d.at(m.NormalsInfoOff, m.NormalsInfo)
+	d.at(m.NormalsOff, m.Normals)
+	if hasBoneWeights {
+		m.VerticesWeights = make([]StudioBoneWeight, m.VertsNum)
+		m.NormalsWeights = make([]StudioBoneWeight, m.NormalsNum)
+		d.at(m.BlendVertInfoOff, m.VerticesWeights)
+		d.at(m.BlendNormInfoOff, m.NormalsWeights)
+	}
+
+	m.Meshes = make([]*Mesh, m.MeshesNum)
+	for i := range m.Meshes {
+		mesh := new(Mesh)
+		d.at(m.MeshesOff+uint32(i)*20, &mesh.StudioMesh)
+		d.at(mesh.TrianglesOff)
+		mesh.Triangles = make([]*Triangle, 0)
+		for d.err == nil {
+			var vertsNum int16
+			d.read(&vertsNum)
+			if vertsNum == 0 {
+				break
+			}
+			tri := &Triangle{IsStrip: vertsNum < 0}
+			if vertsNum < 0 {
+				vertsNum = -vertsNum
+			}
+			tri.Vertices = make([]*StudioTriangle, vertsNum)
+			for k := range tri.Vertices {
+				tri.Vertices[k] = new(StudioTriangle)
+				d.read(tri.Vertices[k])
+			}
+			mesh.Triangles = append(mesh.Triangles, tri)
+		}
+		m.Meshes[i] = mesh
+	}
+}
+
+func (d *referenceDecoder) referenceHeader2(mdl *Mdl) {
+	hdr2 := new(StudioHdr2)
+	d.at(mdl.Header.StudioHdr2Off, hdr2)
+	mdl.Header2 = hdr2
+
+	mdl.PoseParams = make([]*StudioPoseParam, hdr2.PoseParamsNum)
+	d.at(hdr2.PoseParamsOff)
+	for i := range mdl.PoseParams {
+		mdl.PoseParams[i] = new(StudioPoseParam)
+		d.read(mdl.PoseParams[i])
+	}
+
+	if hdr2.KeyValuesSize > 0 {
+		data := make([]byte, hdr2.KeyValuesSize)
+		d.at(hdr2.KeyValuesOff, data)
+		mdl.KeyValues = strings.TrimRight(string(data), "\x00")
+	}
+
+	mdl.HitBoxSets = make([]*HitBoxSet, hdr2.HitBoxSetsNum)
+	for i := range mdl.HitBoxSets {
+		set := new(HitBoxSet)
+		d.at(hdr2.HitBoxSetsOff+uint32(i)*40, &set.StudioHitBoxSet)
+		set.HitBoxes = make([]*StudioHitBox, set.HitBoxesNum)
+		d.at(set.HitBoxesOff)
+		for j := range set.HitBoxes {
+			set.HitBoxes[j] = new(StudioHitBox)
+			d.read(set.HitBoxes[j])
+		}
+		mdl.HitBoxSets[i] = set
+	}
+}
+
+// TestDecodeReference checks the reference decoder against the decoder on
+// the compiled fixtures.
+func TestDecodeReference(t *testing.T) {
+	for _, name := range []string{"box.mdl", "boxgroup.mdl"} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := DecodeBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeReference(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: decoded differently by the reference decoder", name)
+		}
+	}
+}
@@ -0,0 +1,1405 @@
+package studio
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+const MdlIdent = 0x54534449
+const SeqIdent = 0x51534449
+const StudioVersion = 10
+
+const MaxStudioBones = 128
+const MaxHitboxes = 512
+const MaxBoneWeights = 4
+const MaxPivots = 256
+
+// allocation caps used while decoding, well above what studiomdl produces
+const (
+	maxBones        = 1024
+	maxControllers  = 1024
+	maxSequences    = 8192
+	maxSeqGroups    = 1024
+	maxEvents       = 8192
+	maxBlends       = 64
+	maxFrames       = 65536
+	maxTextures     = 4096
+	maxTextureSize  = 8192
+	maxSkinFamilies = 1024
+	maxBodyParts    = 1024
+	maxModels       = 1024
+	maxMeshes       = 4096
+	maxVerts        = 65536 // vertex and normal indices are 16-bit
+	maxAttachments  = 1024
+	maxTransitions  = 255 // table entries are node numbers stored in bytes
+	maxSoundData    = 1 << 20
+)
+
+// client-side model flags
+const (
+	StudioHasBoneInfo    = 1 << 30
+	StudioHasBoneWeights = 1 << 31
+)
+
+// lighting & rendermode options
+const (
+	StudioNfFlatshade = 1 << iota
+	StudioNfChrome
+	StudioNfFullbright
+	StudioNfNomips    // ignore mip-maps
+	StudioNfNosmooth  // don't smooth tangent space
+	StudioNfAdditive  // rendering with additive mode
+	StudioNfMasked    // use texture with alpha channel
+	StudioNfNormalmap // indexed normalmap
+	StudioNfSolid     = 1 << (iota + 3)
+	StudioNfTwoside             // render mesh as twosided
+	StudioNfColormap  = 1 << 30 // internal system flag
+	StudioNfUvCoords  = 1 << 31 // using half-float coords instead of ST
+)
+
+// sequence flags
+const (
+	StudioLooping = 1 << iota
+)
+
+// motion flags
+const (
+	StudioMotionX = 1 << iota
+	StudioMotionY
+	StudioMotionZ
+	StudioMotionXR
+	StudioMotionYR
+	StudioMotionZR
+	StudioMotionLX
+	StudioMotionLY
+	StudioMotionLZ
+	StudioMotionAX
+	StudioMotionAY
+	StudioMotionAZ
+	StudioMotionAXR
+	StudioMotionAYR
+	StudioMotionAZR
+	StudioMotionTypes = 0x7FFF
+	StudioMotionRLoop = 0x8000 // controller that wraps shortest distance
+)
+
+type Vector3_32 struct{ X, Y, Z float32 }
+
+type Bytes32 [32]byte
+type Bytes64 [64]byte
+
+func (v *Vector3_32) Normalize() {
+	vecLen := float32(math.Sqrt(float64(v.X*v.X + v.Y*v.Y + v.Z*v.Z)))
+	if vecLen > 0.0 {
+		vecLen = 1.0 / vecLen
+	}
+	v.X *= vecLen
+	v.Y *= vecLen
+	v.Z *= vecLen
+}
+
+func (bytes Bytes64) String() string {
+	return bytesToString(bytes[:])
+}
+
+func (bytes *Bytes64) FromString(str string) {
+	strLen := len(str)
+	if strLen > 63 {
+		strLen = 63
+	}
+	for i := 0; i < strLen; i++ {
+		bytes[i] = str[i]
+	}
+	bytes[strLen] = 0
+}
+
+func (bytes Bytes32) String() string {
+	return bytesToString(bytes[:])
+}
+
+func (bytes *Bytes32) FromString(str string) {
+	strLen := len(str)
+	if strLen > 31 {
+		strLen = 31
+	}
+	for i := 0; i < strLen; i++ {
+		bytes[i] = str[i]
+	}
+	bytes[strLen] = 0
+}
+
+// TexCoords returns the texture coordinates of a triangle vertex, with v
+// growing upwards. Textures flagged with StudioNfUvCoords store s and t as
+// half floats instead of texel positions.
+func (tex *Texture) TexCoords(tri *StudioTriangle) (float32, float32) {
+	if tex.Flags&StudioNfUvCoords != 0 {
+		return HalfToFloat(uint16(tri.S)), 1.0 - HalfToFloat(uint16(tri.T))
+	}
+	s, t := 1.0/float64(tex.Width), 1.0/float64(tex.Height)
+	return float32(float64(tri.S) * s), float32(1.0 - float64(tri.T)*t)
+}
+
+// Faces splits a triangle strip or fan into triangles, each wound
+// counterclockwise.
+func (tri *Triangle) Faces() [][3]*StudioTriangle {
+	var (
+		faces  = make([][3]*StudioTriangle, 0, len(tri.Vertices))
+		t      [3]*StudioTriangle
+		isEven bool
+	)
+
+	for i, v := range tri.Vertices {
+		switch {
+		case i == 0:
+			t[0] = v
+			continue
+		case i == 1:
+			t[2] = v
+			continue
+		case i == 2:
+			t[1] = v
+			isEven = !tri.IsStrip
+		case tri.IsStrip:
+			t[2], t[1] = t[1], v
+			isEven = false
+		case i%2 > 0:
+			t[0], t[2] = t[2], v
+			isEven = false
+		default:
+			t[0], t[1] = t[1], v
+			isEven = true
+		}
+
+		if isEven {
+			faces = append(faces, [3]*StudioTriangle{t[1], t[2], t[0]})
+		} else {
+			faces = append(faces, t)
+		}
+	}
+	return faces
+}
+
+func bytesToString(bytes []byte) string {
+	n := len(bytes)
+	for i, b := range bytes {
+		if b == 0 {
+			n = i
+			break
+		}
+	}
+	return string(bytes[:n])
+}
+
+type StudioHdr struct {
+	Ident   uint32
+	Version uint32
+
+	Name   Bytes64
+	Length uint32
+
+	EyePosition Vector3_32 // ideal eye position
+	Min         Vector3_32 // ideal movement hull size
+	Max         Vector3_32
+
+	BBMin Vector3_32 // clipping bounding box
+	BBMax Vector3_32
+
+	Flags uint32
+
+	BonesNum    uint32 // bones
+	BonesOffset uint32
+
+	BoneControllersNum uint32 // bone controllers
+	BoneControllersOff uint32
+
+	HitBoxesNum uint32 // complex bounding boxes
+	HitBoxesOff uint32 // complex bounding boxes
+
+	SequencesNum uint32 // animation sequences
+	SequencesOff uint32
+
+	SequenceGroupsNum uint32 // demand loaded sequences
+	SequenceGroupsOff uint32
+
+	TexturesNum     uint32 // raw textures
+	TexturesOff     uint32
+	TexturesDataOff uint32
+
+	SkinRefsNum     uint32 // replaceable textures
+	SkinFamiliesNum uint32
+	SkinsOff        uint32
+
+	BodyPartsNum uint32
+	BodyPartsOff uint32
+
+	AttachmentsNum uint32 // queryable attachable points
+	AttachmentsOff uint32
+
+	StudioHdr2Off uint32
+	SoundsOff     uint32
+
+	SoundGroupsNum uint32
+	SoundGroupsOff uint32
+
+	TransitionsNum uint32
+	TransitionsOff uint32
+}
+
+type StudioBoneController struct {
+	Bone  int32  // -1 == 0
+	Type  uint32 // X, Y, Z, XR, YR, ZR, M
+	Start float32
+	End   float32
+	Rest  uint32 // byte index value at rest
+	Index uint32 // 0-3 user set controller, 4 mouth
+}
+
+type StudioBone struct {
+	Name            Bytes32 // bone name for symbolic links
+	Parent          int32   // parent bone index
+	Flags           uint32
+	BoneControllers [6]uint32  // bone controller index, -1 == none
+	Value           [6]float32 // default DoF values
+	Scale           [6]float32 // scale for delta DoF values
+}
+
+type StudioHitBox struct {
+	Bone  uint32
+	Group uint32     // intersection group
+	BBMin Vector3_32 // bounding box
+	BBMax Vector3_32
+}
+
+type StudioSequence struct {
+	Label Bytes32 // sequence label
+	FPS   float32 // frames per second
+	Flags uint32  // looping/non-looping flags
+
+	Activity uint32
+	ActWight int32
+
+	EventsNum uint32
+	EventsOff uint32
+
+	FramesNum uint32
+
+	PivotsNum uint32 // number of foot pivots
+	PivotsOff uint32
+
+	MotionType       uint32
+	MotionBone       uint32
+	LinerMovement    Vector3_32
+	AutoMovePosOff   uint32
+	AutoMoveAngleOff uint32
+
+	BBMin Vector3_32 // per sequence bounding box
+	BBMax Vector3_32
+
+	BlendsNum uint32
+	AnimOff   uint32 // StudioAnimation pointer relative to start of sequence group data
+	// [blend][bone][X, Y, Z, XR, YR, ZR]
+
+	BlendTypes  [2]uint32  // X, Y, Z, XR, YR, ZR
+	BlendStart  [2]float32 // starting value
+	BlendEnd    [2]float32
+	BlendParent int32
+
+	SeqGroup uint32 // sequence group for demand loading
+
+	EntryNode int32  // transition node at entry
+	ExitNode  int32  // transition node at exit
+	NodeFlags uint32 // transition rules
+
+	NextSeq int32 // auto advancing sequences
+}
+
+type StudioSeqHdr struct {
+	Ident   uint32
+	Version uint32
+	Name    Bytes64
+	Length  uint32
+}
+
+type StudioSeqGroup struct {
+	Label   Bytes32 // textual name
+	Name    Bytes64 // file name
+	Unused1 int32   // cache index pointer
+	Unused2 int32   // hack for group 0
+}
+
+type StudioAnim struct {
+	Offsets [6]uint16
+}
+
+type StudioPivot struct {
+	Org   Vector3_32 // pivot point
+	Start int32
+	End   int32
+}
+
+type StudioEvent struct {
+	Frame   uint32
+	Event   int32
+	Type    uint32
+	Options Bytes64
+}
+
+type StudioTexture struct {
+	Name   Bytes64
+	Flags  uint32
+	Width  uint32
+	Height uint32
+	Offset uint32
+}
+
+type StudioBodyPart struct {
+	Name      Bytes64
+	ModelsNum uint32
+	Base      uint32
+	ModelsOff uint32 // index into models array
+}
+
+type StudioModel struct {
+	Name Bytes64
+	Type int32
+
+	BoundingRadius float32
+
+	MeshesNum uint32
+	MeshesOff uint32
+
+	VertsNum       uint32 // number of unique vertices
+	VertsInfoOff   uint32 // vertex bone info
+	VertsOff       uint32 // vertex vector3s
+	NormalsNum     uint32 // number of unique surface normals
+	NormalsInfoOff uint32 // normal bone info
+	NormalsOff     uint32 // normal vector3s
+
+	BlendVertInfoOff uint32 // boneweighted vertex info
+	BlendNormInfoOff uint32 // boneweighted normal info
+}
+
+type StudioMesh struct {
+	TrianglesNum uint32
+	TrianglesOff uint32
+	SkinRef      uint32
+	NormalsNum   uint32
+	NormalsOff   uint32
+}
+
+type StudioBoneWeight struct {
+	Weight [MaxBoneWeights]uint8
+	Bone   [MaxBoneWeights]int8
+}
+
+type StudioBoneInfo struct {
+	PoseToBone Matrix3x4_32
+	QAlignment Vector4_32
+	ProcType   int32
+	ProcIndex  int32
+	Quat       Vector4_32
+	Reserved   [10]int32
+}
+
+type StudioTriangle struct {
+	VertexIndex uint16 // index into vertex array
+	NormalIndex uint16 // index into normal array
+	S, T        int16  // s, t position on skin
+}
+
+type StudioAttachment struct {
+	Name    Bytes32
+	Type    uint32
+	Bone    uint32
+	Origins Vector3_32
+	Vectors [3]Vector3_32
+}
+
+type Sequence struct {
+	StudioSequence
+	Events []*StudioEvent
+	Pivots []*StudioPivot
+	Anims  []*Anim
+}
+
+type Anim struct {
+	AnimValues [6][]*AnimValue
+}
+
+type AnimValue struct {
+	Valid  uint8
+	Total  uint8
+	Values []int16
+}
+
+type Texture struct {
+	StudioTexture
+	Indices []byte
+	Pallets [256 * 3]byte
+}
+
+type BodyPart struct {
+	StudioBodyPart
+	Models []*Model
+}
+
+type Model struct {
+	StudioModel
+	Meshes          []*Mesh
+	Vertices        []Vector3_32
+	VerticesInfo    []byte
+	NormalsInfo     []byte
+	Normals         []Vector3_32
+	VerticesWeights []StudioBoneWeight
+	NormalsWeights  []StudioBoneWeight
+}
+
+type Mesh struct {
+	StudioMesh
+	Triangles []*Triangle
+}
+
+type Triangle struct {
+	IsStrip  bool
+	Vertices []*StudioTriangle
+}
+
+type Mdl struct {
+	FilePath        string
+	Header          *StudioHdr
+	Bones           []*StudioBone
+	BonesInfo       []*StudioBoneInfo
+	BoneControllers []*StudioBoneController
+	HitBoxes        []*StudioHitBox
+	Sequences       []*Sequence
+	SeqGroups       []*StudioSeqGroup
+	Transitions     [][]byte // next node on the way between two transition nodes
+	Textures        []*Texture
+	Skins           *[][]uint16
+	BodyParts       []*BodyPart
+	Attachments     []*StudioAttachment
+	Sounds          []byte // raw sound table, its layout is not defined
+	SoundGroups     []byte // raw sound groups
+
+	// Xash3D extension
+	Header2    *StudioHdr2
+	PoseParams []*StudioPoseParam
+	KeyValues  string
+	HitBoxSets []*HitBoxSet
+
+	Repairs  []Repair // what recovery mode skipped or repaired
+	Warnings []Repair // what strict decoding dropped and went on without
+
+	recovery *recovery
+}
+
+// seekArray moves to off after making sure count elements of size bytes
+// starting there lie inside the file.
+func seekArray(file io.ReadSeeker, section string, index int, off, count uint32, size, limit int64) error {
+	if int64(count) > limit {
+		return &DecodeError{"", section, index, int64(off), limitError(int64(count), limit)}
+	}
+	if count == 0 {
+		return nil
+	}
+	end, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if int64(off) > end || int64(count)*size > end-int64(off) {
+		return &DecodeError{"", section, index, int64(off), ErrOutOfBounds}
+	}
+	_, err = file.Seek(int64(off), io.SeekStart)
+	return err
+}
+
+func checkBone(section string, index int, off int64, bone int64, bonesNum uint32) error {
+	if bone < 0 || bone >= int64(bonesNum) {
+		return &DecodeError{"", section, index, off, indexError(bone, int64(bonesNum))}
+	}
+	return nil
+}
+
+func (mdl *Mdl) ReadBones(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	if err := rc.clampArray(file, "bone", hdr.BonesOffset, &hdr.BonesNum, 112, maxBones); err != nil {
+		return err
+	}
+	if rc != nil && hdr.BonesNum == 0 && hdr.BodyPartsNum > 0 {
+		// vertices have to be attached to some bone
+		rc.fix(&DecodeError{"", "bone", -1, int64(hdr.BonesOffset), indexError(0, 0)}, "added a root bone")
+		hdr.BonesNum = 1
+		mdl.Bones = []*StudioBone{rootBone()}
+		if hdr.Flags&StudioHasBoneInfo != 0 {
+			mdl.BonesInfo = restBonesInfo(mdl.Bones)
+		}
+		return nil
+	}
+	var bones = make([]*StudioBone, hdr.BonesNum)
+	for i := 0; i < int(hdr.BonesNum); i++ {
+		b := new(StudioBone)
+		if err := readValue(file, "bone", i, b); err != nil {
+			return err
+		}
+		if b.Parent < -1 || b.Parent >= int32(i) {
+			err := &DecodeError{"", "bone", i, int64(hdr.BonesOffset) + int64(i)*112,
+				indexError(int64(b.Parent), int64(i))}
+			if !rc.fix(err, "attached to the root") {
+				return err
+			}
+			b.Parent = -1
+		}
+		bones[i] = b
+	}
+	mdl.Bones = bones
+
+	if hdr.Flags&StudioHasBoneInfo != 0 {
+		mdl.BonesInfo = nil
+		infoOff := hdr.BonesOffset + hdr.BonesNum*112
+		if err := seekArray(file, "bone info", -1, infoOff, hdr.BonesNum, 128, maxBones); err != nil {
+			if !rc.fix(err, "rebuilt from the default pose") {
+				return err
+			}
+			mdl.BonesInfo = restBonesInfo(bones)
+			return nil
+		}
+		var bonesInfo = make([]*StudioBoneInfo, hdr.BonesNum)
+		for i := 0; i < int(hdr.BonesNum); i++ {
+			bi := new(StudioBoneInfo)
+			if err := readValue(file, "bone info", i, bi); err != nil {
+				return err
+			}
+			bonesInfo[i] = bi
+		}
+		mdl.BonesInfo = bonesInfo
+	}
+
+	return nil
+}
+
+func (mdl *Mdl) ReadBoneControllers(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	if err := rc.clampArray(file, "bone controller", hdr.BoneControllersOff, &hdr.BoneControllersNum,
+		24, maxControllers); err != nil {
+		return err
+	}
+	var boneControllers = make([]*StudioBoneController, 0, hdr.BoneControllersNum)
+	for i := 0; i < int(hdr.BoneControllersNum); i++ {
+		bc := new(StudioBoneController)
+		if err := readValue(file, "bone controller", i, bc); err != nil {
+			return err
+		}
+		if bc.Bone != -1 {
+			off := int64(hdr.BoneControllersOff) + int64(i)*24
+			if err := checkBone("bone controller", i, off, int64(bc.Bone), hdr.BonesNum); err != nil {
+				if !rc.fix(err, "dropped") {
+					return err
+				}
+				continue
+			}
+		}
+		boneControllers = append(boneControllers, bc)
+	}
+	hdr.BoneControllersNum = uint32(len(boneControllers))
+	mdl.BoneControllers = boneControllers
+	return nil
+}
+
+func (mdl *Mdl) ReadHitBoxes(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	if err := rc.clampArray(file, "hitbox", hdr.HitBoxesOff, &hdr.HitBoxesNum, 32, MaxHitboxes); err != nil {
+		return err
+	}
+	var hitBoxes = make([]*StudioHitBox, 0, hdr.HitBoxesNum)
+	for i := 0; i < int(hdr.HitBoxesNum); i++ {
+		hb := new(StudioHitBox)
+		if err := readValue(file, "hitbox", i, hb); err != nil {
+			return err
+		}
+		off := int64(hdr.HitBoxesOff) + int64(i)*32
+		if err := checkBone("hitbox", i, off, int64(hb.Bone), hdr.BonesNum); err != nil {
+			if !rc.fix(err, "dropped") {
+				return err
+			}
+			continue
+		}
+		hitBoxes = append(hitBoxes, hb)
+	}
+	hdr.HitBoxesNum = uint32(len(hitBoxes))
+	mdl.HitBoxes = hitBoxes
+	return nil
+}
+
+func (mdl *Mdl) ReadSequenceGroups(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	if err := rc.clampArray(file, "sequence group", hdr.SequenceGroupsOff, &hdr.SequenceGroupsNum,
+		104, maxSeqGroups); err != nil {
+		return err
+	}
+	var seqGroups = make([]*StudioSeqGroup, hdr.SequenceGroupsNum)
+	for i := 0; i < int(hdr.SequenceGroupsNum); i++ {
+		sg := new(StudioSeqGroup)
+		if err := readValue(file, "sequence group", i, sg); err != nil {
+			return err
+		}
+		seqGroups[i] = sg
+	}
+	mdl.SeqGroups = seqGroups
+	return nil
+}
+
+func (mdl *Mdl) ReadSequences(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	if err := rc.clampArray(file, "sequence", hdr.SequencesOff, &hdr.SequencesNum, 176, maxSequences); err != nil {
+		return err
+	}
+	var sequences = make([]*Sequence, hdr.SequencesNum)
+	for i := 0; i < int(hdr.SequencesNum); i++ {
+		seq := new(Sequence)
+		if err := readValue(file, "sequence", i, &seq.StudioSequence); err != nil {
+			return err
+		}
+		curFileOff, _ := file.Seek(0, io.SeekCurrent)
+		section := fmt.Sprintf("sequence %d", i)
+		if seq.FramesNum > maxFrames {
+			err := &DecodeError{"", "sequence", i, curFileOff - 176, limitError(int64(seq.FramesNum), maxFrames)}
+			if !rc.fix(err, "clamped to %d frames", maxFrames) {
+				return err
+			}
+			seq.FramesNum = maxFrames
+		}
+		if seq.SeqGroup > 0 && seq.SeqGroup >= hdr.SequenceGroupsNum {
+			err := &DecodeError{"", "sequence", i, curFileOff - 176,
+				indexError(int64(seq.SeqGroup), int64(hdr.SequenceGroupsNum))}
+			if !rc.fix(err, "moved to the main file") {
+				return err
+			}
+			seq.SeqGroup = 0
+		}
+		if err := seq.readEvents(file, section, rc); err != nil {
+			return err
+		}
+		if err := seq.readPivots(file, section, rc); err != nil {
+			return err
+		}
+		if seq.SeqGroup == 0 {
+			if err := seq.readAnims(file, section, hdr.BonesNum, rc); err != nil {
+				return err
+			}
+		}
+		if _, err := file.Seek(curFileOff, io.SeekStart); err != nil {
+			return err
+		}
+		sequences[i] = seq
+	}
+	mdl.Sequences = sequences
+	return nil
+}
+
+func (seq *Sequence) readEvents(file io.ReadSeeker, section string, rc *recovery) error {
+	section += " event"
+	if err := seekArray(file, section, -1, seq.EventsOff, seq.EventsNum, 76, maxEvents); err != nil {
+		if !rc.fix(err, "dropped %d events", seq.EventsNum) {
+			return err
+		}
+		seq.EventsNum = 0
+	}
+	var events = make([]*StudioEvent, seq.EventsNum)
+	for i := 0; i < int(seq.EventsNum); i++ {
+		ev := new(StudioEvent)
+		if err := readValue(file, section, i, ev); err != nil {
+			return err
+		}
+		events[i] = ev
+	}
+	seq.Events = events
+	return nil
+}
+
+func (seq *Sequence) readPivots(file io.ReadSeeker, section string, rc *recovery) error {
+	section += " pivot"
+	if err := seekArray(file, section, -1, seq.PivotsOff, seq.PivotsNum, 20, MaxPivots); err != nil {
+		if !rc.fix(err, "dropped %d pivots", seq.PivotsNum) {
+			return err
+		}
+		seq.PivotsNum = 0
+	}
+	var pivots = make([]*StudioPivot, seq.PivotsNum)
+	for i := 0; i < int(seq.PivotsNum); i++ {
+		pv := new(StudioPivot)
+		if err := readValue(file, section, i, pv); err != nil {
+			return err
+		}
+		pivots[i] = pv
+	}
+	seq.Pivots = pivots
+	return nil
+}
+
+func (seq *Sequence) readAnims(file io.ReadSeeker, section string, bonesNum uint32, rc *recovery) error {
+	section += " animation"
+	if seq.BlendsNum > maxBlends {
+		err := &DecodeError{"", section, -1, int64(seq.AnimOff), limitError(int64(seq.BlendsNum), maxBlends)}
+		if !rc.fix(err, "kept the first blend") {
+			return err
+		}
+		seq.BlendsNum = 1
+	}
+
+	anims, err := seq.decodeAnims(file, section, bonesNum)
+	if err != nil {
+		if !rc.fix(err, "replaced with the default pose") {
+			return err
+		}
+		anims = restAnims(seq.BlendsNum * bonesNum)
+	}
+	seq.Anims = anims
+	return nil
+}
+
+func (seq *Sequence) decodeAnims(file io.ReadSeeker, section string, bonesNum uint32) ([]*Anim, error) {
+	animOff := int64(seq.AnimOff)
+	animsNum := seq.BlendsNum * bonesNum
+	if err := seekArray(file, section, -1, seq.AnimOff, animsNum, 12, maxBlends*maxBones); err != nil {
+		return nil, err
+	}
+	var anims = make([]*Anim, animsNum)
+
+	var studioAnims = make([]StudioAnim, animsNum)
+	for i := 0; i < int(animsNum); i++ {
+		if err := readValue(file, section, i, &studioAnims[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, a := range studioAnims {
+		anim := new(Anim)
+		for j := 0; j < 6; j++ {
+			if a.Offsets[j] == 0 {
+				continue
+			}
+			animValues := make([]*AnimValue, 0, seq.FramesNum)
+			valueOff := animOff + int64(i*12) + int64(a.Offsets[j])
+			if _, err := file.Seek(valueOff, io.SeekStart); err != nil {
+				return nil, err
+			}
+
+			f := int(seq.FramesNum)
+			for f > 0 {
+				av := new(AnimValue)
+				if err := readValue(file, section, i, &av.Valid); err != nil {
+					return nil, err
+				}
+				if err := readValue(file, section, i, &av.Total); err != nil {
+					return nil, err
+				}
+				if av.Total == 0 || av.Valid == 0 || av.Valid > av.Total {
+					return nil, &DecodeError{"", section, i, valueOff, ErrBadAnim}
+				}
+				av.Values = make([]int16, av.Valid)
+				if err := readValue(file, section, i, &av.Values); err != nil {
+					return nil, err
+				}
+				animValues = append(animValues, av)
+				f -= int(av.Total)
+			}
+			anim.AnimValues[j] = animValues
+		}
+		anims[i] = anim
+	}
+
+	return anims, nil
+}
+
+func (mdl *Mdl) ReadTransitions(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	var err error
+	if hdr.TransitionsNum > maxTransitions {
+		err = &DecodeError{"", "transition", -1, int64(hdr.TransitionsOff),
+			limitError(int64(hdr.TransitionsNum), maxTransitions)}
+	} else {
+		err = seekArray(file, "transition", -1, hdr.TransitionsOff, hdr.TransitionsNum*hdr.TransitionsNum,
+			1, maxTransitions*maxTransitions)
+	}
+	if err != nil {
+		if !rc.fix(err, "rebuilt from the sequence nodes") {
+			return err
+		}
+		mdl.Transitions = BuildTransitions(mdl.Sequences)
+		hdr.TransitionsNum = uint32(len(mdl.Transitions))
+		return nil
+	}
+
+	var transitions = make([][]byte, hdr.TransitionsNum)
+	for i := range transitions {
+		transitions[i] = make([]byte, hdr.TransitionsNum)
+		if err := readValue(file, "transition", i, &transitions[i]); err != nil {
+			return err
+		}
+	}
+	mdl.Transitions = transitions
+	return nil
+}
+
+// dataOffsets returns the offsets of everything decoded from the main file:
+// the sections the header points to and the data of their elements.
+func (mdl *Mdl) dataOffsets() []uint32 {
+	hdr := mdl.Header
+	var offsets = []uint32{hdr.BonesOffset, hdr.BoneControllersOff, hdr.HitBoxesOff, hdr.SequencesOff,
+		hdr.SequenceGroupsOff, hdr.TexturesOff, hdr.TexturesDataOff, hdr.SkinsOff, hdr.BodyPartsOff,
+		hdr.AttachmentsOff, hdr.StudioHdr2Off, hdr.SoundsOff, hdr.SoundGroupsOff, hdr.TransitionsOff}
+	for _, seq := range mdl.Sequences {
+		offsets = append(offsets, seq.EventsOff, seq.PivotsOff)
+		if seq.SeqGroup == 0 {
+			offsets = append(offsets, seq.AnimOff)
+		}
+	}
+	for _, bp := range mdl.BodyParts {
+		offsets = append(offsets, bp.ModelsOff)
+		for _, m := range bp.Models {
+			offsets = append(offsets, m.MeshesOff, m.VertsOff, m.VertsInfoOff, m.NormalsOff, m.NormalsInfoOff,
+				m.BlendVertInfoOff, m.BlendNormInfoOff)
+			for _, mesh := range m.Meshes {
+				offsets = append(offsets, mesh.TrianglesOff)
+			}
+		}
+	}
+	for _, t := range mdl.Textures {
+		offsets = append(offsets, t.Offset)
+	}
+	if hdr2 := mdl.Header2; hdr2 != nil {
+		offsets = append(offsets, hdr2.PoseParamsOff, hdr2.IKAutoplayLocksOff, hdr2.IKChainsOff,
+			hdr2.KeyValuesOff, hdr2.HitBoxSetsOff)
+		for _, set := range mdl.HitBoxSets {
+			offsets = append(offsets, set.HitBoxesOff)
+		}
+	}
+	return offsets
+}
+
+// ReadSounds keeps the sound tables as raw bytes: studiomdl never fills them
+// and their layout is not defined, so the header gives no size for them. A
+// table reaches up to the next data decoded from the file or its end, and
+// has to be read after the other sections. Tables that can not be read are
+// dropped with a warning, the engine does not use them.
+func (mdl *Mdl) ReadSounds(file io.ReadSeeker) error {
+	hdr := mdl.Header
+	var err error
+	if hdr.SoundsOff != 0 {
+		if mdl.Sounds, err = mdl.readRawTable(file, "sound table", hdr.SoundsOff); err != nil {
+			return err
+		}
+		if mdl.Sounds == nil {
+			hdr.SoundsOff = 0
+		}
+	}
+	if hdr.SoundGroupsNum != 0 {
+		if mdl.SoundGroups, err = mdl.readRawTable(file, "sound group", hdr.SoundGroupsOff); err != nil {
+			return err
+		}
+		if mdl.SoundGroups == nil {
+			hdr.SoundGroupsNum, hdr.SoundGroupsOff = 0, 0
+		}
+	}
+	return nil
+}
+
+func (mdl *Mdl) readRawTable(file io.ReadSeeker, section string, off uint32) ([]byte, error) {
+	end, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	for _, next := range mdl.dataOffsets() {
+		if next > off && int64(next) < end {
+			end = int64(next)
+		}
+	}
+
+	var derr *DecodeError
+	if int64(off) >= end {
+		derr = &DecodeError{"", section, -1, int64(off), ErrOutOfBounds}
+	} else if end-int64(off) > maxSoundData {
+		derr = &DecodeError{"", section, -1, int64(off), limitError(end-int64(off), maxSoundData)}
+	}
+	if derr != nil {
+		if !mdl.recovery.fix(derr, "dropped the %s", section) {
+			mdl.Warnings = append(mdl.Warnings, Repair{derr, "dropped the " + section})
+		}
+		return nil, nil
+	}
+
+	var data = make([]byte, end-int64(off))
+	if _, err := file.Seek(int64(off), io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := readValue(file, section, -1, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (mdl *Mdl) ReadTextures(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	if rc != nil && hdr.TexturesNum > 0 && fitCount(file, hdr.TexturesOff, hdr.TexturesNum, 80) == 0 {
+		// an empty list would send the loader looking for a T.mdl file
+		rc.fix(seekArray(file, "texture", -1, hdr.TexturesOff, hdr.TexturesNum, 80, maxTextures),
+			"replaced with blank textures")
+		mdl.Textures = placeholderTextures(mdl).Textures
+		hdr.TexturesNum = uint32(len(mdl.Textures))
+		return nil
+	}
+	if err := rc.clampArray(file, "texture", hdr.TexturesOff, &hdr.TexturesNum, 80, maxTextures); err != nil {
+		return err
+	}
+	var textures = make([]*Texture, hdr.TexturesNum)
+	for i := 0; i < int(hdr.TexturesNum); i++ {
+		t := new(Texture)
+		if err := readValue(file, "texture", i, &t.StudioTexture); err != nil {
+			return err
+		}
+		curFileOff, _ := file.Seek(0, io.SeekCurrent)
+		if t.Width > maxTextureSize || t.Height > maxTextureSize {
+			err := &DecodeError{"", "texture", i, curFileOff - 80,
+				limitError(int64(math.Max(float64(t.Width), float64(t.Height))), maxTextureSize)}
+			if !rc.fix(err, "replaced with a blank texture") {
+				return err
+			}
+			blank := placeholderTexture(t.Name.String())
+			blank.Flags = t.Flags
+			textures[i] = blank
+			continue
+		}
+		dataSize := t.Width*t.Height + uint32(len(t.Pallets))
+		if err := seekArray(file, "texture data", i, t.Offset, dataSize, 1, math.MaxUint32); err != nil {
+			if rc == nil {
+				return err
+			}
+			// only textures cut short are worth keeping
+			if fit := fitCount(file, t.Offset, dataSize, 1); fit < int64(dataSize)/2 {
+				rc.fix(err, "replaced with a blank texture")
+				blank := placeholderTexture(t.Name.String())
+				blank.Flags = t.Flags
+				textures[i] = blank
+				if _, err := file.Seek(curFileOff, io.SeekStart); err != nil {
+					return err
+				}
+				continue
+			}
+			data := make([]byte, dataSize)
+			missing, rerr := readPartial(file, t.Offset, data)
+			if rerr != nil {
+				return rerr
+			}
+			rc.fix(err, "zero-filled %d missing bytes", missing)
+			t.Indices = data[:t.Width*t.Height]
+			copy(t.Pallets[:], data[t.Width*t.Height:])
+		} else {
+			t.Indices = make([]byte, t.Width*t.Height)
+			if err := readValue(file, "texture data", i, &t.Indices); err != nil {
+				return err
+			}
+			if err := readValue(file, "texture data", i, &t.Pallets); err != nil {
+				return err
+			}
+		}
+		if _, err := file.Seek(curFileOff, io.SeekStart); err != nil {
+			return err
+		}
+		textures[i] = t
+	}
+	mdl.Textures = textures
+	return nil
+}
+
+func (mdl *Mdl) ReadSkins(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+
+	err := mdl.readSkins(file)
+	if err == nil {
+		return nil
+	}
+	if !rc.fix(err, "replaced with the default skin family") {
+		return err
+	}
+
+	hdr.SkinFamiliesNum, hdr.SkinRefsNum = 1, hdr.TexturesNum
+	var skins = [][]uint16{make([]uint16, hdr.SkinRefsNum)}
+	for i := range skins[0] {
+		skins[0][i] = uint16(i)
+	}
+	mdl.Skins = &skins
+	return nil
+}
+
+func (mdl *Mdl) readSkins(file io.ReadSeeker) error {
+	hdr := mdl.Header
+	if hdr.SkinFamiliesNum > maxSkinFamilies {
+		return &DecodeError{"", "skin family", -1, int64(hdr.SkinsOff),
+			limitError(int64(hdr.SkinFamiliesNum), maxSkinFamilies)}
+	}
+	if hdr.SkinRefsNum > maxTextures {
+		return &DecodeError{"", "skin family", -1, int64(hdr.SkinsOff),
+			limitError(int64(hdr.SkinRefsNum), maxTextures)}
+	}
+	if err := seekArray(file, "skin family", -1, hdr.SkinsOff, hdr.SkinFamiliesNum*hdr.SkinRefsNum,
+		2, maxSkinFamilies*maxTextures); err != nil {
+		return err
+	}
+	var skins = make([][]uint16, hdr.SkinFamiliesNum)
+
+	for i := 0; i < int(hdr.SkinFamiliesNum); i++ {
+		skins[i] = make([]uint16, hdr.SkinRefsNum)
+		if err := readValue(file, "skin family", i, &skins[i]); err != nil {
+			return err
+		}
+	}
+	mdl.Skins = &skins
+	return nil
+}
+
+func (mdl *Mdl) ReadBodyParts(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	if err := rc.clampArray(file, "body part", hdr.BodyPartsOff, &hdr.BodyPartsNum, 76, maxBodyParts); err != nil {
+		return err
+	}
+	var bodyParts = make([]*BodyPart, hdr.BodyPartsNum)
+	for i := 0; i < int(hdr.BodyPartsNum); i++ {
+		bp := new(BodyPart)
+		if err := readValue(file, "body part", i, &bp.StudioBodyPart); err != nil {
+			return err
+		}
+		curFileOff, _ := file.Seek(0, io.SeekCurrent)
+		if err := bp.readModels(file, fmt.Sprintf("body part %d", i), hdr, rc); err != nil {
+			return err
+		}
+		if _, err := file.Seek(curFileOff, io.SeekStart); err != nil {
+			return err
+		}
+		bodyParts[i] = bp
+	}
+	mdl.BodyParts = bodyParts
+	return nil
+}
+
+func (bp *BodyPart) readModels(file io.ReadSeeker, section string, hdr *StudioHdr, rc *recovery) error {
+	if err := rc.clampArray(file, section+" model", bp.ModelsOff, &bp.ModelsNum, 112, maxModels); err != nil {
+		return err
+	}
+	var models = make([]*Model, bp.ModelsNum)
+	for i := 0; i < int(bp.ModelsNum); i++ {
+		m := new(Model)
+
+		if err := readValue(file, section+" model", i, &m.StudioModel); err != nil {
+			return err
+		}
+		curFileOff, _ := file.Seek(0, io.SeekCurrent)
+
+		var err error
+		if m.VertsNum > maxVerts {
+			err = &DecodeError{"", section + " model", i, curFileOff - 112, limitError(int64(m.VertsNum), maxVerts)}
+		} else if m.NormalsNum > maxVerts {
+			err = &DecodeError{"", section + " model", i, curFileOff - 112, limitError(int64(m.NormalsNum), maxVerts)}
+		} else {
+			err = m.readGeometry(file, fmt.Sprintf("%s model %d", section, i), hdr, rc)
+		}
+		if err != nil {
+			if !rc.fix(err, "dropped the geometry of the model") {
+				return err
+			}
+			m.clearGeometry()
+		}
+
+		if _, err := file.Seek(curFileOff, io.SeekStart); err != nil {
+			return err
+		}
+		models[i] = m
+	}
+	bp.Models = models
+	return nil
+}
+
+func (m *Model) clearGeometry() {
+	m.MeshesNum, m.VertsNum, m.NormalsNum = 0, 0, 0
+	m.Meshes = []*Mesh{}
+	m.Vertices, m.Normals = []Vector3_32{}, []Vector3_32{}
+	m.VerticesInfo, m.NormalsInfo = []byte{}, []byte{}
+	m.VerticesWeights, m.NormalsWeights = nil, nil
+}
+
+// readGeometry reads the vertices, normals and meshes of a model. When
+// recovering it only fails if the vertices themselves are damaged.
+func (m *Model) readGeometry(file io.ReadSeeker, section string, hdr *StudioHdr, rc *recovery) error {
+	hasBoneWeights := hdr.Flags&StudioHasBoneWeights != 0
+
+	if err := seekArray(file, section+" vertices", -1, m.VertsOff, m.VertsNum, 12, maxVerts); err != nil {
+		return err
+	}
+	m.Vertices = make([]Vector3_32, m.VertsNum)
+	if err := readValue(file, section+" vertices", -1, &m.Vertices); err != nil {
+		return err
+	}
+
+	m.VerticesInfo = make([]byte, m.VertsNum)
+	if err := seekArray(file, section+" vertex info", -1, m.VertsInfoOff, m.VertsNum, 1, maxVerts); err != nil {
+		if !rc.fix(err, "bound every vertex to bone 0") {
+			return err
+		}
+	} else if err := readValue(file, section+" vertex info", -1, &m.VerticesInfo); err != nil {
+		return err
+	}
+	for j, bone := range m.VerticesInfo {
+		off := int64(m.VertsInfoOff) + int64(j)
+		if err := checkBone(section+" vertex info", j, off, int64(bone), hdr.BonesNum); err != nil {
+			if !rc.fix(err, "bound to bone 0") {
+				return err
+			}
+			m.VerticesInfo[j] = 0
+		}
+	}
+
+	m.NormalsInfo = make([]byte, m.NormalsNum)
+	if err := seekArray(file, section+" normal info", -1, m.NormalsInfoOff, m.NormalsNum, 1, maxVerts); err != nil {
+		if !rc.fix(err, "bound every normal to bone 0") {
+			return err
+		}
+	} else if err := readValue(file, section+" normal info", -1, &m.NormalsInfo); err != nil {
+		return err
+	}
+	for j, bone := range m.NormalsInfo {
+		off := int64(m.NormalsInfoOff) + int64(j)
+		if err := checkBone(section+" normal info", j, off, int64(bone), hdr.BonesNum); err != nil {
+			if !rc.fix(err, "bound to bone 0") {
+				return err
+			}
+			m.NormalsInfo[j] = 0
+		}
+	}
+
+	m.Normals = make([]Vector3_32, m.NormalsNum)
+	if err := seekArray(file, section+" normals", -1, m.NormalsOff, m.NormalsNum, 12, maxVerts); err != nil {
+		if !rc.fix(err, "zero-filled %d normals", m.NormalsNum) {
+			return err
+		}
+	} else if err := readValue(file, section+" normals", -1, &m.Normals); err != nil {
+		return err
+	}
+
+	if hasBoneWeights {
+		if err := m.readWeights(file, section, hdr, rc); err != nil {
+			return err
+		}
+	}
+
+	return m.readMeshes(file, section, hasBoneWeights, rc)
+}
+
+func (m *Model) readWeights(file io.ReadSeeker, section string, hdr *StudioHdr, rc *recovery) error {
+	weightsSection := section + " vertex weights"
+	m.VerticesWeights = make([]StudioBoneWeight, m.VertsNum)
+	if err := seekArray(file, weightsSection, -1, m.BlendVertInfoOff, m.VertsNum, 8, maxVerts); err != nil {
+		if !rc.fix(err, "rebuilt from the vertex bones") {
+			return err
+		}
+		for j := range m.VerticesWeights {
+			m.VerticesWeights[j] = singleBoneWeight(m.VerticesInfo[j])
+		}
+	} else if err := readValue(file, weightsSection, -1, &m.VerticesWeights); err != nil {
+		return err
+	}
+	if err := checkWeights(weightsSection, m.BlendVertInfoOff, m.VerticesWeights, m.VerticesInfo, hdr.BonesNum, rc); err != nil {
+		return err
+	}
+
+	weightsSection = section + " normal weights"
+	m.NormalsWeights = make([]StudioBoneWeight, m.NormalsNum)
+	if err := seekArray(file, weightsSection, -1, m.BlendNormInfoOff, m.NormalsNum, 8, maxVerts); err != nil {
+		if !rc.fix(err, "rebuilt from the normal bones") {
+			return err
+		}
+		for j := range m.NormalsWeights {
+			m.NormalsWeights[j] = singleBoneWeight(m.NormalsInfo[j])
+		}
+	} else if err := readValue(file, weightsSection, -1, &m.NormalsWeights); err != nil {
+		return err
+	}
+	return checkWeights(weightsSection, m.BlendNormInfoOff, m.NormalsWeights, m.NormalsInfo, hdr.BonesNum, rc)
+}
+
+// checkWeights validates the weighted bones, binding bad elements to their
+// single bone when recovering.
+func checkWeights(section string, off uint32, weights []StudioBoneWeight, bones []byte, bonesNum uint32, rc *recovery) error {
+	for j := range weights {
+		elemOff := int64(off) + int64(j)*8
+		// weighted bones come first, the rest of the slots are -1
+		for k, bone := range weights[j].Bone {
+			if bone == -1 && (k == MaxBoneWeights-1 || weights[j].Bone[k+1] == -1) {
+				continue
+			}
+			if err := checkBone(section, j, elemOff, int64(bone), bonesNum); err != nil {
+				if !rc.fix(err, "bound to the element bone") {
+					return err
+				}
+				weights[j] = singleBoneWeight(bones[j])
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func singleBoneWeight(bone byte) StudioBoneWeight {
+	return StudioBoneWeight{
+		Weight: [MaxBoneWeights]uint8{255},
+		Bone:   [MaxBoneWeights]int8{int8(bone), -1, -1, -1},
+	}
+}
+
+// readMeshes reads the mesh table of a model. When recovering from a damaged
+// table, the places where studiomdl usually stores it are tried before
+// keeping what can be read from the table.
+func (m *Model) readMeshes(file io.ReadSeeker, section string, hasBoneWeights bool, rc *recovery) error {
+	meshes, err := m.decodeMeshes(file, section, m.MeshesOff, m.MeshesNum, nil)
+	if err == nil || rc == nil {
+		m.Meshes = meshes
+		return err
+	}
+
+	for _, off := range m.meshTableOffsets(hasBoneWeights) {
+		if off == m.MeshesOff {
+			continue
+		}
+		if meshes, serr := m.decodeMeshes(file, section, off, m.MeshesNum, nil); serr == nil {
+			rc.fix(err, "mesh table found at offset %d", off)
+			m.MeshesOff, m.Meshes = off, meshes
+			return nil
+		}
+	}
+
+	if err := rc.clampArray(file, section+" mesh", m.MeshesOff, &m.MeshesNum, 20, maxMeshes); err != nil {
+		return err
+	}
+	if meshes, err = m.decodeMeshes(file, section, m.MeshesOff, m.MeshesNum, rc); err != nil {
+		if !rc.fix(err, "dropped %d meshes", m.MeshesNum) {
+			return err
+		}
+		m.MeshesNum, meshes = 0, []*Mesh{}
+	}
+	m.Meshes = meshes
+	return nil
+}
+
+func (m *Model) decodeMeshes(file io.ReadSeeker, section string, off, count uint32, rc *recovery) ([]*Mesh, error) {
+	if err := seekArray(file, section+" mesh", -1, off, count, 20, maxMeshes); err != nil {
+		return nil, err
+	}
+	var meshes = make([]*Mesh, count)
+	for i := 0; i < int(count); i++ {
+		me := new(Mesh)
+		if err := readValue(file, section+" mesh", i, &me.StudioMesh); err != nil {
+			return nil, err
+		}
+		if me.SkinRef >= maxTextures {
+			err := &DecodeError{"", section + " mesh", i, int64(off) + int64(i)*20,
+				limitError(int64(me.SkinRef), maxTextures)}
+			if !rc.fix(err, "pointed at texture 0") {
+				return nil, err
+			}
+			me.SkinRef = 0
+		}
+		curFileOff, _ := file.Seek(0, io.SeekCurrent)
+		if err := me.readTriangles(file, fmt.Sprintf("%s mesh %d triangles", section, i), m, rc); err != nil {
+			return nil, err
+		}
+		if _, err := file.Seek(curFileOff, io.SeekStart); err != nil {
+			return nil, err
+		}
+		meshes[i] = me
+	}
+	return meshes, nil
+}
+
+func (mesh *Mesh) readTriangles(file io.ReadSeeker, section string, m *Model, rc *recovery) error {
+	var trianglesNum int16
+
+	if _, err := file.Seek(int64(mesh.TrianglesOff), io.SeekStart); err != nil {
+		return err
+	}
+
+	capacity := mesh.TrianglesNum
+	if capacity > maxVerts {
+		capacity = maxVerts
+	}
+	var triangles = make([]*Triangle, 0, capacity)
+	for index := 0; ; index++ {
+		if err := readValue(file, section, index, &trianglesNum); err != nil {
+			if !rc.fix(err, "kept %d triangle commands", len(triangles)) {
+				return err
+			}
+			break
+		}
+		if trianglesNum == 0 {
+			break
+		}
+
+		tri := new(Triangle)
+		vertsNum := int(trianglesNum)
+		if vertsNum < 0 {
+			vertsNum = -vertsNum
+			tri.IsStrip = true
+		}
+		tri.Vertices = make([]*StudioTriangle, vertsNum)
+
+		var badIndex error
+		for i := 0; i < vertsNum; i++ {
+			off, _ := file.Seek(0, io.SeekCurrent)
+			v := new(StudioTriangle)
+			if err := readValue(file, section, index, v); err != nil {
+				return err
+			}
+			if badIndex == nil && uint32(v.VertexIndex) >= m.VertsNum {
+				badIndex = &DecodeError{"", section, index, off, indexError(int64(v.VertexIndex), int64(m.VertsNum))}
+			}
+			if badIndex == nil && uint32(v.NormalIndex) >= m.NormalsNum {
+				badIndex = &DecodeError{"", section, index, off, indexError(int64(v.NormalIndex), int64(m.NormalsNum))}
+			}
+			tri.Vertices[i] = v
+		}
+		if badIndex != nil {
+			if !rc.fix(badIndex, "dropped the triangle command") {
+				return badIndex
+			}
+			continue
+		}
+
+		triangles = append(triangles, tri)
+	}
+
+	mesh.Triangles = triangles
+	return nil
+}
+
+func (mdl *Mdl) ReadAttachments(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	if err := rc.clampArray(file, "attachment", hdr.AttachmentsOff, &hdr.AttachmentsNum, 88, maxAttachments); err != nil {
+		return err
+	}
+	var attachments = make([]*StudioAttachment, 0, hdr.AttachmentsNum)
+	for i := 0; i < int(hdr.AttachmentsNum); i++ {
+		a := new(StudioAttachment)
+		if err := readValue(file, "attachment", i, a); err != nil {
+			return err
+		}
+		off := int64(hdr.AttachmentsOff) + int64(i)*88
+		if err := checkBone("attachment", i, off, int64(a.Bone), hdr.BonesNum); err != nil {
+			if !rc.fix(err, "dropped") {
+				return err
+			}
+			continue
+		}
+		attachments = append(attachments, a)
+	}
+	hdr.AttachmentsNum = uint32(len(attachments))
+	mdl.Attachments = attachments
+	return nil
+}
@@ -0,0 +1,82 @@
+package studio
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBytesString(t *testing.T) {
+	var name Bytes32
+	if s := name.String(); s != "" {
+		t.Errorf("empty name gives %q", s)
+	}
+
+	name.FromString("bone")
+	if s := name.String(); s != "bone" {
+		t.Errorf("got %q, want \"bone\"", s)
+	}
+	name.FromString("b")
+	if s := name.String(); s != "b" {
+		t.Errorf("a shorter name over a longer one gives %q", s)
+	}
+
+	long := strings.Repeat("x", 40)
+	name.FromString(long)
+	if s := name.String(); s != long[:31] {
+		t.Errorf("a long name gives %q, want the first 31 bytes", s)
+	}
+	name[31] = 'x'
+	if s := name.String(); s != long[:32] {
+		t.Errorf("a name without a terminator gives %q, want the whole array", s)
+	}
+}
+
+func TestHalfToFloat(t *testing.T) {
+	tests := []struct {
+		h    uint16
+		want float32
+	}{
+		{0x0000, 0},
+		{0x3c00, 1},
+		{0x3800, 0.5},
+		{0x3555, 0.333251953125},
+		{0xc000, -2},
+		{0x7bff, 65504},
+		{0x0001, 1.0 / (1 << 24)},
+		{0x8001, -1.0 / (1 << 24)},
+		{0x7c00, float32(math.Inf(1))},
+		{0xfc00, float32(math.Inf(-1))},
+	}
+	for _, test := range tests {
+		if got := HalfToFloat(test.h); got != test.want {
+			t.Errorf("HalfToFloat(%#04x) = %v, want %v", test.h, got, test.want)
+		}
+	}
+	if got := HalfToFloat(0x7e00); !math.IsNaN(float64(got)) {
+		t.Errorf("HalfToFloat(0x7e00) = %v, want NaN", got)
+	}
+	if got := HalfToFloat(0x8000); got != 0 || !math.Signbit(float64(got)) {
+		t.Errorf("HalfToFloat(0x8000) = %v, want -0", got)
+	}
+}
+
+func TestTexCoords(t *testing.T) {
+	tex := &Texture{StudioTexture: StudioTexture{Width: 64, Height: 32}}
+	tri := &StudioTriangle{S: 16, T: 8}
+	if s, v := tex.TexCoords(tri); s != 0.25 || v != 0.75 {
+		t.Errorf("texel position (16, 8) gives (%v, %v), want (0.25, 0.75)", s, v)
+	}
+
+	// 0.25 and 0.75 as half floats, whatever the size of the texture
+	tex.Flags |= StudioNfUvCoords
+	tri = &StudioTriangle{S: 0x3400, T: 0x3a00}
+	if s, v := tex.TexCoords(tri); s != 0.25 || v != 0.25 {
+		t.Errorf("half floats (0.25, 0.75) give (%v, %v), want (0.25, 0.25)", s, v)
+	}
+	// the sign bit of a half float makes a negative int16
+	tri = &StudioTriangle{S: -0x4000, T: 0}
+	if s, v := tex.TexCoords(tri); s != -2 || v != 1 {
+		t.Errorf("half floats (-2, 0) give (%v, %v), want (-2, 1)", s, v)
+	}
+}
@@ -0,0 +1,139 @@
+package studio
+
+// transitionGraph links the transition nodes of a model through its
+// sequences, as the node, transition and rtransition QC options do.
+type transitionGraph struct {
+	edges [][]bool
+	dist  [][]int // shortest number of steps between nodes, -1 if none
+	first [][]int // node to go to first on the way, -1 if none
+}
+
+func newTransitionGraph(sequences []*Sequence) *transitionGraph {
+	var nodesNum int
+	for _, seq := range sequences {
+		for _, node := range []int32{seq.EntryNode, seq.ExitNode} {
+			if int(node) > nodesNum && node <= maxTransitions {
+				nodesNum = int(node)
+			}
+		}
+	}
+
+	g := &transitionGraph{
+		edges: make([][]bool, nodesNum),
+		dist:  make([][]int, nodesNum),
+		first: make([][]int, nodesNum),
+	}
+	for i := range g.edges {
+		g.edges[i] = make([]bool, nodesNum)
+	}
+
+	for _, seq := range sequences {
+		entry, exit := int(seq.EntryNode)-1, int(seq.ExitNode)-1
+		if entry < 0 || exit < 0 || entry >= nodesNum || exit >= nodesNum || entry == exit {
+			continue
+		}
+		g.edges[entry][exit] = true
+		if seq.NodeFlags != 0 {
+			g.edges[exit][entry] = true
+		}
+	}
+
+	for i := 0; i < nodesNum; i++ {
+		g.dist[i], g.first[i] = g.search(i)
+	}
+	return g
+}
+
+// search walks the graph breadth first from node, preferring lower nodes.
+func (g *transitionGraph) search(node int) ([]int, []int) {
+	dist := make([]int, len(g.edges))
+	first := make([]int, len(g.edges))
+	for i := range dist {
+		dist[i], first[i] = -1, -1
+	}
+	dist[node] = 0
+
+	queue := []int{node}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for next, linked := range g.edges[cur] {
+			if !linked || dist[next] >= 0 {
+				continue
+			}
+			dist[next] = dist[cur] + 1
+			if cur == node {
+				first[next] = next
+			} else {
+				first[next] = first[cur]
+			}
+			queue = append(queue, next)
+		}
+	}
+	return dist, first
+}
+
+// BuildTransitions computes the transition table from the entry and exit
+// nodes of the sequences: the entry for nodes i+1 and j+1 is the node to
+// go to next on the shortest way between them, or 0 if there is none.
+func BuildTransitions(sequences []*Sequence) [][]byte {
+	g := newTransitionGraph(sequences)
+	var transitions = make([][]byte, len(g.edges))
+	for i := range transitions {
+		transitions[i] = make([]byte, len(g.edges))
+		for j, next := range g.first[i] {
+			if next >= 0 {
+				transitions[i][j] = byte(next + 1)
+			}
+		}
+	}
+	return transitions
+}
+
+// TransitionMismatch is an entry of a transition table that can not be
+// rebuilt from the entry and exit nodes of the sequences.
+type TransitionMismatch struct {
+	From, To int // transition nodes
+	Node     int // next node stored in the table
+	Expected int // next node the sequences lead to, 0 if none
+}
+
+// CheckTransitions compares a decoded transition table with the one built
+// from the sequences. Any of the shortest ways between two nodes is
+// accepted, and the diagonal, never read by the engine, is skipped.
+func CheckTransitions(transitions [][]byte, sequences []*Sequence) []TransitionMismatch {
+	g := newTransitionGraph(sequences)
+	nodesNum := len(g.edges)
+	if len(transitions) > nodesNum {
+		nodesNum = len(transitions)
+	}
+
+	var mismatches []TransitionMismatch
+	for i := 0; i < nodesNum; i++ {
+		for j := 0; j < nodesNum; j++ {
+			if i == j {
+				continue
+			}
+			var node, expected int
+			if i < len(transitions) && j < len(transitions[i]) {
+				node = int(transitions[i][j])
+			}
+			if i < len(g.edges) && j < len(g.edges) {
+				expected = g.first[i][j] + 1
+			}
+			if node == expected || g.isShortestStep(i, j, node-1) {
+				continue
+			}
+			mismatches = append(mismatches, TransitionMismatch{i + 1, j + 1, node, expected})
+		}
+	}
+	return mismatches
+}
+
+func (g *transitionGraph) isShortestStep(from, to, next int) bool {
+	n := len(g.edges)
+	if from >= n || to >= n || next < 0 || next >= n || !g.edges[from][next] {
+		return false
+	}
+	return g.dist[from][to] > 0 && g.dist[next][to] == g.dist[from][to]-1
+}
@@ -0,0 +1,3 @@
+package studio
+
+const Version = "0.3"
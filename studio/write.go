@@ -0,0 +1,633 @@
+package studio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// mdlWriter lays the studio data out in memory so that offsets of the
+// already written tables can be patched once their contents are known.
+type mdlWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *mdlWriter) offset() uint32 {
+	return uint32(w.buf.Len())
+}
+
+func (w *mdlWriter) write(data interface{}) error {
+	return binary.Write(&w.buf, binary.LittleEndian, data)
+}
+
+func (w *mdlWriter) patch(off uint32, data interface{}) error {
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, data); err != nil {
+		return err
+	}
+	copy(w.buf.Bytes()[off:], b.Bytes())
+	return nil
+}
+
+func (w *mdlWriter) align() {
+	for w.buf.Len()%4 != 0 {
+		w.buf.WriteByte(0)
+	}
+}
+
+// Encode serializes the model into a version 10 studio file. All counts and
+// offsets are recomputed from the decoded data and textures loaded from a
+// companion "T.mdl" are stored in the resulting file itself. Animations of
+// sequences outside of the default group are left to EncodeFiles.
+func (mdl *Mdl) Encode() ([]byte, error) {
+	data, _, err := mdl.encode("")
+	return data, err
+}
+
+// EncodeFiles serializes the model like Encode together with its sequence
+// group files, one for every group of the model. The default group is
+// stored in the main file, so its element is nil. The groups are named
+// after modelPath, the file the model is written to, as studiomdl names
+// them.
+func (mdl *Mdl) EncodeFiles(modelPath string) ([]byte, [][]byte, error) {
+	return mdl.encode(modelPath)
+}
+
+// encode keeps the stored sequence group names when modelPath is empty.
+func (mdl *Mdl) encode(modelPath string) ([]byte, [][]byte, error) {
+	if hdr2 := mdl.Header2; hdr2 != nil && (hdr2.IKChainsNum > 0 || hdr2.IKAutoplayLocksNum > 0) {
+		return nil, nil, errors.New(fmt.Sprintf("model has %d IK chains and %d IK autoplay locks that can not be encoded",
+			hdr2.IKChainsNum, hdr2.IKAutoplayLocksNum))
+	}
+
+	w := new(mdlWriter)
+
+	hdr := *mdl.Header
+	hdr.Ident = MdlIdent
+	hdr.Version = StudioVersion
+	hdr.StudioHdr2Off = 0
+
+	if err := w.write(&hdr); err != nil {
+		return nil, nil, err
+	}
+
+	if err := mdl.writeBones(w, &hdr); err != nil {
+		return nil, nil, err
+	}
+	if err := mdl.writeBoneControllers(w, &hdr); err != nil {
+		return nil, nil, err
+	}
+	if err := mdl.writeAttachments(w, &hdr); err != nil {
+		return nil, nil, err
+	}
+	if err := mdl.writeHitBoxes(w, &hdr); err != nil {
+		return nil, nil, err
+	}
+	if err := mdl.writeHeader2(w, &hdr); err != nil {
+		return nil, nil, err
+	}
+	groups, err := mdl.writeSequences(w, &hdr, modelPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := mdl.writeTransitions(w, &hdr); err != nil {
+		return nil, nil, err
+	}
+	if err := mdl.writeBodyParts(w, &hdr); err != nil {
+		return nil, nil, err
+	}
+	if err := mdl.writeTextures(w, &hdr); err != nil {
+		return nil, nil, err
+	}
+	if err := mdl.writeSounds(w, &hdr); err != nil {
+		return nil, nil, err
+	}
+
+	hdr.Length = w.offset()
+	if err := w.patch(0, &hdr); err != nil {
+		return nil, nil, err
+	}
+
+	return w.buf.Bytes(), groups, nil
+}
+
+func (mdl *Mdl) writeBones(w *mdlWriter, hdr *StudioHdr) error {
+	hdr.BonesNum = uint32(len(mdl.Bones))
+	hdr.BonesOffset = w.offset()
+	for _, b := range mdl.Bones {
+		if err := w.write(b); err != nil {
+			return err
+		}
+	}
+
+	if hdr.Flags&StudioHasBoneInfo != 0 {
+		if len(mdl.BonesInfo) != len(mdl.Bones) {
+			return errors.New(fmt.Sprintf("model has %d bones but %d bone infos",
+				len(mdl.Bones), len(mdl.BonesInfo)))
+		}
+		for _, bi := range mdl.BonesInfo {
+			if err := w.write(bi); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (mdl *Mdl) writeBoneControllers(w *mdlWriter, hdr *StudioHdr) error {
+	hdr.BoneControllersNum = uint32(len(mdl.BoneControllers))
+	hdr.BoneControllersOff = w.offset()
+	for _, bc := range mdl.BoneControllers {
+		if err := w.write(bc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mdl *Mdl) writeAttachments(w *mdlWriter, hdr *StudioHdr) error {
+	hdr.AttachmentsNum = uint32(len(mdl.Attachments))
+	hdr.AttachmentsOff = w.offset()
+	for _, a := range mdl.Attachments {
+		if err := w.write(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mdl *Mdl) writeHitBoxes(w *mdlWriter, hdr *StudioHdr) error {
+	hdr.HitBoxesNum = uint32(len(mdl.HitBoxes))
+	hdr.HitBoxesOff = w.offset()
+	for _, hb := range mdl.HitBoxes {
+		if err := w.write(hb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHeader2 stores the Xash3D secondary header. IK chains and autoplay
+// locks are not decoded, encode refuses the models having them.
+func (mdl *Mdl) writeHeader2(w *mdlWriter, hdr *StudioHdr) error {
+	if !mdl.HasHeader2() {
+		return nil
+	}
+
+	var hdr2 StudioHdr2
+	hdr.StudioHdr2Off = w.offset()
+	if err := w.write(&hdr2); err != nil {
+		return err
+	}
+
+	hdr2.PoseParamsNum = uint32(len(mdl.PoseParams))
+	hdr2.PoseParamsOff = w.offset()
+	for _, pp := range mdl.PoseParams {
+		if err := w.write(pp); err != nil {
+			return err
+		}
+	}
+
+	if len(mdl.KeyValues) > 0 {
+		hdr2.KeyValuesOff = w.offset()
+		hdr2.KeyValuesSize = uint32(len(mdl.KeyValues) + 1)
+		w.buf.WriteString(mdl.KeyValues)
+		w.buf.WriteByte(0)
+		w.align()
+	}
+
+	var sets = make([]StudioHitBoxSet, len(mdl.HitBoxSets))
+	hdr2.HitBoxSetsNum = uint32(len(sets))
+	hdr2.HitBoxSetsOff = w.offset()
+	if err := w.write(sets); err != nil {
+		return err
+	}
+	for i, set := range mdl.HitBoxSets {
+		sets[i] = set.StudioHitBoxSet
+		sets[i].HitBoxesNum = uint32(len(set.HitBoxes))
+		sets[i].HitBoxesOff = w.offset()
+		for _, hb := range set.HitBoxes {
+			if err := w.write(hb); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.patch(hdr2.HitBoxSetsOff, sets); err != nil {
+		return err
+	}
+
+	return w.patch(hdr.StudioHdr2Off, &hdr2)
+}
+
+// writeSounds stores the raw sound tables back at the end of the file, one
+// after the other and unpadded, where the decoder ends them. The count of
+// sound groups is kept as the header stores it.
+func (mdl *Mdl) writeSounds(w *mdlWriter, hdr *StudioHdr) error {
+	if (hdr.SoundGroupsNum == 0) != (len(mdl.SoundGroups) == 0) {
+		return errors.New(fmt.Sprintf("model has %d sound groups in %d bytes",
+			hdr.SoundGroupsNum, len(mdl.SoundGroups)))
+	}
+
+	hdr.SoundsOff = 0
+	if len(mdl.Sounds) > 0 {
+		hdr.SoundsOff = w.offset()
+		w.buf.Write(mdl.Sounds)
+	}
+
+	hdr.SoundGroupsOff = 0
+	if len(mdl.SoundGroups) > 0 {
+		hdr.SoundGroupsOff = w.offset()
+		w.buf.Write(mdl.SoundGroups)
+	}
+	return nil
+}
+
+func (mdl *Mdl) writeSequences(w *mdlWriter, hdr *StudioHdr, modelPath string) ([][]byte, error) {
+	var sequences = make([]StudioSequence, len(mdl.Sequences))
+	for i, seq := range mdl.Sequences {
+		sequences[i] = seq.StudioSequence
+	}
+
+	hdr.SequencesNum = uint32(len(sequences))
+	hdr.SequencesOff = w.offset()
+	if err := w.write(sequences); err != nil {
+		return nil, err
+	}
+
+	for i, seq := range mdl.Sequences {
+		sequences[i].EventsNum = uint32(len(seq.Events))
+		sequences[i].EventsOff = w.offset()
+		for _, ev := range seq.Events {
+			if err := w.write(ev); err != nil {
+				return nil, err
+			}
+		}
+		sequences[i].PivotsNum = uint32(len(seq.Pivots))
+		sequences[i].PivotsOff = w.offset()
+		for _, pv := range seq.Pivots {
+			if err := w.write(pv); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var seqGroups = make([]StudioSeqGroup, len(mdl.SeqGroups))
+	for i, sg := range mdl.SeqGroups {
+		seqGroups[i] = *sg
+		if i > 0 && len(modelPath) > 0 {
+			seqGroups[i].Name.FromString(seqGroupName(sg.Name.String(), modelPath, i))
+		}
+	}
+	if len(seqGroups) == 0 {
+		seqGroups = make([]StudioSeqGroup, 1)
+		seqGroups[0].Label.FromString("default")
+	}
+	hdr.SequenceGroupsNum = uint32(len(seqGroups))
+	hdr.SequenceGroupsOff = w.offset()
+	if err := w.write(seqGroups); err != nil {
+		return nil, err
+	}
+
+	// animations of the default group follow in the main file, the others
+	// start their own files after the sequence file header
+	var groupWriters = make([]*mdlWriter, len(seqGroups))
+	groupWriters[0] = w
+	for i := 1; i < len(seqGroups); i++ {
+		groupWriters[i] = new(mdlWriter)
+		if err := groupWriters[i].write(new(StudioSeqHdr)); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, seq := range mdl.Sequences {
+		if int(seq.SeqGroup) >= len(seqGroups) {
+			return nil, errors.New(fmt.Sprintf("sequence %s refers to missing sequence group %d",
+				seq.Label, seq.SeqGroup))
+		}
+		gw := groupWriters[seq.SeqGroup]
+		sequences[i].AnimOff = gw.offset()
+		if err := seq.writeAnims(gw, len(mdl.Bones)); err != nil {
+			return nil, err
+		}
+	}
+
+	var groups = make([][]byte, len(seqGroups))
+	for i := 1; i < len(seqGroups); i++ {
+		seqHdr := StudioSeqHdr{Ident: SeqIdent, Version: StudioVersion, Length: groupWriters[i].offset()}
+		seqHdr.Name = seqGroups[i].Name
+		if err := groupWriters[i].patch(0, &seqHdr); err != nil {
+			return nil, err
+		}
+		groups[i] = groupWriters[i].buf.Bytes()
+	}
+
+	return groups, w.patch(hdr.SequencesOff, sequences)
+}
+
+func (mdl *Mdl) writeTransitions(w *mdlWriter, hdr *StudioHdr) error {
+	hdr.TransitionsNum = uint32(len(mdl.Transitions))
+	hdr.TransitionsOff = w.offset()
+	for _, row := range mdl.Transitions {
+		if len(row) != len(mdl.Transitions) {
+			return errors.New("transition table is not square")
+		}
+		if err := w.write(row); err != nil {
+			return err
+		}
+	}
+	w.align()
+	return nil
+}
+
+func (seq *Sequence) writeAnims(w *mdlWriter, bonesNum int) error {
+	animsNum := int(seq.BlendsNum) * bonesNum
+	if len(seq.Anims) != animsNum {
+		return errors.New(fmt.Sprintf("sequence %s has %d animations, expected %d",
+			seq.Label, len(seq.Anims), animsNum))
+	}
+
+	animOff := w.offset()
+	var studioAnims = make([]StudioAnim, animsNum)
+	if err := w.write(studioAnims); err != nil {
+		return err
+	}
+
+	for i, anim := range seq.Anims {
+		for j := 0; j < 6; j++ {
+			if anim.AnimValues[j] == nil {
+				continue
+			}
+
+			off := w.offset() - (animOff + uint32(i*12))
+			if off > math.MaxUint16 {
+				return errors.New(fmt.Sprintf("sequence %s animation data is too large", seq.Label))
+			}
+			studioAnims[i].Offsets[j] = uint16(off)
+
+			for _, av := range anim.AnimValues[j] {
+				if len(av.Values) != int(av.Valid) {
+					return errors.New(fmt.Sprintf("sequence %s has a malformed animation value", seq.Label))
+				}
+				if err := w.write([2]uint8{av.Valid, av.Total}); err != nil {
+					return err
+				}
+				if err := w.write(av.Values); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	w.align()
+
+	return w.patch(animOff, studioAnims)
+}
+
+func (mdl *Mdl) writeBodyParts(w *mdlWriter, hdr *StudioHdr) error {
+	var bodyParts = make([]StudioBodyPart, len(mdl.BodyParts))
+	for i, bp := range mdl.BodyParts {
+		bodyParts[i] = bp.StudioBodyPart
+	}
+
+	hdr.BodyPartsNum = uint32(len(bodyParts))
+	hdr.BodyPartsOff = w.offset()
+	if err := w.write(bodyParts); err != nil {
+		return err
+	}
+
+	for i, bp := range mdl.BodyParts {
+		bodyParts[i].ModelsNum = uint32(len(bp.Models))
+		bodyParts[i].ModelsOff = w.offset()
+		if err := bp.writeModels(w, hdr.Flags&StudioHasBoneWeights != 0); err != nil {
+			return err
+		}
+	}
+
+	return w.patch(hdr.BodyPartsOff, bodyParts)
+}
+
+func (bp *BodyPart) writeModels(w *mdlWriter, hasBoneWeights bool) error {
+	var models = make([]StudioModel, len(bp.Models))
+	for i, m := range bp.Models {
+		models[i] = m.StudioModel
+	}
+
+	modelsOff := w.offset()
+	if err := w.write(models); err != nil {
+		return err
+	}
+
+	for i, m := range bp.Models {
+		if err := m.write(w, &models[i], hasBoneWeights); err != nil {
+			return err
+		}
+	}
+
+	return w.patch(modelsOff, models)
+}
+
+func (m *Model) write(w *mdlWriter, sm *StudioModel, hasBoneWeights bool) error {
+	if len(m.VerticesInfo) != len(m.Vertices) || len(m.NormalsInfo) != len(m.Normals) {
+		return errors.New(fmt.Sprintf("model %s has inconsistent vertex bone info", m.Name))
+	}
+
+	sm.VertsNum = uint32(len(m.Vertices))
+	sm.NormalsNum = uint32(len(m.Normals))
+
+	sm.VertsInfoOff = w.offset()
+	if err := w.write(m.VerticesInfo); err != nil {
+		return err
+	}
+	w.align()
+
+	sm.NormalsInfoOff = w.offset()
+	if err := w.write(m.NormalsInfo); err != nil {
+		return err
+	}
+	w.align()
+
+	if hasBoneWeights {
+		if len(m.VerticesWeights) != len(m.Vertices) || len(m.NormalsWeights) != len(m.Normals) {
+			return errors.New(fmt.Sprintf("model %s has inconsistent vertex weights", m.Name))
+		}
+
+		sm.BlendVertInfoOff = w.offset()
+		if err := w.write(m.VerticesWeights); err != nil {
+			return err
+		}
+		sm.BlendNormInfoOff = w.offset()
+		if err := w.write(m.NormalsWeights); err != nil {
+			return err
+		}
+	} else {
+		sm.BlendVertInfoOff = 0
+		sm.BlendNormInfoOff = 0
+	}
+
+	sm.VertsOff = w.offset()
+	if err := w.write(m.Vertices); err != nil {
+		return err
+	}
+	sm.NormalsOff = w.offset()
+	if err := w.write(m.Normals); err != nil {
+		return err
+	}
+
+	var meshes = make([]StudioMesh, len(m.Meshes))
+	sm.MeshesNum = uint32(len(meshes))
+	sm.MeshesOff = w.offset()
+	if err := w.write(meshes); err != nil {
+		return err
+	}
+
+	normalsOff := sm.NormalsOff
+	for i, me := range m.Meshes {
+		meshes[i] = me.StudioMesh
+		meshes[i].NormalsOff = normalsOff
+		normalsOff += me.NormalsNum * 12
+
+		meshes[i].TrianglesOff = w.offset()
+		trianglesNum, err := me.writeTriangles(w)
+		if err != nil {
+			return err
+		}
+		meshes[i].TrianglesNum = trianglesNum
+	}
+
+	return w.patch(sm.MeshesOff, meshes)
+}
+
+func (mesh *Mesh) writeTriangles(w *mdlWriter) (uint32, error) {
+	var trianglesNum uint32
+
+	for _, tri := range mesh.Triangles {
+		vertsNum := len(tri.Vertices)
+		if vertsNum < 3 || vertsNum > math.MaxInt16 {
+			return 0, errors.New(fmt.Sprintf("invalid number of vertices (%d) in triangle command", vertsNum))
+		}
+
+		cmd := int16(vertsNum)
+		if tri.IsStrip {
+			cmd = -cmd
+		}
+		if err := w.write(cmd); err != nil {
+			return 0, err
+		}
+		for _, v := range tri.Vertices {
+			if err := w.write(v); err != nil {
+				return 0, err
+			}
+		}
+		trianglesNum += uint32(vertsNum - 2)
+	}
+
+	if err := w.write(int16(0)); err != nil {
+		return 0, err
+	}
+	w.align()
+
+	return trianglesNum, nil
+}
+
+func (mdl *Mdl) writeTextures(w *mdlWriter, hdr *StudioHdr) error {
+	var textures = make([]StudioTexture, len(mdl.Textures))
+	for i, tex := range mdl.Textures {
+		textures[i] = tex.StudioTexture
+	}
+
+	hdr.TexturesNum = uint32(len(textures))
+	hdr.TexturesOff = w.offset()
+	if err := w.write(textures); err != nil {
+		return err
+	}
+
+	hdr.SkinFamiliesNum, hdr.SkinRefsNum = 0, 0
+	hdr.SkinsOff = w.offset()
+	if mdl.Skins != nil && len(*mdl.Skins) > 0 {
+		hdr.SkinFamiliesNum = uint32(len(*mdl.Skins))
+		hdr.SkinRefsNum = uint32(len((*mdl.Skins)[0]))
+		for _, sf := range *mdl.Skins {
+			if len(sf) != int(hdr.SkinRefsNum) {
+				return errors.New("skin families have different sizes")
+			}
+			if err := w.write(sf); err != nil {
+				return err
+			}
+		}
+	}
+	w.align()
+
+	hdr.TexturesDataOff = w.offset()
+	for i, tex := range mdl.Textures {
+		if len(tex.Indices) != int(tex.Width*tex.Height) {
+			return errors.New(fmt.Sprintf("texture %s has %d pixels, expected %d",
+				tex.Name, len(tex.Indices), tex.Width*tex.Height))
+		}
+		textures[i].Offset = w.offset()
+		if err := w.write(tex.Indices); err != nil {
+			return err
+		}
+		if err := w.write(&tex.Pallets); err != nil {
+			return err
+		}
+	}
+	w.align()
+
+	return w.patch(hdr.TexturesOff, textures)
+}
+
+// seqGroupName returns the name of the file of sequence group i for a model
+// written to modelPath: the NN.mdl file named after the model, in the
+// directory of the stored name.
+func seqGroupName(stored, modelPath string, i int) string {
+	name := path.Base(legacySeqGroupPath(filepath.ToSlash(modelPath), i))
+	if dir := path.Dir(strings.Replace(stored, "\\", "/", -1)); dir != "." {
+		name = dir + "/" + name
+	}
+	return name
+}
+
+// Save encodes mdl and writes it to outPath, together with the files of its
+// sequence groups named after outPath.
+func Save(outPath string, mdl *Mdl) error {
+	data, groups, err := mdl.EncodeFiles(outPath)
+	if err != nil {
+		return err
+	}
+
+	paths := []string{outPath}
+	for i := 1; i < len(groups); i++ {
+		paths = append(paths, legacySeqGroupPath(outPath, i))
+	}
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			return errors.New(fmt.Sprintf("%s is a directory", p))
+		}
+	}
+
+	if err = writeFile(outPath, data); err != nil {
+		return err
+	}
+	for i := 1; i < len(groups); i++ {
+		if err = writeFile(paths[i], groups[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(outPath string, data []byte) error {
+	file, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(data)
+	return err
+}
@@ -0,0 +1,266 @@
+package studio_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/internal/studiotest"
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// encodeLoad encodes a model with its sequence group files and loads it
+// back as the file name.
+func encodeLoad(t *testing.T, mdl *studio.Mdl, name string) ([]byte, *studio.Mdl) {
+	data, groups, err := mdl.EncodeFiles(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files = make(map[string][]byte)
+	for i := 1; i < len(groups); i++ {
+		files[fmt.Sprintf("%s%02d.mdl", strings.TrimSuffix(name, ".mdl"), i)] = groups[i]
+	}
+
+	loaded, err := studio.LoadFrom(bytes.NewReader(data), name, studio.BytesResolver(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, loaded
+}
+
+// clearOffsets zeroes what the encoder computes from the data: offsets,
+// counts of the decoded lists and the file length.
+func clearOffsets(mdl *studio.Mdl) {
+	hdr := mdl.Header
+	// the count of sound groups is kept by the encoder, not computed
+	sounds := hdr.SoundGroupsNum
+	*hdr = studio.StudioHdr{Ident: hdr.Ident, Version: hdr.Version, Name: hdr.Name,
+		EyePosition: hdr.EyePosition, Min: hdr.Min, Max: hdr.Max, BBMin: hdr.BBMin, BBMax: hdr.BBMax, Flags: hdr.Flags}
+	hdr.SoundGroupsNum = sounds
+	if mdl.Header2 != nil {
+		*mdl.Header2 = studio.StudioHdr2{}
+	}
+	for _, set := range mdl.HitBoxSets {
+		set.HitBoxesNum, set.HitBoxesOff = 0, 0
+	}
+	for _, seq := range mdl.Sequences {
+		seq.EventsNum, seq.EventsOff = 0, 0
+		seq.PivotsNum, seq.PivotsOff = 0, 0
+		seq.AnimOff = 0
+	}
+	for _, bp := range mdl.BodyParts {
+		bp.ModelsNum, bp.ModelsOff = 0, 0
+		for _, m := range bp.Models {
+			sm := &m.StudioModel
+			sm.MeshesNum, sm.MeshesOff = 0, 0
+			sm.VertsNum, sm.VertsInfoOff, sm.VertsOff = 0, 0, 0
+			sm.NormalsNum, sm.NormalsInfoOff, sm.NormalsOff = 0, 0, 0
+			sm.BlendVertInfoOff, sm.BlendNormInfoOff = 0, 0
+			for _, me := range m.Meshes {
+				me.TrianglesNum, me.TrianglesOff, me.NormalsOff = 0, 0, 0
+			}
+		}
+	}
+	for _, tex := range mdl.Textures {
+		tex.Offset = 0
+	}
+}
+
+// firstDiff returns the path of the first field differing between two
+// values, or an empty string.
+func firstDiff(path string, want, got reflect.Value) string {
+	if want.Kind() != got.Kind() {
+		return path
+	}
+	switch want.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if want.IsNil() || got.IsNil() {
+			if want.IsNil() != got.IsNil() {
+				return path
+			}
+			return ""
+		}
+		return firstDiff(path, want.Elem(), got.Elem())
+	case reflect.Struct:
+		for i := 0; i < want.NumField(); i++ {
+			if want.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if d := firstDiff(path+"."+want.Type().Field(i).Name, want.Field(i), got.Field(i)); d != "" {
+				return d
+			}
+		}
+		return ""
+	case reflect.Slice, reflect.Array:
+		if want.Len() != got.Len() || want.Kind() == reflect.Slice && want.IsNil() != got.IsNil() {
+			return fmt.Sprintf("%s (length %d, want %d)", path, got.Len(), want.Len())
+		}
+		for i := 0; i < want.Len(); i++ {
+			if d := firstDiff(fmt.Sprintf("%s[%d]", path, i), want.Index(i), got.Index(i)); d != "" {
+				return d
+			}
+		}
+		return ""
+	}
+	if !reflect.DeepEqual(want.Interface(), got.Interface()) {
+		return fmt.Sprintf("%s (%v, want %v)", path, got.Interface(), want.Interface())
+	}
+	return ""
+}
+
+// TestEncodeRoundTrip encodes a model using every section the writer knows,
+// a demand loaded sequence group included, and checks that the loaded model
+// is the source model and that encoding it again gives the same bytes.
+func TestEncodeRoundTrip(t *testing.T) {
+	mdl := studiotest.Model(studiotest.Options{Bones: 3, Angle: 0.3, Sequences: 3, Frames: 5, Blends: 2,
+		Vertices: 6, Commands: 3, Textures: 2, TextureSize: 4, Extra: true})
+	mdl.FilePath = "test.mdl"
+
+	data, a := encodeLoad(t, mdl, "test.mdl")
+	data2, b := encodeLoad(t, a, "test.mdl")
+	if !bytes.Equal(data, data2) {
+		t.Error("the re-encoded model differs from the first encoding")
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("the reloaded models differ at %s", firstDiff("Mdl", reflect.ValueOf(a), reflect.ValueOf(b)))
+	}
+
+	clearOffsets(a)
+	if d := firstDiff("Mdl", reflect.ValueOf(mdl), reflect.ValueOf(a)); d != "" {
+		t.Errorf("the loaded model differs from the source model at %s", d)
+	}
+}
+
+// TestSaveRenamed saves a model with a demand loaded sequence group under
+// another name and checks that the group file follows the new name.
+func TestSaveRenamed(t *testing.T) {
+	mdl := studiotest.Model(studiotest.Options{Sequences: 2, Frames: 3, Vertices: 4, Extra: true})
+	mdl.SeqGroups[1].Name.FromString("models\\test01.mdl")
+
+	dir, err := ioutil.TempDir("", "studio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outPath := filepath.Join(dir, "renamed.mdl")
+	if err = studio.Save(outPath, mdl); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "renamed01.mdl")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "test01.mdl")); !os.IsNotExist(err) {
+		t.Errorf("the group file is written under the stored name: %v", err)
+	}
+
+	loaded, err := studio.Load(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := loaded.SeqGroups[1].Name.String(); name != "models/renamed01.mdl" {
+		t.Errorf("the group is named %q, want \"models/renamed01.mdl\"", name)
+	}
+	if !reflect.DeepEqual(loaded.Sequences[1].Anims, mdl.Sequences[1].Anims) {
+		t.Error("the animations of the group differ from the source model")
+	}
+}
+
+// TestSaveOntoDirectory checks that Save refuses a directory in the place of
+// the model or of a group file, and leaves it as it is.
+func TestSaveOntoDirectory(t *testing.T) {
+	mdl := studiotest.Model(studiotest.Options{Sequences: 2, Frames: 3, Vertices: 4, Extra: true})
+
+	dir, err := ioutil.TempDir("", "studio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"model.mdl", "model01.mdl"} {
+		target := filepath.Join(dir, name)
+		if err = os.Mkdir(target, 0755); err != nil {
+			t.Fatal(err)
+		}
+		kept := filepath.Join(target, "kept.txt")
+		if err = ioutil.WriteFile(kept, []byte("kept"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = studio.Save(filepath.Join(dir, "model.mdl"), mdl); err == nil {
+			t.Errorf("%s: the model is saved onto a directory", name)
+		}
+		if _, err = os.Stat(kept); err != nil {
+			t.Errorf("%s: the directory lost its file: %v", name, err)
+		}
+		if err = os.RemoveAll(target); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEncodeIK(t *testing.T) {
+	mdl := studiotest.Model(studiotest.Options{Vertices: 4, Extra: true})
+	mdl.Header2.IKChainsNum = 1
+	if _, err := mdl.Encode(); err == nil {
+		t.Error("a model with IK chains is encoded without them")
+	}
+}
+
+// TestSoundTables checks that the raw sound tables keep their size and count
+// through encoding, and that a table is ended by the data that follows it.
+func TestSoundTables(t *testing.T) {
+	mdl := studiotest.Model(studiotest.Options{Vertices: 4, Extra: true})
+	mdl.Sounds = []byte("step")
+	mdl.Header.SoundGroupsNum = 3
+	mdl.SoundGroups = []byte("abcde")
+	data, loaded := encodeLoad(t, mdl, "test.mdl")
+	if !bytes.Equal(loaded.Sounds, mdl.Sounds) || !bytes.Equal(loaded.SoundGroups, mdl.SoundGroups) ||
+		loaded.Header.SoundGroupsNum != 3 {
+		t.Errorf("sound tables %q and %d groups in %q, want %q and 3 in %q", loaded.Sounds,
+			loaded.Header.SoundGroupsNum, loaded.SoundGroups, mdl.Sounds, mdl.SoundGroups)
+	}
+
+	// the sound table moved right before the triangles of the first mesh
+	trianglesOff := loaded.BodyParts[0].Models[0].Meshes[0].TrianglesOff
+	binary.LittleEndian.PutUint32(data[224:], trianglesOff-6)
+	moved, err := studio.DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved.Sounds) != 6 {
+		t.Errorf("sound table of %d bytes before the triangles, want 6", len(moved.Sounds))
+	}
+
+	mdl.Header.SoundGroupsNum = 0
+	if _, err := mdl.Encode(); err == nil {
+		t.Error("sound group data without a count is encoded")
+	}
+}
+
+// TestEncodeFixtures loads the compiled test models, encodes them and checks
+// that the loaded encoding is the same model.
+func TestEncodeFixtures(t *testing.T) {
+	for _, name := range []string{"box.mdl", "boxgroup.mdl"} {
+		path := filepath.Join("..", "testdata", name)
+		a, err := studio.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "boxgroup.mdl" && len(a.SeqGroups) != 2 {
+			t.Fatalf("%s has %d sequence groups, want 2", name, len(a.SeqGroups))
+		}
+
+		_, b := encodeLoad(t, a, path)
+		clearOffsets(a)
+		clearOffsets(b)
+		if d := firstDiff("Mdl", reflect.ValueOf(a), reflect.ValueOf(b)); d != "" {
+			t.Errorf("%s: the encoded model differs at %s", name, d)
+		}
+	}
+}
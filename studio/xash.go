@@ -0,0 +1,169 @@
+package studio
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// limits of the Xash3D extension used while decoding
+const (
+	maxPoseParams    = 1024
+	maxHitBoxSets    = 1024
+	maxKeyValuesSize = 1 << 20
+)
+
+// StudioHdr2 is the secondary header of Xash3D models, pointed to by
+// StudioHdr.StudioHdr2Off.
+type StudioHdr2 struct {
+	PoseParamsNum uint32
+	PoseParamsOff uint32
+
+	IKAutoplayLocksNum uint32
+	IKAutoplayLocksOff uint32
+
+	IKChainsNum uint32
+	IKChainsOff uint32
+
+	KeyValuesOff  uint32
+	KeyValuesSize uint32
+
+	HitBoxSetsNum uint32
+	HitBoxSetsOff uint32
+
+	Unused [6]int32 // future expansions
+}
+
+type StudioPoseParam struct {
+	Name  Bytes32
+	Flags uint32
+	Start float32 // starting value
+	End   float32 // ending value
+	Loop  float32 // looping range, 0 for no looping, 360 for rotations, etc.
+}
+
+type StudioHitBoxSet struct {
+	Name        Bytes32
+	HitBoxesNum uint32
+	HitBoxesOff uint32
+}
+
+type HitBoxSet struct {
+	StudioHitBoxSet
+	HitBoxes []*StudioHitBox
+}
+
+// HasHeader2 reports whether the model carries data of the Xash3D secondary
+// header.
+func (mdl *Mdl) HasHeader2() bool {
+	return mdl.Header2 != nil || len(mdl.PoseParams) > 0 || len(mdl.KeyValues) > 0 || len(mdl.HitBoxSets) > 0
+}
+
+func (mdl *Mdl) ReadHeader2(file io.ReadSeeker) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	if hdr.StudioHdr2Off == 0 {
+		return nil
+	}
+
+	hdr2 := new(StudioHdr2)
+	err := seekArray(file, "secondary header", -1, hdr.StudioHdr2Off, 1, 64, 1)
+	if err == nil {
+		err = readValue(file, "secondary header", -1, hdr2)
+	}
+	if err != nil {
+		if !rc.fix(err, "dropped the Xash3D extension") {
+			return err
+		}
+		hdr.StudioHdr2Off = 0
+		return nil
+	}
+	mdl.Header2 = hdr2
+
+	if err := mdl.readPoseParams(file, hdr2); err != nil {
+		return err
+	}
+	if err := mdl.readKeyValues(file, hdr2); err != nil {
+		return err
+	}
+	return mdl.readHitBoxSets(file, hdr2)
+}
+
+func (mdl *Mdl) readPoseParams(file io.ReadSeeker, hdr2 *StudioHdr2) error {
+	rc := mdl.recovery
+	if err := rc.clampArray(file, "pose parameter", hdr2.PoseParamsOff, &hdr2.PoseParamsNum, 48, maxPoseParams); err != nil {
+		return err
+	}
+	var poseParams = make([]*StudioPoseParam, hdr2.PoseParamsNum)
+	for i := 0; i < int(hdr2.PoseParamsNum); i++ {
+		pp := new(StudioPoseParam)
+		if err := readValue(file, "pose parameter", i, pp); err != nil {
+			return err
+		}
+		poseParams[i] = pp
+	}
+	mdl.PoseParams = poseParams
+	return nil
+}
+
+func (mdl *Mdl) readKeyValues(file io.ReadSeeker, hdr2 *StudioHdr2) error {
+	rc := mdl.recovery
+	if hdr2.KeyValuesSize == 0 {
+		return nil
+	}
+	if err := seekArray(file, "key values", -1, hdr2.KeyValuesOff, hdr2.KeyValuesSize, 1, maxKeyValuesSize); err != nil {
+		if !rc.fix(err, "dropped") {
+			return err
+		}
+		hdr2.KeyValuesSize = 0
+		return nil
+	}
+	var data = make([]byte, hdr2.KeyValuesSize)
+	if err := readValue(file, "key values", -1, &data); err != nil {
+		return err
+	}
+	mdl.KeyValues = strings.TrimRight(string(data), "\x00")
+	return nil
+}
+
+func (mdl *Mdl) readHitBoxSets(file io.ReadSeeker, hdr2 *StudioHdr2) error {
+	hdr, rc := mdl.Header, mdl.recovery
+	if err := rc.clampArray(file, "hitbox set", hdr2.HitBoxSetsOff, &hdr2.HitBoxSetsNum, 40, maxHitBoxSets); err != nil {
+		return err
+	}
+	var sets = make([]*HitBoxSet, hdr2.HitBoxSetsNum)
+	for i := 0; i < int(hdr2.HitBoxSetsNum); i++ {
+		set := new(HitBoxSet)
+		if err := readValue(file, "hitbox set", i, &set.StudioHitBoxSet); err != nil {
+			return err
+		}
+		curFileOff, _ := file.Seek(0, io.SeekCurrent)
+
+		section := fmt.Sprintf("hitbox set %d hitbox", i)
+		if err := rc.clampArray(file, section, set.HitBoxesOff, &set.HitBoxesNum, 32, MaxHitboxes); err != nil {
+			return err
+		}
+		set.HitBoxes = make([]*StudioHitBox, 0, set.HitBoxesNum)
+		for j := 0; j < int(set.HitBoxesNum); j++ {
+			hb := new(StudioHitBox)
+			if err := readValue(file, section, j, hb); err != nil {
+				return err
+			}
+			off := int64(set.HitBoxesOff) + int64(j)*32
+			if err := checkBone(section, j, off, int64(hb.Bone), hdr.BonesNum); err != nil {
+				if !rc.fix(err, "dropped") {
+					return err
+				}
+				continue
+			}
+			set.HitBoxes = append(set.HitBoxes, hb)
+		}
+		set.HitBoxesNum = uint32(len(set.HitBoxes))
+
+		if _, err := file.Seek(curFileOff, io.SeekStart); err != nil {
+			return err
+		}
+		sets[i] = set
+	}
+	mdl.HitBoxSets = sets
+	return nil
+}
@@ -0,0 +1,85 @@
+package studio_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// appendHeader2 appends a secondary header with its pose parameter, key
+// values and hitbox set to a compiled model and points the header at it.
+func appendHeader2(t *testing.T, data []byte, keyValues string, pp *studio.StudioPoseParam,
+	set *studio.StudioHitBoxSet, hb *studio.StudioHitBox) []byte {
+	var hdr studio.StudioHdr
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	off := uint32(len(data)+3) &^ 3
+	hdr.StudioHdr2Off = off
+
+	hdr2 := studio.StudioHdr2{PoseParamsNum: 1, PoseParamsOff: off + 64,
+		KeyValuesOff: off + 112, KeyValuesSize: uint32(len(keyValues) + 1), HitBoxSetsNum: 1}
+	hdr2.HitBoxSetsOff = (hdr2.KeyValuesOff + hdr2.KeyValuesSize + 3) &^ 3
+	set.HitBoxesNum, set.HitBoxesOff = 1, hdr2.HitBoxSetsOff+40
+	hdr.Length = set.HitBoxesOff + 32
+
+	buf := bytes.NewBuffer(data[:len(data):len(data)])
+	buf.Write(make([]byte, off-uint32(len(data))))
+	for _, v := range []interface{}{&hdr2, pp, []byte(keyValues + "\x00")} {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	buf.Write(make([]byte, hdr2.HitBoxSetsOff-uint32(buf.Len())))
+	for _, v := range []interface{}{set, hb} {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+
+	out := buf.Bytes()
+	head := new(bytes.Buffer)
+	binary.Write(head, binary.LittleEndian, &hdr)
+	copy(out, head.Bytes())
+	return out
+}
+
+// TestDecodeHeader2 decodes a model carrying the Xash3D secondary header
+// written field by field, apart from the encoder.
+func TestDecodeHeader2(t *testing.T) {
+	data := readFixture(t, "box.mdl")
+	if mdl, err := studio.DecodeBytes(data); err != nil || mdl.HasHeader2() {
+		t.Fatalf("box.mdl: secondary header %v, error %v", err == nil && mdl.HasHeader2(), err)
+	}
+
+	pp := &studio.StudioPoseParam{Flags: 1, Start: -45, End: 45, Loop: 360}
+	pp.Name.FromString("aim")
+	set := new(studio.StudioHitBoxSet)
+	set.Name.FromString("crouch")
+	hb := &studio.StudioHitBox{Bone: 1, Group: 2, BBMin: studio.Vector3_32{X: -1, Y: -2, Z: -3},
+		BBMax: studio.Vector3_32{X: 1, Y: 2, Z: 3}}
+	keyValues := "{\n\"mass\" \"10\"\n}"
+
+	mdl, err := studio.DecodeBytes(appendHeader2(t, data, keyValues, pp, set, hb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mdl.HasHeader2() || mdl.Header2.PoseParamsNum != 1 || mdl.Header2.HitBoxSetsNum != 1 {
+		t.Fatalf("secondary header %+v", mdl.Header2)
+	}
+	if len(mdl.PoseParams) != 1 || *mdl.PoseParams[0] != *pp {
+		t.Errorf("pose parameters %+v, want %+v", mdl.PoseParams, *pp)
+	}
+	if mdl.KeyValues != keyValues {
+		t.Errorf("key values %q, want %q", mdl.KeyValues, keyValues)
+	}
+	if len(mdl.HitBoxSets) != 1 {
+		t.Fatalf("%d hitbox sets, want 1", len(mdl.HitBoxSets))
+	}
+	got := mdl.HitBoxSets[0]
+	if got.StudioHitBoxSet != *set || !reflect.DeepEqual(got.HitBoxes, []*studio.StudioHitBox{hb}) {
+		t.Errorf("hitbox set %+v %+v, want %+v %+v", got.StudioHitBoxSet, got.HitBoxes, *set, *hb)
+	}
+	if len(mdl.Bones) != 2 || len(mdl.Sequences) != 3 {
+		t.Errorf("%d bones and %d sequences, want the ones of box.mdl", len(mdl.Bones), len(mdl.Sequences))
+	}
+}
@@ -0,0 +1,1132 @@
+package studiomdl
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+
+	"github.com/Psycrow101/mdldec-golang/qc"
+	"github.com/Psycrow101/mdldec-golang/smd"
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+// studiomdl turns the root bones of every animation by 90 degrees,
+// the decompiler undoes it with properBoneRotationZ
+const defaultZRotation = math.Pi / 2
+
+// maxFrames is the number of frames a sequence may have before the decoder
+// rejects the model
+const maxFrames = 65536
+
+type compiler struct {
+	qc      *qc.Script
+	cdPath  string
+	texPath string
+	scale   float32
+
+	log      io.Writer
+	warnings []string
+
+	mdl        *studio.Mdl
+	boneIndex  map[string]int
+	bonePose   []*studio.Matrix3x4
+	poseToBone []*studio.Matrix3x4
+	hasWeights bool
+	textures   map[string]int
+
+	// uncompressed motion of every sequence indexed by [blend][frame][bone]
+	frames [][][][][6]float64
+}
+
+type vertexKey struct {
+	bone    int
+	pos     studio.Vector3_32
+	weights studio.StudioBoneWeight
+}
+
+type normalKey struct {
+	bone int
+	norm studio.Vector3_32
+}
+
+type meshBuilder struct {
+	mesh      *studio.Mesh
+	normals   []studio.Vector3_32
+	normInfo  []byte
+	normBlend []studio.StudioBoneWeight
+	normIndex map[normalKey]int
+	tris      [][3]studio.StudioTriangle
+}
+
+// warnf records a part of the script the compiled model leaves out.
+func (c *compiler) warnf(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+func cleanQCPath(path string) string {
+	return filepath.FromSlash(strings.Replace(path, "\\", "/", -1))
+}
+
+// Compile builds a model from a QC script, the reference and animation
+// SMDs it references and 8-bit BMP textures. The references and sequences
+// are listed to log as they are built, the warnings about what the model
+// leaves out are returned with it.
+func Compile(qcPath string, log io.Writer) (*studio.Mdl, []string, error) {
+	script, err := qc.Load(qcPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qcDir := filepath.Dir(qcPath)
+	c := &compiler{
+		qc:        script,
+		cdPath:    filepath.Join(qcDir, cleanQCPath(script.Cd)),
+		texPath:   filepath.Join(qcDir, cleanQCPath(script.CdTexture)),
+		scale:     script.Scale,
+		log:       log,
+		boneIndex: make(map[string]int),
+		textures:  make(map[string]int),
+	}
+	for _, w := range script.Warnings {
+		c.warnf("%s", w)
+	}
+	if filepath.IsAbs(cleanQCPath(script.Cd)) {
+		c.cdPath = cleanQCPath(script.Cd)
+	}
+	if filepath.IsAbs(cleanQCPath(script.CdTexture)) {
+		c.texPath = cleanQCPath(script.CdTexture)
+	}
+
+	c.mdl = &studio.Mdl{FilePath: qcPath, Header: new(studio.StudioHdr)}
+	c.mdl.Header.Name.FromString(script.ModelName)
+
+	if script.ExternalTextures {
+		c.warnf("$externaltextures is not supported, textures are stored in the model")
+	}
+
+	if err = c.buildBodyParts(); err != nil {
+		return nil, nil, err
+	}
+	if err = c.buildSkins(); err != nil {
+		return nil, nil, err
+	}
+	if err = c.buildSequences(); err != nil {
+		return nil, nil, err
+	}
+	if err = c.buildControllers(); err != nil {
+		return nil, nil, err
+	}
+	if err = c.buildAttachments(); err != nil {
+		return nil, nil, err
+	}
+	if err = c.checkPivots(); err != nil {
+		return nil, nil, err
+	}
+	if err = c.buildHitBoxes(); err != nil {
+		return nil, nil, err
+	}
+	if err = c.buildHeader2(); err != nil {
+		return nil, nil, err
+	}
+	c.buildHeader()
+
+	return c.mdl, c.warnings, nil
+}
+
+func (c *compiler) smdPath(name string) string {
+	path := filepath.Join(c.cdPath, cleanQCPath(name))
+	if !strings.EqualFold(filepath.Ext(path), ".smd") {
+		path += ".smd"
+	}
+	return path
+}
+
+func (c *compiler) lookupBone(name string, pos qc.Pos) (int, error) {
+	if i, ok := c.boneIndex[name]; ok {
+		return i, nil
+	}
+	return 0, &qc.Error{File: c.qc.FileName, Pos: pos, Msg: fmt.Sprintf("unknown bone %q", name)}
+}
+
+// maxPoseDelta is how far the poses of the same bone may differ between
+// references, the rounding of the values written to SMD text
+const maxPoseDelta = 1e-3
+
+// addBones merges the skeleton of a reference into the bone table. The
+// errors are reported at pos, the body model the reference belongs to.
+func (c *compiler) addBones(ref *smd.File, pos qc.Pos) error {
+	if len(ref.Frames) == 0 {
+		return &qc.Error{File: c.qc.FileName, Pos: pos, Msg: fmt.Sprintf("%s has no skeleton", ref.FileName)}
+	}
+	frame := ref.Frames[0]
+	for _, f := range ref.Frames {
+		if f.Time < frame.Time {
+			frame = f
+		}
+	}
+
+	for i, node := range ref.Nodes {
+		var parent int32 = -1
+		if node.Parent >= 0 {
+			parentName := ref.Nodes[node.Parent].Name
+			p, ok := c.boneIndex[parentName]
+			if !ok {
+				return &qc.Error{File: c.qc.FileName, Pos: pos, Msg: fmt.Sprintf(
+					"%s: parent %q of bone %q is not defined before it", ref.FileName, parentName, node.Name)}
+			}
+			parent = int32(p)
+		}
+
+		var value [6]float32
+		for _, pose := range frame.Bones {
+			if pose.Bone == i {
+				value = [6]float32{
+					pose.Position.X * c.scale, pose.Position.Y * c.scale, pose.Position.Z * c.scale,
+					pose.Rotation.X, pose.Rotation.Y, pose.Rotation.Z}
+			}
+		}
+
+		if j, ok := c.boneIndex[node.Name]; ok {
+			bone := c.mdl.Bones[j]
+			if bone.Parent != parent {
+				return &qc.Error{File: c.qc.FileName, Pos: pos, Msg: fmt.Sprintf(
+					"%s: bone %q has a different parent than in the previous references", ref.FileName, node.Name)}
+			}
+			for k := range value {
+				if math.Abs(float64(value[k]-bone.Value[k])) > maxPoseDelta {
+					return &qc.Error{File: c.qc.FileName, Pos: pos, Msg: fmt.Sprintf(
+						"%s: bone %q has a different pose than in the previous references", ref.FileName, node.Name)}
+				}
+			}
+			continue
+		}
+		if len(node.Name) > 31 {
+			return &qc.Error{File: c.qc.FileName, Pos: pos, Msg: fmt.Sprintf(
+				"%s: bone name %q is too long", ref.FileName, node.Name)}
+		}
+		if len(c.mdl.Bones) == studio.MaxStudioBones {
+			return &qc.Error{File: c.qc.FileName, Pos: pos, Msg: fmt.Sprintf(
+				"too many bones (max %d)", studio.MaxStudioBones)}
+		}
+
+		bone := &studio.StudioBone{Parent: parent, Value: value}
+		bone.Name.FromString(node.Name)
+		for j := range bone.BoneControllers {
+			bone.BoneControllers[j] = math.MaxUint32
+		}
+
+		c.boneIndex[node.Name] = len(c.mdl.Bones)
+		c.mdl.Bones = append(c.mdl.Bones, bone)
+	}
+	return nil
+}
+
+func (c *compiler) buildBodyParts() error {
+	var references = make([][]*smd.File, len(c.qc.BodyGroups))
+
+	for i, bg := range c.qc.BodyGroups {
+		references[i] = make([]*smd.File, len(bg.Models))
+		for j, bm := range bg.Models {
+			if bm.Blank {
+				continue
+			}
+			ref, err := smd.Load(c.smdPath(bm.Name))
+			if err != nil {
+				return err
+			}
+			if err = c.addBones(ref, bm.Pos); err != nil {
+				return err
+			}
+			for _, tri := range ref.Triangles {
+				for _, v := range tri.Vertices {
+					if len(v.Links) > 0 {
+						c.hasWeights = true
+					}
+				}
+			}
+			references[i][j] = ref
+		}
+	}
+
+	c.bonePose = studio.CalcBoneTransforms(c.mdl.Bones)
+	c.poseToBone = make([]*studio.Matrix3x4, len(c.bonePose))
+	for i, m := range c.bonePose {
+		c.poseToBone[i] = studio.Matrix3x4Invert(m)
+	}
+
+	base := 1
+	for i, bg := range c.qc.BodyGroups {
+		bp := &studio.BodyPart{}
+		bp.Name.FromString(bg.Name)
+		bp.Base = uint32(base)
+		base *= len(bg.Models)
+
+		for j, bm := range bg.Models {
+			var (
+				m   *studio.Model
+				err error
+			)
+			if bm.Blank {
+				m = new(studio.Model)
+				m.Name.FromString("blank")
+			} else if m, err = c.buildModel(references[i][j], bm.Name); err != nil {
+				return err
+			}
+			bp.Models = append(bp.Models, m)
+		}
+		bp.ModelsNum = uint32(len(bp.Models))
+		c.mdl.BodyParts = append(c.mdl.BodyParts, bp)
+	}
+	return nil
+}
+
+func (c *compiler) vertexWeights(v *smd.Vertex, boneMap []int) studio.StudioBoneWeight {
+	weights := studio.StudioBoneWeight{Bone: [studio.MaxBoneWeights]int8{-1, -1, -1, -1}}
+	if len(v.Links) == 0 {
+		weights.Bone[0] = int8(boneMap[v.Bone])
+		weights.Weight[0] = 255
+		return weights
+	}
+	for i, link := range v.Links {
+		weights.Bone[i] = int8(boneMap[link.Bone])
+		weights.Weight[i] = uint8(math.Max(0, math.Min(255, math.Round(float64(link.Weight)*255.0))))
+	}
+	return weights
+}
+
+func (c *compiler) buildModel(ref *smd.File, name string) (*studio.Model, error) {
+	var (
+		meshes      []*meshBuilder
+		meshBySkin  = make(map[int]*meshBuilder)
+		vertexIndex = make(map[vertexKey]int)
+		boneMap     = make([]int, len(ref.Nodes))
+		radius      float64
+	)
+
+	m := new(studio.Model)
+	m.Name.FromString(name)
+
+	for i, node := range ref.Nodes {
+		boneMap[i] = c.boneIndex[node.Name]
+	}
+
+	for _, tri := range ref.Triangles {
+		skinRef, err := c.texture(tri.Material)
+		if err != nil {
+			return nil, err
+		}
+		tex := c.mdl.Textures[skinRef]
+
+		mb, ok := meshBySkin[skinRef]
+		if !ok {
+			mb = &meshBuilder{mesh: new(studio.Mesh), normIndex: make(map[normalKey]int)}
+			mb.mesh.SkinRef = uint32(skinRef)
+			meshBySkin[skinRef] = mb
+			meshes = append(meshes, mb)
+		}
+
+		var st [3]studio.StudioTriangle
+		// studio winding is the reverse of the SMD one, see writeTriangles
+		for i, j := range [3]int{0, 2, 1} {
+			v := tri.Vertices[j]
+			bone := boneMap[v.Bone]
+			pos := studio.Vector3_32{X: v.Position.X * c.scale, Y: v.Position.Y * c.scale, Z: v.Position.Z * c.scale}
+			norm := v.Normal
+
+			var weights studio.StudioBoneWeight
+			if c.hasWeights {
+				weights = c.vertexWeights(v, boneMap)
+			} else {
+				pos = *studio.Matrix3x4VectorTransform(c.poseToBone[bone], &pos)
+				norm = *studio.Matrix3x4VectorRotate(c.poseToBone[bone], &norm)
+			}
+			norm.Normalize()
+			radius = math.Max(radius, math.Sqrt(float64(
+				v.Position.X*v.Position.X+v.Position.Y*v.Position.Y+v.Position.Z*v.Position.Z))*float64(c.scale))
+
+			vk := vertexKey{bone, pos, weights}
+			vi, ok := vertexIndex[vk]
+			if !ok {
+				vi = len(m.Vertices)
+				vertexIndex[vk] = vi
+				m.Vertices = append(m.Vertices, pos)
+				m.VerticesInfo = append(m.VerticesInfo, byte(bone))
+				if c.hasWeights {
+					m.VerticesWeights = append(m.VerticesWeights, weights)
+				}
+			}
+
+			nk := normalKey{bone, norm}
+			ni, ok := mb.normIndex[nk]
+			if !ok {
+				ni = len(mb.normals)
+				mb.normIndex[nk] = ni
+				mb.normals = append(mb.normals, norm)
+				mb.normInfo = append(mb.normInfo, byte(bone))
+				if c.hasWeights {
+					mb.normBlend = append(mb.normBlend, weights)
+				}
+			}
+
+			st[i] = studio.StudioTriangle{
+				VertexIndex: uint16(vi),
+				NormalIndex: uint16(ni),
+				S:           int16(math.Round(float64(v.U) * float64(tex.Width))),
+				T:           int16(math.Round((1.0 - float64(v.V)) * float64(tex.Height))),
+			}
+		}
+		mb.tris = append(mb.tris, st)
+	}
+
+	// normals are stored grouped by mesh
+	for _, mb := range meshes {
+		base := len(m.Normals)
+		for i := range mb.tris {
+			for j := range mb.tris[i] {
+				mb.tris[i][j].NormalIndex += uint16(base)
+			}
+		}
+		m.Normals = append(m.Normals, mb.normals...)
+		m.NormalsInfo = append(m.NormalsInfo, mb.normInfo...)
+		if c.hasWeights {
+			m.NormalsWeights = append(m.NormalsWeights, mb.normBlend...)
+		}
+
+		mb.mesh.NormalsNum = uint32(len(mb.normals))
+		mb.mesh.Triangles = stripTriangles(mb.tris)
+		mb.mesh.TrianglesNum = uint32(len(mb.tris))
+		m.Meshes = append(m.Meshes, mb.mesh)
+	}
+
+	if len(m.Vertices) > math.MaxUint16 || len(m.Normals) > math.MaxUint16 {
+		return nil, errors.New(fmt.Sprintf("%s has too many vertices", ref.FileName))
+	}
+
+	m.VertsNum = uint32(len(m.Vertices))
+	m.NormalsNum = uint32(len(m.Normals))
+	m.MeshesNum = uint32(len(m.Meshes))
+	m.BoundingRadius = float32(radius)
+
+	fmt.Fprintf(c.log, "Reference: %s (%d vertices, %d meshes)\n", name, m.VertsNum, m.MeshesNum)
+	return m, nil
+}
+
+// texture returns the index of a texture, loading it on first use.
+func (c *compiler) texture(name string) (int, error) {
+	if i, ok := c.textures[name]; ok {
+		return i, nil
+	}
+
+	path := filepath.Join(c.texPath, cleanQCPath(name))
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	img, err := bmp.Decode(file)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("%s: %s", path, err))
+	}
+	paletted, ok := img.(*image.Paletted)
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("%s is not an 8-bit indexed bitmap", path))
+	}
+	if len(name) > 63 {
+		return 0, errors.New(fmt.Sprintf("texture name %q is too long", name))
+	}
+
+	bounds := paletted.Bounds()
+	tex := new(studio.Texture)
+	tex.Name.FromString(name)
+	tex.Width, tex.Height = uint32(bounds.Dx()), uint32(bounds.Dy())
+	tex.Indices = make([]byte, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := paletted.PixOffset(bounds.Min.X, y)
+		tex.Indices = append(tex.Indices, paletted.Pix[row:row+bounds.Dx()]...)
+	}
+	for i, col := range paletted.Palette {
+		if i == 256 {
+			break
+		}
+		r, g, b, _ := col.RGBA()
+		tex.Pallets[i*3], tex.Pallets[i*3+1], tex.Pallets[i*3+2] = byte(r>>8), byte(g>>8), byte(b>>8)
+	}
+
+	c.textures[name] = len(c.mdl.Textures)
+	c.mdl.Textures = append(c.mdl.Textures, tex)
+	return c.textures[name], nil
+}
+
+func (c *compiler) buildSkins() error {
+	skinRefsNum := len(c.mdl.Textures)
+	var family = make([]uint16, skinRefsNum)
+	for i := range family {
+		family[i] = uint16(i)
+	}
+	skins := [][]uint16{family}
+
+	for _, tg := range c.qc.TextureGroups {
+		if len(tg.Families) == 0 {
+			continue
+		}
+
+		var slots = make([]int, len(tg.Families[0]))
+		for i, name := range tg.Families[0] {
+			slot, ok := c.textures[name]
+			if !ok || slot >= skinRefsNum {
+				return &qc.Error{File: c.qc.FileName, Pos: tg.Pos,
+					Msg: fmt.Sprintf("texture %q of the first skin family is not used by any mesh", name)}
+			}
+			slots[i] = slot
+		}
+
+		for i, names := range tg.Families {
+			if len(names) != len(slots) {
+				return &qc.Error{File: c.qc.FileName, Pos: tg.Pos,
+					Msg: fmt.Sprintf("skin family %d has %d textures, expected %d", i+1, len(names), len(slots))}
+			}
+			if i == len(skins) {
+				skins = append(skins, append([]uint16(nil), family...))
+			}
+			for j, name := range names {
+				tex, err := c.texture(name)
+				if err != nil {
+					return err
+				}
+				skins[i][slots[j]] = uint16(tex)
+			}
+		}
+	}
+	c.mdl.Skins = &skins
+
+	for _, rm := range c.qc.TexRenderModes {
+		i, ok := c.textures[rm.Texture]
+		if !ok {
+			c.warnf("%s: $texrendermode for unused texture %q", c.qc.FileName, rm.Texture)
+			continue
+		}
+		tex := c.mdl.Textures[i]
+		switch rm.Mode {
+		case "flatshade":
+			tex.Flags |= studio.StudioNfFlatshade
+		case "chrome":
+			tex.Flags |= studio.StudioNfChrome
+		case "fullbright":
+			tex.Flags |= studio.StudioNfFullbright
+		case "nomips":
+			tex.Flags |= studio.StudioNfNomips
+		case "alpha", "nosmooth":
+			tex.Flags |= studio.StudioNfNosmooth
+		case "additive":
+			tex.Flags |= studio.StudioNfAdditive
+		case "masked":
+			tex.Flags |= studio.StudioNfMasked
+		case "masked_solid":
+			tex.Flags |= studio.StudioNfMasked | studio.StudioNfSolid
+		case "twoside":
+			tex.Flags |= studio.StudioNfTwoside
+		}
+	}
+	return nil
+}
+
+// loadAnimation reads the frames of an animation SMD mapped onto the bone table.
+func (c *compiler) loadAnimation(path string, pos qc.Pos) ([][][6]float64, error) {
+	ref, err := smd.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(ref.Frames) == 0 {
+		return nil, errors.New(fmt.Sprintf("%s has no frames", path))
+	}
+
+	var boneMap = make([]int, len(ref.Nodes))
+	for i, node := range ref.Nodes {
+		bone, ok := c.boneIndex[node.Name]
+		if !ok {
+			c.warnf("%s: bone %q is not in the reference skeleton", path, node.Name)
+			bone = -1
+		}
+		boneMap[i] = bone
+	}
+
+	minTime, maxTime := ref.Frames[0].Time, ref.Frames[0].Time
+	for _, f := range ref.Frames {
+		if f.Time < minTime {
+			minTime = f.Time
+		}
+		if f.Time > maxTime {
+			maxTime = f.Time
+		}
+	}
+	if span := maxTime - minTime; span < 0 || span >= maxFrames {
+		return nil, &qc.Error{File: c.qc.FileName, Pos: pos, Msg: fmt.Sprintf(
+			"%s spans frames %d to %d, more than %d frames", path, minTime, maxTime, maxFrames)}
+	}
+
+	var (
+		bonesNum = len(c.mdl.Bones)
+		frames   = make([][][6]float64, maxTime-minTime+1)
+		isSet    = make([][]bool, len(frames))
+	)
+	for i := range frames {
+		frames[i] = make([][6]float64, bonesNum)
+		isSet[i] = make([]bool, bonesNum)
+	}
+
+	for _, f := range ref.Frames {
+		t := f.Time - minTime
+		for _, pose := range f.Bones {
+			bone := boneMap[pose.Bone]
+			if bone < 0 {
+				continue
+			}
+			frames[t][bone] = [6]float64{
+				float64(pose.Position.X * c.scale),
+				float64(pose.Position.Y * c.scale),
+				float64(pose.Position.Z * c.scale),
+				float64(pose.Rotation.X), float64(pose.Rotation.Y), float64(pose.Rotation.Z)}
+			isSet[t][bone] = true
+		}
+	}
+
+	for t := range frames {
+		for i, bone := range c.mdl.Bones {
+			if !isSet[t][i] {
+				if t == 0 {
+					for k := 0; k < 6; k++ {
+						frames[t][i][k] = float64(bone.Value[k])
+					}
+				} else {
+					frames[t][i] = frames[t-1][i]
+				}
+				continue
+			}
+			if bone.Parent == -1 {
+				sz, cz := math.Sincos(defaultZRotation)
+				x, y := frames[t][i][0], frames[t][i][1]
+				frames[t][i][0] = cz*x - sz*y
+				frames[t][i][1] = sz*x + cz*y
+				frames[t][i][5] += defaultZRotation
+			}
+			for k := 3; k < 6; k++ {
+				studio.ClipRotations(&frames[t][i][k])
+			}
+		}
+	}
+
+	return frames, nil
+}
+
+// extractMotion moves the linear movement of the root bones into the sequence.
+func extractMotion(seq *studio.Sequence, blends [][][][6]float64, bones []*studio.StudioBone) {
+	framesNum := len(blends[0])
+	if framesNum < 2 {
+		return
+	}
+
+	var motion [3]float64
+	first, last := blends[0][0][0], blends[0][framesNum-1][0]
+	if seq.MotionType&studio.StudioMotionLX != 0 {
+		motion[0] = last[0] - first[0]
+	}
+	if seq.MotionType&studio.StudioMotionLY != 0 {
+		motion[1] = last[1] - first[1]
+	}
+	if seq.MotionType&studio.StudioMotionLZ != 0 {
+		motion[2] = last[2] - first[2]
+	}
+	seq.LinerMovement = studio.Vector3_32{X: float32(motion[0]), Y: float32(motion[1]), Z: float32(motion[2])}
+
+	for _, frames := range blends {
+		for f := range frames {
+			progress := float64(f) / float64(framesNum-1)
+			for i, bone := range bones {
+				if bone.Parent != -1 {
+					continue
+				}
+				for k := 0; k < 3; k++ {
+					frames[f][i][k] -= motion[k] * progress
+				}
+				// unused motion stays at the starting value
+				for k, flag := range [6]uint32{studio.StudioMotionX, studio.StudioMotionY, studio.StudioMotionZ,
+					studio.StudioMotionXR, studio.StudioMotionYR, studio.StudioMotionZR} {
+					if seq.MotionType&flag != 0 {
+						frames[f][i][k] = frames[0][i][k]
+					}
+				}
+			}
+		}
+	}
+}
+
+// buildSequenceGroups lays out the default group and the groups of the
+// script, stored in files named after the model like studiomdl does.
+func (c *compiler) buildSequenceGroups() error {
+	sg := new(studio.StudioSeqGroup)
+	sg.Label.FromString("default")
+	c.mdl.SeqGroups = []*studio.StudioSeqGroup{sg}
+
+	for _, qg := range c.qc.SequenceGroups {
+		if len(qg.Label) > 31 {
+			return &qc.Error{File: c.qc.FileName, Pos: qg.Pos, Msg: fmt.Sprintf("sequence group label %q is too long", qg.Label)}
+		}
+		name := strings.TrimSuffix(c.qc.ModelName, ".mdl") + fmt.Sprintf("%02d.mdl", len(c.mdl.SeqGroups))
+		if len(name) > 63 {
+			return &qc.Error{File: c.qc.FileName, Pos: qg.Pos, Msg: fmt.Sprintf("sequence group file name %q is too long", name)}
+		}
+		sg := new(studio.StudioSeqGroup)
+		sg.Label.FromString(qg.Label)
+		sg.Name.FromString(name)
+		c.mdl.SeqGroups = append(c.mdl.SeqGroups, sg)
+	}
+	return nil
+}
+
+func (c *compiler) buildSequences() error {
+	if c.qc.SequenceGroupSize > 0 {
+		c.warnf("$sequencegroupsize is not supported, use $sequencegroup to split animations")
+	}
+	if err := c.buildSequenceGroups(); err != nil {
+		return err
+	}
+
+	for _, qs := range c.qc.Sequences {
+		if len(qs.Name) > 31 {
+			return &qc.Error{File: c.qc.FileName, Pos: qs.Pos, Msg: fmt.Sprintf("sequence name %q is too long", qs.Name)}
+		}
+
+		seq := new(studio.Sequence)
+		seq.Label.FromString(qs.Name)
+		seq.FPS = qs.FPS
+		if qs.Loop {
+			seq.Flags = studio.StudioLooping
+		}
+		seq.Activity = uint32(qs.Activity)
+		seq.ActWight = int32(qs.ActWeight)
+		seq.MotionType = qs.MotionType
+		seq.EntryNode, seq.ExitNode, seq.NodeFlags = qs.EntryNode, qs.ExitNode, qs.NodeFlags
+		seq.SeqGroup = uint32(qs.Group)
+		seq.BlendsNum = uint32(len(qs.Files))
+		for i, b := range qs.Blends {
+			if i == 2 {
+				break
+			}
+			seq.BlendTypes[i], seq.BlendStart[i], seq.BlendEnd[i] = b.Type, b.Start, b.End
+		}
+
+		var blends = make([][][][6]float64, len(qs.Files))
+		for i, file := range qs.Files {
+			frames, err := c.loadAnimation(c.smdPath(file), qs.Pos)
+			if err != nil {
+				return err
+			}
+			if i > 0 && len(frames) != len(blends[0]) {
+				return &qc.Error{File: c.qc.FileName, Pos: qs.Pos, Msg: fmt.Sprintf(
+					"sequence %q blends have different number of frames", qs.Name)}
+			}
+			blends[i] = frames
+		}
+		seq.FramesNum = uint32(len(blends[0]))
+		extractMotion(seq, blends, c.mdl.Bones)
+
+		for _, qe := range qs.Events {
+			if qe.Frame < 0 || qe.Frame >= int(seq.FramesNum) {
+				c.warnf("%s:%d:%d: event frame %d is out of range",
+					c.qc.FileName, qe.Pos.Line, qe.Pos.Column, qe.Frame)
+			}
+			if len(qe.Options) > 63 {
+				return &qc.Error{File: c.qc.FileName, Pos: qe.Pos, Msg: "event options are too long"}
+			}
+			ev := &studio.StudioEvent{Frame: uint32(qe.Frame), Event: qe.Event}
+			ev.Options.FromString(qe.Options)
+			seq.Events = append(seq.Events, ev)
+		}
+		seq.EventsNum = uint32(len(seq.Events))
+
+		for _, qp := range qs.Pivots {
+			for len(seq.Pivots) <= qp.Index {
+				seq.Pivots = append(seq.Pivots, new(studio.StudioPivot))
+			}
+			seq.Pivots[qp.Index].Start, seq.Pivots[qp.Index].End = int32(qp.Start), int32(qp.End)
+		}
+		seq.PivotsNum = uint32(len(seq.Pivots))
+
+		c.frames = append(c.frames, blends)
+		c.mdl.Sequences = append(c.mdl.Sequences, seq)
+	}
+
+	c.mdl.Transitions = studio.BuildTransitions(c.mdl.Sequences)
+
+	c.calcBoneScales()
+	for i, seq := range c.mdl.Sequences {
+		c.compressAnimations(seq, c.frames[i])
+		seq.BBMin, seq.BBMax = c.sequenceBBox(seq)
+		fmt.Fprintf(c.log, "Sequence: %s (%d frames)\n", seq.Label, seq.FramesNum)
+	}
+	return nil
+}
+
+func animDelta(motion *[6]float64, bone *studio.StudioBone, k int) float64 {
+	v := motion[k] - float64(bone.Value[k])
+	if k > 2 {
+		studio.ClipRotations(&v)
+	}
+	return v
+}
+
+// calcBoneScales picks per bone scales fitting every animated value into int16.
+func (c *compiler) calcBoneScales() {
+	for i, bone := range c.mdl.Bones {
+		for k := 0; k < 6; k++ {
+			minV, maxV := -128.0, 128.0
+			if k > 2 {
+				minV, maxV = -math.Pi/8.0, math.Pi/8.0
+			}
+
+			for _, blends := range c.frames {
+				for _, frames := range blends {
+					for f := range frames {
+						v := animDelta(&frames[f][i], bone, k)
+						minV, maxV = math.Min(minV, v), math.Max(maxV, v)
+					}
+				}
+			}
+
+			if -minV > maxV {
+				bone.Scale[k] = float32(minV / -32768.0)
+			} else {
+				bone.Scale[k] = float32(maxV / 32767.0)
+			}
+		}
+	}
+}
+
+// compressAnimValues packs the values of one bone axis into runs the same
+// way studiomdl does: changing values are stored, repeated ones are counted.
+func compressAnimValues(values []int16) []*studio.AnimValue {
+	var (
+		runs []*studio.AnimValue
+		run  *studio.AnimValue
+		zero = true
+	)
+
+	for i, v := range values {
+		if v != 0 {
+			zero = false
+		}
+		switch {
+		case run != nil && run.Total < 255 && v == values[i-1]:
+			run.Total++
+		case run != nil && run.Total < 255 && run.Total == run.Valid:
+			run.Valid++
+			run.Total++
+			run.Values = append(run.Values, v)
+		default:
+			run = &studio.AnimValue{Valid: 1, Total: 1, Values: []int16{v}}
+			runs = append(runs, run)
+		}
+	}
+
+	if zero {
+		return nil
+	}
+	return runs
+}
+
+func (c *compiler) compressAnimations(seq *studio.Sequence, blends [][][][6]float64) {
+	var values = make([]int16, seq.FramesNum)
+
+	for _, frames := range blends {
+		for i, bone := range c.mdl.Bones {
+			anim := new(studio.Anim)
+			for k := 0; k < 6; k++ {
+				for f := range frames {
+					v := math.Round(animDelta(&frames[f][i], bone, k) / float64(bone.Scale[k]))
+					values[f] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, v)))
+				}
+				anim.AnimValues[k] = compressAnimValues(values)
+			}
+			seq.Anims = append(seq.Anims, anim)
+		}
+	}
+}
+
+// sequenceBBox bounds the reference meshes over every frame of the sequence.
+func (c *compiler) sequenceBBox(seq *studio.Sequence) (studio.Vector3_32, studio.Vector3_32) {
+	var (
+		bonesNum   = len(c.mdl.Bones)
+		transforms = make([]*studio.Matrix3x4, bonesNum)
+		skin       = make([]*studio.Matrix3x4, bonesNum)
+		bbMin      = studio.Vector3_32{X: math.MaxFloat32, Y: math.MaxFloat32, Z: math.MaxFloat32}
+		bbMax      = studio.Vector3_32{X: -math.MaxFloat32, Y: -math.MaxFloat32, Z: -math.MaxFloat32}
+		hasVerts   bool
+	)
+
+	for blend := 0; blend < int(seq.BlendsNum); blend++ {
+		for frame := 0; frame < int(seq.FramesNum); frame++ {
+			for i, bone := range c.mdl.Bones {
+				motion := studio.CalcBonePosition(seq.Anims[blend*bonesNum+i], bone, frame)
+				quat := studio.AngleQuaternion(&studio.Vector3_32{X: float32(motion[3]), Y: float32(motion[4]), Z: float32(motion[5])})
+				transforms[i] = studio.Matrix3x4FromOriginQuat(quat,
+					&studio.Vector3_32{X: float32(motion[0]), Y: float32(motion[1]), Z: float32(motion[2])})
+				if bone.Parent > -1 {
+					transforms[i] = studio.Matrix3x4ConcatTransforms(transforms[bone.Parent], transforms[i])
+				}
+				skin[i] = studio.Matrix3x4ConcatTransforms(transforms[i], c.poseToBone[i])
+			}
+
+			for _, bp := range c.mdl.BodyParts {
+				for _, m := range bp.Models {
+					for vi := range m.Vertices {
+						var pos *studio.Vector3_32
+						if c.hasWeights {
+							pos = studio.Matrix3x4VectorTransform(studio.SkinMatrix(skin, &m.VerticesWeights[vi]), &m.Vertices[vi])
+						} else {
+							pos = studio.Matrix3x4VectorTransform(transforms[m.VerticesInfo[vi]], &m.Vertices[vi])
+						}
+						bbMin = studio.Vector3_32{X: float32(math.Min(float64(bbMin.X), float64(pos.X))),
+							Y: float32(math.Min(float64(bbMin.Y), float64(pos.Y))),
+							Z: float32(math.Min(float64(bbMin.Z), float64(pos.Z)))}
+						bbMax = studio.Vector3_32{X: float32(math.Max(float64(bbMax.X), float64(pos.X))),
+							Y: float32(math.Max(float64(bbMax.Y), float64(pos.Y))),
+							Z: float32(math.Max(float64(bbMax.Z), float64(pos.Z)))}
+						hasVerts = true
+					}
+				}
+			}
+		}
+	}
+
+	if !hasVerts {
+		return studio.Vector3_32{}, studio.Vector3_32{}
+	}
+	return bbMin, bbMax
+}
+
+func (c *compiler) buildControllers() error {
+	for i, qcc := range c.qc.Controllers {
+		bone, err := c.lookupBone(qcc.Bone, qcc.Pos)
+		if err != nil {
+			return err
+		}
+
+		axis := -1
+		for k, flag := range [6]uint32{studio.StudioMotionX, studio.StudioMotionY, studio.StudioMotionZ,
+			studio.StudioMotionXR, studio.StudioMotionYR, studio.StudioMotionZR} {
+			if qcc.Type == flag {
+				axis = k
+			}
+		}
+		if axis < 0 {
+			return &qc.Error{File: c.qc.FileName, Pos: qcc.Pos, Msg: "controller type must be one of X, Y, Z, XR, YR, ZR"}
+		}
+
+		bc := &studio.StudioBoneController{
+			Bone:  int32(bone),
+			Type:  qcc.Type,
+			Start: qcc.Start,
+			End:   qcc.End,
+			Index: uint32(qcc.Index),
+		}
+		if axis > 2 && (int(qcc.Start)+360)%360 == (int(qcc.End)+360)%360 {
+			bc.Type |= studio.StudioMotionRLoop
+		}
+		if qcc.End != qcc.Start {
+			rest := math.Round(float64(-qcc.Start) / float64(qcc.End-qcc.Start) * 255.0)
+			bc.Rest = uint32(math.Max(0, math.Min(255, rest)))
+		}
+
+		c.mdl.Bones[bone].BoneControllers[axis] = uint32(i)
+		c.mdl.BoneControllers = append(c.mdl.BoneControllers, bc)
+	}
+	return nil
+}
+
+// checkPivots makes sure the pivots are declared on known bones, which the
+// model does not store. The pivots of the sequences keep zero origins.
+func (c *compiler) checkPivots() error {
+	for _, qp := range c.qc.Pivots {
+		if _, err := c.lookupBone(qp.Bone, qp.Pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) buildAttachments() error {
+	for _, qa := range c.qc.Attachments {
+		bone, err := c.lookupBone(qa.Bone, qa.Pos)
+		if err != nil {
+			return err
+		}
+		a := &studio.StudioAttachment{Bone: uint32(bone)}
+		a.Origins = studio.Vector3_32{X: qa.Origin.X * c.scale, Y: qa.Origin.Y * c.scale, Z: qa.Origin.Z * c.scale}
+		c.mdl.Attachments = append(c.mdl.Attachments, a)
+	}
+	return nil
+}
+
+// buildHitBoxes uses the boxes of the script or, like studiomdl, fits one
+// box around the vertices of every bone. Boxes not larger than a unit on
+// every axis are left out, as studiomdl does.
+func (c *compiler) buildHitBoxes() error {
+	if len(c.qc.HitBoxes) > 0 {
+		hitBoxes, err := c.hitBoxes(c.qc.HitBoxes)
+		c.mdl.HitBoxes = hitBoxes
+		return err
+	}
+
+	var boxes = make([]*studio.StudioHitBox, len(c.mdl.Bones))
+	for _, bp := range c.mdl.BodyParts {
+		for _, m := range bp.Models {
+			for vi := range m.Vertices {
+				bone := int(m.VerticesInfo[vi])
+				pos := &m.Vertices[vi]
+				if c.hasWeights {
+					pos = studio.Matrix3x4VectorTransform(c.poseToBone[bone], pos)
+				}
+
+				hb := boxes[bone]
+				if hb == nil {
+					hb = &studio.StudioHitBox{Bone: uint32(bone), BBMin: *pos, BBMax: *pos}
+					boxes[bone] = hb
+				}
+				hb.BBMin = studio.Vector3_32{X: float32(math.Min(float64(hb.BBMin.X), float64(pos.X))),
+					Y: float32(math.Min(float64(hb.BBMin.Y), float64(pos.Y))),
+					Z: float32(math.Min(float64(hb.BBMin.Z), float64(pos.Z)))}
+				hb.BBMax = studio.Vector3_32{X: float32(math.Max(float64(hb.BBMax.X), float64(pos.X))),
+					Y: float32(math.Max(float64(hb.BBMax.Y), float64(pos.Y))),
+					Z: float32(math.Max(float64(hb.BBMax.Z), float64(pos.Z)))}
+			}
+		}
+	}
+	for _, hb := range boxes {
+		if hb != nil && hb.BBMax.X-hb.BBMin.X > 1 && hb.BBMax.Y-hb.BBMin.Y > 1 && hb.BBMax.Z-hb.BBMin.Z > 1 {
+			c.mdl.HitBoxes = append(c.mdl.HitBoxes, hb)
+		}
+	}
+	return nil
+}
+
+func (c *compiler) hitBoxes(qhs []*qc.HitBox) ([]*studio.StudioHitBox, error) {
+	var hitBoxes = make([]*studio.StudioHitBox, 0, len(qhs))
+	for _, qh := range qhs {
+		bone, err := c.lookupBone(qh.Bone, qh.Pos)
+		if err != nil {
+			return nil, err
+		}
+		hitBoxes = append(hitBoxes, &studio.StudioHitBox{
+			Bone:  uint32(bone),
+			Group: uint32(qh.Group),
+			BBMin: qh.BBMin,
+			BBMax: qh.BBMax,
+		})
+	}
+	return hitBoxes, nil
+}
+
+// buildHeader2 fills the Xash3D extension: pose parameters, key values and
+// hit box sets, the first of which repeats the hit boxes of the main header.
+func (c *compiler) buildHeader2() error {
+	for _, qp := range c.qc.PoseParameters {
+		if len(qp.Name) > 31 {
+			return &qc.Error{File: c.qc.FileName, Pos: qp.Pos, Msg: fmt.Sprintf("pose parameter name %q is too long", qp.Name)}
+		}
+		pp := &studio.StudioPoseParam{Start: qp.Start, End: qp.End, Loop: qp.Loop}
+		pp.Name.FromString(qp.Name)
+		c.mdl.PoseParams = append(c.mdl.PoseParams, pp)
+	}
+
+	c.mdl.KeyValues = c.qc.KeyValues
+
+	if len(c.qc.HitBoxSets) == 0 {
+		return nil
+	}
+	set := &studio.HitBoxSet{HitBoxes: c.mdl.HitBoxes}
+	set.Name.FromString("default")
+	c.mdl.HitBoxSets = append(c.mdl.HitBoxSets, set)
+	for _, qs := range c.qc.HitBoxSets {
+		if len(qs.Name) > 31 {
+			return &qc.Error{File: c.qc.FileName, Pos: qs.Pos, Msg: fmt.Sprintf("hitbox set name %q is too long", qs.Name)}
+		}
+		hitBoxes, err := c.hitBoxes(qs.HitBoxes)
+		if err != nil {
+			return err
+		}
+		set := &studio.HitBoxSet{HitBoxes: hitBoxes}
+		set.Name.FromString(qs.Name)
+		c.mdl.HitBoxSets = append(c.mdl.HitBoxSets, set)
+	}
+	return nil
+}
+
+func (c *compiler) buildHeader() {
+	hdr := c.mdl.Header
+	hdr.Ident = studio.MdlIdent
+	hdr.Version = studio.StudioVersion
+	hdr.EyePosition = c.qc.EyePosition
+	hdr.Min, hdr.Max = c.qc.BBox[0], c.qc.BBox[1]
+	hdr.BBMin, hdr.BBMax = c.qc.CBox[0], c.qc.CBox[1]
+
+	hdr.Flags = c.qc.Flags &^ (studio.StudioHasBoneInfo | studio.StudioHasBoneWeights)
+	if c.hasWeights {
+		hdr.Flags |= studio.StudioHasBoneInfo | studio.StudioHasBoneWeights
+		for i, m := range c.poseToBone {
+			bi := new(studio.StudioBoneInfo)
+			for j := 0; j < 3; j++ {
+				bi.PoseToBone[j] = studio.Vector4_32{X: float32(m[j].X), Y: float32(m[j].Y), Z: float32(m[j].Z), W: float32(m[j].W)}
+			}
+			bone := c.mdl.Bones[i]
+			quat := studio.AngleQuaternion(&studio.Vector3_32{X: bone.Value[3], Y: bone.Value[4], Z: bone.Value[5]})
+			bi.Quat = studio.Vector4_32{X: float32(quat.X), Y: float32(quat.Y), Z: float32(quat.Z), W: float32(quat.W)}
+			bi.QAlignment = studio.Vector4_32{X: 0, Y: 0, Z: 0, W: 1}
+			c.mdl.BonesInfo = append(c.mdl.BonesInfo, bi)
+		}
+	}
+
+	hdr.BonesNum = uint32(len(c.mdl.Bones))
+	hdr.BoneControllersNum = uint32(len(c.mdl.BoneControllers))
+	hdr.HitBoxesNum = uint32(len(c.mdl.HitBoxes))
+	hdr.SequencesNum = uint32(len(c.mdl.Sequences))
+	hdr.SequenceGroupsNum = uint32(len(c.mdl.SeqGroups))
+	hdr.TransitionsNum = uint32(len(c.mdl.Transitions))
+	hdr.TexturesNum = uint32(len(c.mdl.Textures))
+	hdr.SkinFamiliesNum = uint32(len(*c.mdl.Skins))
+	hdr.SkinRefsNum = uint32(len((*c.mdl.Skins)[0]))
+	hdr.BodyPartsNum = uint32(len(c.mdl.BodyParts))
+	hdr.AttachmentsNum = uint32(len(c.mdl.Attachments))
+}
+
+// CompileFile compiles the QC script at qcPath and saves the model to outPath,
+// by default to the $modelname file next to the script. It returns the
+// warnings of Compile.
+func CompileFile(qcPath, outPath string, log io.Writer) ([]string, error) {
+	mdl, warnings, err := Compile(qcPath, log)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(outPath) == 0 {
+		modelName := filepath.Base(cleanQCPath(mdl.Header.Name.String()))
+		if modelName == "." {
+			modelName = strings.TrimSuffix(filepath.Base(qcPath), filepath.Ext(qcPath)) + ".mdl"
+		}
+		outPath = filepath.Join(filepath.Dir(qcPath), modelName)
+	}
+
+	if err = studio.Save(outPath, mdl); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(log, "Model: %s\n", outPath)
+	return warnings, nil
+}
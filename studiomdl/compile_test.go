@@ -0,0 +1,290 @@
+package studiomdl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Psycrow101/mdldec-golang/qc"
+	"github.com/Psycrow101/mdldec-golang/smd"
+	"github.com/Psycrow101/mdldec-golang/studio"
+	"github.com/Psycrow101/mdldec-golang/texture"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "studiomdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// decompileTo writes the QC, SMDs and textures of a model into dir and
+// returns the path of the QC.
+func decompileTo(t *testing.T, mdl *studio.Mdl, dir string) string {
+	qcPath := filepath.Join(dir, "test.qc")
+	if err := qc.SaveLog(qcPath, mdl, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := smd.SaveReferencesN(dir, mdl, 1, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	animsPath := filepath.Join(dir, "anims")
+	texturesPath := filepath.Join(dir, "textures")
+	for _, path := range []string{animsPath, texturesPath} {
+		if err := os.Mkdir(path, 0744); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := smd.SaveSequencesN(animsPath, mdl, 1, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := texture.Save(texturesPath, mdl); err != nil {
+		t.Fatal(err)
+	}
+	return qcPath
+}
+
+// encodeLoad encodes a compiled model and decodes it back.
+func encodeLoad(t *testing.T, mdl *studio.Mdl) *studio.Mdl {
+	data, groups, err := mdl.EncodeFiles("test.mdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files = make(map[string][]byte)
+	for i := 1; i < len(groups); i++ {
+		files[fmt.Sprintf("test%02d.mdl", i)] = groups[i]
+	}
+	loaded, err := studio.LoadFrom(bytes.NewReader(data), "test.mdl", studio.BytesResolver(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-3
+}
+
+func nearVector(a, b studio.Vector3_32) bool {
+	return near(a.X, b.X) && near(a.Y, b.Y) && near(a.Z, b.Z)
+}
+
+// TestCompileDecompiled decompiles the fixtures, compiles them back and
+// compares the decoded models with the originals.
+func TestCompileDecompiled(t *testing.T) {
+	for _, name := range []string{"box.mdl", "boxgroup.mdl"} {
+		t.Run(name, func(t *testing.T) {
+			want, err := studio.Load(filepath.Join("..", "testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+
+			log := new(bytes.Buffer)
+			compiled, warnings, err := Compile(decompileTo(t, want, dir), log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(warnings) > 0 {
+				t.Errorf("warnings %q", warnings)
+			}
+			if !strings.Contains(log.String(), "Sequence: idle (") {
+				t.Errorf("log %q does not list the sequences", log.String())
+			}
+			compareModels(t, encodeLoad(t, compiled), want)
+		})
+	}
+}
+
+func compareModels(t *testing.T, got, want *studio.Mdl) {
+	if len(got.Bones) != len(want.Bones) {
+		t.Fatalf("%d bones, want %d", len(got.Bones), len(want.Bones))
+	}
+	for i, b := range got.Bones {
+		w := want.Bones[i]
+		if b.Name != w.Name || b.Parent != w.Parent || b.BoneControllers != w.BoneControllers {
+			t.Errorf("bone %d: %s parent %d controllers %v, want %s parent %d controllers %v",
+				i, b.Name, b.Parent, b.BoneControllers, w.Name, w.Parent, w.BoneControllers)
+		}
+		for k := range b.Value {
+			if !near(b.Value[k], w.Value[k]) {
+				t.Errorf("bone %s: value %v, want %v", b.Name, b.Value, w.Value)
+				break
+			}
+		}
+	}
+
+	if len(got.Sequences) != len(want.Sequences) {
+		t.Fatalf("%d sequences, want %d", len(got.Sequences), len(want.Sequences))
+	}
+	for i, s := range got.Sequences {
+		w := want.Sequences[i]
+		if s.Label != w.Label || s.FPS != w.FPS || s.Flags != w.Flags || s.Activity != w.Activity ||
+			s.FramesNum != w.FramesNum || s.MotionType != w.MotionType || s.SeqGroup != w.SeqGroup {
+			t.Errorf("sequence %d: %+v, want %+v", i, s.StudioSequence, w.StudioSequence)
+		}
+		if !nearVector(s.LinerMovement, w.LinerMovement) {
+			t.Errorf("sequence %s: linear movement %v, want %v", s.Label, s.LinerMovement, w.LinerMovement)
+		}
+		if len(s.Events) != len(w.Events) {
+			t.Errorf("sequence %s: %d events, want %d", s.Label, len(s.Events), len(w.Events))
+		} else {
+			for j, e := range s.Events {
+				if *e != *w.Events[j] {
+					t.Errorf("sequence %s: event %+v, want %+v", s.Label, *e, *w.Events[j])
+				}
+			}
+		}
+	}
+
+	if len(got.BodyParts) != len(want.BodyParts) {
+		t.Fatalf("%d body parts, want %d", len(got.BodyParts), len(want.BodyParts))
+	}
+	for i, bp := range got.BodyParts {
+		w := want.BodyParts[i]
+		if bp.Name != w.Name || len(bp.Models) != len(w.Models) {
+			t.Errorf("body part %d: %s with %d models, want %s with %d", i, bp.Name, len(bp.Models), w.Name, len(w.Models))
+			continue
+		}
+		for j, m := range bp.Models {
+			wm := w.Models[j]
+			if m.VertsNum != wm.VertsNum || m.NormalsNum != wm.NormalsNum || len(m.Meshes) != len(wm.Meshes) {
+				t.Errorf("model %s: %d vertices %d normals %d meshes, want %d %d %d", m.Name,
+					m.VertsNum, m.NormalsNum, len(m.Meshes), wm.VertsNum, wm.NormalsNum, len(wm.Meshes))
+				continue
+			}
+			for k, mesh := range m.Meshes {
+				if mesh.TrianglesNum != wm.Meshes[k].TrianglesNum || mesh.SkinRef != wm.Meshes[k].SkinRef {
+					t.Errorf("model %s: mesh %d %+v, want %+v", m.Name, k, mesh.StudioMesh, wm.Meshes[k].StudioMesh)
+				}
+			}
+		}
+	}
+
+	if len(got.HitBoxes) != len(want.HitBoxes) {
+		t.Fatalf("%d hitboxes, want %d", len(got.HitBoxes), len(want.HitBoxes))
+	}
+	for i, h := range got.HitBoxes {
+		w := want.HitBoxes[i]
+		if h.Bone != w.Bone || h.Group != w.Group || !nearVector(h.BBMin, w.BBMin) || !nearVector(h.BBMax, w.BBMax) {
+			t.Errorf("hitbox %d: %+v, want %+v", i, *h, *w)
+		}
+	}
+}
+
+// copySources copies the sources of the fixtures into a temporary directory,
+// with the commands appended to box.qc and the extra files written next to it.
+func copySources(t *testing.T, commands string, files map[string]string) string {
+	dir := tempDir(t)
+	src := filepath.Join("..", "testdata", "src")
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		data, err := ioutil.ReadFile(filepath.Join(src, info.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name() == "box.qc" {
+			data = append(data, commands...)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, info.Name()), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, text := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const otherParentSMD = `version 1
+nodes
+  0 "arm" -1
+end
+skeleton
+time 0
+  0 0 0 8 0 0 0
+end
+triangles
+end
+`
+
+const otherPoseSMD = `version 1
+nodes
+  0 "root" -1
+  1 "arm" 0
+end
+skeleton
+time 0
+  0 0 0 0 0 0 0
+  1 0 0 9 0 0 0
+end
+triangles
+end
+`
+
+const longSMD = `version 1
+nodes
+  0 "root" -1
+  1 "arm" 0
+end
+skeleton
+time 0
+  0 0 0 0 0 0 0
+  1 0 0 8 0 0 0
+time 100000000
+  0 0 0 0 0 0 0
+  1 0 0 8 0 0 0
+end
+`
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		commands string
+		files    map[string]string
+		err      string
+	}{
+		{"$controller 1 \"hand\" XR 0 90\n", nil,
+			`box.qc:23:1: unknown bone "hand"`},
+		{"$attachment 1 \"hand\" 0 0 0\n", nil,
+			`box.qc:23:1: unknown bone "hand"`},
+		{"\n$hbox 0 \"hand\" 0 0 0 1 1 1\n", nil,
+			`box.qc:24:1: unknown bone "hand"`},
+		{"$poseparameter \"" + strings.Repeat("p", 32) + "\" 0 1\n", nil,
+			`box.qc:23:1: pose parameter name "` + strings.Repeat("p", 32) + `" is too long`},
+		{"$body other \"other\"\n", map[string]string{"other.smd": otherParentSMD},
+			`box.qc:23:13: other.smd: bone "arm" has a different parent than in the previous references`},
+		{"$body other \"other\"\n", map[string]string{"other.smd": otherPoseSMD},
+			`box.qc:23:13: other.smd: bone "arm" has a different pose than in the previous references`},
+		{"$sequence long \"long\"\n", map[string]string{"long.smd": longSMD},
+			`box.qc:23:1: long.smd spans frames 0 to 100000000, more than 65536 frames`},
+	}
+
+	for _, test := range tests {
+		dir := copySources(t, test.commands, test.files)
+		_, _, err := Compile(filepath.Join(dir, "box.qc"), ioutil.Discard)
+		os.RemoveAll(dir)
+
+		if err == nil {
+			t.Errorf("%q: no error", test.commands)
+			continue
+		}
+		if _, ok := err.(*qc.Error); !ok {
+			t.Errorf("%q: error %T, want *qc.Error", test.commands, err)
+		}
+		if msg := strings.Replace(err.Error(), dir+string(filepath.Separator), "", -1); msg != test.err {
+			t.Errorf("%q: error %q, want %q", test.commands, msg, test.err)
+		}
+	}
+}
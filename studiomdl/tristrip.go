@@ -0,0 +1,110 @@
+package studiomdl
+
+import (
+	"math"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
+)
+
+type triEdge [2]studio.StudioTriangle
+
+// stripTriangles packs the triangles of a mesh into the command lists stored
+// in studio files. Triangles are given in studio winding order; every
+// command is the longest strip or fan found from the first unused triangle.
+// As in the reader, fans are the commands marked with IsStrip.
+func stripTriangles(tris [][3]studio.StudioTriangle) []*studio.Triangle {
+	var (
+		commands []*studio.Triangle
+		edges    = make(map[triEdge][]int)
+		used     = make([]bool, len(tris))
+	)
+
+	for i, tri := range tris {
+		if tri[0] == tri[1] || tri[1] == tri[2] || tri[2] == tri[0] {
+			used[i] = true // degenerate
+			continue
+		}
+		for j := 0; j < 3; j++ {
+			e := triEdge{tri[j], tri[(j+1)%3]}
+			edges[e] = append(edges[e], i)
+		}
+	}
+
+	for start := range tris {
+		if used[start] {
+			continue
+		}
+
+		var (
+			bestVerts   []studio.StudioTriangle
+			bestMembers []int
+			bestIsFan   bool
+		)
+		for _, isFan := range [2]bool{false, true} {
+			for rot := 0; rot < 3; rot++ {
+				verts, members := buildTriCommand(tris, edges, used, start, rot, isFan)
+				if len(members) > len(bestMembers) {
+					bestVerts, bestMembers, bestIsFan = verts, members, isFan
+				}
+			}
+		}
+
+		for _, i := range bestMembers {
+			used[i] = true
+		}
+
+		cmd := &studio.Triangle{IsStrip: bestIsFan, Vertices: make([]*studio.StudioTriangle, len(bestVerts))}
+		for i := range bestVerts {
+			v := bestVerts[i]
+			cmd.Vertices[i] = &v
+		}
+		commands = append(commands, cmd)
+	}
+
+	return commands
+}
+
+func buildTriCommand(tris [][3]studio.StudioTriangle, edges map[triEdge][]int, used []bool,
+	start, rot int, isFan bool) ([]studio.StudioTriangle, []int) {
+
+	tri := tris[start]
+	verts := []studio.StudioTriangle{tri[rot], tri[(rot+1)%3], tri[(rot+2)%3]}
+	members := []int{start}
+	inCommand := map[int]bool{start: true}
+
+	for len(verts) < math.MaxInt16 {
+		// the next triangle is made of the two previous vertices and a new one
+		k := len(verts) - 2
+		var e triEdge
+		switch {
+		case isFan:
+			e = triEdge{verts[0], verts[k+1]}
+		case k%2 == 0:
+			e = triEdge{verts[k], verts[k+1]}
+		default:
+			e = triEdge{verts[k+1], verts[k]}
+		}
+
+		next := -1
+		for _, i := range edges[e] {
+			if !used[i] && !inCommand[i] {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+
+		inCommand[next] = true
+		members = append(members, next)
+		for j, v := range tris[next] {
+			if v == e[0] && tris[next][(j+1)%3] == e[1] {
+				verts = append(verts, tris[next][(j+2)%3])
+				break
+			}
+		}
+	}
+
+	return verts, members
+}
@@ -1,4 +1,4 @@
-package main
+package texture
 
 import (
 	"bufio"
@@ -7,35 +7,36 @@ import (
 	"image/color"
 	"os"
 	"path/filepath"
+
+	"github.com/Psycrow101/mdldec-golang/studio"
 )
 
-func saveTextures(destPath string, mdl *Mdl) error {
+// Save writes every texture of the model as an 8-bit BMP into destPath.
+// Failing textures do not stop the others, the first error is returned.
+func Save(destPath string, mdl *studio.Mdl) error {
 	var (
-		err      error
-		filePath string
-		file     *os.File
-		writer   *bufio.Writer
+		err, firstErr error
+		filePath      string
+		file          *os.File
+		writer        *bufio.Writer
 	)
 	var palette = make([]color.Color, 256)
 
 	for _, tex := range mdl.Textures {
-		func() {
+		if err = func() error {
 			filePath = filepath.Join(destPath, tex.Name.String())
 
 			if err = os.RemoveAll(filePath); err != nil {
-				printError(err)
-				return
+				return err
 			}
 
 			file, err = os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, 0644)
 			if err != nil {
-				printError(err)
-				return
+				return err
 			}
 			defer file.Close()
 
 			writer = bufio.NewWriter(file)
-			defer writer.Flush()
 
 			texIndices, texPalette := &tex.Indices, &tex.Pallets
 			width, height := int(tex.Width), int(tex.Height)
@@ -55,12 +56,14 @@ func saveTextures(destPath string, mdl *Mdl) error {
 				}
 			}
 
-			err = bmp.Encode(writer, img)
-			if err != nil {
-				printError(err)
+			if err = bmp.Encode(writer, img); err != nil {
+				return err
 			}
-		}()
+			return writer.Flush()
+		}(); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
 
-	return nil
+	return firstErr
 }
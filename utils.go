@@ -2,13 +2,29 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"sync/atomic"
 )
 
+var errorsCount int32
+
+// printError reports an error on the standard error and makes the command
+// fail.
 func printError(err error) {
+	atomic.AddInt32(&errorsCount, 1)
 	os.Stderr.WriteString(fmt.Sprintf("[ERROR] %s.\n", err))
 }
 
+func errorsNum() int {
+	return int(atomic.LoadInt32(&errorsCount))
+}
+
+// resetErrors starts the error count of a new command.
+func resetErrors() {
+	atomic.StoreInt32(&errorsCount, 0)
+}
+
 func createDirectory(path string) error {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		if err := os.Mkdir(path, 0744); err != nil {
@@ -17,3 +33,23 @@ func createDirectory(path string) error {
 	}
 	return nil
 }
+
+// isEmptyDirectory reports whether path is missing or an empty directory.
+func isEmptyDirectory(path string) (bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	names, err := file.Readdirnames(1)
+	if len(names) > 0 {
+		return false, nil
+	}
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return true, nil
+}
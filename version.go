@@ -1,3 +0,0 @@
-package main
-
-const appVersion = "0.3"